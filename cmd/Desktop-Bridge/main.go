@@ -276,8 +276,9 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	pmapiClientFactory := pmapifactory.New(cfg, eventListener)
 
 	bridgeInstance := bridge.New(cfg, pref, panicHandler, eventListener, Version, pmapiClientFactory, credentialsStore)
+	defer bridgeInstance.Shutdown()
 	imapBackend := imap.NewIMAPBackend(panicHandler, eventListener, cfg, bridgeInstance)
-	smtpBackend := smtp.NewSMTPBackend(panicHandler, eventListener, pref, bridgeInstance)
+	smtpBackend := smtp.NewSMTPBackend(panicHandler, eventListener, pref, cfg, bridgeInstance)
 
 	go func() {
 		defer panicHandler.HandlePanic()
@@ -321,7 +322,7 @@ func run(context *cli.Context) (contextError error) { // nolint[funlen]
 	}
 
 	showWindowOnStart := !context.GlobalBool("no-window")
-	frontend := frontend.New(Version, buildVersion, frontendMode, showWindowOnStart, panicHandler, cfg, pref, eventListener, updates, bridgeInstance, smtpBackend)
+	frontend := frontend.New(Version, buildVersion, frontendMode, showWindowOnStart, panicHandler, cfg, pref, eventListener, updates, bridgeInstance, smtpBackend, imapBackend)
 
 	// Last part is to start everything.
 	log.Debug("Starting frontend...")
@@ -36,6 +36,14 @@ import (
 	logrus "github.com/sirupsen/logrus"
 )
 
+const (
+	// apiMetricsLogInterval is how often metrics of API requests are logged.
+	apiMetricsLogInterval = 10 * time.Minute
+
+	// apiMetricsLogEndpoints is the number of the slowest endpoints logged.
+	apiMetricsLogEndpoints = 10
+)
+
 var (
 	log                   = config.GetLogEntry("bridge") //nolint[gochecknoglobals]
 	isApplicationOutdated = false                        //nolint[gochecknoglobals]
@@ -63,6 +71,10 @@ type Bridge struct {
 	// The user stores should send idle updates on this channel.
 	idleUpdates chan interface{}
 
+	// stopBackground is closed on shutdown to stop background jobs.
+	stopBackground     chan struct{}
+	stopBackgroundOnce sync.Once
+
 	lock sync.RWMutex
 
 	userAgentClientName    string
@@ -91,14 +103,11 @@ func New(
 		credStorer:         credStorer,
 		storeCache:         store.NewCache(config.GetIMAPCachePath()),
 		idleUpdates:        make(chan interface{}),
+		stopBackground:     make(chan struct{}),
 		lock:               sync.RWMutex{},
 	}
 
-	// Allow DoH before starting bridge if the user has previously set this setting.
-	// This allows us to start even if protonmail is blocked.
-	if pref.GetBool(preferences.AllowProxyKey) {
-		AllowDoH()
-	}
+	setupRouting(config.GetAPIConfig().Routing, pref, credStorer)
 
 	go func() {
 		defer panicHandler.HandlePanic()
@@ -117,9 +126,23 @@ func New(
 
 	go b.heartbeat()
 
+	if metrics, ok := config.GetAPIConfig().Metrics.(*pmapi.APIMetrics); ok {
+		go func() {
+			defer panicHandler.HandlePanic()
+			logAPIMetrics(metrics, b.stopBackground)
+		}()
+	}
+
 	return b
 }
 
+// Shutdown stops background jobs of the bridge. It can be called many times.
+func (b *Bridge) Shutdown() {
+	b.stopBackgroundOnce.Do(func() {
+		close(b.stopBackground)
+	})
+}
+
 // heartbeat sends a heartbeat signal once a day.
 func (b *Bridge) heartbeat() {
 	for range time.NewTicker(1 * time.Hour).C {
@@ -136,6 +159,49 @@ func (b *Bridge) heartbeat() {
 	}
 }
 
+// logAPIMetrics periodically logs metrics of the endpoints with the longest
+// total latency to help find out which requests slow down the sync.
+// It returns when `stop` is closed.
+func logAPIMetrics(metrics *pmapi.APIMetrics, stop <-chan struct{}) {
+	ticker := time.NewTicker(apiMetricsLogInterval)
+	defer ticker.Stop()
+
+	lastRequests := 0
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		snapshot := metrics.Snapshot()
+
+		requests := 0
+		for _, em := range snapshot {
+			requests += em.Requests
+		}
+		if requests == lastRequests {
+			continue
+		}
+		lastRequests = requests
+
+		for idx, em := range snapshot {
+			if idx == apiMetricsLogEndpoints {
+				break
+			}
+			log.WithFields(logrus.Fields{
+				"endpoint":    em.Method + " " + em.Endpoint,
+				"requests":    em.Requests,
+				"meanLatency": em.MeanLatency(),
+				"maxLatency":  em.MaxLatency,
+				"retries":     em.Retries,
+				"errors":      em.Errors,
+				"apiErrors":   em.APIErrors,
+			}).Info("API metrics")
+		}
+	}
+}
+
 func (b *Bridge) loadUsersFromCredentialsStore() (err error) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -150,7 +216,7 @@ func (b *Bridge) loadUsersFromCredentialsStore() (err error) {
 
 		apiClient := b.pmapiClientFactory(userID)
 
-		user, newUserErr := newUser(b.panicHandler, userID, b.events, b.credStorer, apiClient, b.storeCache, b.config.GetDBDir())
+		user, newUserErr := newUser(b.panicHandler, userID, b.events, b.credStorer, apiClient, b.storeCache, b.config.GetDBDir(), b.config.GetSendRecorderConfig())
 		if newUserErr != nil {
 			l.WithField("user", userID).WithError(newUserErr).Warn("Could not load user, skipping")
 			continue
@@ -297,7 +363,7 @@ func (b *Bridge) FinishLogin(loginClient PMAPIProvider, auth *pmapi.Auth, mbPass
 
 	// If it's a new user, generate the user object.
 	if !hasUser {
-		user, err = newUser(b.panicHandler, apiUser.ID, b.events, b.credStorer, apiClient, b.storeCache, b.config.GetDBDir())
+		user, err = newUser(b.panicHandler, apiUser.ID, b.events, b.credStorer, apiClient, b.storeCache, b.config.GetDBDir(), b.config.GetSendRecorderConfig())
 		if err != nil {
 			log.WithField("user", apiUser.ID).WithError(err).Error("Could not create user")
 			return
@@ -474,16 +540,28 @@ func (b *Bridge) GetIMAPUpdatesChannel() chan interface{} {
 	return b.idleUpdates
 }
 
-// AllowDoH instructs bridge to use DoH to access an API proxy if necessary.
-// It also needs to work before bridge is initialised (because we may need to use the proxy at startup).
-func AllowDoH() {
-	pmapi.GlobalAllowDoH()
-}
+// setupRouting applies preferences of how to reach the API to the routing shared
+// by all clients. It has to be done before loading users, because we may need
+// to use the proxy at startup.
+func setupRouting(routing *pmapi.Routing, pref PreferenceProvider, credStorer CredentialsStorer) {
+	if routing == nil {
+		return
+	}
 
-// DisallowDoH instructs bridge to not use DoH to access an API proxy if necessary.
-// It also needs to work before bridge is initialised (because we may need to use the proxy at startup).
-func DisallowDoH() {
-	pmapi.GlobalDisallowDoH()
+	// Allow DoH if the user has previously set this setting.
+	// This allows us to start even if protonmail is blocked.
+	if pref.GetBool(preferences.AllowProxyKey) {
+		routing.AllowDoH()
+	}
+
+	proxy, err := loadUserProxy(pref, credStorer)
+	if err != nil {
+		log.WithError(err).Error("Cannot load proxy, connecting directly")
+		return
+	}
+	if err := routing.SetUserProxy(proxy); err != nil {
+		log.WithError(err).Error("Ignoring invalid proxy from preferences")
+	}
 }
 
 func (b *Bridge) updateCurrentUserAgent() {
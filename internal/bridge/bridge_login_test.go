@@ -112,11 +112,11 @@ func TestBridgeFinishLoginNewUser(t *testing.T) {
 
 	// Set up mocks for starting the store's event loop (in store.New).
 	// The event loop runs in another goroutine so this might happen at any time.
-	m.pmapiClient.EXPECT().GetEvent("").Return(testPMAPIEvent, nil)
-	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
 
 	// Set up mocks for performing the initial store sync.
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
 
 	checkBridgeFinishLogin(t, m, testAuth, testCredentials.MailboxPassword, "user", nil)
 }
@@ -167,11 +167,11 @@ func TestBridgeFinishLoginExistingUser(t *testing.T) {
 
 	// Set up mocks for starting the store's event loop (in store.New)
 	// The event loop runs in another goroutine so this might happen at any time.
-	m.pmapiClient.EXPECT().GetEvent("").Return(testPMAPIEvent, nil)
-	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
 
 	// Set up mocks for performing the initial store sync.
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
 
 	checkBridgeFinishLogin(t, m, testAuth, testCredentials.MailboxPassword, "user", nil)
 }
@@ -195,9 +195,9 @@ func TestBridgeDoubleLogin(t *testing.T) {
 	m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil)
 	m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress})
 
-	m.pmapiClient.EXPECT().GetEvent("").Return(testPMAPIEvent, nil)
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
-	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
 
 	bridge := testNewBridge(t, m)
 	defer cleanUpBridgeUserData(bridge)
@@ -94,9 +94,9 @@ func TestNewBridgeWithConnectedUser(t *testing.T) {
 	m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil)
 	m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress})
 	m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil)
-	m.pmapiClient.EXPECT().GetEvent("").Return(testPMAPIEvent, nil)
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
-	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
 
 	m.credentialsStore.EXPECT().List().Return([]string{"user"}, nil)
 	m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil).Times(2)
@@ -129,9 +129,9 @@ func TestNewBridgeWithUsers(t *testing.T) {
 	m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil)
 	m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress})
 	m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil)
-	m.pmapiClient.EXPECT().GetEvent("").Return(testPMAPIEvent, nil)
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
-	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
 
 	checkBridgeNew(t, m, []*credentials.Credentials{testCredentialsDisconnected, testCredentials})
 }
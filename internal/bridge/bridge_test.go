@@ -29,6 +29,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/internal/metrics"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	gomock "github.com/golang/mock/gomock"
 	"github.com/sirupsen/logrus"
@@ -160,6 +161,15 @@ func initMocks(t *testing.T) mocks {
 	m.prefProvider.EXPECT().Get(preferences.NextHeartbeatKey).AnyTimes()
 	m.prefProvider.EXPECT().Set(preferences.NextHeartbeatKey, gomock.Any()).AnyTimes()
 
+	// Sync progress is reported by every store sync.
+	m.eventListener.EXPECT().Emit(events.SyncProgressEvent, gomock.Any()).AnyTimes()
+
+	// Event loop of every store listens to connection changes.
+	m.eventListener.EXPECT().Add(events.InternetOffEvent, gomock.Any()).AnyTimes()
+	m.eventListener.EXPECT().Add(events.InternetOnEvent, gomock.Any()).AnyTimes()
+	m.eventListener.EXPECT().Remove(events.InternetOffEvent, gomock.Any()).AnyTimes()
+	m.eventListener.EXPECT().Remove(events.InternetOnEvent, gomock.Any()).AnyTimes()
+
 	// Called during clean-up.
 	m.PanicHandler.EXPECT().HandlePanic().AnyTimes()
 
@@ -177,9 +187,9 @@ func testNewBridgeWithUsers(t *testing.T, m mocks) *Bridge {
 	m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil).Times(2)
 	m.credentialsStore.EXPECT().UpdateToken("user", ":reftok").Return(nil)
 	m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil)
-	m.pmapiClient.EXPECT().GetEvent("").Return(testPMAPIEvent, nil)
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
-	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
 
 	// Init for users.
 	m.pmapiClient.EXPECT().AuthRefresh("token").Return(testAuthRefresh, nil)
@@ -191,9 +201,9 @@ func testNewBridgeWithUsers(t *testing.T, m mocks) *Bridge {
 	m.credentialsStore.EXPECT().Get("users").Return(testCredentialsSplit, nil).Times(2)
 	m.credentialsStore.EXPECT().UpdateToken("users", ":reftok").Return(nil)
 	m.credentialsStore.EXPECT().Get("users").Return(testCredentialsSplit, nil)
-	m.pmapiClient.EXPECT().GetEvent("").Return(testPMAPIEvent, nil)
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
-	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
 
 	m.credentialsStore.EXPECT().List().Return([]string{"user", "users"}, nil)
 
@@ -206,8 +216,11 @@ func testNewBridge(t *testing.T, m mocks) *Bridge {
 
 	m.prefProvider.EXPECT().GetBool(preferences.FirstStartKey).Return(false).AnyTimes()
 	m.prefProvider.EXPECT().GetBool(preferences.AllowProxyKey).Return(false).AnyTimes()
+	m.prefProvider.EXPECT().Get(preferences.UserProxyKey).Return("").AnyTimes()
 	m.config.EXPECT().GetDBDir().Return("/tmp").AnyTimes()
+	m.config.EXPECT().GetAPIConfig().Return(&pmapi.ClientConfig{}).AnyTimes()
 	m.config.EXPECT().GetIMAPCachePath().Return(cacheFile.Name()).AnyTimes()
+	m.config.EXPECT().GetSendRecorderConfig().Return(config.SendRecorderConfig{}).AnyTimes()
 	m.pmapiClient.EXPECT().SetAuths(gomock.Any()).AnyTimes()
 	m.eventListener.EXPECT().Add(events.UpgradeApplicationEvent, gomock.Any())
 	pmapiClientFactory := func(userID string) PMAPIProvider {
@@ -254,3 +267,20 @@ func TestClearData(t *testing.T) {
 
 	waitForEvents()
 }
+
+func TestLogAPIMetricsStopsOnShutdown(t *testing.T) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		logAPIMetrics(pmapi.NewAPIMetrics(), stop)
+		close(done)
+	}()
+
+	close(stop)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "API metrics are still logged after shutdown")
+	}
+}
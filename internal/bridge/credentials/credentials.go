@@ -50,6 +50,11 @@ type Credentials struct {
 	Timestamp int64
 	IsHidden, // Deprecated.
 	IsCombinedAddressMode bool
+	// AddressGroups are groups of addresses with their own IMAP login.
+	// They are used only in split mode which makes it hybrid mode.
+	// They are marshalled in place of the combined mode flag, older
+	// versions therefore see hybrid mode as split mode.
+	AddressGroups string
 }
 
 func (s *Credentials) Marshal() string {
@@ -62,7 +67,7 @@ func (s *Credentials) Marshal() string {
 		s.Version,         // 5
 		"",                // 6
 		"",                // 7
-		"",                // 8
+		s.AddressGroups,   // 8
 	}
 
 	items[6] = fmt.Sprint(s.Timestamp)
@@ -102,8 +107,10 @@ func (s *Credentials) Unmarshal(secret string) error {
 	if s.IsHidden = false; items[7] == "1" {
 		s.IsHidden = true
 	}
-	if s.IsCombinedAddressMode = false; items[8] == "1" {
+	if s.IsCombinedAddressMode, s.AddressGroups = false, ""; items[8] == "1" {
 		s.IsCombinedAddressMode = true
+	} else {
+		s.AddressGroups = items[8]
 	}
 	return nil
 }
@@ -116,6 +123,31 @@ func (s *Credentials) EmailList() []string {
 	return strings.Split(s.Emails, ";")
 }
 
+// SetAddressGroupList sets groups of addresses used in hybrid mode.
+func (s *Credentials) SetAddressGroupList(groups [][]string) {
+	list := []string{}
+	for _, group := range groups {
+		list = append(list, strings.Join(group, ";"))
+	}
+	s.AddressGroups = strings.Join(list, "|")
+}
+
+// AddressGroupList returns groups of addresses used in hybrid mode.
+func (s *Credentials) AddressGroupList() (groups [][]string) {
+	if s.AddressGroups == "" {
+		return nil
+	}
+	for _, group := range strings.Split(s.AddressGroups, "|") {
+		groups = append(groups, strings.Split(group, ";"))
+	}
+	return groups
+}
+
+// IsHybridAddressMode returns whether addresses are split into user-defined groups.
+func (s *Credentials) IsHybridAddressMode() bool {
+	return !s.IsCombinedAddressMode && s.AddressGroups != ""
+}
+
 func (s *Credentials) CheckPassword(password string) error {
 	if subtle.ConstantTimeCompare([]byte(s.BridgePassword), []byte(password)) != 1 {
 		log.WithFields(logrus.Fields{
@@ -30,16 +30,28 @@ import (
 
 var storeLocker = sync.RWMutex{} //nolint[gochecknoglobals]
 
+// proxySecretID is the keychain ID of the password of the proxy set by the user.
+const proxySecretID = "proxy"
+
 // Store is an encrypted credentials store.
 type Store struct {
 	secrets *keychain.Access
+
+	// proxySecrets is kept separately, otherwise it would be listed
+	// (and removed as malformed) together with user credentials.
+	proxySecrets *keychain.Access
 }
 
 // NewStore creates a new encrypted credentials store.
 func NewStore() (*Store, error) {
 	secrets, err := keychain.NewAccess("bridge")
+	if err != nil {
+		return &Store{}, err
+	}
+	proxySecrets, err := keychain.NewAccess("bridge-proxy")
 	return &Store{
-		secrets: secrets,
+		secrets:      secrets,
+		proxySecrets: proxySecrets,
 	}, err
 }
 
@@ -106,11 +118,28 @@ func (s *Store) SwitchAddressMode(userID string) error {
 	}
 
 	credentials.IsCombinedAddressMode = !credentials.IsCombinedAddressMode
+	credentials.AddressGroups = ""
 	credentials.BridgePassword = generatePassword()
 
 	return s.saveCredentials(credentials)
 }
 
+// SetAddressGroups switches the user to hybrid mode with the given groups of addresses.
+func (s *Store) SetAddressGroups(userID string, groups [][]string) error {
+	storeLocker.Lock()
+	defer storeLocker.Unlock()
+
+	credentials, err := s.get(userID)
+	if err != nil {
+		return err
+	}
+
+	credentials.IsCombinedAddressMode = false
+	credentials.SetAddressGroupList(groups)
+
+	return s.saveCredentials(credentials)
+}
+
 func (s *Store) UpdateEmails(userID string, emails []string) error {
 	storeLocker.Lock()
 	defer storeLocker.Unlock()
@@ -303,6 +332,37 @@ func (s *Store) checkKeychain() (err error) {
 	return
 }
 
+// GetProxyPassword returns the password of the proxy set by the user.
+func (s *Store) GetProxyPassword() (string, error) {
+	storeLocker.RLock()
+	defer storeLocker.RUnlock()
+
+	if s.proxySecrets == nil {
+		return "", keychain.ErrNoKeychainInstalled
+	}
+
+	return s.proxySecrets.Get(proxySecretID)
+}
+
+// SetProxyPassword stores the password of the proxy set by the user.
+// Empty password removes the stored one.
+func (s *Store) SetProxyPassword(password string) error {
+	storeLocker.Lock()
+	defer storeLocker.Unlock()
+
+	if s.proxySecrets == nil {
+		return keychain.ErrNoKeychainInstalled
+	}
+
+	if password == "" {
+		// The password does not have to be stored at all.
+		_ = s.proxySecrets.Delete(proxySecretID)
+		return nil
+	}
+
+	return s.proxySecrets.Put(proxySecretID, password)
+}
+
 // Delete removes credentials from the store.
 func (s *Store) Delete(userID string) (err error) {
 	storeLocker.Lock()
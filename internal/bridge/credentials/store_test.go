@@ -284,6 +284,7 @@ func TestMarshal(t *testing.T) {
 		Timestamp:             152469263742,
 		IsHidden:              true,
 		IsCombinedAddressMode: false,
+		AddressGroups:         "aj@cus.tom",
 	}
 	fmt.Printf("input %#v\n", input)
 
@@ -295,3 +296,46 @@ func TestMarshal(t *testing.T) {
 	fmt.Printf("output %#v\n", output)
 	assert.Equal(t, input, output)
 }
+
+func TestUnmarshalWithoutAddressGroups(t *testing.T) {
+	secret := base64.StdEncoding.EncodeToString([]byte(strings.Join([]string{
+		"007", "ja@pm.me", "token", "mailbox", "bridge", "k11", "152469263742", "", "1",
+	}, sep)))
+
+	output := Credentials{}
+	require.NoError(t, output.Unmarshal(secret))
+	assert.True(t, output.IsCombinedAddressMode)
+	assert.Equal(t, "", output.AddressGroups)
+	assert.Nil(t, output.AddressGroupList())
+}
+
+func TestMarshalKeepsFormatOfOlderVersions(t *testing.T) {
+	input := Credentials{Name: "007", AddressGroups: "aj@cus.tom"}
+
+	b, err := base64.StdEncoding.DecodeString(input.Marshal())
+	require.NoError(t, err)
+	items := strings.Split(string(b), sep)
+
+	// Older versions accept only nine items and see hybrid mode as split mode.
+	require.Equal(t, 9, len(items))
+	assert.NotEqual(t, "1", items[8])
+
+	input.IsCombinedAddressMode = true
+	output := Credentials{}
+	require.NoError(t, output.Unmarshal(input.Marshal()))
+	assert.True(t, output.IsCombinedAddressMode)
+	assert.Equal(t, "", output.AddressGroups)
+}
+
+func TestAddressGroupList(t *testing.T) {
+	creds := Credentials{}
+	groups := [][]string{{"work@pm.me"}, {"a@pm.me", "b@pm.me"}}
+
+	creds.SetAddressGroupList(groups)
+	assert.Equal(t, "work@pm.me|a@pm.me;b@pm.me", creds.AddressGroups)
+	assert.Equal(t, groups, creds.AddressGroupList())
+	assert.True(t, creds.IsHybridAddressMode())
+
+	creds.IsCombinedAddressMode = true
+	assert.False(t, creds.IsHybridAddressMode())
+}
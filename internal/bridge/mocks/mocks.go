@@ -5,7 +5,9 @@
 package mocks
 
 import (
+	context "context"
 	credentials "github.com/ProtonMail/proton-bridge/internal/bridge/credentials"
+	config "github.com/ProtonMail/proton-bridge/pkg/config"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	crypto "github.com/ProtonMail/gopenpgp/crypto"
 	gomock "github.com/golang/mock/gomock"
@@ -92,6 +94,20 @@ func (mr *MockConfigerMockRecorder) GetIMAPCachePath() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetIMAPCachePath", reflect.TypeOf((*MockConfiger)(nil).GetIMAPCachePath))
 }
 
+// GetSendRecorderConfig mocks base method
+func (m *MockConfiger) GetSendRecorderConfig() config.SendRecorderConfig {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSendRecorderConfig")
+	ret0, _ := ret[0].(config.SendRecorderConfig)
+	return ret0
+}
+
+// GetSendRecorderConfig indicates an expected call of GetSendRecorderConfig
+func (mr *MockConfigerMockRecorder) GetSendRecorderConfig() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSendRecorderConfig", reflect.TypeOf((*MockConfiger)(nil).GetSendRecorderConfig))
+}
+
 // MockPreferenceProvider is a mock of PreferenceProvider interface
 type MockPreferenceProvider struct {
 	ctrl     *gomock.Controller
@@ -448,6 +464,21 @@ func (mr *MockPMAPIProviderMockRecorder) GetAttachment(arg0 interface{}) *gomock
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachment", reflect.TypeOf((*MockPMAPIProvider)(nil).GetAttachment), arg0)
 }
 
+// GetAttachmentContext mocks base method
+func (m *MockPMAPIProvider) GetAttachmentContext(arg0 context.Context, arg1 string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAttachmentContext", arg0, arg1)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAttachmentContext indicates an expected call of GetAttachmentContext
+func (mr *MockPMAPIProviderMockRecorder) GetAttachmentContext(arg0 interface{}, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachmentContext", reflect.TypeOf((*MockPMAPIProvider)(nil).GetAttachmentContext), arg0, arg1)
+}
+
 // GetContactByID mocks base method
 func (m *MockPMAPIProvider) GetContactByID(arg0 string) (pmapi.Contact, error) {
 	m.ctrl.T.Helper()
@@ -478,6 +509,21 @@ func (mr *MockPMAPIProviderMockRecorder) GetContactEmailByEmail(arg0, arg1, arg2
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContactEmailByEmail", reflect.TypeOf((*MockPMAPIProvider)(nil).GetContactEmailByEmail), arg0, arg1, arg2)
 }
 
+// GetContactEmailsByGroup mocks base method
+func (m *MockPMAPIProvider) GetContactEmailsByGroup(arg0 string, arg1, arg2 int) ([]pmapi.ContactEmail, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetContactEmailsByGroup", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]pmapi.ContactEmail)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetContactEmailsByGroup indicates an expected call of GetContactEmailsByGroup
+func (mr *MockPMAPIProviderMockRecorder) GetContactEmailsByGroup(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetContactEmailsByGroup", reflect.TypeOf((*MockPMAPIProvider)(nil).GetContactEmailsByGroup), arg0, arg1, arg2)
+}
+
 // GetEvent mocks base method
 func (m *MockPMAPIProvider) GetEvent(arg0 string) (*pmapi.Event, error) {
 	m.ctrl.T.Helper()
@@ -493,6 +539,21 @@ func (mr *MockPMAPIProviderMockRecorder) GetEvent(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvent", reflect.TypeOf((*MockPMAPIProvider)(nil).GetEvent), arg0)
 }
 
+// GetEventContext mocks base method
+func (m *MockPMAPIProvider) GetEventContext(arg0 context.Context, arg1 string) (*pmapi.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEventContext", arg0, arg1)
+	ret0, _ := ret[0].(*pmapi.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEventContext indicates an expected call of GetEventContext
+func (mr *MockPMAPIProviderMockRecorder) GetEventContext(arg0 interface{}, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEventContext", reflect.TypeOf((*MockPMAPIProvider)(nil).GetEventContext), arg0, arg1)
+}
+
 // GetMailSettings mocks base method
 func (m *MockPMAPIProvider) GetMailSettings() (pmapi.MailSettings, error) {
 	m.ctrl.T.Helper()
@@ -523,6 +584,21 @@ func (mr *MockPMAPIProviderMockRecorder) GetMessage(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessage", reflect.TypeOf((*MockPMAPIProvider)(nil).GetMessage), arg0)
 }
 
+// GetMessageContext mocks base method
+func (m *MockPMAPIProvider) GetMessageContext(arg0 context.Context, arg1 string) (*pmapi.Message, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMessageContext", arg0, arg1)
+	ret0, _ := ret[0].(*pmapi.Message)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMessageContext indicates an expected call of GetMessageContext
+func (mr *MockPMAPIProviderMockRecorder) GetMessageContext(arg0 interface{}, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMessageContext", reflect.TypeOf((*MockPMAPIProvider)(nil).GetMessageContext), arg0, arg1)
+}
+
 // GetPublicKeysForEmail mocks base method
 func (m *MockPMAPIProvider) GetPublicKeysForEmail(arg0 string) ([]pmapi.PublicKey, bool, error) {
 	m.ctrl.T.Helper()
@@ -539,6 +615,22 @@ func (mr *MockPMAPIProviderMockRecorder) GetPublicKeysForEmail(arg0 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublicKeysForEmail", reflect.TypeOf((*MockPMAPIProvider)(nil).GetPublicKeysForEmail), arg0)
 }
 
+// GetPublicKeysForEmailContext mocks base method
+func (m *MockPMAPIProvider) GetPublicKeysForEmailContext(arg0 context.Context, arg1 string) ([]pmapi.PublicKey, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPublicKeysForEmailContext", arg0, arg1)
+	ret0, _ := ret[0].([]pmapi.PublicKey)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetPublicKeysForEmailContext indicates an expected call of GetPublicKeysForEmailContext
+func (mr *MockPMAPIProviderMockRecorder) GetPublicKeysForEmailContext(arg0 interface{}, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPublicKeysForEmailContext", reflect.TypeOf((*MockPMAPIProvider)(nil).GetPublicKeysForEmailContext), arg0, arg1)
+}
+
 // Import mocks base method
 func (m *MockPMAPIProvider) Import(arg0 []*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error) {
 	m.ctrl.T.Helper()
@@ -582,6 +674,21 @@ func (mr *MockPMAPIProviderMockRecorder) LabelMessages(arg0, arg1 interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LabelMessages", reflect.TypeOf((*MockPMAPIProvider)(nil).LabelMessages), arg0, arg1)
 }
 
+// ListContactGroups mocks base method
+func (m *MockPMAPIProvider) ListContactGroups() ([]*pmapi.Label, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListContactGroups")
+	ret0, _ := ret[0].([]*pmapi.Label)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListContactGroups indicates an expected call of ListContactGroups
+func (mr *MockPMAPIProviderMockRecorder) ListContactGroups() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListContactGroups", reflect.TypeOf((*MockPMAPIProvider)(nil).ListContactGroups))
+}
+
 // ListLabels mocks base method
 func (m *MockPMAPIProvider) ListLabels() ([]*pmapi.Label, error) {
 	m.ctrl.T.Helper()
@@ -613,6 +720,22 @@ func (mr *MockPMAPIProviderMockRecorder) ListMessages(arg0 interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMessages", reflect.TypeOf((*MockPMAPIProvider)(nil).ListMessages), arg0)
 }
 
+// ListMessagesContext mocks base method
+func (m *MockPMAPIProvider) ListMessagesContext(arg0 context.Context, arg1 *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListMessagesContext", arg0, arg1)
+	ret0, _ := ret[0].([]*pmapi.Message)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListMessagesContext indicates an expected call of ListMessagesContext
+func (mr *MockPMAPIProviderMockRecorder) ListMessagesContext(arg0 interface{}, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListMessagesContext", reflect.TypeOf((*MockPMAPIProvider)(nil).ListMessagesContext), arg0, arg1)
+}
+
 // Logout mocks base method
 func (m *MockPMAPIProvider) Logout() error {
 	m.ctrl.T.Helper()
@@ -851,6 +974,21 @@ func (mr *MockCredentialsStorerMockRecorder) Get(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockCredentialsStorer)(nil).Get), arg0)
 }
 
+// GetProxyPassword mocks base method
+func (m *MockCredentialsStorer) GetProxyPassword() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetProxyPassword")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetProxyPassword indicates an expected call of GetProxyPassword
+func (mr *MockCredentialsStorerMockRecorder) GetProxyPassword() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProxyPassword", reflect.TypeOf((*MockCredentialsStorer)(nil).GetProxyPassword))
+}
+
 // List mocks base method
 func (m *MockCredentialsStorer) List() ([]string, error) {
 	m.ctrl.T.Helper()
@@ -880,6 +1018,34 @@ func (mr *MockCredentialsStorerMockRecorder) Logout(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Logout", reflect.TypeOf((*MockCredentialsStorer)(nil).Logout), arg0)
 }
 
+// SetAddressGroups mocks base method
+func (m *MockCredentialsStorer) SetAddressGroups(arg0 string, arg1 [][]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetAddressGroups", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetAddressGroups indicates an expected call of SetAddressGroups
+func (mr *MockCredentialsStorerMockRecorder) SetAddressGroups(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAddressGroups", reflect.TypeOf((*MockCredentialsStorer)(nil).SetAddressGroups), arg0, arg1)
+}
+
+// SetProxyPassword mocks base method
+func (m *MockCredentialsStorer) SetProxyPassword(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetProxyPassword", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetProxyPassword indicates an expected call of SetProxyPassword
+func (mr *MockCredentialsStorerMockRecorder) SetProxyPassword(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetProxyPassword", reflect.TypeOf((*MockCredentialsStorer)(nil).SetProxyPassword), arg0)
+}
+
 // SwitchAddressMode mocks base method
 func (m *MockCredentialsStorer) SwitchAddressMode(arg0 string) error {
 	m.ctrl.T.Helper()
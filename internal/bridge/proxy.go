@@ -0,0 +1,125 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package bridge
+
+import (
+	"errors"
+	"net/url"
+
+	"github.com/ProtonMail/proton-bridge/internal/preferences"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+// SetUserProxy sets the proxy for all connections to the API and keeps it
+// in preferences. The password of the proxy is kept in the keychain, not
+// in preferences which are stored in plain text. Empty proxy disables it.
+func (b *Bridge) SetUserProxy(proxy string) error {
+	routing := b.config.GetAPIConfig().Routing
+	if routing == nil {
+		return errors.New("routing is not set up")
+	}
+
+	var proxyURL *url.URL
+	if proxy != "" {
+		var err error
+		if proxyURL, err = pmapi.ParseUserProxy(proxy); err != nil {
+			return err
+		}
+	}
+
+	if err := b.setProxyPassword(getProxyPassword(proxyURL)); err != nil {
+		return err
+	}
+	if err := routing.SetUserProxy(proxy); err != nil {
+		return err
+	}
+	b.pref.Set(preferences.UserProxyKey, getProxyWithoutPassword(proxyURL))
+
+	return nil
+}
+
+// GetUserProxy returns the proxy set by the user without its password.
+func (b *Bridge) GetUserProxy() string {
+	return b.pref.Get(preferences.UserProxyKey)
+}
+
+func (b *Bridge) setProxyPassword(password string) error {
+	if b.credStorer == nil {
+		if password == "" {
+			return nil
+		}
+		return errors.New("proxy password cannot be stored without credentials store")
+	}
+	return b.credStorer.SetProxyPassword(password)
+}
+
+// loadUserProxy returns the proxy from preferences with the password from
+// the keychain. Password found in preferences is moved to the keychain.
+func loadUserProxy(pref PreferenceProvider, credStorer CredentialsStorer) (string, error) {
+	proxy := pref.Get(preferences.UserProxyKey)
+	if proxy == "" {
+		return "", nil
+	}
+
+	proxyURL, err := pmapi.ParseUserProxy(proxy)
+	if err != nil {
+		return "", err
+	}
+	if proxyURL.User == nil {
+		return proxy, nil
+	}
+	if credStorer == nil {
+		return "", errors.New("proxy password cannot be loaded without credentials store")
+	}
+
+	if password := getProxyPassword(proxyURL); password != "" {
+		if err := credStorer.SetProxyPassword(password); err != nil {
+			return "", err
+		}
+		pref.Set(preferences.UserProxyKey, getProxyWithoutPassword(proxyURL))
+		return proxy, nil
+	}
+
+	password, err := credStorer.GetProxyPassword()
+	if err != nil {
+		return "", err
+	}
+	if password != "" {
+		proxyURL.User = url.UserPassword(proxyURL.User.Username(), password)
+	}
+	return proxyURL.String(), nil
+}
+
+func getProxyPassword(proxyURL *url.URL) string {
+	if proxyURL == nil || proxyURL.User == nil {
+		return ""
+	}
+	password, _ := proxyURL.User.Password()
+	return password
+}
+
+func getProxyWithoutPassword(proxyURL *url.URL) string {
+	if proxyURL == nil {
+		return ""
+	}
+	withoutPassword := *proxyURL
+	if proxyURL.User != nil {
+		withoutPassword.User = url.User(proxyURL.User.Username())
+	}
+	return withoutPassword.String()
+}
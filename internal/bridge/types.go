@@ -18,10 +18,12 @@
 package bridge
 
 import (
+	"context"
 	"io"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
 	"github.com/ProtonMail/proton-bridge/internal/bridge/credentials"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi" // mockgen needs this to be given an explicit import name
 )
 
@@ -30,6 +32,7 @@ type Configer interface {
 	GetDBDir() string
 	GetIMAPCachePath() string
 	GetAPIConfig() *pmapi.ClientConfig
+	GetSendRecorderConfig() config.SendRecorderConfig
 }
 
 type PreferenceProvider interface {
@@ -58,10 +61,13 @@ type PMAPIProvider interface {
 	Logout() error
 
 	GetEvent(eventID string) (*pmapi.Event, error)
+	GetEventContext(ctx context.Context, eventID string) (*pmapi.Event, error)
 
 	CountMessages(addressID string) ([]*pmapi.MessagesCount, error)
 	ListMessages(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
+	ListMessagesContext(ctx context.Context, filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
 	GetMessage(apiID string) (*pmapi.Message, error)
+	GetMessageContext(ctx context.Context, apiID string) (*pmapi.Message, error)
 	Import([]*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error)
 	DeleteMessages(apiIDs []string) error
 	LabelMessages(apiIDs []string, labelID string) error
@@ -70,6 +76,7 @@ type PMAPIProvider interface {
 	MarkMessagesUnread(apiIDs []string) error
 
 	ListLabels() ([]*pmapi.Label, error)
+	ListContactGroups() ([]*pmapi.Label, error)
 	CreateLabel(label *pmapi.Label) (*pmapi.Label, error)
 	UpdateLabel(label *pmapi.Label) (*pmapi.Label, error)
 	DeleteLabel(labelID string) error
@@ -83,14 +90,17 @@ type PMAPIProvider interface {
 	GetMailSettings() (pmapi.MailSettings, error)
 	GetContactEmailByEmail(string, int, int) ([]pmapi.ContactEmail, error)
 	GetContactByID(string) (pmapi.Contact, error)
+	GetContactEmailsByGroup(string, int, int) ([]pmapi.ContactEmail, error)
 	DecryptAndVerifyCards([]pmapi.Card) ([]pmapi.Card, error)
 	GetPublicKeysForEmail(string) ([]pmapi.PublicKey, bool, error)
+	GetPublicKeysForEmailContext(context.Context, string) ([]pmapi.PublicKey, bool, error)
 	SendMessage(string, *pmapi.SendMessageReq) (sent, parent *pmapi.Message, err error)
 	CreateDraft(m *pmapi.Message, parent string, action int) (created *pmapi.Message, err error)
 	CreateAttachment(att *pmapi.Attachment, r io.Reader, sig io.Reader) (created *pmapi.Attachment, err error)
 	KeyRingForAddressID(string) (kr *pmcrypto.KeyRing)
 
 	GetAttachment(id string) (att io.ReadCloser, err error)
+	GetAttachmentContext(ctx context.Context, id string) (att io.ReadCloser, err error)
 }
 
 type CredentialsStorer interface {
@@ -98,8 +108,11 @@ type CredentialsStorer interface {
 	Add(userID, userName, apiToken, mailboxPassword string, emails []string) (*credentials.Credentials, error)
 	Get(userID string) (*credentials.Credentials, error)
 	SwitchAddressMode(userID string) error
+	SetAddressGroups(userID string, groups [][]string) error
 	UpdateEmails(userID string, emails []string) error
 	UpdateToken(userID, apiToken string) error
 	Logout(userID string) error
 	Delete(userID string) error
+	GetProxyPassword() (string, error)
+	SetProxyPassword(password string) error
 }
@@ -27,6 +27,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/internal/bridge/credentials"
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
@@ -50,6 +51,8 @@ type User struct {
 	storeCache *store.Cache
 	storePath  string
 
+	sendRecorderConfig config.SendRecorderConfig
+
 	userID string
 	creds  *credentials.Credentials
 
@@ -70,6 +73,7 @@ func newUser(
 	apiClient PMAPIProvider,
 	storeCache *store.Cache,
 	storeDir string,
+	sendRecorderConfig config.SendRecorderConfig,
 ) (u *User, err error) {
 	log := log.WithField("user", userID)
 	log.Debug("Creating or loading user")
@@ -80,15 +84,16 @@ func newUser(
 	}
 
 	u = &User{
-		log:          log,
-		panicHandler: panicHandler,
-		listener:     eventListener,
-		credStorer:   credStorer,
-		apiClient:    apiClient,
-		storeCache:   storeCache,
-		storePath:    getUserStorePath(storeDir, userID),
-		userID:       userID,
-		creds:        creds,
+		log:                log,
+		panicHandler:       panicHandler,
+		listener:           eventListener,
+		credStorer:         credStorer,
+		apiClient:          apiClient,
+		storeCache:         storeCache,
+		storePath:          getUserStorePath(storeDir, userID),
+		sendRecorderConfig: sendRecorderConfig,
+		userID:             userID,
+		creds:              creds,
 	}
 
 	return
@@ -147,7 +152,7 @@ func (u *User) init(idleUpdates chan interface{}, apiClient PMAPIProvider) (err
 		}
 		u.store = nil
 	}
-	store, err := store.New(u.panicHandler, u, u.apiClient, u.listener, u.storePath, u.storeCache)
+	store, err := store.New(u.panicHandler, u, u.apiClient, u.listener, u.storePath, u.storeCache, u.sendRecorderConfig)
 	if err != nil {
 		return errors.Wrap(err, "failed to create store")
 	}
@@ -357,6 +362,23 @@ func (u *User) IsCombinedAddressMode() bool {
 	return u.creds.IsCombinedAddressMode
 }
 
+// IsHybridAddressMode returns whether user's addresses are split into
+// user-defined groups. Every group has its own IMAP login and mailbox tree
+// and addresses not listed in any group are combined with the primary one.
+func (u *User) IsHybridAddressMode() bool {
+	if u.store != nil {
+		return u.store.IsHybridMode()
+	}
+
+	return u.creds.IsHybridAddressMode()
+}
+
+// GetConfiguredAddressGroups returns address groups as set by the user
+// for hybrid mode.
+func (u *User) GetConfiguredAddressGroups() [][]string {
+	return u.creds.AddressGroupList()
+}
+
 // GetPrimaryAddress returns the user's original address (which is
 // not necessarily the same as the primary address, because a primary address
 // might be an alias and be in position one).
@@ -373,11 +395,66 @@ func (u *User) GetStoreAddresses() []string {
 	u.lock.RLock()
 	defer u.lock.RUnlock()
 
+	addresses := []string{}
+	for _, group := range u.getAddressGroups() {
+		addresses = append(addresses, group[0])
+	}
+
+	return addresses
+}
+
+// GetAddressGroups returns the user's addresses grouped by the address mode.
+// Addresses in one group share one IMAP login which is the first address
+// of the group. In combined mode there is only one group, in split mode
+// every address has its own group.
+func (u *User) GetAddressGroups() [][]string {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	return u.getAddressGroups()
+}
+
+// GetAddressGroup returns all addresses sharing the IMAP login with the given address.
+func (u *User) GetAddressGroup(address string) []string {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	for _, group := range u.getAddressGroups() {
+		for _, groupAddress := range group {
+			if strings.EqualFold(groupAddress, address) {
+				return group
+			}
+		}
+	}
+
+	return nil
+}
+
+func (u *User) getAddressGroups() (groups [][]string) {
+	if u.store != nil && u.store.IsHybridMode() {
+		storeGroups, err := u.store.GetAddressGroups()
+		if err == nil {
+			for _, storeGroup := range storeGroups {
+				group := []string{}
+				for _, addr := range storeGroup {
+					group = append(group, addr.Address)
+				}
+				groups = append(groups, group)
+			}
+			return groups
+		}
+		u.log.WithError(err).Error("Failed getting address groups from store")
+	}
+
 	if u.IsCombinedAddressMode() {
-		return u.creds.EmailList()[:1]
+		return [][]string{u.creds.EmailList()}
 	}
 
-	return u.creds.EmailList()
+	for _, address := range u.creds.EmailList() {
+		groups = append(groups, []string{address})
+	}
+
+	return groups
 }
 
 // getStoreAddresses returns a user's used addresses (with the original address in first place).
@@ -423,6 +500,72 @@ func (u *User) GetAddressID(address string) (id string, err error) {
 	return u.store.GetAddressID(address)
 }
 
+// GetSyncProgress returns the progress of the sync of the user's store.
+func (u *User) GetSyncProgress() (progress events.SyncProgress, err error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		err = errors.New("store is not initialised")
+		return
+	}
+
+	return u.store.GetSyncProgress(), nil
+}
+
+// PauseSync stops the running sync and does not start new one until
+// ResumeSync is called.
+func (u *User) PauseSync() error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	u.store.PauseSync()
+	return nil
+}
+
+// ResumeSync continues the sync where it was paused.
+func (u *User) ResumeSync() error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	u.store.ResumeSync()
+	return nil
+}
+
+// Resync forgets the sync state and downloads all messages again.
+func (u *User) Resync() error {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	u.store.Resync()
+	return nil
+}
+
+// CheckStore checks the consistency of the user's store. When repair is set,
+// it fixes everything which can be fixed without full resync.
+func (u *User) CheckStore(repair bool) (*store.IntegrityReport, error) {
+	u.lock.RLock()
+	defer u.lock.RUnlock()
+
+	if u.store == nil {
+		return nil, errors.New("store is not initialised")
+	}
+
+	return u.store.CheckIntegrity(repair)
+}
+
 // GetBridgePassword returns bridge password. This is not a password of the PM
 // account, but generated password for local purposes to not use a PM account
 // in the clients (such as Thunderbird).
@@ -518,6 +661,82 @@ func (u *User) SwitchAddressMode() (err error) {
 	return err
 }
 
+// SetAddressGroups switches the user to hybrid mode. Every group of addresses
+// gets its own IMAP login and mailbox tree, the rest of addresses stays
+// combined with the primary address.
+func (u *User) SetAddressGroups(groups [][]string) (err error) {
+	u.log.WithField("groups", groups).Trace("Setting user address groups")
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+
+	if u.store == nil {
+		return errors.New("store is not initialised")
+	}
+
+	if groups, err = u.checkAddressGroups(groups); err != nil {
+		return err
+	}
+
+	u.closeAllConnections()
+
+	if err = u.store.UseHybridMode(groups); err != nil {
+		u.log.WithError(err).Error("Could not switch store to hybrid mode")
+		return
+	}
+
+	if err = u.credStorer.SetAddressGroups(u.userID, groups); err != nil {
+		u.log.WithError(err).Error("Could not set credentials store address groups")
+		return
+	}
+
+	u.refreshFromCredentials()
+
+	return nil
+}
+
+// checkAddressGroups returns groups with addresses as known by bridge.
+// Every address can be only in one group and the primary address
+// cannot be in any because it always belongs to the default group.
+func (u *User) checkAddressGroups(groups [][]string) ([][]string, error) {
+	if len(groups) == 0 {
+		return nil, errors.New("at least one address group is needed")
+	}
+
+	emails := u.creds.EmailList()
+	used := map[string]bool{}
+	checked := [][]string{}
+	for _, group := range groups {
+		if len(group) == 0 {
+			return nil, errors.New("address group cannot be empty")
+		}
+
+		checkedGroup := []string{}
+		for _, address := range group {
+			index := -1
+			for i, email := range emails {
+				if strings.EqualFold(email, strings.TrimSpace(address)) {
+					index = i
+					break
+				}
+			}
+			switch {
+			case index < 0:
+				return nil, fmt.Errorf("address %s does not belong to the user", address)
+			case index == 0:
+				return nil, fmt.Errorf("primary address %s cannot be moved to another group", address)
+			case used[emails[index]]:
+				return nil, fmt.Errorf("address %s is in more groups", address)
+			}
+			used[emails[index]] = true
+			checkedGroup = append(checkedGroup, emails[index])
+		}
+		checked = append(checked, checkedGroup)
+	}
+
+	return checked, nil
+}
+
 // logout is the same as Logout, but for internal purposes (logged out from
 // the server) which emits LogoutEvent to notify other parts of the Bridge.
 func (u *User) logout() error {
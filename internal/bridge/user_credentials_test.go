@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	gomock "github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
@@ -64,10 +65,6 @@ func TestUserSwitchAddressMode(t *testing.T) {
 
 	gomock.InOrder(
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "user@pm.me"),
-		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
-		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
-		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
-
 		m.credentialsStore.EXPECT().SwitchAddressMode("user").Return(nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentialsSplit, nil),
 	)
@@ -81,14 +78,10 @@ func TestUserSwitchAddressMode(t *testing.T) {
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "users@pm.me"),
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "anotheruser@pm.me"),
 		m.eventListener.EXPECT().Emit(events.CloseConnectionEvent, "alsouser@pm.me"),
-		m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil),
-		m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil),
-		m.pmapiClient.EXPECT().Addresses().Return([]*pmapi.Address{testPMAPIAddress}),
-
 		m.credentialsStore.EXPECT().SwitchAddressMode("user").Return(nil),
 		m.credentialsStore.EXPECT().Get("user").Return(testCredentials, nil),
 	)
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil).AnyTimes()
 
 	assert.NoError(t, user.SwitchAddressMode())
 	assert.True(t, user.store.IsCombinedMode())
@@ -174,7 +167,7 @@ func TestCheckBridgeLoginLoggedOut(t *testing.T) {
 	defer m.ctrl.Finish()
 
 	m.credentialsStore.EXPECT().Get("user").Return(testCredentialsDisconnected, nil)
-	user, _ := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp")
+	user, _ := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp", config.SendRecorderConfig{})
 	m.pmapiClient.EXPECT().ListLabels().Return(nil, errors.New("ErrUnauthorized"))
 	m.pmapiClient.EXPECT().Addresses().Return(nil)
 	m.pmapiClient.EXPECT().SetAuths(gomock.Any())
@@ -206,3 +199,22 @@ func TestCheckBridgeLoginBadPassword(t *testing.T) {
 	waitForEvents()
 	assert.Equal(t, "backend/credentials: incorrect password", err.Error())
 }
+
+func TestUserCheckAddressGroups(t *testing.T) {
+	user := &User{creds: testCredentialsSplit}
+
+	groups, err := user.checkAddressGroups([][]string{{"AnotherUser@pm.me", " alsouser@pm.me"}})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"anotheruser@pm.me", "alsouser@pm.me"}}, groups)
+
+	for _, wrongGroups := range [][][]string{
+		nil,
+		{{}},
+		{{"users@pm.me"}},
+		{{"nobody@pm.me"}},
+		{{"anotheruser@pm.me"}, {"anotheruser@pm.me"}},
+	} {
+		_, err := user.checkAddressGroups(wrongGroups)
+		assert.Error(t, err, "groups %v", wrongGroups)
+	}
+}
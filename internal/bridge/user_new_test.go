@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	gomock "github.com/golang/mock/gomock"
 	a "github.com/stretchr/testify/assert"
@@ -33,7 +34,7 @@ func TestNewUserNoCredentialsStore(t *testing.T) {
 
 	m.credentialsStore.EXPECT().Get("user").Return(nil, errors.New("fail"))
 
-	_, err := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp")
+	_, err := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp", config.SendRecorderConfig{})
 	a.Error(t, err)
 }
 
@@ -63,7 +64,7 @@ func TestNewUserNoInternetConnection(t *testing.T) {
 
 	m.pmapiClient.EXPECT().Addresses().Return(nil)
 	m.pmapiClient.EXPECT().ListLabels().Return(nil, pmapi.ErrAPINotReachable)
-	m.pmapiClient.EXPECT().GetEvent("").Return(nil, pmapi.ErrAPINotReachable).AnyTimes()
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(nil, pmapi.ErrAPINotReachable).AnyTimes()
 
 	checkNewUser(m)
 }
@@ -154,15 +155,15 @@ func TestNewUser(t *testing.T) {
 	m.pmapiClient.EXPECT().ListLabels().Return([]*pmapi.Label{}, nil)
 	m.pmapiClient.EXPECT().CountMessages("").Return([]*pmapi.MessagesCount{}, nil)
 
-	m.pmapiClient.EXPECT().GetEvent("").Return(testPMAPIEvent, nil)
-	m.pmapiClient.EXPECT().ListMessages(gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
-	m.pmapiClient.EXPECT().GetEvent(testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), "").Return(testPMAPIEvent, nil)
+	m.pmapiClient.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return([]*pmapi.Message{}, 0, nil)
+	m.pmapiClient.EXPECT().GetEventContext(gomock.Any(), testPMAPIEvent.EventID).Return(testPMAPIEvent, nil)
 
 	checkNewUser(m)
 }
 
 func checkNewUser(m mocks) {
-	user, _ := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp")
+	user, _ := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp", config.SendRecorderConfig{})
 	defer cleanUpUserData(user)
 
 	_ = user.init(nil, m.pmapiClient)
@@ -173,7 +174,7 @@ func checkNewUser(m mocks) {
 }
 
 func checkNewUserDisconnected(m mocks) {
-	user, _ := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp")
+	user, _ := newUser(m.PanicHandler, "user", m.eventListener, m.credentialsStore, m.pmapiClient, m.storeCache, "/tmp", config.SendRecorderConfig{})
 	defer cleanUpUserData(user)
 
 	_ = user.init(nil, m.pmapiClient)
@@ -0,0 +1,55 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// States of the store event loop reported by EventLoopStatusEvent.
+const (
+	EventLoopRunning     = "running"
+	EventLoopBackoff     = "backoff"
+	EventLoopCircuitOpen = "circuitOpen"
+	EventLoopRestarted   = "restarted"
+)
+
+// EventLoopStatus is the data of EventLoopStatusEvent. It is emitted when
+// polling of events fails, when the event loop is restarted and when it
+// recovers.
+type EventLoopStatus struct {
+	UserID   string
+	State    string
+	Failures int
+	Restarts int
+	RetryIn  time.Duration
+	Error    string `json:",omitempty"`
+}
+
+// Encode returns the status as event data.
+func (s EventLoopStatus) Encode() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// DecodeEventLoopStatus parses the data of EventLoopStatusEvent.
+func DecodeEventLoopStatus(data string) (status EventLoopStatus, err error) {
+	err = json.Unmarshal([]byte(data), &status)
+	return
+}
@@ -40,6 +40,11 @@ const (
 	NoActiveKeyForRecipientEvent = "noActiveKeyForRecipient"
 	UpgradeApplicationEvent      = "upgradeApplication"
 	TLSCertIssue                 = "tlsCertPinningIssue"
+	SyncProgressEvent            = "syncProgress"
+	WriteQueueRejectedEvent      = "writeQueueRejected"
+	EventLoopStatusEvent         = "eventLoopStatus"
+	APIThrottledEvent            = "apiThrottled"
+	TransferProgressEvent        = "transferProgress"
 
 	// LogoutEventTimeout is the minimum time to permit between logout events being sent.
 	LogoutEventTimeout = 3 * time.Minute
@@ -0,0 +1,72 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Phases of the store sync reported by SyncProgressEvent.
+const (
+	SyncPhaseIdle      = "idle"
+	SyncPhasePreparing = "preparing"
+	SyncPhaseSyncing   = "syncing"
+	SyncPhaseDeleting  = "deleting"
+	SyncPhaseFinished  = "finished"
+	SyncPhasePaused    = "paused"
+	SyncPhaseFailed    = "failed"
+)
+
+// SyncProgress is the data of SyncProgressEvent. Listener passes only
+// strings, therefore it is sent encoded by `Encode` and frontends get it
+// back by `DecodeSyncProgress`.
+type SyncProgress struct {
+	UserID    string
+	Phase     string
+	Processed int
+	Total     int
+	ETA       time.Duration
+}
+
+// Percent returns how much of the sync is done.
+func (p SyncProgress) Percent() float64 {
+	if p.Phase == SyncPhaseFinished {
+		return 100
+	}
+	if p.Total <= 0 {
+		return 0
+	}
+	percent := 100 * float64(p.Processed) / float64(p.Total)
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// Encode returns the progress as event data.
+func (p SyncProgress) Encode() string {
+	data, _ := json.Marshal(p)
+	return string(data)
+}
+
+// DecodeSyncProgress parses the data of SyncProgressEvent.
+func DecodeSyncProgress(data string) (progress SyncProgress, err error) {
+	err = json.Unmarshal([]byte(data), &progress)
+	return
+}
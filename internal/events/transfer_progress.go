@@ -0,0 +1,130 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package events
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+)
+
+// Directions of the attachment transfer reported by TransferProgressEvent.
+const (
+	TransferUpload   = "upload"
+	TransferDownload = "download"
+)
+
+// transferProgressEmitInterval is the minimal time between two progress
+// events of the same transfer. Transfers finished sooner are not reported
+// at all, only the long ones are worth showing in frontends.
+const transferProgressEmitInterval = time.Second
+
+// TransferProgress is the data of TransferProgressEvent. It is encoded
+// the same way as SyncProgress.
+type TransferProgress struct {
+	UserID      string
+	Direction   string
+	Name        string
+	Transferred int64
+	Total       int64
+	Finished    bool
+}
+
+// Percent returns how much of the transfer is done.
+func (p TransferProgress) Percent() float64 {
+	if p.Finished {
+		return 100
+	}
+	if p.Total <= 0 {
+		return 0
+	}
+	percent := 100 * float64(p.Transferred) / float64(p.Total)
+	if percent > 100 {
+		return 100
+	}
+	return percent
+}
+
+// Encode returns the progress as event data.
+func (p TransferProgress) Encode() string {
+	data, _ := json.Marshal(p)
+	return string(data)
+}
+
+// DecodeTransferProgress parses the data of TransferProgressEvent.
+func DecodeTransferProgress(data string) (progress TransferProgress, err error) {
+	err = json.Unmarshal([]byte(data), &progress)
+	return
+}
+
+// TransferProgressReporter emits TransferProgressEvent for one transfer.
+type TransferProgressReporter struct {
+	lock     sync.Mutex
+	listener listener.Listener
+	progress TransferProgress
+
+	start    time.Time
+	lastEmit time.Time
+}
+
+// NewTransferProgressReporter returns reporter of the transfer described
+// by progress. The listener can be nil, then nothing is emitted.
+func NewTransferProgressReporter(listener listener.Listener, progress TransferProgress) *TransferProgressReporter {
+	return &TransferProgressReporter{
+		listener: listener,
+		progress: progress,
+		start:    time.Now(),
+	}
+}
+
+// Update sets the number of transferred bytes. It has the signature
+// of pmapi.ProgressFunc.
+func (r *TransferProgressReporter) Update(transferred, total int64) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.progress.Transferred = transferred
+	r.progress.Total = total
+
+	now := time.Now()
+	if now.Sub(r.start) < transferProgressEmitInterval || now.Sub(r.lastEmit) < transferProgressEmitInterval {
+		return
+	}
+	r.lastEmit = now
+	r.emit()
+}
+
+// Finish emits the final event if any progress of the transfer was emitted.
+func (r *TransferProgressReporter) Finish() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.lastEmit.IsZero() {
+		return
+	}
+	r.progress.Finished = true
+	r.emit()
+}
+
+func (r *TransferProgressReporter) emit() {
+	if r.listener != nil {
+		r.listener.Emit(TransferProgressEvent, r.progress.Encode())
+	}
+}
@@ -58,6 +58,16 @@ func (c *appleMail) Configure(imapPort, smtpPort int, imapSSL, smtpSSL bool, use
 			}
 		}
 		addresses = displayName
+
+		// In hybrid mode the address shares the login with its group.
+		for _, group := range user.GetAddressGroups() {
+			for _, address := range group {
+				if address == displayName {
+					displayName = group[0]
+					addresses = strings.Join(group, ",")
+				}
+			}
+		}
 	}
 
 	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
@@ -19,9 +19,11 @@ package cli
 
 import (
 	"strings"
+	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
+	"github.com/ProtonMail/proton-bridge/internal/imap"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/abiosoft/ishell"
 )
@@ -37,6 +39,8 @@ func (f *frontendCLI) listAccounts(c *ishell.Context) {
 		mode := "split"
 		if user.IsCombinedAddressMode() {
 			mode = "combined"
+		} else if user.IsHybridAddressMode() {
+			mode = "hybrid"
 		}
 		f.Printf(spacing, idx, user.Username(), connected, mode)
 	}
@@ -54,12 +58,11 @@ func (f *frontendCLI) showAccountInfo(c *ishell.Context) {
 		return
 	}
 
-	if user.IsCombinedAddressMode() {
-		f.showAccountAddressInfo(user, user.GetPrimaryAddress())
-	} else {
-		for _, address := range user.GetAddresses() {
-			f.showAccountAddressInfo(user, address)
+	for _, group := range user.GetAddressGroups() {
+		if user.IsHybridAddressMode() {
+			f.Printf("Address group: %s\n", strings.Join(group, ", "))
 		}
+		f.showAccountAddressInfo(user, group[0])
 	}
 }
 
@@ -217,3 +220,254 @@ func (f *frontendCLI) changeMode(c *ishell.Context) {
 	}
 	f.Printf("Address mode for account %s changed to %s\n", user.Username(), newMode)
 }
+
+func (f *frontendCLI) changeAddressGroups(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	f.Println("Addresses of the account:")
+	for _, address := range user.GetAddresses() {
+		f.Println("  " + address)
+	}
+	f.Println("Addresses in one group share one login; groups are separated by semicolon, addresses by comma.")
+	f.Println("Addresses not listed in any group stay together with the primary address.")
+	f.Print("Groups: ")
+
+	groups := [][]string{}
+	for _, groupLine := range strings.Split(c.ReadLine(), ";") {
+		group := []string{}
+		for _, address := range strings.Split(groupLine, ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				group = append(group, address)
+			}
+		}
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 0 {
+		f.Println("No groups entered, nothing changed.")
+		return
+	}
+
+	if !f.yesNoQuestion("Are you sure you want to change the mode for account " + bold(user.Username()) + " to " + bold("hybrid mode")) {
+		return
+	}
+	if err := user.SetAddressGroups(groups); err != nil {
+		f.printAndLogError("Cannot set address groups:", err)
+		return
+	}
+	f.Printf("Address mode for account %s changed to hybrid mode\n", user.Username())
+}
+
+func (f *frontendCLI) showSyncStatus(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	progress, err := user.GetSyncProgress()
+	if err != nil {
+		f.printAndLogError("Cannot get sync status: ", err)
+		return
+	}
+	f.Printf("Sync of %s: %s\n", bold(user.Username()), formatSyncProgress(progress))
+}
+
+func (f *frontendCLI) pauseSync(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+	if err := user.PauseSync(); err != nil {
+		f.printAndLogError("Cannot pause sync: ", err)
+		return
+	}
+	f.Printf("Sync of %s is paused.\n", bold(user.Username()))
+}
+
+func (f *frontendCLI) resumeSync(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+	if err := user.ResumeSync(); err != nil {
+		f.printAndLogError("Cannot resume sync: ", err)
+		return
+	}
+	f.Printf("Sync of %s is resumed.\n", bold(user.Username()))
+}
+
+func (f *frontendCLI) resyncAccount(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+	if !f.yesNoQuestion("Are you sure you want to download all messages of " + bold(user.Username()) + " again") {
+		return
+	}
+	if err := user.Resync(); err != nil {
+		f.printAndLogError("Cannot start resync: ", err)
+		return
+	}
+	f.Printf("Resync of %s started.\n", bold(user.Username()))
+}
+
+func (f *frontendCLI) checkStore(c *ishell.Context) {
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	report, err := user.CheckStore(false)
+	if err != nil {
+		f.printAndLogError("Cannot check store: ", err)
+		return
+	}
+	f.printStoreReport(user.Username(), report)
+	if report.Unfixed() > 0 {
+		f.Println("Use `store repair` to fix the issues.")
+	}
+}
+
+func (f *frontendCLI) repairStore(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+	if !f.yesNoQuestion("Are you sure you want to repair the local cache of " + bold(user.Username())) {
+		return
+	}
+
+	report, err := user.CheckStore(true)
+	if err != nil {
+		f.printAndLogError("Cannot repair store: ", err)
+		return
+	}
+	f.printStoreReport(user.Username(), report)
+	if report.UIDValidityChanged {
+		f.Println("Some mailboxes were rebuilt, email clients will download their messages again.")
+	}
+	if report.Unfixed() > 0 {
+		f.Println("Remaining issues can be fixed only by `sync resync`.")
+	}
+}
+
+func (f *frontendCLI) exportAccount(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	opts := imap.ExportOptions{}
+	opts.Format = f.readStringInAttempts("Format (mbox or maildir)", c.ReadLine, isExportFormat)
+	if opts.Format == "" {
+		return
+	}
+	if opts.Path = f.readStringInAttempts("Directory", c.ReadLine, isNotEmpty); opts.Path == "" {
+		return
+	}
+
+	f.Print("Mailboxes separated by comma (empty for all): ")
+	for _, mailbox := range strings.Split(c.ReadLine(), ",") {
+		if mailbox = strings.TrimSpace(mailbox); mailbox != "" {
+			opts.Mailboxes = append(opts.Mailboxes, mailbox)
+		}
+	}
+
+	var ok bool
+	if opts.After, ok = f.readExportDate(c, "Export messages since (YYYY-MM-DD, empty for no limit)"); !ok {
+		return
+	}
+	if opts.Before, ok = f.readExportDate(c, "Export messages before (YYYY-MM-DD, empty for no limit)"); !ok {
+		return
+	}
+
+	f.Printf("Exporting %s to %s...\n", bold(user.Username()), opts.Path)
+	err := f.importExporter.ExportUser(user.ID(), opts, func(progress imap.ExportProgress) {
+		if progress.Exported+progress.Skipped == progress.Total {
+			f.Printf("%s/%s: %d exported, %d skipped\n", progress.Address, progress.Mailbox, progress.Exported, progress.Skipped)
+		}
+	})
+	if err != nil {
+		f.printAndLogError("Export failed, run it again to continue: ", err)
+		return
+	}
+	f.Println("Export finished.")
+}
+
+func (f *frontendCLI) importAccount(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	user := f.askUserByIndexOrName(c)
+	if user == nil {
+		return
+	}
+
+	opts := imap.ImportOptions{}
+	opts.Format = f.readStringInAttempts("Format (mbox or maildir)", c.ReadLine, isExportFormat)
+	if opts.Format == "" {
+		return
+	}
+	if opts.Path = f.readStringInAttempts("Directory or mbox file", c.ReadLine, isNotEmpty); opts.Path == "" {
+		return
+	}
+
+	f.Printf("Import to address (empty for %s): ", user.GetPrimaryAddress())
+	opts.Address = strings.TrimSpace(c.ReadLine())
+
+	f.Printf("Importing %s to %s...\n", opts.Path, bold(user.Username()))
+	report, err := f.importExporter.ImportUser(user.ID(), opts, func(progress imap.ImportProgress) {
+		if progress.Imported+progress.Failed+progress.Skipped == progress.Total {
+			f.Printf("%s: %d imported, %d failed, %d skipped\n", progress.Folder, progress.Imported, progress.Failed, progress.Skipped)
+		}
+	})
+	if report != nil && len(report.Failures) > 0 {
+		f.Println("Messages which were not imported:")
+		for _, failure := range report.Failures {
+			f.Println("  " + failure.String())
+		}
+	}
+	if err != nil {
+		f.printAndLogError("Import failed, run it again to continue: ", err)
+		return
+	}
+	if len(report.Failures) > 0 {
+		f.Println("Import finished with failures, run it again to retry failed messages.")
+		return
+	}
+	f.Println("Import finished.")
+}
+
+func isExportFormat(format string) bool {
+	return format == imap.ExportMbox || format == imap.ExportMaildir
+}
+
+func (f *frontendCLI) readExportDate(c *ishell.Context, title string) (date time.Time, ok bool) {
+	f.Printf("%s: ", title)
+	value := strings.TrimSpace(c.ReadLine())
+	if value == "" {
+		return time.Time{}, true
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		f.Println("Wrong date format, expected YYYY-MM-DD.")
+		return time.Time{}, false
+	}
+	return date, true
+}
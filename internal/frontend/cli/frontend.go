@@ -35,11 +35,12 @@ var (
 type frontendCLI struct {
 	*ishell.Shell
 
-	config        *config.Config
-	preferences   *config.Preferences
-	eventListener listener.Listener
-	updates       types.Updater
-	bridge        types.Bridger
+	config         *config.Config
+	preferences    *config.Preferences
+	eventListener  listener.Listener
+	updates        types.Updater
+	bridge         types.Bridger
+	importExporter types.ImportExporter
 
 	appRestart bool
 }
@@ -52,15 +53,17 @@ func New( //nolint[funlen]
 	eventListener listener.Listener,
 	updates types.Updater,
 	bridge types.Bridger,
+	importExporter types.ImportExporter,
 ) *frontendCLI { //nolint[golint]
 	fe := &frontendCLI{
 		Shell: ishell.New(),
 
-		config:        config,
-		preferences:   preferences,
-		eventListener: eventListener,
-		updates:       updates,
-		bridge:        bridge,
+		config:         config,
+		preferences:    preferences,
+		eventListener:  eventListener,
+		updates:        updates,
+		bridge:         bridge,
+		importExporter: importExporter,
 
 		appRestart: false,
 	}
@@ -93,6 +96,12 @@ func New( //nolint[funlen]
 		Func:      fe.changeMode,
 		Completer: fe.completeUsernames,
 	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "groups",
+		Help:      "switch account to hybrid mode with groups of addresses having their own login. Use index or account name as parameter. (alias: g)",
+		Aliases:   []string{"g"},
+		Func:      fe.changeAddressGroups,
+		Completer: fe.completeUsernames,
+	})
 	changeCmd.AddCmd(&ishell.Cmd{Name: "port",
 		Help:    "change port numbers of IMAP and SMTP servers. (alias: p)",
 		Aliases: []string{"p"},
@@ -102,6 +111,10 @@ func New( //nolint[funlen]
 		Help: "allow or disallow bridge to securely connect to proton via a third party when it is being blocked",
 		Func: fe.toggleAllowProxy,
 	})
+	changeCmd.AddCmd(&ishell.Cmd{Name: "proxy-server",
+		Help: "set HTTP or SOCKS5 proxy server used to connect to proton, e.g. socks5://127.0.0.1:9050. Use empty value to connect directly",
+		Func: fe.changeProxyServer,
+	})
 	changeCmd.AddCmd(&ishell.Cmd{Name: "smtp-security",
 		Help:    "change port numbers of IMAP and SMTP servers.(alias: ssl, starttls)",
 		Aliases: []string{"ssl", "starttls"},
@@ -175,6 +188,64 @@ func New( //nolint[funlen]
 		Completer: fe.completeUsernames,
 	})
 
+	// Sync commands.
+	syncCmd := &ishell.Cmd{Name: "sync",
+		Help:    "show or control the synchronisation of account messages. (alias: s)",
+		Aliases: []string{"s"},
+	}
+	syncCmd.AddCmd(&ishell.Cmd{Name: "status",
+		Help:      "print the sync progress of the account. Use index or account name as parameter. (aliases: st, show)",
+		Aliases:   []string{"st", "show"},
+		Func:      fe.noAccountWrapper(fe.showSyncStatus),
+		Completer: fe.completeUsernames,
+	})
+	syncCmd.AddCmd(&ishell.Cmd{Name: "pause",
+		Help:      "pause the sync of the account. Use index or account name as parameter. (alias: p)",
+		Aliases:   []string{"p"},
+		Func:      fe.noAccountWrapper(fe.pauseSync),
+		Completer: fe.completeUsernames,
+	})
+	syncCmd.AddCmd(&ishell.Cmd{Name: "resume",
+		Help:      "resume the paused sync of the account. Use index or account name as parameter. (alias: r)",
+		Aliases:   []string{"r"},
+		Func:      fe.noAccountWrapper(fe.resumeSync),
+		Completer: fe.completeUsernames,
+	})
+	syncCmd.AddCmd(&ishell.Cmd{Name: "resync",
+		Help:      "forget the synced state and download all messages of the account again. Use index or account name as parameter.",
+		Func:      fe.noAccountWrapper(fe.resyncAccount),
+		Completer: fe.completeUsernames,
+	})
+	fe.AddCmd(syncCmd)
+
+	// Store commands.
+	storeCmd := &ishell.Cmd{Name: "store",
+		Help: "check or repair the local cache of account messages.",
+	}
+	storeCmd.AddCmd(&ishell.Cmd{Name: "check",
+		Help:      "check the consistency of the local cache of the account. Use index or account name as parameter.",
+		Func:      fe.noAccountWrapper(fe.checkStore),
+		Completer: fe.completeUsernames,
+	})
+	storeCmd.AddCmd(&ishell.Cmd{Name: "repair",
+		Help:      "fix the inconsistencies of the local cache of the account. Use index or account name as parameter.",
+		Func:      fe.noAccountWrapper(fe.repairStore),
+		Completer: fe.completeUsernames,
+	})
+	fe.AddCmd(storeCmd)
+
+	// Export and import commands.
+	fe.AddCmd(&ishell.Cmd{Name: "export",
+		Help:      "export messages of the account to mbox files or Maildir directories. Use index or account name as parameter.",
+		Func:      fe.noAccountWrapper(fe.exportAccount),
+		Completer: fe.completeUsernames,
+	})
+	fe.AddCmd(&ishell.Cmd{Name: "import",
+		Help:      "import messages from mbox files or Maildir directories to the account. Use index or account name as parameter.",
+		Func:      fe.noAccountWrapper(fe.importAccount),
+		Completer: fe.completeUsernames,
+	})
+
 	// System commands.
 	fe.AddCmd(&ishell.Cmd{Name: "restart",
 		Help: "restart the bridge.",
@@ -198,6 +269,10 @@ func (f *frontendCLI) watchEvents() {
 	addressChangedLogoutCh := f.getEventChannel(events.AddressChangedLogoutEvent)
 	logoutCh := f.getEventChannel(events.LogoutEvent)
 	certIssue := f.getEventChannel(events.TLSCertIssue)
+	syncProgressCh := f.getEventChannel(events.SyncProgressEvent)
+	writeQueueRejectedCh := f.getEventChannel(events.WriteQueueRejectedEvent)
+	apiThrottledCh := f.getEventChannel(events.APIThrottledEvent)
+	transferProgressCh := f.getEventChannel(events.TransferProgressEvent)
 	for {
 		select {
 		case errorDetails := <-errorCh:
@@ -218,6 +293,14 @@ func (f *frontendCLI) watchEvents() {
 			f.notifyLogout(user.Username())
 		case <-certIssue:
 			f.notifyCertIssue()
+		case data := <-syncProgressCh:
+			f.notifySyncProgress(data)
+		case description := <-writeQueueRejectedCh:
+			f.Println("Change made while offline could not be applied:", description)
+		case retryAfter := <-apiThrottledCh:
+			f.Println("Server asked to slow down, requests are paused for", retryAfter)
+		case data := <-transferProgressCh:
+			f.notifyTransferProgress(data)
 		}
 	}
 }
@@ -19,12 +19,13 @@ package cli
 
 import (
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 
-	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/pkg/connection"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/ProtonMail/proton-bridge/pkg/ports"
 	"github.com/abiosoft/ishell"
 )
@@ -42,7 +43,7 @@ func (f *frontendCLI) restart(c *ishell.Context) {
 }
 
 func (f *frontendCLI) checkInternetConnection(c *ishell.Context) {
-	if connection.CheckInternetConnection() == nil {
+	if connection.CheckInternetConnection(f.config.GetAPIConfig().Routing) == nil {
 		f.Println("Internet connection is available.")
 	} else {
 		f.Println("Can not contact server please check you internet connection.")
@@ -135,15 +136,67 @@ func (f *frontendCLI) toggleAllowProxy(c *ishell.Context) {
 		f.Println("Bridge is currently set to use alternative routing to connect to Proton if it is being blocked.")
 		if f.yesNoQuestion("Are you sure you want to stop bridge from doing this") {
 			f.preferences.SetBool(preferences.AllowProxyKey, false)
-			bridge.DisallowDoH()
+			f.config.GetAPIConfig().Routing.DisallowDoH()
 		}
 	} else {
 		f.Println("Bridge is currently set to NOT use alternative routing to connect to Proton if it is being blocked.")
 		if f.yesNoQuestion("Are you sure you want to allow bridge to do this") {
 			f.preferences.SetBool(preferences.AllowProxyKey, true)
-			bridge.AllowDoH()
+			f.config.GetAPIConfig().Routing.AllowDoH()
 		}
 	}
+	if f.preferences.Get(preferences.UserProxyKey) != "" {
+		f.Println("Note: alternative routing is not used while the proxy server is set (see `change proxy-server`).")
+	}
+}
+
+func (f *frontendCLI) changeProxyServer(c *ishell.Context) {
+	f.ShowPrompt(false)
+	defer f.ShowPrompt(true)
+
+	current := f.bridge.GetUserProxy()
+	if current != "" {
+		f.Println("Bridge is currently connecting to Proton through proxy server", redactProxyPassword(current))
+	} else {
+		f.Println("Bridge is currently connecting to Proton directly.")
+	}
+
+	var proxy string
+	if len(c.Args) > 0 {
+		proxy = c.Args[0]
+	} else {
+		f.Println("Use http://[user:password@]host:port or socks5://[user:password@]host:port, e.g. socks5://127.0.0.1:9050 for Tor.")
+		f.Print("Set proxy server (empty to connect directly): ")
+		proxy = strings.TrimSpace(c.ReadLine())
+	}
+
+	if proxy == current {
+		f.Println("Nothing changed")
+		return
+	}
+
+	if err := f.bridge.SetUserProxy(proxy); err != nil {
+		f.Println("Proxy server was not changed:", err)
+		return
+	}
+
+	if proxy == "" {
+		f.Println("Bridge will connect to Proton directly.")
+	} else {
+		f.Println("Bridge will connect to Proton through proxy server", redactProxyPassword(proxy))
+	}
+}
+
+// redactProxyPassword hides the password of the proxy server when shown.
+func redactProxyPassword(proxy string) string {
+	proxyURL, err := pmapi.ParseUserProxy(proxy)
+	if err != nil {
+		return proxy
+	}
+	if _, hasPassword := proxyURL.User.Password(); hasPassword {
+		proxyURL.User = url.UserPassword(proxyURL.User.Username(), "xxxxx")
+	}
+	return proxyURL.String()
 }
 
 func (f *frontendCLI) isPortFree(port string) bool {
@@ -18,8 +18,11 @@
 package cli
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/fatih/color"
 )
@@ -92,6 +95,67 @@ func (f *frontendCLI) notifyLogout(address string) {
 	f.Printf("Account %s is disconnected. Login to continue using this account with email client.", address)
 }
 
+func (f *frontendCLI) notifySyncProgress(data string) {
+	progress, err := events.DecodeSyncProgress(data)
+	if err != nil {
+		log.WithError(err).Warn("Cannot decode sync progress")
+		return
+	}
+
+	// Only the end of sync is interesting enough to interrupt the shell.
+	if progress.Phase != events.SyncPhaseFinished && progress.Phase != events.SyncPhaseFailed {
+		return
+	}
+
+	user, err := f.bridge.GetUser(progress.UserID)
+	if err != nil {
+		return
+	}
+	f.Printf("Sync of %s: %s\n", bold(user.Username()), formatSyncProgress(progress))
+}
+
+func formatSyncProgress(progress events.SyncProgress) string {
+	if progress.Phase == "" {
+		return events.SyncPhaseIdle
+	}
+
+	status := fmt.Sprintf("%s %.0f%% (%d/%d)", progress.Phase, progress.Percent(), progress.Processed, progress.Total)
+	if progress.ETA > 0 {
+		status += fmt.Sprintf(", %s remaining", progress.ETA)
+	}
+	return status
+}
+
+// notifyTransferProgress prints progress of attachment transfers. Only
+// transfers taking long enough are reported by the bridge.
+func (f *frontendCLI) notifyTransferProgress(data string) {
+	progress, err := events.DecodeTransferProgress(data)
+	if err != nil {
+		log.WithError(err).Warn("Cannot decode transfer progress")
+		return
+	}
+
+	user, err := f.bridge.GetUser(progress.UserID)
+	if err != nil {
+		return
+	}
+	f.Printf("%s of attachment %s of %s: %s\n", formatTransferDirection(progress.Direction), progress.Name, bold(user.Username()), formatTransferProgress(progress))
+}
+
+func formatTransferDirection(direction string) string {
+	if direction == events.TransferUpload {
+		return "Upload"
+	}
+	return "Download"
+}
+
+func formatTransferProgress(progress events.TransferProgress) string {
+	if progress.Finished {
+		return "finished"
+	}
+	return fmt.Sprintf("%.0f%% (%d/%d bytes)", progress.Percent(), progress.Transferred, progress.Total)
+}
+
 func (f *frontendCLI) notifyNeedUpgrade() {
 	f.Println("Please download and install the newest version of application from", f.updates.GetDownloadLink())
 }
@@ -121,3 +185,14 @@ Recommendation:
   a different network to access ProtonMail.
 `)
 }
+
+func (f *frontendCLI) printStoreReport(username string, report *store.IntegrityReport) {
+	if len(report.Issues) == 0 {
+		f.Printf("Local cache of %s is consistent.\n", bold(username))
+		return
+	}
+	f.Printf("Local cache of %s has %d issues (%d not fixed):\n", bold(username), len(report.Issues), report.Unfixed())
+	for _, issue := range report.Issues {
+		f.Println("  " + issue.String())
+	}
+}
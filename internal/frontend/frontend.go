@@ -60,9 +60,10 @@ func New(
 	updates types.Updater,
 	bridge *bridge.Bridge,
 	noEncConfirmator types.NoEncConfirmator,
+	importExporter types.ImportExporter,
 ) Frontend {
 	bridgeWrap := types.NewBridgeWrap(bridge)
-	return new(version, buildVersion, frontendType, showWindowOnStart, panicHandler, config, preferences, eventListener, updates, bridgeWrap, noEncConfirmator)
+	return new(version, buildVersion, frontendType, showWindowOnStart, panicHandler, config, preferences, eventListener, updates, bridgeWrap, noEncConfirmator, importExporter)
 }
 
 func new(
@@ -77,10 +78,11 @@ func new(
 	updates types.Updater,
 	bridge types.Bridger,
 	noEncConfirmator types.NoEncConfirmator,
+	importExporter types.ImportExporter,
 ) Frontend {
 	switch frontendType {
 	case "cli":
-		return cli.New(panicHandler, config, preferences, eventListener, updates, bridge)
+		return cli.New(panicHandler, config, preferences, eventListener, updates, bridge, importExporter)
 	default:
 		return qt.New(version, buildVersion, showWindowOnStart, panicHandler, config, preferences, eventListener, updates, bridge, noEncConfirmator)
 	}
@@ -254,6 +254,59 @@ Column {
             }
         }
 
+        Rectangle {
+            id: syncStatusWrapper
+            anchors {
+                left  : parent.left
+                right : parent.right
+            }
+            visible : mainaccRow.state=="expanded" && syncStatus!=""
+            height  : 2*Style.accounts.heightAddrRow/3
+            color   : Style.accounts.backgroundExpanded
+
+            Text {
+                id: syncStatusText
+                anchors {
+                    top        : syncStatusWrapper.top
+                    left       : syncStatusWrapper.left
+                    leftMargin : Style.accounts.leftMarginAddr+Style.main.leftMargin
+                }
+                font.pointSize : Style.main.fontSize * Style.pt
+                color          : Style.main.textDisabled
+                text           : syncStatus
+            }
+
+            ClickIconText {
+                id: resyncAccount
+                anchors {
+                    top         : syncStatusWrapper.top
+                    right       : syncStatusWrapper.right
+                    rightMargin : Style.main.rightMargin
+                }
+                textColor   : Style.main.textBlue
+                iconText    : Style.fa.refresh
+                iconOnRight : false
+                text        : qsTr("Resync", "Text of button downloading all messages of the account again")
+                onClicked   : go.resyncAccount(root.iAccount)
+            }
+
+            ClickIconText {
+                id: pauseSync
+                anchors {
+                    top         : syncStatusWrapper.top
+                    right       : resyncAccount.left
+                    rightMargin : Style.main.rightMargin
+                }
+                textColor   : Style.main.textBlue
+                iconText    : isSyncPaused ? Style.fa.play : Style.fa.pause
+                iconOnRight : false
+                text        : isSyncPaused ?
+                qsTr("Resume sync", "Text of button continuing the paused synchronisation of the account") :
+                qsTr("Pause sync", "Text of button pausing the synchronisation of the account")
+                onClicked   : isSyncPaused ? go.resumeSync(root.iAccount) : go.pauseSync(root.iAccount)
+            }
+        }
+
         Repeater {
             id: repeaterAddresses
             model: ["one", "two"]
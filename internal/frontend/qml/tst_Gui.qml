@@ -228,9 +228,9 @@ Window {
 
         ListModel{
             id: accountsModel
-            ListElement{ account : "bridge"                                           ; status : "connected";    isExpanded: false; isCombinedAddressMode: false; hostname : "127.0.0.1"; password : "ZI9tKp+ryaxmbpn2E12"; security : "StarTLS"; portSMTP : 1025; portIMAP : 1143; aliases : "bridge@pm.com;bridge2@pm.com;theHorriblySlowMurderWithExtremelyInefficientWeapon@youtube.com" }
-            ListElement{ account : "exteremelongnamewhichmustbeeladed@protonmail.com" ; status : "connected";    isExpanded: true;  isCombinedAddressMode: true;  hostname : "127.0.0.1"; password : "ZI9tKp+ryaxmbpn2E12"; security : "StarTLS"; portSMTP : 1025; portIMAP : 1143; aliases : "bridge@pm.com;bridge2@pm.com;hu@hu.hu"                                                        }
-            ListElement{ account : "bridge2@protonmail.com"                           ; status : "disconnected"; isExpanded: false; isCombinedAddressMode: false; hostname : "127.0.0.1"; password : "ZI9tKp+ryaxmbpn2E12"; security : "StarTLS"; portSMTP : 1025; portIMAP : 1143; aliases : "bridge@pm.com;bridge2@pm.com;hu@hu.hu"                                                        }
+            ListElement{ account : "bridge"                                           ; status : "connected";    isExpanded: false; isCombinedAddressMode: false; syncStatus: "Synchronising (syncing) 42%, 3m0s remaining"; isSyncPaused: false; hostname : "127.0.0.1"; password : "ZI9tKp+ryaxmbpn2E12"; security : "StarTLS"; portSMTP : 1025; portIMAP : 1143; aliases : "bridge@pm.com;bridge2@pm.com;theHorriblySlowMurderWithExtremelyInefficientWeapon@youtube.com" }
+            ListElement{ account : "exteremelongnamewhichmustbeeladed@protonmail.com" ; status : "connected";    isExpanded: true;  isCombinedAddressMode: true;  syncStatus: "Synchronised"; isSyncPaused: false; hostname : "127.0.0.1"; password : "ZI9tKp+ryaxmbpn2E12"; security : "StarTLS"; portSMTP : 1025; portIMAP : 1143; aliases : "bridge@pm.com;bridge2@pm.com;hu@hu.hu"                                                        }
+            ListElement{ account : "bridge2@protonmail.com"                           ; status : "disconnected"; isExpanded: false; isCombinedAddressMode: false; syncStatus: ""; isSyncPaused: false; hostname : "127.0.0.1"; password : "ZI9tKp+ryaxmbpn2E12"; security : "StarTLS"; portSMTP : 1025; portIMAP : 1143; aliases : "bridge@pm.com;bridge2@pm.com;hu@hu.hu"                                                        }
         }
 
         Component.onCompleted : {
@@ -346,6 +346,21 @@ Window {
             workAndClose()
         }
 
+        function pauseSync(index) {
+            accountsModel.get(index).isSyncPaused = true
+            accountsModel.get(index).syncStatus = "Synchronisation paused at 42%"
+        }
+
+        function resumeSync(index) {
+            accountsModel.get(index).isSyncPaused = false
+            accountsModel.get(index).syncStatus = "Synchronising (syncing) 42%"
+        }
+
+        function resyncAccount(index) {
+            accountsModel.get(index).isSyncPaused = false
+            accountsModel.get(index).syncStatus = "Synchronising (preparing) 0%"
+        }
+
         function login(username,password) {
             delay(700)
             if (password=="wrong") {
@@ -389,7 +404,9 @@ Window {
                 "portSMTP" : 1025,
                 "portIMAP" : 1143,
                 "aliases" : "bridge@pm.com;bridges@pm.com;theHorriblySlowMurderWithExtremelyInefficientWeapon@youtube.com",
-                "isCombinedAddressMode": true
+                "isCombinedAddressMode": true,
+                "syncStatus": "Synchronising (preparing) 0%",
+                "isSyncPaused": false
             })
             workAndClose()
         }
@@ -41,6 +41,8 @@ type AccountInfo struct {
 	_ string `property:"aliases"`
 	_ bool   `property:"isExpanded"`
 	_ bool   `property:"isCombinedAddressMode"`
+	_ string `property:"syncStatus"`
+	_ bool   `property:"isSyncPaused"`
 }
 
 // Constants for data map.
@@ -57,6 +59,8 @@ const (
 	Aliases
 	IsExpanded
 	IsCombinedAddressMode
+	SyncStatus
+	IsSyncPaused
 )
 
 // Registration of new metatype before creating instance.
@@ -114,6 +118,8 @@ func (s *AccountsModel) init() {
 		Aliases:               NewQByteArrayFromString("aliases"),
 		IsExpanded:            NewQByteArrayFromString("isExpanded"),
 		IsCombinedAddressMode: NewQByteArrayFromString("isCombinedAddressMode"),
+		SyncStatus:            NewQByteArrayFromString("syncStatus"),
+		IsSyncPaused:          NewQByteArrayFromString("isSyncPaused"),
 	})
 	// Basic QAbstractListModel methods.
 	s.ConnectData(s.data)
@@ -171,6 +177,10 @@ func (s *AccountsModel) data(index *core.QModelIndex, role int) *core.QVariant {
 		return NewQVariantBool(p.IsExpanded())
 	case IsCombinedAddressMode:
 		return NewQVariantBool(p.IsCombinedAddressMode())
+	case SyncStatus:
+		return NewQVariantString(p.SyncStatus())
+	case IsSyncPaused:
+		return NewQVariantBool(p.IsSyncPaused())
 	default:
 		return core.NewQVariant()
 	}
@@ -214,6 +224,20 @@ func (s *AccountsModel) toggleIsAvailable(row int) {
 	s.DataChanged(pIndex, pIndex, []int{Status})
 }
 
+// setSyncStatus updates the sync status of the account with `userID`.
+func (s *AccountsModel) setSyncStatus(userID, status string, isPaused bool) {
+	for row, p := range s.Accounts() {
+		if p.UserID() != userID {
+			continue
+		}
+		p.SetSyncStatus(status)
+		p.SetIsSyncPaused(isPaused)
+		var pIndex = s.Index(row, 0, core.NewQModelIndex())
+		s.DataChanged(pIndex, pIndex, []int{SyncStatus, IsSyncPaused})
+		return
+	}
+}
+
 // Method connected to removeAccount slot.
 func (s *AccountsModel) removeAccount(row int) {
 	s.BeginRemoveRows(core.NewQModelIndex(), row, row)
@@ -25,6 +25,7 @@ import (
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/frontend/types"
 	"github.com/ProtonMail/proton-bridge/internal/preferences"
 	"github.com/ProtonMail/proton-bridge/pkg/keychain"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -71,6 +72,12 @@ func (s *FrontendQt) loadAccounts() {
 		acc_info.SetIsExpanded(user.ID() == s.userIDAdded)
 		acc_info.SetIsCombinedAddressMode(user.IsCombinedAddressMode())
 
+		// Set sync status.
+		if progress, err := user.GetSyncProgress(); err == nil {
+			acc_info.SetSyncStatus(formatSyncStatus(progress))
+			acc_info.SetIsSyncPaused(progress.Phase == events.SyncPhasePaused)
+		}
+
 		s.Accounts.addAccount(acc_info)
 	}
 
@@ -114,6 +121,105 @@ func (s *FrontendQt) logoutAccount(iAccount int) {
 	}
 }
 
+func (s *FrontendQt) pauseSync(iAccount int) {
+	s.controlSync(iAccount, "pausing sync", types.BridgeUser.PauseSync)
+}
+
+func (s *FrontendQt) resumeSync(iAccount int) {
+	s.controlSync(iAccount, "resuming sync", types.BridgeUser.ResumeSync)
+}
+
+func (s *FrontendQt) resyncAccount(iAccount int) {
+	s.controlSync(iAccount, "starting resync", types.BridgeUser.Resync)
+}
+
+func (s *FrontendQt) controlSync(iAccount int, action string, control func(types.BridgeUser) error) {
+	userID := s.Accounts.get(iAccount).UserID()
+	user, err := s.bridge.GetUser(userID)
+	if err != nil {
+		log.Error("While ", action, " of ", userID, ": ", err)
+		return
+	}
+	if err := control(user); err != nil {
+		log.Error("While ", action, " of ", userID, ": ", err)
+	}
+}
+
+// updateSyncStatus shows the progress received in SyncProgressEvent.
+func (s *FrontendQt) updateSyncStatus(data string) {
+	progress, err := events.DecodeSyncProgress(data)
+	if err != nil {
+		log.WithError(err).Warn("Cannot decode sync progress")
+		return
+	}
+
+	accountMutex.Lock()
+	defer accountMutex.Unlock()
+
+	s.Accounts.setSyncStatus(progress.UserID, formatSyncStatus(progress), progress.Phase == events.SyncPhasePaused)
+}
+
+// formatSyncStatus returns the text shown in the account details.
+func formatSyncStatus(progress events.SyncProgress) string {
+	switch progress.Phase {
+	case "", events.SyncPhaseIdle:
+		return ""
+	case events.SyncPhaseFinished:
+		return "Synchronised"
+	case events.SyncPhaseFailed:
+		return "Synchronisation failed"
+	}
+
+	status := fmt.Sprintf("Synchronising (%s) %.0f%%", progress.Phase, progress.Percent())
+	if progress.Phase == events.SyncPhasePaused {
+		status = fmt.Sprintf("Synchronisation paused at %.0f%%", progress.Percent())
+	}
+	if progress.ETA > 0 {
+		status += fmt.Sprintf(", %s remaining", progress.ETA)
+	}
+	return status
+}
+
+// updateTransferStatus shows the progress received in TransferProgressEvent
+// in place of the sync status. The sync status is shown again once
+// the transfer is finished.
+func (s *FrontendQt) updateTransferStatus(data string) {
+	progress, err := events.DecodeTransferProgress(data)
+	if err != nil {
+		log.WithError(err).Warn("Cannot decode transfer progress")
+		return
+	}
+
+	status := formatTransferStatus(progress)
+	isPaused := false
+	if progress.Finished {
+		user, err := s.bridge.GetUser(progress.UserID)
+		if err != nil {
+			return
+		}
+		syncProgress, err := user.GetSyncProgress()
+		if err != nil {
+			return
+		}
+		status = formatSyncStatus(syncProgress)
+		isPaused = syncProgress.Phase == events.SyncPhasePaused
+	}
+
+	accountMutex.Lock()
+	defer accountMutex.Unlock()
+
+	s.Accounts.setSyncStatus(progress.UserID, status, isPaused)
+}
+
+// formatTransferStatus returns the text shown in the account details.
+func formatTransferStatus(progress events.TransferProgress) string {
+	action := "Downloading"
+	if progress.Direction == events.TransferUpload {
+		action = "Uploading"
+	}
+	return fmt.Sprintf("%s attachment %s %.0f%%", action, progress.Name, progress.Percent())
+}
+
 func (s *FrontendQt) showLoginError(err error, scope string) bool {
 	if err == nil {
 		s.Qml.SetConnectionStatus(true) // If we are here connection is ok.
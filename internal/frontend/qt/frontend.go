@@ -187,6 +187,10 @@ func (s *FrontendQt) watchEvents() {
 	updateApplicationCh := s.getEventChannel(events.UpgradeApplicationEvent)
 	newUserCh := s.getEventChannel(events.UserRefreshEvent)
 	certIssue := s.getEventChannel(events.TLSCertIssue)
+	syncProgressCh := s.getEventChannel(events.SyncProgressEvent)
+	writeQueueRejectedCh := s.getEventChannel(events.WriteQueueRejectedEvent)
+	apiThrottledCh := s.getEventChannel(events.APIThrottledEvent)
+	transferProgressCh := s.getEventChannel(events.TransferProgressEvent)
 	for {
 		select {
 		case errorDetails := <-errorCh:
@@ -226,6 +230,14 @@ func (s *FrontendQt) watchEvents() {
 			s.Qml.LoadAccounts()
 		case <-certIssue:
 			s.Qml.ShowCertIssue()
+		case data := <-syncProgressCh:
+			s.updateSyncStatus(data)
+		case description := <-writeQueueRejectedCh:
+			s.SendNotification(TabAccount, "Change made while offline could not be applied: "+description)
+		case retryAfter := <-apiThrottledCh:
+			s.SendNotification(TabAccount, "Server asked to slow down, requests are paused for "+retryAfter)
+		case data := <-transferProgressCh:
+			s.updateTransferStatus(data)
 		}
 	}
 }
@@ -527,11 +539,11 @@ func (s *FrontendQt) toggleAllowProxy() {
 
 	if s.preferences.GetBool(preferences.AllowProxyKey) {
 		s.preferences.SetBool(preferences.AllowProxyKey, false)
-		bridge.DisallowDoH()
+		s.config.GetAPIConfig().Routing.DisallowDoH()
 		s.Qml.SetIsProxyAllowed(false)
 	} else {
 		s.preferences.SetBool(preferences.AllowProxyKey, true)
-		bridge.AllowDoH()
+		s.config.GetAPIConfig().Routing.AllowDoH()
 		s.Qml.SetIsProxyAllowed(true)
 	}
 }
@@ -568,7 +580,7 @@ func (s *FrontendQt) isSMTPSTARTTLS() bool {
 }
 
 func (s *FrontendQt) checkInternet() {
-	s.Qml.SetConnectionStatus(IsInternetAvailable())
+	s.Qml.SetConnectionStatus(IsInternetAvailable(s.config.GetAPIConfig().Routing))
 }
 
 func (s *FrontendQt) switchAddressModeUser(iAccount int) {
@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/pkg/connection"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/therecipe/qt/core"
 )
 
@@ -64,8 +65,8 @@ func PauseLong() {
 	time.Sleep(3 * time.Second)
 }
 
-func IsInternetAvailable() bool {
-	return connection.CheckInternetConnection() == nil
+func IsInternetAvailable(routing *pmapi.Routing) bool {
+	return connection.CheckInternetConnection(routing) == nil
 }
 
 // FIXME: Not working in test...
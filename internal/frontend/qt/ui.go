@@ -111,6 +111,9 @@ type GoQMLInterface struct {
 	_ func(iAccount int)                         `slot:"logoutAccount"`
 	_ func(iAccount int, iAddress int)           `slot:"configureAppleMail"`
 	_ func(iAccount int)                         `signal:"switchAddressMode"`
+	_ func(iAccount int)                         `slot:"pauseSync"`
+	_ func(iAccount int)                         `slot:"resumeSync"`
+	_ func(iAccount int)                         `slot:"resyncAccount"`
 
 	_ func(login, password string) int      `slot:"login"`
 	_ func(twoFacAuth string) int           `slot:"auth2FA"`
@@ -164,6 +167,9 @@ func (s *GoQMLInterface) SetFrontend(f *FrontendQt) {
 
 	s.ConnectDeleteAccount(f.deleteAccount)
 	s.ConnectLogoutAccount(f.logoutAccount)
+	s.ConnectPauseSync(f.pauseSync)
+	s.ConnectResumeSync(f.resumeSync)
+	s.ConnectResyncAccount(f.resyncAccount)
 	s.ConnectConfigureAppleMail(f.configureAppleMail)
 	s.ConnectLogin(f.login)
 	s.ConnectAuth2FA(f.auth2FA)
@@ -20,6 +20,9 @@ package types
 
 import (
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/internal/imap"
+	"github.com/ProtonMail/proton-bridge/internal/store"
 	pmapi "github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/ProtonMail/proton-bridge/pkg/updates"
 )
@@ -41,6 +44,22 @@ type NoEncConfirmator interface {
 	ConfirmNoEncryption(string, bool)
 }
 
+// Exporter is an interface for exporting messages of the user to local files.
+type Exporter interface {
+	ExportUser(userID string, opts imap.ExportOptions, progress func(imap.ExportProgress)) error
+}
+
+// Importer is an interface for importing messages of the user from local files.
+type Importer interface {
+	ImportUser(userID string, opts imap.ImportOptions, progress func(imap.ImportProgress)) (*imap.ImportReport, error)
+}
+
+// ImportExporter is an interface for transferring messages between the user and local files.
+type ImportExporter interface {
+	Exporter
+	Importer
+}
+
 // Bridger is an interface of bridge needed by frontend.
 type Bridger interface {
 	GetCurrentClient() string
@@ -52,6 +71,8 @@ type Bridger interface {
 	DeleteUser(userID string, clearCache bool) error
 	ReportBug(osType, osVersion, description, accountName, address, emailClient string) error
 	ClearData() error
+	GetUserProxy() string
+	SetUserProxy(proxy string) error
 }
 
 // BridgeUser is an interface of user needed by frontend.
@@ -60,10 +81,18 @@ type BridgeUser interface {
 	Username() string
 	IsConnected() bool
 	IsCombinedAddressMode() bool
+	IsHybridAddressMode() bool
 	GetPrimaryAddress() string
 	GetAddresses() []string
+	GetAddressGroups() [][]string
 	GetBridgePassword() string
 	SwitchAddressMode() error
+	SetAddressGroups(groups [][]string) error
+	GetSyncProgress() (events.SyncProgress, error)
+	PauseSync() error
+	ResumeSync() error
+	Resync() error
+	CheckStore(repair bool) (*store.IntegrityReport, error)
 	Logout() error
 }
 
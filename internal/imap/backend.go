@@ -27,6 +27,7 @@ import (
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	goIMAPBackend "github.com/emersion/go-imap/backend"
 )
 
@@ -49,6 +50,9 @@ type imapBackend struct {
 	imapCache     map[string]map[string]string
 	imapCachePath string
 	imapCacheLock *sync.RWMutex
+
+	// tracer links IMAP commands to API requests they cause.
+	tracer pmapi.Tracer
 }
 
 // NewIMAPBackend returns struct implementing go-imap/backend interface.
@@ -90,6 +94,8 @@ func newIMAPBackend(
 
 		imapCachePath: cfg.GetIMAPCachePath(),
 		imapCacheLock: &sync.RWMutex{},
+
+		tracer: cfg.GetAPIConfig().Tracer,
 	}
 }
 
@@ -114,11 +120,12 @@ func (ib *imapBackend) createUser(address string) (*imapUser, error) {
 		return nil, err
 	}
 
-	// Make sure you return the same user for all valid addresses when in combined mode.
-	if user.IsCombinedAddressMode() {
-		address = strings.ToLower(user.GetPrimaryAddress())
-		if combinedUser, ok := ib.users[address]; ok {
-			return combinedUser, nil
+	// Make sure you return the same user for all addresses of one group
+	// (all valid addresses when in combined mode).
+	if group := user.GetAddressGroup(address); len(group) > 0 {
+		address = strings.ToLower(group[0])
+		if groupUser, ok := ib.users[address]; ok {
+			return groupUser, nil
 		}
 	}
 
@@ -175,7 +182,7 @@ func (ib *imapBackend) Login(username, password string) (goIMAPBackend.User, err
 	// (otherwise the store will be locked for 1 sec per email during synchronization).
 	imapUser.user.SetIMAPIdleUpdateChannel()
 
-	return imapUser, nil
+	return imapUser.forConnection(), nil
 }
 
 // Updates returns a channel of updates for IMAP IDLE extension.
@@ -19,12 +19,14 @@ package imap
 
 import (
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
 type configProvider interface {
 	GetEventsPath() string
 	GetDBDir() string
 	GetIMAPCachePath() string
+	GetAPIConfig() *pmapi.ClientConfig
 }
 
 type bridger interface {
@@ -35,9 +37,10 @@ type bridger interface {
 type bridgeUser interface {
 	ID() string
 	CheckBridgeLogin(password string) error
-	IsCombinedAddressMode() bool
+	GetAddressGroup(address string) []string
 	GetAddressID(address string) (string, error)
 	GetPrimaryAddress() string
+	GetStoreAddresses() []string
 	SetIMAPIdleUpdateChannel()
 	UpdateUser() error
 	Logout() error
@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package cache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+)
+
+// maxMemoryBodySize is the size of built message above which the message
+// is moved from memory to a temporary file.
+const maxMemoryBodySize = 1 << 20 // B
+
+// Body is a built message. Small messages are kept in memory, bigger ones are
+// written to a temporary file as they are being built, so messages with big
+// attachments are never held in memory as a whole. The temporary file is
+// removed once the body is not used anymore.
+type Body struct {
+	buf  bytes.Buffer
+	file *os.File
+	size int64
+}
+
+// NewBody returns empty body ready to be written.
+func NewBody() *Body {
+	return &Body{}
+}
+
+// NewBodyFromBytes returns body with the given content.
+func NewBodyFromBytes(data []byte) *Body {
+	b := &Body{size: int64(len(data))}
+	_, _ = b.buf.Write(data)
+	return b
+}
+
+// Write appends the data to the body. It must not be called once the body
+// is being read.
+func (b *Body) Write(p []byte) (n int, err error) {
+	if b.file == nil && b.buf.Len()+len(p) > maxMemoryBodySize {
+		if err = b.spool(); err != nil {
+			return 0, err
+		}
+	}
+
+	if b.file != nil {
+		n, err = b.file.Write(p)
+	} else {
+		n, err = b.buf.Write(p)
+	}
+	b.size += int64(n)
+	return
+}
+
+// spool moves the body from memory to a temporary file.
+func (b *Body) spool() error {
+	f, err := ioutil.TempFile("", "bridge-message-")
+	if err != nil {
+		return err
+	}
+	if _, err := b.buf.WriteTo(f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	b.buf = bytes.Buffer{}
+	b.file = f
+
+	// Readers of the body can outlive the cache entry, the file is therefore
+	// removed only when nothing refers to the body anymore.
+	runtime.SetFinalizer(b, (*Body).remove)
+	return nil
+}
+
+func (b *Body) remove() {
+	_ = b.file.Close()
+	_ = os.Remove(b.file.Name())
+}
+
+// Len returns the size of the body.
+func (b *Body) Len() int {
+	return int(b.size)
+}
+
+// ReadAt implements io.ReaderAt. It is safe to be used concurrently.
+func (b *Body) ReadAt(p []byte, off int64) (int, error) {
+	if b.file != nil {
+		return b.file.ReadAt(p, off)
+	}
+	return bytes.NewReader(b.buf.Bytes()).ReadAt(p, off)
+}
+
+// NewReader returns reader of the whole body.
+func (b *Body) NewReader() *io.SectionReader {
+	return io.NewSectionReader(b, 0, b.size)
+}
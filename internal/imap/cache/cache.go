@@ -18,7 +18,6 @@
 package cache
 
 import (
-	"bytes"
 	"sort"
 	"sync"
 	"time"
@@ -40,7 +39,7 @@ func (s oldestFirst) Less(i, j int) bool { return s[i].Timestamp < s[j].Timestam
 
 type cachedMessage struct {
 	key
-	data      []byte
+	body      *Body
 	structure backendMessage.BodyStructure
 }
 
@@ -101,12 +100,12 @@ func BuildUnlock(messageID string) {
 	delete(buildLocks, messageID)
 }
 
-func LoadMail(mID string) (reader *bytes.Reader, structure *backendMessage.BodyStructure) {
-	reader = &bytes.Reader{}
+// LoadMail returns the built message or nil when it is not cached.
+func LoadMail(mID string) (body *Body, structure *backendMessage.BodyStructure) {
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 	if message, ok := mailCache[mID]; ok && message.isValidOrDel() {
-		reader = bytes.NewReader(message.data)
+		body = message.body
 		structure = &message.structure
 
 		// Update timestamp to keep emails which are used often.
@@ -115,7 +114,7 @@ func LoadMail(mID string) (reader *bytes.Reader, structure *backendMessage.BodyS
 	return
 }
 
-func SaveMail(mID string, msg []byte, structure *backendMessage.BodyStructure) {
+func SaveMail(mID string, body *Body, structure *backendMessage.BodyStructure) {
 	cacheMutex.Lock()
 	defer cacheMutex.Unlock()
 
@@ -123,9 +122,9 @@ func SaveMail(mID string, msg []byte, structure *backendMessage.BodyStructure) {
 		key: key{
 			ID:        mID,
 			Timestamp: timestamp(),
-			Size:      len(msg),
+			Size:      body.Len(),
 		},
-		data:      msg,
+		body:      body,
 		structure: *structure,
 	}
 
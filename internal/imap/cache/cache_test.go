@@ -20,6 +20,8 @@ package cache
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
 
@@ -33,29 +35,28 @@ const testUID = "testmsg"
 func TestSaveAndLoad(t *testing.T) {
 	msg := []byte("Test message")
 
-	SaveMail(testUID, msg, bs)
-	require.Equal(t, mailCache[testUID].data, msg)
+	SaveMail(testUID, NewBodyFromBytes(msg), bs)
 
-	reader, _ := LoadMail(testUID)
-	require.Equal(t, reader.Len(), len(msg))
-	stored := make([]byte, len(msg))
-	_, _ = reader.Read(stored)
+	body, _ := LoadMail(testUID)
+	require.Equal(t, body.Len(), len(msg))
+	stored, err := ioutil.ReadAll(body.NewReader())
+	require.NoError(t, err)
 	require.Equal(t, stored, msg)
 }
 
 func TestMissing(t *testing.T) {
-	reader, _ := LoadMail("non-existing")
-	require.Equal(t, reader.Len(), 0)
+	body, _ := LoadMail("non-existing")
+	require.Nil(t, body)
 }
 
 func TestClearOld(t *testing.T) {
 	cacheTimeLimit = 10
 	msg := []byte("Test message")
-	SaveMail(testUID, msg, bs)
+	SaveMail(testUID, NewBodyFromBytes(msg), bs)
 	time.Sleep(100 * time.Millisecond)
 
-	reader, _ := LoadMail(testUID)
-	require.Equal(t, reader.Len(), 0)
+	body, _ := LoadMail(testUID)
+	require.Nil(t, body)
 }
 
 func TestClearBig(t *testing.T) {
@@ -68,7 +69,7 @@ func TestClearBig(t *testing.T) {
 	// It should have more than nSize items.
 	for i := 0; i < nSize*nSize; i++ {
 		time.Sleep(1 * time.Millisecond)
-		SaveMail(fmt.Sprintf("%s%d", testUID, i), msg, bs)
+		SaveMail(fmt.Sprintf("%s%d", testUID, i), NewBodyFromBytes(msg), bs)
 		if len(mailCache) > nSize {
 			t.Error("Number of items in cache should not be more than", nSize)
 		}
@@ -77,15 +78,17 @@ func TestClearBig(t *testing.T) {
 	// Check that the oldest are deleted first.
 	for i := 0; i < nSize*nSize; i++ {
 		iUID := fmt.Sprintf("%s%d", testUID, i)
-		reader, _ := LoadMail(iUID)
-		if i < nSize*(nSize-1) && reader.Len() != 0 {
+		body, _ := LoadMail(iUID)
+		if i < nSize*(nSize-1) && body != nil {
 			mail := mailCache[iUID]
-			t.Error("LoadMail should return empty but have:", mail.data, iUID, mail.key.Timestamp)
+			t.Error("LoadMail should return empty but have:", mail.body, iUID, mail.key.Timestamp)
+		}
+		if i < nSize*(nSize-1) {
+			continue
 		}
-		stored := make([]byte, len(msg))
-		_, _ = reader.Read(stored)
 
-		if i >= nSize*(nSize-1) && !bytes.Equal(stored, msg) {
+		stored, _ := ioutil.ReadAll(body.NewReader())
+		if !bytes.Equal(stored, msg) {
 			t.Error("LoadMail returned wrong message:", stored, iUID)
 		}
 	}
@@ -94,6 +97,31 @@ func TestClearBig(t *testing.T) {
 func TestConcurency(t *testing.T) {
 	msg := []byte("Test message")
 	for i := 0; i < 10; i++ {
-		go SaveMail(fmt.Sprintf("%s%d", testUID, i), msg, bs)
+		go SaveMail(fmt.Sprintf("%s%d", testUID, i), NewBodyFromBytes(msg), bs)
+	}
+}
+
+func TestBigBodyInFile(t *testing.T) {
+	msg := bytes.Repeat([]byte("Test message\r\n"), maxMemoryBodySize/10)
+
+	body := NewBody()
+	for i := 0; i < len(msg); i += 1000 {
+		end := i + 1000
+		if end > len(msg) {
+			end = len(msg)
+		}
+		_, err := body.Write(msg[i:end])
+		require.NoError(t, err)
 	}
+	require.NotNil(t, body.file)
+	require.Equal(t, 0, body.buf.Len())
+	require.Equal(t, len(msg), body.Len())
+
+	stored, err := ioutil.ReadAll(body.NewReader())
+	require.NoError(t, err)
+	require.Equal(t, msg, stored)
+
+	body.remove()
+	_, err = os.Stat(body.file.Name())
+	require.True(t, os.IsNotExist(err))
 }
@@ -0,0 +1,350 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Formats supported by ExportUser.
+const (
+	ExportMbox    = "mbox"
+	ExportMaildir = "maildir"
+)
+
+// exportProgressFile keeps IDs of already exported messages so interrupted
+// export can be resumed without writing the same messages again.
+const exportProgressFile = ".bridge-export-progress"
+
+// exportProgressSeparator separates fields of one line of the progress file.
+const exportProgressSeparator = "\t"
+
+// ExportOptions configures ExportUser.
+type ExportOptions struct {
+	// Format is either ExportMbox or ExportMaildir.
+	Format string
+	// Path is the directory where every address gets its own subdirectory.
+	Path string
+	// Mailboxes limits the export to mailboxes with given names.
+	// All mailboxes are exported when empty.
+	Mailboxes []string
+	// After and Before limit the export to messages in the time range.
+	// Zero value means no limit.
+	After, Before time.Time
+}
+
+// ExportProgress is reported after every processed message.
+type ExportProgress struct {
+	Address  string
+	Mailbox  string
+	Exported int
+	Skipped  int
+	Total    int
+}
+
+// messageExporter writes built messages of one mailbox.
+type messageExporter interface {
+	write(m *pmapi.Message, flags []string, keywords []string, body []byte) error
+	// size returns the size of the written output if it is one file.
+	size() (int64, error)
+	// truncate removes output written after the output had the size.
+	truncate(size int64) error
+	close() error
+}
+
+// ExportUser writes decrypted messages of all user's addresses and
+// mailboxes to mbox files or Maildir directories.
+func (ib *imapBackend) ExportUser(userID string, opts ExportOptions, progress func(ExportProgress)) error {
+	if opts.Format != ExportMbox && opts.Format != ExportMaildir {
+		return errors.Errorf("unknown export format %q", opts.Format)
+	}
+
+	user, err := ib.bridge.GetUser(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(opts.Path, 0700); err != nil {
+		return errors.Wrap(err, "cannot create export directory")
+	}
+
+	done, err := loadExportProgress(filepath.Join(opts.Path, exportProgressFile))
+	if err != nil {
+		return err
+	}
+	defer done.close() //nolint[errcheck]
+
+	for _, address := range user.GetStoreAddresses() {
+		addressID, err := user.GetAddressID(address)
+		if err != nil {
+			return err
+		}
+
+		iu, err := newIMAPUser(ib.panicHandler, ib, user, addressID, address)
+		if err != nil {
+			return err
+		}
+
+		keywords := map[string]string{}
+		for _, storeMailbox := range iu.storeAddress.ListMailboxes() {
+			if !storeMailbox.IsSystem() && !storeMailbox.IsFolder() {
+				keywords[storeMailbox.LabelID()] = strings.TrimPrefix(storeMailbox.Name(), store.UserLabelsPrefix)
+			}
+		}
+
+		for _, storeMailbox := range iu.storeAddress.ListMailboxes() {
+			if !opts.includesMailbox(storeMailbox.Name()) {
+				continue
+			}
+
+			im := newIMAPMailbox(ib.panicHandler, iu, storeMailbox)
+			if err := im.export(opts, address, keywords, done, progress); err != nil {
+				return errors.Wrapf(err, "cannot export mailbox %s of %s", storeMailbox.Name(), address)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (opts *ExportOptions) includesMailbox(name string) bool {
+	if len(opts.Mailboxes) == 0 {
+		return true
+	}
+	for _, mailbox := range opts.Mailboxes {
+		if strings.EqualFold(mailbox, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts *ExportOptions) includesTime(unixTime int64) bool {
+	t := time.Unix(unixTime, 0)
+	if !opts.After.IsZero() && t.Before(opts.After) {
+		return false
+	}
+	if !opts.Before.IsZero() && !t.Before(opts.Before) {
+		return false
+	}
+	return true
+}
+
+func (im *imapMailbox) export(
+	opts ExportOptions,
+	address string,
+	labelNames map[string]string,
+	done *exportProgress,
+	progress func(ExportProgress),
+) error {
+	apiIDs, err := im.storeMailbox.GetAPIIDsFromSequenceRange(1, 0)
+	if err != nil {
+		return err
+	}
+
+	mailboxKey := im.storeAddress.AddressID() + "/" + im.storeMailbox.LabelID()
+
+	path := filepath.Join(opts.Path, sanitizeExportPath(address), sanitizeExportPath(im.name))
+	var exporter messageExporter
+	if opts.Format == ExportMbox {
+		exporter, err = newMboxExporter(path + ".mbox")
+	} else {
+		exporter, err = newMaildirExporter(path)
+	}
+	if err != nil {
+		return err
+	}
+	defer exporter.close() //nolint[errcheck]
+
+	// A message written by interrupted export but not saved as exported
+	// would be duplicated; it is removed and written again. The size of
+	// a new mailbox is saved before the first message for the same reason.
+	if size, ok := done.sizes[mailboxKey]; ok {
+		err = exporter.truncate(size)
+	} else {
+		err = done.save(mailboxKey, "", exporter)
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot resume export")
+	}
+	state := ExportProgress{Address: address, Mailbox: im.name, Total: len(apiIDs)}
+	report := func() {
+		if progress != nil {
+			progress(state)
+		}
+	}
+	if len(apiIDs) == 0 {
+		report()
+	}
+
+	for _, apiID := range apiIDs {
+		if done.isDone(mailboxKey, apiID) {
+			state.Skipped++
+			report()
+			continue
+		}
+
+		storeMessage, err := im.storeMailbox.GetMessage(apiID)
+		if err != nil {
+			return err
+		}
+		m := storeMessage.Message()
+		if !opts.includesTime(m.Time) {
+			state.Skipped++
+			report()
+			continue
+		}
+
+		flags := getExportFlags(m)
+		keywords := getExportKeywords(m, labelNames)
+
+		_, body, err := im.buildMessage(m)
+		if _, ok := err.(*doNotCacheError); ok {
+			im.log.WithField("msgID", m.ID).WithError(err).Warn("Exporting message which was not built properly")
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+		// Exported messages are transformed as a whole.
+		content, err := ioutil.ReadAll(body.NewReader())
+		if err != nil {
+			return err
+		}
+
+		if err := exporter.write(m, flags, keywords, content); err != nil {
+			return err
+		}
+		if err := done.save(mailboxKey, apiID, exporter); err != nil {
+			return err
+		}
+
+		state.Exported++
+		report()
+	}
+
+	return exporter.close()
+}
+
+// exportProgress keeps exported messages of every mailbox and the size of
+// its mbox file after the last exported message. Every line of the file is
+// the mailbox key, API ID of the message (empty before the first message)
+// and the size.
+type exportProgress struct {
+	file  *os.File
+	done  map[string]bool
+	sizes map[string]int64
+}
+
+func loadExportProgress(path string) (*exportProgress, error) {
+	progress := &exportProgress{
+		done:  map[string]bool{},
+		sizes: map[string]int64{},
+	}
+
+	if err := progress.load(path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) //nolint[gosec]
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open export progress")
+	}
+	progress.file = f
+
+	return progress, nil
+}
+
+func (progress *exportProgress) load(path string) error {
+	f, err := os.Open(path) //nolint[gosec]
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "cannot read export progress")
+	}
+	defer f.Close() //nolint[errcheck]
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), exportProgressSeparator)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		if fields[1] != "" {
+			progress.done[fields[0]+"/"+fields[1]] = true
+		}
+		progress.sizes[fields[0]] = size
+	}
+	return scanner.Err()
+}
+
+func (progress *exportProgress) isDone(mailboxKey, apiID string) bool {
+	return progress.done[mailboxKey+"/"+apiID]
+}
+
+func (progress *exportProgress) save(mailboxKey, apiID string, exporter messageExporter) error {
+	size, err := exporter.size()
+	if err != nil {
+		return errors.Wrap(err, "cannot get size of export")
+	}
+	line := strings.Join([]string{mailboxKey, apiID, strconv.FormatInt(size, 10)}, exportProgressSeparator)
+	if _, err := fmt.Fprintln(progress.file, line); err != nil {
+		return errors.Wrap(err, "cannot save export progress")
+	}
+	progress.sizes[mailboxKey] = size
+	return nil
+}
+
+func (progress *exportProgress) close() error {
+	return progress.file.Close()
+}
+
+// sanitizeExportPath converts the IMAP name to a relative file path which
+// cannot point outside of the export directory.
+func sanitizeExportPath(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		part = strings.Map(func(r rune) rune {
+			if r == '\\' || r == ':' || r < ' ' {
+				return '_'
+			}
+			return r
+		}, part)
+		if part == "" || part == "." || part == ".." {
+			part = "_"
+		}
+		parts[i] = part
+	}
+	return filepath.Join(parts...)
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func getExportTestMessage() *pmapi.Message {
+	return &pmapi.Message{
+		ID:       "msgID",
+		Time:     1577836800, // 2020-01-01
+		Unread:   0,
+		Flags:    pmapi.FlagReceived | pmapi.FlagReplied,
+		LabelIDs: []string{pmapi.InboxLabel, pmapi.StarredLabel, "labelID"},
+	}
+}
+
+func TestExportMbox(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	m := getExportTestMessage()
+	flags := getExportFlags(m)
+	keywords := getExportKeywords(m, map[string]string{"labelID": "Important"})
+
+	path := filepath.Join(dir, "INBOX.mbox")
+	exporter, err := newMboxExporter(path)
+	require.NoError(t, err)
+	require.NoError(t, exporter.write(m, flags, keywords, []byte("Subject: Hello\r\n\r\nFrom me\r\n>From you\r\n")))
+	require.NoError(t, exporter.close())
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "From MAILER-DAEMON Wed Jan  1 00:00:00 2020\n"+
+		"Status: RO\n"+
+		"X-Status: AF\n"+
+		"X-Keywords: nonjunk, Important\n"+
+		"Subject: Hello\n"+
+		"\n"+
+		">From me\n"+
+		">>From you\n"+
+		"\n", string(content))
+}
+
+func TestExportMboxResumeRemovesUnsavedMessage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	m := getExportTestMessage()
+	body := []byte("Subject: Hello\r\n\r\nBody\r\n")
+	path := filepath.Join(dir, "INBOX.mbox")
+
+	progress, err := loadExportProgress(filepath.Join(dir, exportProgressFile))
+	require.NoError(t, err)
+	exporter, err := newMboxExporter(path)
+	require.NoError(t, err)
+	require.NoError(t, progress.save("mailbox", "", exporter))
+	require.NoError(t, exporter.write(m, nil, nil, body))
+	require.NoError(t, progress.save("mailbox", "msgID", exporter))
+	// Interrupted before the second message was saved as exported.
+	require.NoError(t, exporter.write(m, nil, nil, body))
+	require.NoError(t, exporter.close())
+	require.NoError(t, progress.close())
+
+	progress, err = loadExportProgress(filepath.Join(dir, exportProgressFile))
+	require.NoError(t, err)
+	defer progress.close() //nolint[errcheck]
+	require.True(t, progress.isDone("mailbox", "msgID"))
+	require.False(t, progress.isDone("mailbox", "otherID"))
+
+	exporter, err = newMboxExporter(path)
+	require.NoError(t, err)
+	require.NoError(t, exporter.truncate(progress.sizes["mailbox"]))
+	require.NoError(t, exporter.close())
+
+	content, err := ioutil.ReadFile(path) //nolint[gosec]
+	require.NoError(t, err)
+	require.Equal(t, "From MAILER-DAEMON Wed Jan  1 00:00:00 2020\n"+
+		"Status: O\n"+
+		"Subject: Hello\n"+
+		"\n"+
+		"Body\n"+
+		"\n", string(content))
+}
+
+func TestExportMaildir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "export-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	m := getExportTestMessage()
+	exporter, err := newMaildirExporter(dir)
+	require.NoError(t, err)
+	require.NoError(t, exporter.write(m, getExportFlags(m), []string{"Important"}, []byte("Subject: Hello\r\n\r\nBody\r\n")))
+
+	name := getMaildirName(m, getExportFlags(m))
+	require.Regexp(t, `^1577836800\.[0-9a-f]{16}\.bridge[:!]2,FRS$`, name)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "cur", name)) //nolint[gosec]
+	require.NoError(t, err)
+	require.Equal(t, "X-Keywords: Important\nSubject: Hello\n\nBody\n", string(content))
+}
+
+func TestExportOptionsFilters(t *testing.T) {
+	opts := ExportOptions{
+		Mailboxes: []string{"inbox"},
+		After:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Before:    time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	require.True(t, opts.includesMailbox("INBOX"))
+	require.False(t, opts.includesMailbox("Sent"))
+	require.True(t, opts.includesTime(1577836800))
+	require.False(t, opts.includesTime(1577836799))
+	require.False(t, opts.includesTime(1580515200))
+}
+
+func TestSanitizeExportPath(t *testing.T) {
+	require.Equal(t, filepath.Join("Folders", "Work"), sanitizeExportPath("Folders/Work"))
+	require.Equal(t, filepath.Join("_", "_", "a_b"), sanitizeExportPath("../../a:b"))
+}
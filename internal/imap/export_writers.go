@@ -0,0 +1,246 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+	"github.com/pkg/errors"
+)
+
+// mboxFromLineRegexp matches lines which must be quoted in mboxrd format.
+var mboxFromLineRegexp = regexp.MustCompile(`(?m)^(>*From )`) //nolint[gochecknoglobals]
+
+// getExportFlags returns IMAP system flags of the message.
+func getExportFlags(m *pmapi.Message) (flags []string) {
+	for _, flag := range message.GetFlags(m) {
+		if strings.HasPrefix(flag, "\\") {
+			flags = append(flags, flag)
+		}
+	}
+	return
+}
+
+// getExportKeywords returns IMAP keywords and names of labels of the message.
+func getExportKeywords(m *pmapi.Message, labelNames map[string]string) (keywords []string) {
+	for _, flag := range message.GetFlags(m) {
+		if !strings.HasPrefix(flag, "\\") {
+			keywords = append(keywords, flag)
+		}
+	}
+	for _, labelID := range m.LabelIDs {
+		if name, ok := labelNames[labelID]; ok {
+			keywords = append(keywords, name)
+		}
+	}
+	return
+}
+
+// prependExportHeaders adds headers with flags which are not part of the
+// built message and converts line endings to LF used by mbox and Maildir.
+func prependExportHeaders(headers []string, body []byte) []byte {
+	buf := &bytes.Buffer{}
+	for _, header := range headers {
+		buf.WriteString(header + "\n")
+	}
+	buf.Write(bytes.Replace(body, []byte("\r\n"), []byte("\n"), -1))
+	return buf.Bytes()
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// mboxExporter appends messages to one file in mboxrd format.
+type mboxExporter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func newMboxExporter(path string) (*mboxExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, errors.Wrap(err, "cannot create mbox directory")
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) //nolint[gosec]
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open mbox")
+	}
+	return &mboxExporter{f: f, w: bufio.NewWriter(f)}, nil
+}
+
+func (e *mboxExporter) write(m *pmapi.Message, flags []string, keywords []string, body []byte) error {
+	status := "O"
+	if hasFlag(flags, imap.SeenFlag) {
+		status = "RO"
+	}
+	xStatus := ""
+	if hasFlag(flags, imap.AnsweredFlag) {
+		xStatus += "A"
+	}
+	if hasFlag(flags, imap.FlaggedFlag) {
+		xStatus += "F"
+	}
+	if hasFlag(flags, imap.DraftFlag) {
+		xStatus += "T"
+	}
+
+	headers := []string{"Status: " + status}
+	if xStatus != "" {
+		headers = append(headers, "X-Status: "+xStatus)
+	}
+	if len(keywords) > 0 {
+		headers = append(headers, "X-Keywords: "+strings.Join(keywords, ", "))
+	}
+
+	content := prependExportHeaders(headers, body)
+	content = mboxFromLineRegexp.ReplaceAll(content, []byte(">$1"))
+	if !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+
+	date := time.Unix(m.Time, 0).UTC().Format(time.ANSIC)
+	if _, err := fmt.Fprintf(e.w, "From MAILER-DAEMON %s\n", date); err != nil {
+		return err
+	}
+	if _, err := e.w.Write(content); err != nil {
+		return err
+	}
+	if _, err := e.w.WriteString("\n"); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *mboxExporter) size() (int64, error) {
+	info, err := e.f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// truncate removes everything written after the given size, i.e. messages
+// written by interrupted export which were not saved as exported.
+func (e *mboxExporter) truncate(size int64) error {
+	current, err := e.size()
+	if err != nil || current <= size {
+		return err
+	}
+	return e.f.Truncate(size)
+}
+
+func (e *mboxExporter) close() error {
+	if e.f == nil {
+		return nil
+	}
+	err := e.w.Flush()
+	if closeErr := e.f.Close(); err == nil {
+		err = closeErr
+	}
+	e.f = nil
+	return err
+}
+
+// maildirExporter writes every message to its own file in cur directory.
+type maildirExporter struct {
+	path string
+}
+
+func newMaildirExporter(path string) (*maildirExporter, error) {
+	for _, dir := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(path, dir), 0700); err != nil {
+			return nil, errors.Wrap(err, "cannot create maildir")
+		}
+	}
+	return &maildirExporter{path: path}, nil
+}
+
+// getMaildirName returns the unique name of the message file with flags
+// in the info part. The name is the same for the same message which makes
+// resumed export idempotent.
+func getMaildirName(m *pmapi.Message, flags []string) string {
+	maildirFlags := []string{}
+	for flag, letter := range map[string]string{
+		imap.DraftFlag:    "D",
+		imap.FlaggedFlag:  "F",
+		imap.AnsweredFlag: "R",
+		imap.SeenFlag:     "S",
+		imap.DeletedFlag:  "T",
+	} {
+		if hasFlag(flags, flag) {
+			maildirFlags = append(maildirFlags, letter)
+		}
+	}
+	sort.Strings(maildirFlags)
+
+	// Colon is not allowed in file names on Windows.
+	infoSeparator := ":"
+	if runtime.GOOS == "windows" {
+		infoSeparator = "!"
+	}
+
+	hash := sha256.Sum256([]byte(m.ID))
+	return fmt.Sprintf("%d.%x.bridge%s2,%s", m.Time, hash[:8], infoSeparator, strings.Join(maildirFlags, ""))
+}
+
+func (e *maildirExporter) write(m *pmapi.Message, flags []string, keywords []string, body []byte) error {
+	headers := []string{}
+	if len(keywords) > 0 {
+		headers = append(headers, "X-Keywords: "+strings.Join(keywords, ", "))
+	}
+
+	name := getMaildirName(m, flags)
+	tmpPath := filepath.Join(e.path, "tmp", name)
+	if err := ioutil.WriteFile(tmpPath, prependExportHeaders(headers, body), 0600); err != nil {
+		return errors.Wrap(err, "cannot write message")
+	}
+	return os.Rename(tmpPath, filepath.Join(e.path, "cur", name))
+}
+
+// size is always zero, messages are written to separate files
+// under stable names which makes repeated writes harmless.
+func (e *maildirExporter) size() (int64, error) {
+	return 0, nil
+}
+
+func (e *maildirExporter) truncate(int64) error {
+	return nil
+}
+
+func (e *maildirExporter) close() error {
+	return nil
+}
@@ -0,0 +1,633 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// importProgressFile keeps source IDs of already imported messages so
+// interrupted import can be resumed without creating duplicates.
+const importProgressFile = ".bridge-import-progress"
+
+const (
+	defaultImportBatchSize     = 10
+	defaultImportBatchInterval = time.Second
+)
+
+// ImportOptions configures ImportUser.
+type ImportOptions struct {
+	// Format is either ExportMbox or ExportMaildir.
+	Format string
+	// Path is the directory with mbox files or Maildir directories
+	// or one mbox file.
+	Path string
+	// Address is the address to import messages to.
+	// The primary address is used when empty.
+	Address string
+	// BatchSize is the number of messages sent in one import request.
+	BatchSize int
+	// BatchInterval is the minimal time between two import requests.
+	BatchInterval time.Duration
+}
+
+// ImportProgress is reported after every processed message.
+type ImportProgress struct {
+	Folder   string
+	Imported int
+	Failed   int
+	Skipped  int
+	Total    int
+}
+
+// ImportFailure describes one message which could not be imported.
+type ImportFailure struct {
+	Source string
+	Error  string
+}
+
+func (f ImportFailure) String() string {
+	return f.Source + ": " + f.Error
+}
+
+// ImportReport is the summary of the finished import.
+type ImportReport struct {
+	Imported int
+	Skipped  int
+	Failures []ImportFailure
+}
+
+// importedMessage is one line of the import progress file.
+type importedMessage struct {
+	apiID     string
+	messageID string
+}
+
+// importer keeps the state shared by all imported folders.
+type importer struct {
+	opts   ImportOptions
+	userID string
+	client bridge.PMAPIProvider
+	labels *importLabels
+
+	address   *pmapi.Address
+	done      map[string]importedMessage
+	byMessage map[string]string // Message-Id -> API ID
+	progress  *os.File
+
+	lastRequest time.Time
+	report      *ImportReport
+}
+
+// pendingImport is a message waiting in the batch for import request.
+type pendingImport struct {
+	source    string
+	messageID string
+	req       *pmapi.ImportMsgReq
+}
+
+// ImportUser uploads messages from mbox files or Maildir directories to the
+// user's address. Folders are mapped to folders and labels, missing ones are
+// created. Messages are encrypted by bridge and uploaded in batches.
+// Messages which failed to import are listed in the report and are tried
+// again when the import is started again with the same path.
+func (ib *imapBackend) ImportUser(userID string, opts ImportOptions, progress func(ImportProgress)) (*ImportReport, error) { //nolint[funlen]
+	if opts.Format != ExportMbox && opts.Format != ExportMaildir {
+		return nil, errors.Errorf("unknown import format %q", opts.Format)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultImportBatchSize
+	}
+	if opts.BatchInterval <= 0 {
+		opts.BatchInterval = defaultImportBatchInterval
+	}
+
+	user, err := ib.bridge.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	address := opts.Address
+	if address == "" {
+		address = user.GetPrimaryAddress()
+	}
+	addressID, err := user.GetAddressID(address)
+	if err != nil {
+		return nil, err
+	}
+	iu, err := newIMAPUser(ib.panicHandler, ib, user, addressID, address)
+	if err != nil {
+		return nil, err
+	}
+	apiAddress := iu.storeAddress.APIAddress()
+	if apiAddress == nil {
+		return nil, errors.New("no available address for encryption")
+	}
+
+	folders, err := findImportFolders(opts.Format, opts.Path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read import path")
+	}
+	sortImportFolders(folders)
+
+	labels, err := newImportLabels(iu.client)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list labels")
+	}
+
+	progressPath := getImportProgressPath(opts.Path)
+	done, err := loadImportProgress(progressPath, user.ID())
+	if err != nil {
+		return nil, err
+	}
+	progressFile, err := os.OpenFile(progressPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600) //nolint[gosec]
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot open import progress")
+	}
+	defer progressFile.Close() //nolint[errcheck]
+
+	imp := &importer{
+		opts:      opts,
+		userID:    user.ID(),
+		client:    iu.client,
+		labels:    labels,
+		address:   apiAddress,
+		done:      done,
+		byMessage: map[string]string{},
+		progress:  progressFile,
+		report:    &ImportReport{},
+	}
+	for _, msg := range done {
+		if msg.messageID != "" {
+			imp.byMessage[msg.messageID] = msg.apiID
+		}
+	}
+
+	for _, folder := range folders {
+		if err := imp.importFolder(folder, progress); err != nil {
+			return imp.report, errors.Wrapf(err, "cannot import %s", folder.name)
+		}
+	}
+
+	return imp.report, nil
+}
+
+// sortImportFolders puts folders before labels so messages present in both
+// are imported to the folder and only labeled later.
+func sortImportFolders(folders []importFolder) {
+	isLabel := func(i int) bool {
+		_, _, exclusive, _ := getImportLabelName(folders[i].name)
+		return !exclusive
+	}
+	sorted := make([]importFolder, 0, len(folders))
+	for i := range folders {
+		if !isLabel(i) {
+			sorted = append(sorted, folders[i])
+		}
+	}
+	for i := range folders {
+		if isLabel(i) {
+			sorted = append(sorted, folders[i])
+		}
+	}
+	copy(folders, sorted)
+}
+
+func (imp *importer) importFolder(folder importFolder, progress func(ImportProgress)) error {
+	systemID, name, exclusive, skip := getImportLabelName(folder.name)
+	if skip {
+		log.WithField("folder", folder.name).Info("Skipping import of folder")
+		return nil
+	}
+
+	folderLabelID := systemID
+	if folderLabelID == "" {
+		var err error
+		if folderLabelID, err = imp.labels.get(name, exclusive); err != nil {
+			return err
+		}
+	}
+
+	state := ImportProgress{Folder: folder.name}
+	report := func() {
+		if progress != nil {
+			progress(state)
+		}
+	}
+
+	// Messages are read twice to know the total count without keeping
+	// whole folder in memory.
+	if err := readImportFolder(imp.opts.Format, folder, func(importMessage) error {
+		state.Total++
+		return nil
+	}); err != nil {
+		return err
+	}
+	if state.Total == 0 {
+		report()
+	}
+
+	batch := []*pendingImport{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		imported, failed, err := imp.importBatch(batch)
+		state.Imported += imported
+		state.Failed += failed
+		batch = batch[:0]
+		report()
+		return err
+	}
+
+	err := readImportFolder(imp.opts.Format, folder, func(msg importMessage) error {
+		if _, ok := imp.done[msg.id]; ok {
+			state.Skipped++
+			imp.report.Skipped++
+			report()
+			return nil
+		}
+
+		pending, err := imp.prepareMessage(msg, folderLabelID, systemID, exclusive)
+		if err != nil {
+			imp.addFailure(msg.id, err)
+			state.Failed++
+			report()
+			return nil
+		}
+		if pending != nil && isMessagePending(batch, pending.messageID) {
+			// The same message waits in the batch; once the batch is
+			// imported, this copy only adds labels to it.
+			if err := flush(); err != nil {
+				return err
+			}
+			if apiID, ok := imp.byMessage[pending.messageID]; ok {
+				if err := imp.labelImported(msg.id, apiID, pending.messageID, pending.req.LabelIDs); err != nil {
+					imp.addFailure(msg.id, err)
+					state.Failed++
+					report()
+					return nil
+				}
+				pending = nil
+			}
+		}
+		if pending == nil {
+			state.Skipped++
+			imp.report.Skipped++
+			report()
+			return nil
+		}
+
+		batch = append(batch, pending)
+		if len(batch) >= imp.opts.BatchSize {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// isMessagePending returns whether message with the Message-Id is already in
+// the batch waiting for upload.
+func isMessagePending(batch []*pendingImport, messageID string) bool {
+	if messageID == "" {
+		return false
+	}
+	for _, pending := range batch {
+		if pending.messageID == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareMessage parses and encrypts the message. It returns nil when the
+// message was already imported from another folder and only labels were
+// added to it.
+func (imp *importer) prepareMessage(msg importMessage, folderLabelID, systemID string, exclusive bool) (*pendingImport, error) {
+	m, _, _, readers, err := message.Parse(bytes.NewReader(msg.body), "", "")
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse message")
+	}
+
+	labelIDs := []string{}
+	if !exclusive {
+		// Import needs at least one system label.
+		labelIDs = append(labelIDs, pmapi.ArchiveLabel)
+	}
+	labelIDs = append(labelIDs, folderLabelID)
+	for _, keyword := range getImportKeywords(msg.body) {
+		if isImportFlagKeyword(keyword) {
+			continue
+		}
+		labelID, err := imp.labels.get(keyword, false)
+		if err != nil {
+			return nil, err
+		}
+		labelIDs = append(labelIDs, labelID)
+	}
+
+	if systemID == pmapi.SentLabel {
+		m.Flags |= pmapi.FlagSent
+	}
+	message.ParseFlags(m, msg.flags)
+	for _, labelID := range m.LabelIDs {
+		if labelID == pmapi.StarredLabel {
+			labelIDs = append(labelIDs, pmapi.StarredLabel)
+		}
+	}
+	labelIDs = uniqueStrings(labelIDs)
+
+	messageID := m.Header.Get("Message-Id")
+	if apiID, ok := imp.byMessage[messageID]; ok && messageID != "" {
+		return nil, imp.labelImported(msg.id, apiID, messageID, labelIDs)
+	}
+
+	// Handle imported messages which have no "Sender" address.
+	if m.Sender == nil {
+		m.Sender = &mail.Address{Address: imp.address.Email}
+	}
+	m.AddressID = imp.address.ID
+
+	body, err := buildImportBody(m, readers, imp.address.KeyRing())
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot encrypt message")
+	}
+
+	req := &pmapi.ImportMsgReq{
+		AddressID: m.AddressID,
+		Body:      body,
+		Unread:    m.Unread,
+		Flags:     m.Flags,
+		Time:      m.Time,
+		LabelIDs:  labelIDs,
+	}
+	if m.Has(pmapi.FlagReplied) {
+		req.IsReplied = 1
+	}
+
+	return &pendingImport{source: msg.id, messageID: messageID, req: req}, nil
+}
+
+// labelImported adds non-exclusive labels to the already imported message.
+func (imp *importer) labelImported(source, apiID, messageID string, labelIDs []string) error {
+	for _, labelID := range labelIDs {
+		if labelID == pmapi.StarredLabel || !pmapi.IsSystemLabel(labelID) && !imp.labels.isExclusive(labelID) {
+			imp.waitForRequest()
+			if err := imp.client.LabelMessages([]string{apiID}, labelID); err != nil {
+				return errors.Wrap(err, "cannot label already imported message")
+			}
+		}
+	}
+	return imp.saveProgress(source, apiID, messageID)
+}
+
+// importBatch uploads the batch. Failures of single messages are added to the
+// report, the returned error means the whole request failed.
+func (imp *importer) importBatch(batch []*pendingImport) (imported, failed int, err error) {
+	reqs := make([]*pmapi.ImportMsgReq, len(batch))
+	for i, pending := range batch {
+		reqs[i] = pending.req
+	}
+
+	imp.waitForRequest()
+	resps, err := imp.client.Import(reqs)
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "import request failed")
+	}
+
+	for i, pending := range batch {
+		if i >= len(resps) {
+			imp.addFailure(pending.source, errors.New("missing import response"))
+			failed++
+			continue
+		}
+		if resps[i].Error != nil {
+			imp.addFailure(pending.source, resps[i].Error)
+			failed++
+			continue
+		}
+		if err := imp.saveProgress(pending.source, resps[i].MessageID, pending.messageID); err != nil {
+			return imported, failed, err
+		}
+		imp.report.Imported++
+		imported++
+	}
+
+	return imported, failed, nil
+}
+
+// waitForRequest makes sure the API is not called more often than
+// configured by BatchInterval.
+func (imp *importer) waitForRequest() {
+	if wait := imp.opts.BatchInterval - time.Since(imp.lastRequest); wait > 0 {
+		time.Sleep(wait)
+	}
+	imp.lastRequest = time.Now()
+}
+
+func (imp *importer) addFailure(source string, err error) {
+	log.WithField("source", source).WithError(err).Warn("Message import failed")
+	imp.report.Failures = append(imp.report.Failures, ImportFailure{Source: source, Error: err.Error()})
+}
+
+func (imp *importer) saveProgress(source, apiID, messageID string) error {
+	imp.done[source] = importedMessage{apiID: apiID, messageID: messageID}
+	if messageID != "" {
+		imp.byMessage[messageID] = apiID
+	}
+	line := strings.Join([]string{imp.userID, source, apiID, messageID}, "\t")
+	if _, err := fmt.Fprintln(imp.progress, line); err != nil {
+		return errors.Wrap(err, "cannot save import progress")
+	}
+	return nil
+}
+
+func getImportProgressPath(path string) string {
+	if info, err := os.Stat(path); err == nil && !info.IsDir() {
+		return filepath.Join(filepath.Dir(path), importProgressFile)
+	}
+	return filepath.Join(path, importProgressFile)
+}
+
+// loadImportProgress returns messages already imported to the user.
+func loadImportProgress(path, userID string) (map[string]importedMessage, error) {
+	done := map[string]importedMessage{}
+
+	f, err := os.Open(path) //nolint[gosec]
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read import progress")
+	}
+	defer f.Close() //nolint[errcheck]
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 4 || fields[0] != userID {
+			continue
+		}
+		done[fields[1]] = importedMessage{apiID: fields[2], messageID: fields[3]}
+	}
+	return done, scanner.Err()
+}
+
+// getImportLabelName maps the folder name to the system label or to the name
+// of the folder or label. Folders which would only duplicate messages of
+// other folders are skipped. The address directory written by export is not
+// part of the name.
+func getImportLabelName(folder string) (systemID, name string, exclusive, skip bool) {
+	if parts := strings.SplitN(folder, "/", 2); len(parts) == 2 && strings.Contains(parts[0], "@") {
+		folder = parts[1]
+	}
+
+	switch strings.ToLower(folder) {
+	case "inbox":
+		return pmapi.InboxLabel, "", true, false
+	case "sent":
+		return pmapi.SentLabel, "", true, false
+	case "drafts":
+		return pmapi.DraftLabel, "", true, false
+	case "archive":
+		return pmapi.ArchiveLabel, "", true, false
+	case "spam":
+		return pmapi.SpamLabel, "", true, false
+	case "trash":
+		return pmapi.TrashLabel, "", true, false
+	case "all mail", "starred":
+		return "", "", true, true
+	}
+
+	lower := strings.ToLower(folder)
+	switch {
+	case strings.HasPrefix(lower, strings.ToLower(store.UserFoldersPrefix)):
+		return "", folder[len(store.UserFoldersPrefix):], true, false
+	case strings.HasPrefix(lower, strings.ToLower(store.UserLabelsPrefix)):
+		return "", folder[len(store.UserLabelsPrefix):], false, false
+	}
+	return "", folder, true, false
+}
+
+func isImportFlagKeyword(keyword string) bool {
+	for _, flag := range []string{message.AppleMailJunkFlag, message.ThunderbirdJunkFlag, message.ThunderbirdNonJunkFlag} {
+		if strings.EqualFold(keyword, flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueStrings(values []string) (unique []string) {
+	seen := map[string]bool{}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// importLabels finds labels by name and creates missing ones.
+type importLabels struct {
+	client bridge.PMAPIProvider
+	labels map[string]*pmapi.Label
+}
+
+func newImportLabels(client bridge.PMAPIProvider) (*importLabels, error) {
+	labels, err := client.ListLabels()
+	if err != nil {
+		return nil, err
+	}
+	l := &importLabels{client: client, labels: map[string]*pmapi.Label{}}
+	for _, label := range labels {
+		l.labels[getImportLabelKey(pmapi.LabelPath(labels, label), label.Exclusive == 1)] = label
+	}
+	return l, nil
+}
+
+func getImportLabelKey(name string, exclusive bool) string {
+	if exclusive {
+		return store.UserFoldersPrefix + strings.ToLower(name)
+	}
+	return store.UserLabelsPrefix + strings.ToLower(name)
+}
+
+// get returns the ID of the label with the full path name. Missing parents
+// are created as well.
+func (l *importLabels) get(name string, exclusive bool) (string, error) {
+	name = strings.Trim(name, pmapi.LabelPathDelimiter)
+	key := getImportLabelKey(name, exclusive)
+	if label, ok := l.labels[key]; ok {
+		return label.ID, nil
+	}
+
+	parentID, leafName := "", name
+	if idx := strings.LastIndex(name, pmapi.LabelPathDelimiter); idx >= 0 {
+		var err error
+		if parentID, err = l.get(name[:idx], exclusive); err != nil {
+			return "", err
+		}
+		leafName = name[idx+len(pmapi.LabelPathDelimiter):]
+	}
+
+	log.WithField("name", name).WithField("folder", exclusive).Info("Creating label for import")
+	label := &pmapi.Label{
+		Name:     leafName,
+		Color:    pmapi.LabelColors[len(l.labels)%len(pmapi.LabelColors)],
+		Type:     pmapi.LabelTypeMailbox,
+		ParentID: parentID,
+	}
+	if exclusive {
+		label.Exclusive = 1
+	}
+	created, err := l.client.CreateLabel(label)
+	if err != nil {
+		return "", errors.Wrapf(err, "cannot create label %s", name)
+	}
+	l.labels[key] = created
+	return created.ID, nil
+}
+
+func (l *importLabels) isExclusive(labelID string) bool {
+	for _, label := range l.labels {
+		if label.ID == labelID {
+			return label.Exclusive == 1
+		}
+	}
+	return false
+}
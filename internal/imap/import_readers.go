@@ -0,0 +1,281 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/pkg/errors"
+)
+
+// mboxQuotedFromLineRegexp matches lines quoted by mboxrd format.
+var mboxQuotedFromLineRegexp = regexp.MustCompile(`^>+From `) //nolint[gochecknoglobals]
+
+// importFolder is one mbox file or Maildir directory.
+type importFolder struct {
+	// name is the path relative to the import directory with slash
+	// as separator and without extension, e.g. `Folders/Work`.
+	name string
+	path string
+}
+
+// importMessage is one message read from the import folder.
+type importMessage struct {
+	// id is unique and stable for the message in the import directory
+	// and it is used to resume interrupted import.
+	id    string
+	flags []string
+	body  []byte
+}
+
+// findImportFolders returns mbox files (with .mbox extension) or Maildir
+// directories (containing cur directory) in the path.
+func findImportFolders(format, root string) (folders []importFolder, err error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	// The path can point directly to one mbox file.
+	if !info.IsDir() {
+		if format != ExportMbox {
+			return nil, errors.New("maildir import needs a directory")
+		}
+		name := strings.TrimSuffix(filepath.Base(root), ".mbox")
+		return []importFolder{{name: name, path: root}}, nil
+	}
+
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		var name string
+		switch {
+		case format == ExportMbox && !info.IsDir() && strings.HasSuffix(path, ".mbox"):
+			name = strings.TrimSuffix(path, ".mbox")
+		case format == ExportMaildir && info.IsDir() && isMaildir(path):
+			name = path
+		default:
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			rel = filepath.Base(root)
+		}
+		folders = append(folders, importFolder{name: filepath.ToSlash(rel), path: path})
+		return nil
+	})
+
+	return folders, err
+}
+
+func isMaildir(path string) bool {
+	info, err := os.Stat(filepath.Join(path, "cur"))
+	return err == nil && info.IsDir()
+}
+
+// readImportFolder calls the callback for every message in the folder.
+func readImportFolder(format string, folder importFolder, callback func(importMessage) error) error {
+	if format == ExportMbox {
+		return readMbox(folder, callback)
+	}
+	return readMaildir(folder, callback)
+}
+
+// readMbox reads messages in mboxrd format. Flags are parsed from Status
+// and X-Status headers.
+func readMbox(folder importFolder, callback func(importMessage) error) error {
+	f, err := os.Open(folder.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint[errcheck]
+
+	reader := bufio.NewReader(f)
+	body := &bytes.Buffer{}
+	index := 0
+	inMessage := false
+	// "From " line separates messages only at the beginning of the file
+	// or after a blank line.
+	afterBlankLine := true
+
+	flush := func() error {
+		if !inMessage {
+			return nil
+		}
+		content := bytes.TrimSuffix(body.Bytes(), []byte("\n"))
+		msg := importMessage{
+			id:    folder.name + "#" + strconv.Itoa(index),
+			flags: getMboxFlags(content),
+			body:  append([]byte{}, content...),
+		}
+		body.Reset()
+		index++
+		return callback(msg)
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			isSeparator := afterBlankLine && bytes.HasPrefix(line, []byte("From "))
+			afterBlankLine = len(bytes.TrimRight(line, "\r\n")) == 0
+			switch {
+			case isSeparator:
+				if err := flush(); err != nil {
+					return err
+				}
+				inMessage = true
+			case inMessage:
+				if mboxQuotedFromLineRegexp.Match(line) {
+					line = line[1:]
+				}
+				body.Write(line)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	return flush()
+}
+
+// getMboxFlags parses flags from headers written by mbox exporter and
+// other common clients.
+func getMboxFlags(content []byte) (flags []string) {
+	for _, line := range getHeaderLines(content) {
+		name, value := splitHeaderLine(line)
+		switch strings.ToLower(name) {
+		case "status":
+			if strings.Contains(value, "R") {
+				flags = append(flags, imap.SeenFlag)
+			}
+		case "x-status":
+			if strings.Contains(value, "A") {
+				flags = append(flags, imap.AnsweredFlag)
+			}
+			if strings.Contains(value, "F") {
+				flags = append(flags, imap.FlaggedFlag)
+			}
+			if strings.Contains(value, "T") {
+				flags = append(flags, imap.DraftFlag)
+			}
+		}
+	}
+	return flags
+}
+
+// readMaildir reads messages from cur and new directories. Flags are parsed
+// from the info part of the file name.
+func readMaildir(folder importFolder, callback func(importMessage) error) error {
+	for _, dir := range []string{"cur", "new"} {
+		files, err := ioutil.ReadDir(filepath.Join(folder.path, dir))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			body, err := ioutil.ReadFile(filepath.Join(folder.path, dir, file.Name())) //nolint[gosec]
+			if err != nil {
+				return err
+			}
+			uniq, flags := parseMaildirName(file.Name())
+			if err := callback(importMessage{id: folder.name + "/" + uniq, flags: flags, body: body}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseMaildirName returns the unique part of the name and IMAP flags.
+func parseMaildirName(name string) (uniq string, flags []string) {
+	idx := strings.LastIndexAny(name, ":!")
+	if idx < 0 || !strings.HasPrefix(name[idx+1:], "2,") {
+		return name, nil
+	}
+
+	for _, letter := range name[idx+3:] {
+		switch letter {
+		case 'D':
+			flags = append(flags, imap.DraftFlag)
+		case 'F':
+			flags = append(flags, imap.FlaggedFlag)
+		case 'R':
+			flags = append(flags, imap.AnsweredFlag)
+		case 'S':
+			flags = append(flags, imap.SeenFlag)
+		case 'T':
+			flags = append(flags, imap.DeletedFlag)
+		}
+	}
+	return name[:idx], flags
+}
+
+// getImportKeywords returns values of X-Keywords header.
+func getImportKeywords(content []byte) (keywords []string) {
+	for _, line := range getHeaderLines(content) {
+		name, value := splitHeaderLine(line)
+		if !strings.EqualFold(name, "X-Keywords") {
+			continue
+		}
+		for _, keyword := range strings.Split(value, ",") {
+			if keyword = strings.TrimSpace(keyword); keyword != "" {
+				keywords = append(keywords, keyword)
+			}
+		}
+	}
+	return keywords
+}
+
+// getHeaderLines returns unfolded lines of the message header.
+func getHeaderLines(content []byte) []string {
+	header := strings.Replace(string(content), "\r\n", "\n", -1)
+	if headerEnd := strings.Index(header, "\n\n"); headerEnd >= 0 {
+		header = header[:headerEnd]
+	}
+	header = strings.Replace(header, "\n ", " ", -1)
+	header = strings.Replace(header, "\n\t", " ", -1)
+	return strings.Split(header, "\n")
+}
+
+func splitHeaderLine(line string) (name, value string) {
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		return "", ""
+	}
+	return strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/bridge/mocks"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/emersion/go-imap"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllImportMessages(t *testing.T, format string, folder importFolder) (messages []importMessage) {
+	require.NoError(t, readImportFolder(format, folder, func(msg importMessage) error {
+		messages = append(messages, msg)
+		return nil
+	}))
+	return
+}
+
+func TestImportMboxWrittenByExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	m := getExportTestMessage()
+	exporter, err := newMboxExporter(filepath.Join(dir, "Folders", "Work.mbox"))
+	require.NoError(t, err)
+	require.NoError(t, exporter.write(m, getExportFlags(m), []string{"Important"}, []byte("Subject: One\r\n\r\nFrom me\r\n")))
+	require.NoError(t, exporter.write(m, nil, nil, []byte("Subject: Two\r\n\r\n>From you\r\n")))
+	require.NoError(t, exporter.close())
+
+	folders, err := findImportFolders(ExportMbox, dir)
+	require.NoError(t, err)
+	require.Equal(t, []importFolder{{name: "Folders/Work", path: filepath.Join(dir, "Folders", "Work.mbox")}}, folders)
+
+	messages := readAllImportMessages(t, ExportMbox, folders[0])
+	require.Len(t, messages, 2)
+
+	require.Equal(t, "Folders/Work#0", messages[0].id)
+	require.Equal(t, []string{imap.SeenFlag, imap.AnsweredFlag, imap.FlaggedFlag}, messages[0].flags)
+	require.Equal(t, []string{"Important"}, getImportKeywords(messages[0].body))
+	require.Equal(t, "Status: RO\nX-Status: AF\nX-Keywords: Important\nSubject: One\n\nFrom me\n", string(messages[0].body))
+
+	require.Equal(t, "Folders/Work#1", messages[1].id)
+	require.Nil(t, messages[1].flags)
+	require.Equal(t, "Status: O\nSubject: Two\n\n>From you\n", string(messages[1].body))
+}
+
+func TestImportMaildirWrittenByExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	m := getExportTestMessage()
+	exporter, err := newMaildirExporter(filepath.Join(dir, "INBOX"))
+	require.NoError(t, err)
+	require.NoError(t, exporter.write(m, getExportFlags(m), nil, []byte("Subject: Hello\r\n\r\nBody\r\n")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "INBOX", "new", "1.unread"), []byte("Subject: New\n\n"), 0600))
+
+	folders, err := findImportFolders(ExportMaildir, dir)
+	require.NoError(t, err)
+	require.Equal(t, []importFolder{{name: "INBOX", path: filepath.Join(dir, "INBOX")}}, folders)
+
+	messages := readAllImportMessages(t, ExportMaildir, folders[0])
+	require.Len(t, messages, 2)
+
+	uniq, _ := parseMaildirName(getMaildirName(m, nil))
+	require.Equal(t, "INBOX/"+uniq, messages[0].id)
+	require.Equal(t, []string{imap.FlaggedFlag, imap.AnsweredFlag, imap.SeenFlag}, messages[0].flags)
+	require.Equal(t, "Subject: Hello\n\nBody\n", string(messages[0].body))
+
+	require.Equal(t, "INBOX/1.unread", messages[1].id)
+	require.Nil(t, messages[1].flags)
+}
+
+func TestImportMboxSplitsOnlyAfterBlankLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "import-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "INBOX.mbox")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Join([]string{
+		"From me@pm.me Thu Jan  1 00:00:00 2020",
+		"Subject: One",
+		"",
+		"Hello,",
+		"From the team",
+		"",
+		"From me@pm.me Thu Jan  1 00:00:00 2020",
+		"Subject: Two",
+		"",
+		"Bye",
+		"",
+		"",
+	}, "\n")), 0600))
+
+	messages := readAllImportMessages(t, ExportMbox, importFolder{name: "INBOX", path: path})
+	require.Len(t, messages, 2)
+	require.Equal(t, "Subject: One\n\nHello,\nFrom the team\n", string(messages[0].body))
+	require.Equal(t, "Subject: Two\n\nBye\n", string(messages[1].body))
+}
+
+func TestImportLabelsDuplicateOfPendingMessage(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	client := mocks.NewMockPMAPIProvider(mockCtrl)
+
+	dir, err := ioutil.TempDir("", "import-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "INBOX.mbox")
+	require.NoError(t, ioutil.WriteFile(path, []byte(strings.Join([]string{
+		"From me@pm.me Thu Jan  1 00:00:00 2020",
+		"Message-Id: <dup@pm.me>",
+		"Subject: One",
+		"",
+		"Body",
+		"",
+		"From me@pm.me Thu Jan  1 00:00:00 2020",
+		"Message-Id: <dup@pm.me>",
+		"X-Keywords: Important",
+		"Subject: One",
+		"",
+		"Body",
+		"",
+	}, "\n")), 0600))
+
+	key, err := pmcrypto.GetGopenPGP().GenerateKey("import", "pm.me", "pass", "x25519", 0)
+	require.NoError(t, err)
+	kr, err := pmcrypto.ReadArmoredKeyRing(strings.NewReader(key))
+	require.NoError(t, err)
+	require.NoError(t, kr.Unlock([]byte("pass")))
+
+	progress, err := os.Create(filepath.Join(dir, importProgressFile))
+	require.NoError(t, err)
+	defer progress.Close() //nolint[errcheck]
+
+	imp := &importer{
+		opts:   ImportOptions{Format: ExportMbox, BatchSize: 10},
+		userID: "user",
+		client: client,
+		labels: &importLabels{client: client, labels: map[string]*pmapi.Label{
+			getImportLabelKey("Important", false): {ID: "important"},
+		}},
+		address:   &pmapi.Address{ID: "address", Email: "me@pm.me", Keys: pmapi.PMKeys{KeyRing: kr}},
+		done:      map[string]importedMessage{},
+		byMessage: map[string]string{},
+		progress:  progress,
+		report:    &ImportReport{},
+	}
+
+	gomock.InOrder(
+		client.EXPECT().Import(gomock.Len(1)).Return([]*pmapi.ImportMsgRes{{MessageID: "msg1"}}, nil),
+		client.EXPECT().LabelMessages([]string{"msg1"}, "important").Return(nil),
+	)
+
+	require.NoError(t, imp.importFolder(importFolder{name: "INBOX", path: path}, nil))
+	require.Equal(t, &ImportReport{Imported: 1, Skipped: 1}, imp.report)
+}
+
+func TestParseMaildirName(t *testing.T) {
+	uniq, flags := parseMaildirName("123.abc.host:2,DST")
+	require.Equal(t, "123.abc.host", uniq)
+	require.Equal(t, []string{imap.DraftFlag, imap.SeenFlag, imap.DeletedFlag}, flags)
+
+	uniq, flags = parseMaildirName("123.abc.host!2,F")
+	require.Equal(t, "123.abc.host", uniq)
+	require.Equal(t, []string{imap.FlaggedFlag}, flags)
+
+	uniq, flags = parseMaildirName("123.abc.host")
+	require.Equal(t, "123.abc.host", uniq)
+	require.Nil(t, flags)
+}
+
+func TestGetImportLabelName(t *testing.T) {
+	tests := []struct {
+		folder    string
+		systemID  string
+		name      string
+		exclusive bool
+		skip      bool
+	}{
+		{"INBOX", pmapi.InboxLabel, "", true, false},
+		{"sent", pmapi.SentLabel, "", true, false},
+		{"All Mail", "", "", true, true},
+		{"Folders/Work", "", "Work", true, false},
+		{"Labels/Important", "", "Important", false, false},
+		{"Old stuff", "", "Old stuff", true, false},
+		{"user@pm.me/INBOX", pmapi.InboxLabel, "", true, false},
+		{"user@pm.me/Folders/Work", "", "Work", true, false},
+		{"Folders/Work/user@pm.me", "", "Work/user@pm.me", true, false},
+	}
+
+	for _, test := range tests {
+		systemID, name, exclusive, skip := getImportLabelName(test.folder)
+		require.Equal(t, test.systemID, systemID, test.folder)
+		require.Equal(t, test.name, name, test.folder)
+		require.Equal(t, test.exclusive, exclusive, test.folder)
+		require.Equal(t, test.skip, skip, test.folder)
+	}
+}
+
+func TestSortImportFolders(t *testing.T) {
+	folders := []importFolder{{name: "Labels/A"}, {name: "INBOX"}, {name: "Labels/B"}, {name: "Folders/C"}}
+	sortImportFolders(folders)
+	require.Equal(t, []importFolder{{name: "INBOX"}, {name: "Folders/C"}, {name: "Labels/A"}, {name: "Labels/B"}}, folders)
+}
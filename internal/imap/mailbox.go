@@ -57,6 +57,22 @@ func newIMAPMailbox(panicHandler panicHandler, user *imapUser, storeMailbox stor
 	}
 }
 
+// withUser returns a copy of the mailbox used by the user.
+func (im *imapMailbox) withUser(user *imapUser) *imapMailbox {
+	userMailbox := *im
+	userMailbox.user = user
+	return &userMailbox
+}
+
+// startSpan starts the span of the IMAP command. API requests sent by
+// the returned mailbox are traced as children of the command. Only commands
+// which can call API are traced.
+func (im *imapMailbox) startSpan(command string) (*imapMailbox, pmapi.Span) {
+	ctx, span := pmapi.StartSpan(im.user.ctx, im.user.backend.tracer, "IMAP "+command)
+	span.SetAttribute("imap.mailbox", im.name)
+	return im.withUser(im.user.withContext(ctx)), span
+}
+
 // Name returns this mailbox name.
 func (im *imapMailbox) Name() string {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
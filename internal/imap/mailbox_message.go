@@ -32,6 +32,7 @@ import (
 	"time"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/internal/imap/cache"
 	"github.com/ProtonMail/proton-bridge/internal/imap/uidplus"
 	"github.com/ProtonMail/proton-bridge/pkg/message"
@@ -67,10 +68,13 @@ func (dnc *doNotCacheError) errorOrNil() error {
 //
 // If the Backend implements Updater, it must notify the client immediately
 // via a mailbox update.
-func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) error { // nolint[funlen]
+func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.Literal) (err error) { // nolint[funlen]
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	im, span := im.startSpan("APPEND")
+	defer func() { pmapi.EndSpan(span, err) }()
+
 	m, _, _, readers, err := message.Parse(body, "", "")
 	if err != nil {
 		return err
@@ -158,9 +162,9 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 	// Avoid appending a message which is already on the server. Apply the new
 	// label instead. This sometimes happens which Outlook (it uses APPEND instead of COPY).
 	if internalID != "" {
-		// Check to see if this belongs to a different address in split mode or another ProtonMail account.
+		// Check to see if this belongs to a different address group or another ProtonMail account.
 		msg, err := im.storeMailbox.GetMessage(internalID)
-		if err == nil && (im.user.user.IsCombinedAddressMode() || (im.storeAddress.AddressID() == msg.Message().AddressID)) {
+		if err == nil && im.storeAddress.ListsAddressID(msg.Message().AddressID) {
 			IDs := []string{internalID}
 
 			err = im.storeMailbox.LabelMessages(IDs)
@@ -183,7 +187,25 @@ func (im *imapMailbox) CreateMessage(flags []string, date time.Time, body imap.L
 	return uidplus.AppendResponse(im.storeMailbox.UIDValidity(), targetSeq)
 }
 
-func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *pmcrypto.KeyRing) (err error) { // nolint[funlen]
+func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *pmcrypto.KeyRing) (err error) {
+	body, err := buildImportBody(m, readers, kr)
+	if err != nil {
+		return err
+	}
+
+	labels := []string{}
+	for _, l := range m.LabelIDs {
+		if l == pmapi.StarredLabel {
+			labels = append(labels, pmapi.StarredLabel)
+		}
+	}
+
+	return im.storeMailbox.ImportMessage(m, body, labels)
+}
+
+// buildImportBody encrypts the parsed message with its attachments and
+// returns the body for import API.
+func buildImportBody(m *pmapi.Message, readers []io.Reader, kr *pmcrypto.KeyRing) (body []byte, err error) { // nolint[funlen]
 	b := &bytes.Buffer{}
 
 	// Overwrite content for main header for import.
@@ -213,10 +235,10 @@ func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *
 	}
 	// First, encrypt the message body.
 	if err = m.Encrypt(kr, kr); err != nil {
-		return err
+		return nil, err
 	}
 	if _, err := io.WriteString(p, m.Body); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Write the attachments parts.
@@ -235,34 +257,27 @@ func (im *imapMailbox) importMessage(m *pmapi.Message, readers []io.Reader, kr *
 
 		data, err := ioutil.ReadAll(r)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// Create encrypted writer.
 		pgpMessage, err := kr.Encrypt(pmcrypto.NewPlainMessage(data), nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if _, err := bw.Write(pgpMessage.GetBinary()); err != nil {
-			return err
+			return nil, err
 		}
 		if err := bw.Close(); err != nil {
-			return err
+			return nil, err
 		}
 	}
 
 	if err := mw.Close(); err != nil {
-		return err
-	}
-
-	labels := []string{}
-	for _, l := range m.LabelIDs {
-		if l == pmapi.StarredLabel {
-			labels = append(labels, pmapi.StarredLabel)
-		}
+		return nil, err
 	}
 
-	return im.storeMailbox.ImportMessage(m, b.Bytes(), labels)
+	return b.Bytes(), nil
 }
 
 func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []string) (msg *imap.Message, err error) {
@@ -306,6 +321,8 @@ func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []str
 			if err != nil {
 				return nil, err
 			}
+		case threadIDMsgAttr:
+			msg.Items[threadIDMsgAttr] = getThreadID(storeMessage.ConversationID())
 		default:
 			s := item
 
@@ -329,16 +346,15 @@ func (im *imapMailbox) getMessage(storeMessage storeMessageProvider, items []str
 
 func (im *imapMailbox) getBodyStructure(storeMessage storeMessageProvider) (
 	structure *message.BodyStructure,
-	bodyReader *bytes.Reader, err error,
+	body *cache.Body, err error,
 ) {
 	m := storeMessage.Message()
 	id := im.storeUser.UserID() + m.ID
 	cache.BuildLock(id)
-	if bodyReader, structure = cache.LoadMail(id); bodyReader.Len() == 0 || structure == nil {
-		var body []byte
+	if body, structure = cache.LoadMail(id); body == nil || body.Len() == 0 || structure == nil {
 		structure, body, err = im.buildMessage(m)
-		if err == nil && structure != nil && len(body) > 0 {
-			m.Size = int64(len(body))
+		if err == nil && structure != nil && body.Len() > 0 {
+			m.Size = int64(body.Len())
 			if err := storeMessage.SetSize(m.Size); err != nil {
 				im.log.WithError(err).
 					WithField("newSize", m.Size).
@@ -354,16 +370,14 @@ func (im *imapMailbox) getBodyStructure(storeMessage storeMessageProvider) (
 			if !isMessageInDraftFolder(m) {
 				cache.SaveMail(id, body, structure)
 			}
-			bodyReader = bytes.NewReader(body)
 		}
 		if _, ok := err.(*doNotCacheError); ok {
 			im.log.WithField("msgID", m.ID).Errorf("do not cache message: %v", err)
 			err = nil
-			bodyReader = bytes.NewReader(body)
 		}
 	}
 	cache.BuildUnlock(id)
-	return structure, bodyReader, err
+	return structure, body, err
 }
 
 func isMessageInDraftFolder(m *pmapi.Message) bool {
@@ -377,12 +391,13 @@ func isMessageInDraftFolder(m *pmapi.Message) bool {
 
 // This will download message (or read from cache) and pick up the section,
 // extract data (header,body, both) and trim the output if needed.
+// Sections of the message body are streamed from the built message.
 func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider, section *imap.BodySectionName) (literal imap.Literal, err error) { // nolint[funlen]
 	var (
-		structure  *message.BodyStructure
-		bodyReader *bytes.Reader
-		header     textproto.MIMEHeader
-		response   []byte
+		structure *message.BodyStructure
+		body      *cache.Body
+		header    textproto.MIMEHeader
+		response  *io.SectionReader
 	)
 
 	im.log.WithField("msgID", storeMessage.ID()).Trace("Getting message body")
@@ -408,7 +423,7 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 		}
 	} else {
 		// The rest of cases need download and decrypt.
-		structure, bodyReader, err = im.getBodyStructure(storeMessage)
+		structure, body, err = im.getBodyStructure(storeMessage)
 		if err != nil {
 			return
 		}
@@ -416,11 +431,11 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 		switch {
 		case section.Specifier == imap.EntireSpecifier && len(section.Path) == 0:
 			//  An empty section specification refers to the entire message, including the header.
-			response, err = structure.GetSection(bodyReader, section.Path)
+			response, err = structure.GetSectionReader(body, section.Path)
 		case section.Specifier == imap.TextSpecifier || (section.Specifier == imap.EntireSpecifier && len(section.Path) != 0):
 			// The TEXT specifier refers to the content of the message (or section), omitting the [RFC-2822] header.
 			// Non-empty section with no specifier (imap.EntireSpecifier) refers to section content without header.
-			response, err = structure.GetSectionContent(bodyReader, section.Path)
+			response, err = structure.GetSectionContentReader(body, section.Path)
 		case section.Specifier == imap.MimeSpecifier:
 			// The MIME part specifier refers to the [MIME-IMB] header for this part.
 			fallthrough
@@ -466,18 +481,42 @@ func (im *imapMailbox) getMessageBodySection(storeMessage storeMessageProvider,
 				}
 			}
 		}
-		response = headerBuf.Bytes()
+		response = io.NewSectionReader(bytes.NewReader(headerBuf.Bytes()), 0, int64(headerBuf.Len()))
 	}
 
 	// Trim any output if requested.
-	literal = bytes.NewBuffer(section.ExtractPartial(response))
-	return literal, nil
+	return extractPartial(section, response), nil
+}
+
+// sectionLiteral streams part of the built message to the IMAP client.
+type sectionLiteral struct {
+	*io.SectionReader
+}
+
+func (l *sectionLiteral) Len() int {
+	return int(l.Size())
+}
+
+// extractPartial does the same as section.ExtractPartial without reading
+// the section into memory.
+func extractPartial(section *imap.BodySectionName, response *io.SectionReader) imap.Literal {
+	from, to := int64(0), response.Size()
+	if len(section.Partial) == 2 {
+		from = int64(section.Partial[0])
+		if from > to {
+			return &sectionLiteral{io.NewSectionReader(response, 0, 0)}
+		}
+		if partialTo := from + int64(section.Partial[1]); partialTo < to {
+			to = partialTo
+		}
+	}
+	return &sectionLiteral{io.NewSectionReader(response, from, to-from)}
 }
 
 func (im *imapMailbox) fetchMessage(m *pmapi.Message) (err error) {
 	im.log.Trace("Fetching message")
 
-	complete, err := im.storeMailbox.FetchMessage(m.ID)
+	complete, err := im.storeMailbox.FetchMessage(im.user.ctx, m.ID)
 	if err != nil {
 		im.log.WithError(err).Error("Could not get message from store")
 		return
@@ -546,14 +585,27 @@ func (im *imapMailbox) writeAndParseMIMEBody(m *pmapi.Message) (mime *enmime.Env
 
 func (im *imapMailbox) writeAttachmentBody(w io.Writer, m *pmapi.Message, att *pmapi.Attachment) (err error) {
 	// Retrieve encrypted attachment.
-	r, err := im.user.client.GetAttachment(att.ID)
+	r, err := im.user.client.GetAttachmentContext(im.user.ctx, att.ID)
 	if err != nil {
 		return
 	}
 	defer r.Close() //nolint[errcheck]
 
+	progress := events.NewTransferProgressReporter(im.user.backend.eventListener, events.TransferProgress{
+		UserID:    im.storeUser.UserID(),
+		Direction: events.TransferDownload,
+		Name:      att.Name,
+	})
+	defer progress.Finish()
+
 	kr := im.user.client.KeyRingForAddressID(m.AddressID)
-	if err = message.WriteAttachmentBody(w, kr, m, att, r); err != nil {
+	err = message.WriteAttachmentBody(w, kr, m, att, pmapi.NewProgressReader(r, att.Size, progress.Update))
+	if err == pmapi.ErrAttachmentIntegrity {
+		// Data which failed the integrity check must not be passed on.
+		// The whole message is built before it is sent to the client,
+		// so the error message is sent instead.
+		return
+	} else if err != nil {
 		// Returning an error here makes certain mail clients behave badly,
 		// trying to retrieve the message again and again.
 		im.log.Warn("Cannot write attachment body: ", err)
@@ -582,8 +634,10 @@ func (im *imapMailbox) writeRelatedPart(p io.Writer, m *pmapi.Message, inlines [
 	_, _ = buf.WriteTo(p)
 
 	for _, inline := range inlines {
-		buf = &bytes.Buffer{}
-		if err = im.writeAttachmentBody(buf, m, inline); err != nil {
+		// Header of the part depends on the result of decryption,
+		// the attachment has to be written aside first.
+		attBody := cache.NewBody()
+		if err = im.writeAttachmentBody(attBody, m, inline); err != nil {
 			return
 		}
 
@@ -591,7 +645,9 @@ func (im *imapMailbox) writeRelatedPart(p io.Writer, m *pmapi.Message, inlines [
 		if p, err = related.CreatePart(h); err != nil {
 			return
 		}
-		_, _ = buf.WriteTo(p)
+		if _, err = io.Copy(p, attBody.NewReader()); err != nil {
+			return
+		}
 	}
 
 	_ = related.Close()
@@ -635,7 +691,7 @@ func (im *imapMailbox) setMessageContentType(m *pmapi.Message) (multipartType in
 }
 
 // buildMessage from PM to IMAP.
-func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodyStructure, msgBody []byte, err error) {
+func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodyStructure, msgBody *cache.Body, err error) {
 	im.log.Trace("Building message")
 
 	var errNoCache doNotCacheError
@@ -666,6 +722,10 @@ func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodySt
 	} else if err != nil {
 		errNoCache.add(err)
 		im.customMessage(m, err, true)
+		if err == pmapi.ErrAttachmentIntegrity {
+			// Attachments which failed the check cannot be part of the message.
+			m.Attachments, m.NumAttachments = nil, 0
+		}
 		structure, msgBody, err = im.buildMessageInner(m, kr)
 		if err != nil {
 			return nil, nil, err
@@ -677,13 +737,15 @@ func (im *imapMailbox) buildMessage(m *pmapi.Message) (structure *message.BodySt
 	return structure, msgBody, err
 }
 
-func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing) (structure *message.BodyStructure, msgBody []byte, err error) { // nolint[funlen]
+// buildMessageInner writes the message to a body which keeps only small messages
+// in memory, so big attachments are never held in memory as a whole.
+func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing) (structure *message.BodyStructure, msgBody *cache.Body, err error) { // nolint[funlen]
 	multipartType, err := im.setMessageContentType(m)
 	if err != nil {
 		return
 	}
 
-	tmpBuf := &bytes.Buffer{}
+	tmpBuf := cache.NewBody()
 	mainHeader := message.GetHeader(m)
 	if err = writeHeader(tmpBuf, mainHeader); err != nil {
 		return
@@ -715,7 +777,10 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing)
 			if partWriter, err = mw.CreatePart(relatedHeader); err != nil {
 				return
 			}
-			_ = im.writeRelatedPart(partWriter, m, inlines)
+			if err = im.writeRelatedPart(partWriter, m, inlines); err == pmapi.ErrAttachmentIntegrity {
+				return
+			}
+			err = nil
 		} else {
 			buf := &bytes.Buffer{}
 			if err = im.writeMessageBody(buf, m); err != nil {
@@ -740,16 +805,15 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing)
 		processCallback := func(value interface{}) (interface{}, error) {
 			att := value.(*pmapi.Attachment)
 
-			buf := &bytes.Buffer{}
-			if err = im.writeAttachmentBody(buf, m, att); err != nil {
+			attBody := cache.NewBody()
+			if err := im.writeAttachmentBody(attBody, m, att); err != nil {
 				return nil, err
 			}
-			return buf, nil
+			return attBody, nil
 		}
 
 		collectCallback := func(idx int, value interface{}) error {
-			buf := value.(*bytes.Buffer)
-			defer buf.Reset()
+			attBody := value.(*cache.Body)
 			att := atts[idx]
 
 			attachmentHeader := message.GetAttachmentHeader(att)
@@ -757,8 +821,8 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing)
 				return err
 			}
 
-			_, _ = buf.WriteTo(partWriter)
-			return nil
+			_, err = io.Copy(partWriter, attBody.NewReader())
+			return err
 		}
 
 		err = parallel.RunParallel(fetchAttachmentsWorkers, input, processCallback, collectCallback)
@@ -771,9 +835,8 @@ func (im *imapMailbox) buildMessageInner(m *pmapi.Message, kr *pmcrypto.KeyRing)
 		fmt.Fprintf(tmpBuf, "\r\n\r\nUknown multipart type: %d\r\n\r\n", multipartType)
 	}
 
-	// We need to copy buffer before building body structure.
-	msgBody = tmpBuf.Bytes()
-	structure, err = message.NewBodyStructure(tmpBuf)
+	msgBody = tmpBuf
+	structure, err = message.NewBodyStructure(tmpBuf.NewReader())
 	if err != nil {
 		// NOTE: We need to set structure if it fails and is empty.
 		if structure == nil {
@@ -19,8 +19,12 @@ package imap
 
 import (
 	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
 
+	"github.com/emersion/go-imap"
 	"github.com/stretchr/testify/require"
 )
 
@@ -39,3 +43,18 @@ func TestDoNotCache(t *testing.T) {
 	dnc.add(errors.New("third"))
 	t.Log(dnc.errorOrNil())
 }
+
+func TestExtractPartial(t *testing.T) {
+	const response = "0123456789"
+
+	for _, partial := range [][]int{nil, {0, 5}, {3, 4}, {8, 5}, {10, 1}, {11, 1}} {
+		section := &imap.BodySectionName{Partial: partial}
+		literal := extractPartial(section, io.NewSectionReader(strings.NewReader(response), 0, int64(len(response))))
+
+		expected := section.ExtractPartial([]byte(response))
+		require.Equal(t, len(expected), literal.Len())
+		b, err := ioutil.ReadAll(literal)
+		require.NoError(t, err)
+		require.Equal(t, string(expected), string(b))
+	}
+}
@@ -37,7 +37,7 @@ import (
 //
 // If the Backend implements Updater, it must notify the client immediately
 // via a message update.
-func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operation imap.FlagsOp, flags []string) error {
+func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operation imap.FlagsOp, flags []string) (err error) {
 	log.WithFields(logrus.Fields{
 		"flags":     flags,
 		"operation": operation,
@@ -46,6 +46,9 @@ func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operat
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	im, span := im.startSpan("STORE")
+	defer func() { pmapi.EndSpan(span, err) }()
+
 	messageIDs, err := im.apiIDsFromSeqSet(uid, seqSet)
 	if err != nil || len(messageIDs) == 0 {
 		return err
@@ -98,10 +101,13 @@ func (im *imapMailbox) UpdateMessagesFlags(uid bool, seqSet *imap.SeqSet, operat
 // CopyMessages copies the specified message(s) to the end of the specified
 // destination mailbox. The flags and internal date of the message(s) SHOULD
 // be preserved, and the Recent flag SHOULD be set, in the copy.
-func (im *imapMailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, targetLabel string) error {
+func (im *imapMailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, targetLabel string) (err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	im, span := im.startSpan("COPY")
+	defer func() { pmapi.EndSpan(span, err) }()
+
 	messageIDs, err := im.apiIDsFromSeqSet(uid, seqSet)
 	if err != nil || len(messageIDs) == 0 {
 		return err
@@ -127,10 +133,13 @@ func (im *imapMailbox) CopyMessages(uid bool, seqSet *imap.SeqSet, targetLabel s
 //
 // This should not be used until MOVE extension has option to send UIDPLUS
 // responses.
-func (im *imapMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, newLabel string) error {
+func (im *imapMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, newLabel string) (err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	im, span := im.startSpan("MOVE")
+	defer func() { pmapi.EndSpan(span, err) }()
+
 	messageIDs, err := im.apiIDsFromSeqSet(uid, seqSet)
 	if err != nil || len(messageIDs) == 0 {
 		return err
@@ -149,10 +158,39 @@ func (im *imapMailbox) MoveMessages(uid bool, seqSet *imap.SeqSet, newLabel stri
 
 // SearchMessages searches messages. The returned list must contain UIDs if
 // uid is set to true, or sequence numbers otherwise.
-func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria) (ids []uint32, err error) { //nolint[gocyclo]
+func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria) (ids []uint32, err error) {
 	// Called from go-imap in goroutines - we need to handle panics for each function.
 	defer im.panicHandler.HandlePanic()
 
+	im, span := im.startSpan("SEARCH")
+	defer func() { pmapi.EndSpan(span, err) }()
+
+	storeMessages, err := im.searchMessages(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, storeMessage := range storeMessages {
+		id, err := getMessageID(storeMessage, isUID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// getMessageID returns UID if isUID is set to true, or sequence number otherwise.
+func getMessageID(storeMessage storeMessageProvider, isUID bool) (uint32, error) {
+	if isUID {
+		return storeMessage.UID()
+	}
+	return storeMessage.SequenceNumber()
+}
+
+// searchMessages returns messages of the mailbox matching the criteria.
+func (im *imapMailbox) searchMessages(criteria *imap.SearchCriteria) (storeMessages []storeMessageProvider, err error) { //nolint[gocyclo]
 	if criteria.Not != nil || criteria.Or[0] != nil {
 		return nil, errors.New("unsupported search query")
 	}
@@ -314,23 +352,10 @@ func (im *imapMailbox) SearchMessages(isUID bool, criteria *imap.SearchCriteria)
 			}
 		}
 
-		// Add the ID to response.
-		var id uint32
-		if isUID {
-			id, err = storeMessage.UID()
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			id, err = storeMessage.SequenceNumber()
-			if err != nil {
-				return nil, err
-			}
-		}
-		ids = append(ids, id)
+		storeMessages = append(storeMessages, storeMessage)
 	}
 
-	return ids, nil
+	return storeMessages, nil
 }
 
 // ListMessages returns a list of messages. seqset must be interpreted as UIDs
@@ -348,6 +373,9 @@ func (im *imapMailbox) ListMessages(isUID bool, seqSet *imap.SeqSet, items []str
 		im.panicHandler.HandlePanic()
 	}()
 
+	im, span := im.startSpan("FETCH")
+	defer func() { pmapi.EndSpan(span, err) }()
+
 	var markAsReadIDs []string
 	markAsReadMutex := &sync.Mutex{}
 
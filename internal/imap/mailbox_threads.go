@@ -0,0 +1,97 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/thread"
+	"github.com/emersion/go-imap"
+)
+
+// threadIDMsgAttr is fetch item with numeric ID of the conversation,
+// compatible with Gmail's X-GM-THRID.
+const threadIDMsgAttr = "X-GM-THRID"
+
+// threadMember is message of the mailbox with information needed for threading.
+type threadMember struct {
+	id             uint32
+	conversationID string
+	time           int64
+}
+
+// Thread returns messages matching the criteria grouped by conversations.
+// The algorithm is ignored, see package thread for more information.
+func (im *imapMailbox) Thread(isUID bool, algorithm string, criteria *imap.SearchCriteria) ([]*thread.Thread, error) {
+	// Called from go-imap in goroutines - we need to handle panics for each function.
+	defer im.panicHandler.HandlePanic()
+
+	storeMessages, err := im.searchMessages(criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []threadMember{}
+	for _, storeMessage := range storeMessages {
+		id, err := getMessageID(storeMessage, isUID)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, threadMember{
+			id:             id,
+			conversationID: storeMessage.ConversationID(),
+			time:           storeMessage.Message().Time,
+		})
+	}
+
+	return buildThreads(members), nil
+}
+
+// buildThreads groups members by conversation. The oldest message is
+// the parent of all other messages of the conversation. Threads and
+// children are sorted by date.
+func buildThreads(members []threadMember) (threads []*thread.Thread) {
+	sort.SliceStable(members, func(i, j int) bool {
+		if members[i].time == members[j].time {
+			return members[i].id < members[j].id
+		}
+		return members[i].time < members[j].time
+	})
+
+	roots := map[string]*thread.Thread{}
+	for _, member := range members {
+		node := &thread.Thread{ID: member.id}
+		if root, ok := roots[member.conversationID]; ok {
+			root.Children = append(root.Children, node)
+			continue
+		}
+		roots[member.conversationID] = node
+		threads = append(threads, node)
+	}
+
+	return threads
+}
+
+// getThreadID returns positive 63-bit number derived from the conversation ID.
+func getThreadID(conversationID string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(conversationID))
+	return strconv.FormatUint(h.Sum64()>>1, 10)
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package imap
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/imap/thread"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildThreads(t *testing.T) {
+	threads := buildThreads([]threadMember{
+		{id: 1, conversationID: "a", time: 100},
+		{id: 2, conversationID: "b", time: 50},
+		{id: 3, conversationID: "a", time: 300},
+		{id: 4, conversationID: "c", time: 200},
+		{id: 5, conversationID: "a", time: 200},
+		{id: 6, conversationID: "b", time: 50},
+	})
+
+	require.Equal(t, []*thread.Thread{
+		{ID: 2, Children: []*thread.Thread{{ID: 6}}},
+		{ID: 1, Children: []*thread.Thread{{ID: 5}, {ID: 3}}},
+		{ID: 4},
+	}, threads)
+
+	require.Nil(t, buildThreads(nil))
+}
+
+func TestGetThreadID(t *testing.T) {
+	id := getThreadID("conversationID")
+	require.Equal(t, id, getThreadID("conversationID"))
+	require.NotEqual(t, id, getThreadID("otherConversationID"))
+
+	// Must be valid signed 64-bit number for clients expecting Gmail IDs.
+	_, err := strconv.ParseInt(id, 10, 64)
+	require.NoError(t, err)
+}
@@ -18,6 +18,7 @@
 package imap
 
 import (
+	"context"
 	"io"
 	"net/mail"
 
@@ -46,6 +47,7 @@ type storeUserProvider interface {
 type storeAddressProvider interface {
 	AddressString() string
 	AddressID() string
+	ListsAddressID(addressID string) bool
 	APIAddress() *pmapi.Address
 
 	CreateMailbox(name string) error
@@ -74,7 +76,7 @@ type storeMailboxProvider interface {
 	GetDelimiter() string
 
 	GetMessage(apiID string) (storeMessageProvider, error)
-	FetchMessage(apiID string) (storeMessageProvider, error)
+	FetchMessage(ctx context.Context, apiID string) (storeMessageProvider, error)
 	LabelMessages(apiID []string) error
 	UnlabelMessages(apiID []string) error
 	MarkMessagesRead(apiID []string) error
@@ -87,6 +89,7 @@ type storeMailboxProvider interface {
 
 type storeMessageProvider interface {
 	ID() string
+	ConversationID() string
 	UID() (uint32, error)
 	SequenceNumber() (uint32, error)
 	Message() *pmapi.Message
@@ -151,6 +154,6 @@ func (s *storeMailboxWrap) GetMessage(apiID string) (storeMessageProvider, error
 	return s.Mailbox.GetMessage(apiID)
 }
 
-func (s *storeMailboxWrap) FetchMessage(apiID string) (storeMessageProvider, error) {
-	return s.Mailbox.FetchMessage(apiID)
+func (s *storeMailboxWrap) FetchMessage(ctx context.Context, apiID string) (storeMessageProvider, error) {
+	return s.Mailbox.FetchMessage(ctx, apiID)
 }
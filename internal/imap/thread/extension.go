@@ -0,0 +1,174 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package thread DOES NOT implement full RFC5256!
+//
+// Excluded parts are:
+// * SORT command
+// * Threading algorithms: Bridge does not build threads from subjects or
+//   references but uses conversations from the server. Both REFERENCES and
+//   ORDEREDSUBJECT return the same result: the first message of the
+//   conversation is the parent and all other messages are its children
+//   in order of date.
+//
+// Otherwise the THREAD command and response follow the standard RFC5256.
+package thread
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/server"
+)
+
+// Threading algorithms advertised as capabilities.
+const (
+	References     = "REFERENCES"
+	OrderedSubject = "ORDEREDSUBJECT"
+)
+
+const commandName = "THREAD"
+
+// Thread is one node of the thread tree with message UID or sequence number.
+type Thread struct {
+	ID       uint32
+	Children []*Thread
+}
+
+// Mailbox is implemented by mailboxes which can group messages to threads.
+type Mailbox interface {
+	// Thread returns threads of messages matching the criteria. Threads
+	// must contain UIDs if uid is set to true, or sequence numbers otherwise.
+	Thread(uid bool, algorithm string, criteria *imap.SearchCriteria) ([]*Thread, error)
+}
+
+// Command is THREAD command as defined in RFC5256.
+type Command struct {
+	Algorithm string
+	Charset   string
+	Criteria  *imap.SearchCriteria
+}
+
+func (cmd *Command) Parse(fields []interface{}) error {
+	if len(fields) < 3 {
+		return errors.New("no enough arguments")
+	}
+
+	algorithm, ok := fields[0].(string)
+	if !ok {
+		return errors.New("algorithm must be a string")
+	}
+	cmd.Algorithm = strings.ToUpper(algorithm)
+	if cmd.Algorithm != References && cmd.Algorithm != OrderedSubject {
+		return errors.New("unsupported threading algorithm")
+	}
+
+	if cmd.Charset, ok = fields[1].(string); !ok {
+		return errors.New("charset must be a string")
+	}
+
+	cmd.Criteria = &imap.SearchCriteria{}
+	return cmd.Criteria.Parse(fields[2:])
+}
+
+func (cmd *Command) handle(uid bool, conn server.Conn) error {
+	ctx := conn.Context()
+	if ctx.Mailbox == nil {
+		return server.ErrNoMailboxSelected
+	}
+
+	mailbox, ok := ctx.Mailbox.(Mailbox)
+	if !ok {
+		return errors.New("threads are not supported in this mailbox")
+	}
+
+	threads, err := mailbox.Thread(uid, cmd.Algorithm, cmd.Criteria)
+	if err != nil {
+		return err
+	}
+
+	return conn.WriteResp(&Response{Threads: threads})
+}
+
+func (cmd *Command) Handle(conn server.Conn) error    { return cmd.handle(false, conn) }
+func (cmd *Command) UidHandle(conn server.Conn) error { return cmd.handle(true, conn) } //nolint[golint]
+
+// Response is THREAD response as defined in RFC5256.
+type Response struct {
+	Threads []*Thread
+}
+
+// WriteTo writes the response. Thread lists are not separated by space
+// which cannot be done with imap.Writer fields.
+func (r *Response) WriteTo(w *imap.Writer) error {
+	line := "* " + commandName
+	if len(r.Threads) > 0 {
+		line += " " + formatThreads(r.Threads)
+	}
+	if _, err := io.WriteString(w, line+"\r\n"); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func formatThreads(threads []*Thread) (out string) {
+	for _, thread := range threads {
+		out += formatThread(thread)
+	}
+	return out
+}
+
+// formatThread writes the chain of single children as list of numbers
+// followed by nested lists for more children, e.g. `(1 2 (3)(4 5))`.
+func formatThread(thread *Thread) string {
+	out := "(" + strconv.FormatUint(uint64(thread.ID), 10)
+	for len(thread.Children) == 1 {
+		thread = thread.Children[0]
+		out += " " + strconv.FormatUint(uint64(thread.ID), 10)
+	}
+	if len(thread.Children) > 1 {
+		out += " " + formatThreads(thread.Children)
+	}
+	return out + ")"
+}
+
+type extension struct{}
+
+// NewExtension of THREAD.
+func NewExtension() server.Extension {
+	return &extension{}
+}
+
+func (ext *extension) Capabilities(c server.Conn) []string {
+	if c.Context().State&imap.AuthenticatedState != 0 {
+		return []string{commandName + "=" + References, commandName + "=" + OrderedSubject}
+	}
+	return nil
+}
+
+func (ext *extension) Command(name string) server.HandlerFactory {
+	if name == commandName {
+		return func() server.Handler {
+			return &Command{}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package thread
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseWriteTo(t *testing.T) {
+	testData := []struct {
+		threads []*Thread
+		want    string
+	}{
+		{nil, "* THREAD\r\n"},
+		{[]*Thread{{ID: 1}}, "* THREAD (1)\r\n"},
+		{[]*Thread{{ID: 2}, {ID: 3, Children: []*Thread{{ID: 6}}}}, "* THREAD (2)(3 6)\r\n"},
+		{ // Example from RFC5256.
+			[]*Thread{{ID: 3, Children: []*Thread{{ID: 6, Children: []*Thread{
+				{ID: 4, Children: []*Thread{{ID: 23}}},
+				{ID: 44, Children: []*Thread{{ID: 7, Children: []*Thread{{ID: 96}}}}},
+			}}}}},
+			"* THREAD (3 6 (4 23)(44 7 96))\r\n",
+		},
+		{ // Conversation with first message as parent.
+			[]*Thread{{ID: 1, Children: []*Thread{{ID: 2}, {ID: 5}, {ID: 9}}}},
+			"* THREAD (1 (2)(5)(9))\r\n",
+		},
+	}
+
+	for _, td := range testData {
+		b := &bytes.Buffer{}
+		res := &Response{Threads: td.threads}
+		require.NoError(t, res.WriteTo(imap.NewWriter(b)))
+		assert.Equal(t, td.want, b.String())
+	}
+}
+
+func TestCommandParse(t *testing.T) {
+	cmd := &Command{}
+	require.NoError(t, cmd.Parse([]interface{}{"references", "UTF-8", "UNSEEN"}))
+	assert.Equal(t, References, cmd.Algorithm)
+	assert.Equal(t, "UTF-8", cmd.Charset)
+	assert.True(t, cmd.Criteria.Unseen)
+
+	assert.Error(t, (&Command{}).Parse([]interface{}{"REFS", "UTF-8", "ALL"}))
+	assert.Error(t, (&Command{}).Parse([]interface{}{References, "UTF-8"}))
+}
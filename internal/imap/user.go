@@ -18,6 +18,7 @@
 package imap
 
 import (
+	"context"
 	"errors"
 	"strings"
 
@@ -40,6 +41,10 @@ type imapUser struct {
 	storeAddress storeAddressProvider
 
 	currentAddressLowercase string
+
+	// ctx is canceled on logout to abort API requests of the connection.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // newIMAPUser returns struct implementing go-imap/user interface.
@@ -64,6 +69,8 @@ func newIMAPUser(
 
 	client := user.GetTemporaryPMAPIClient()
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &imapUser{
 		panicHandler: panicHandler,
 		backend:      backend,
@@ -74,9 +81,27 @@ func newIMAPUser(
 		storeAddress: storeAddress,
 
 		currentAddressLowercase: strings.ToLower(address),
+
+		ctx:    ctx,
+		cancel: cancel,
 	}, err
 }
 
+// forConnection returns a copy of the user with its own context so that
+// closing one connection does not abort requests of the others.
+func (iu *imapUser) forConnection() *imapUser {
+	connUser := *iu
+	connUser.ctx, connUser.cancel = context.WithCancel(context.Background())
+	return &connUser
+}
+
+// withContext returns a copy of the user sending API requests with ctx.
+func (iu *imapUser) withContext(ctx context.Context) *imapUser {
+	ctxUser := *iu
+	ctxUser.ctx = ctx
+	return &ctxUser
+}
+
 func (iu *imapUser) isSubscribed(labelID string) bool {
 	subscriptionExceptions := iu.backend.getCacheList(iu.storeUser.UserID(), SubscriptionException)
 	exceptions := strings.Split(subscriptionExceptions, ";")
@@ -188,6 +213,7 @@ func (iu *imapUser) Logout() (err error) {
 
 	log.Debug("IMAP client logged out address ", iu.storeAddress.AddressID())
 
+	iu.cancel()
 	iu.backend.deleteUser(iu.currentAddressLowercase)
 
 	return nil
@@ -21,12 +21,21 @@
 package pmapifactory
 
 import (
+	"time"
+
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
+	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
-func New(cfg bridge.Configer, _ listener.Listener) bridge.PMAPIProviderFactory {
+func New(cfg bridge.Configer, listener listener.Listener) bridge.PMAPIProviderFactory {
+	if scheduler := cfg.GetAPIConfig().Scheduler; scheduler != nil {
+		scheduler.ReportThrottled = func(retryAfter time.Duration) {
+			listener.Emit(events.APIThrottledEvent, retryAfter.String())
+		}
+	}
+
 	return func(userID string) bridge.PMAPIProvider {
 		return pmapi.NewClient(cfg.GetAPIConfig(), userID)
 	}
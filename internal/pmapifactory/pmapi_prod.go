@@ -32,11 +32,17 @@ import (
 func New(config bridge.Configer, listener listener.Listener) bridge.PMAPIProviderFactory {
 	cfg := config.GetAPIConfig()
 
-	pin := pmapi.NewPMAPIPinning(cfg.AppVersion)
+	pin := pmapi.NewPMAPIPinning(cfg.AppVersion, cfg.Routing)
 	pin.ReportCertIssueLocal = func() {
 		listener.Emit(events.TLSCertIssue, "")
 	}
 
+	if cfg.Scheduler != nil {
+		cfg.Scheduler.ReportThrottled = func(retryAfter time.Duration) {
+			listener.Emit(events.APIThrottledEvent, retryAfter.String())
+		}
+	}
+
 	// This transport already has timeouts set governing the roundtrip:
 	// - IdleConnTimeout:       5 * time.Minute,
 	// - ExpectContinueTimeout: 500 * time.Millisecond,
@@ -35,6 +35,7 @@ const (
 	SMTPPortKey            = "user_port_smtp"
 	SMTPSSLKey             = "user_ssl_smtp"
 	AllowProxyKey          = "allow_proxy"
+	UserProxyKey           = "user_proxy"
 	AutostartKey           = "autostart"
 	ReportOutgoingNoEncKey = "report_outgoing_email_without_encryption"
 	LastVersionKey         = "last_used_version"
@@ -69,6 +70,7 @@ func setDefaults(preferences *config.Preferences, cfg configProvider) {
 	preferences.SetDefault(IMAPPortKey, strconv.Itoa(cfg.GetDefaultIMAPPort()))
 	preferences.SetDefault(SMTPPortKey, strconv.Itoa(cfg.GetDefaultSMTPPort()))
 	preferences.SetDefault(AllowProxyKey, "true")
+	preferences.SetDefault(UserProxyKey, "")
 	preferences.SetDefault(AutostartKey, "true")
 	preferences.SetDefault(ReportOutgoingNoEncKey, "false")
 	preferences.SetDefault(LastVersionKey, "")
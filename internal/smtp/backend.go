@@ -19,6 +19,7 @@ package smtp
 
 import (
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
@@ -38,7 +39,12 @@ type smtpBackend struct {
 	preferences             *config.Preferences
 	bridge                  bridger
 	shouldSendNoEncChannels map[string]chan bool
-	sendRecorder            *sendRecorder
+
+	outgoingRulesPath    string
+	outgoingRulesVersion outgoingRulesVersion
+	outgoingPipeline     *outgoingPipeline
+	outgoingPipelineErr  error
+	outgoingLocker       sync.Locker
 }
 
 // NewSMTPBackend returns struct implementing go-smtp/backend interface.
@@ -46,27 +52,64 @@ func NewSMTPBackend(
 	panicHandler panicHandler,
 	eventListener listener.Listener,
 	preferences *config.Preferences,
+	cfg configProvider,
 	bridge *bridge.Bridge,
 ) *smtpBackend { //nolint[golint]
-	return newSMTPBackend(panicHandler, eventListener, preferences, newBridgeWrap(bridge))
+	return newSMTPBackend(panicHandler, eventListener, preferences, cfg, newBridgeWrap(bridge))
 }
 
 func newSMTPBackend(
 	panicHandler panicHandler,
 	eventListener listener.Listener,
 	preferences *config.Preferences,
+	cfg configProvider,
 	bridge bridger,
 ) *smtpBackend {
+	// Invalid rules must not prevent bridge from running. Nothing is sent
+	// though until the rules file is fixed, so that no message leaves
+	// without the rules the user asked for.
+	version := getOutgoingRulesVersion(cfg.GetOutgoingRulesPath())
+	pipeline, err := loadOutgoingPipeline(cfg.GetOutgoingRulesPath())
+	if err != nil {
+		log.WithError(err).Error("Cannot load outgoing rules")
+	}
+
 	return &smtpBackend{
 		panicHandler:            panicHandler,
 		eventListener:           eventListener,
 		preferences:             preferences,
 		bridge:                  bridge,
 		shouldSendNoEncChannels: make(map[string]chan bool),
-		sendRecorder:            newSendRecorder(),
+		outgoingRulesPath:       cfg.GetOutgoingRulesPath(),
+		outgoingRulesVersion:    version,
+		outgoingPipeline:        pipeline,
+		outgoingPipelineErr:     err,
+		outgoingLocker:          &sync.Mutex{},
 	}
 }
 
+// getOutgoingPipeline returns rules which have to be applied to outgoing
+// messages. The rules are loaded again whenever the rules file changes, so
+// edits take effect without restarting the bridge. When the rules file could
+// not be loaded, sending is refused until the file is fixed.
+func (sb *smtpBackend) getOutgoingPipeline() (*outgoingPipeline, error) {
+	sb.outgoingLocker.Lock()
+	defer sb.outgoingLocker.Unlock()
+
+	version := getOutgoingRulesVersion(sb.outgoingRulesPath)
+	if sb.outgoingPipelineErr != nil || version != sb.outgoingRulesVersion {
+		sb.outgoingRulesVersion = version
+		sb.outgoingPipeline, sb.outgoingPipelineErr = loadOutgoingPipeline(sb.outgoingRulesPath)
+		if sb.outgoingPipelineErr != nil {
+			log.WithError(sb.outgoingPipelineErr).Error("Cannot load outgoing rules")
+			return nil, errOutgoingRulesInvalid.wrap(sb.outgoingPipelineErr)
+		}
+		log.Info("Outgoing rules were loaded")
+	}
+
+	return sb.outgoingPipeline, nil
+}
+
 // Login authenticates a user.
 func (sb *smtpBackend) Login(username, password string) (goSMTPBackend.User, error) {
 	// Called from go-smtp in goroutines - we need to handle panics for each function.
@@ -91,8 +134,9 @@ func (sb *smtpBackend) Login(username, password string) (goSMTPBackend.User, err
 		log.Error("Cannot get addressID: ", err)
 		return nil, err
 	}
-	// AddressID is only for split mode--it has to be empty for combined mode.
-	if user.IsCombinedAddressMode() {
+	// AddressID is only for address with its own login--it has to be empty
+	// when more addresses share the login (combined mode or hybrid mode group).
+	if len(user.GetAddressGroup(username)) > 1 {
 		addressID = ""
 	}
 	return newSMTPUser(sb.panicHandler, sb.eventListener, sb, user, addressID)
@@ -21,13 +21,17 @@ import (
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 )
 
+type configProvider interface {
+	GetOutgoingRulesPath() string
+}
+
 type bridger interface {
 	GetUser(query string) (bridgeUser, error)
 }
 
 type bridgeUser interface {
 	CheckBridgeLogin(password string) error
-	IsCombinedAddressMode() bool
+	GetAddressGroup(address string) []string
 	GetAddressID(address string) (string, error)
 	GetTemporaryPMAPIClient() bridge.PMAPIProvider
 	GetStore() storeUserProvider
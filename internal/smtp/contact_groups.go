@@ -0,0 +1,241 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// contactGroupDomain is the pseudo-domain used to address contact groups.
+// For example, `family@groups.bridge.local` is sent to all members of group "family".
+const contactGroupDomain = "groups.bridge.local"
+
+// contactGroupPageSize is the number of group members requested at once.
+const contactGroupPageSize = 1000
+
+// getContactGroupName returns the group name if the address uses contact group pseudo-domain.
+func getContactGroupName(address string) (string, bool) {
+	at := strings.LastIndex(address, "@")
+	if at <= 0 {
+		return "", false
+	}
+	if !strings.EqualFold(address[at+1:], contactGroupDomain) {
+		return "", false
+	}
+	return address[:at], true
+}
+
+// matchContactGroupName checks whether the local part of the group address refers
+// to the group. Group names can contain spaces which are not allowed in the address,
+// therefore dashes can be used instead.
+func matchContactGroupName(groupName, localPart string) bool {
+	return strings.EqualFold(groupName, localPart) ||
+		strings.EqualFold(strings.ReplaceAll(groupName, " ", "-"), localPart)
+}
+
+// expandContactGroups replaces all contact group addresses in the recipients
+// and in To, Cc and Bcc lists of the message with the addresses of group members.
+// To and Cc headers of the message and of the MIME body are replaced by the
+// expanded lists; members reached through Bcc are never listed in headers.
+func (su *smtpUser) expandContactGroups(m *pmapi.Message, to []string, mimeBody string) ([]string, string, error) {
+	hasGroup := false
+	for _, address := range to {
+		if _, ok := getContactGroupName(address); ok {
+			hasGroup = true
+			break
+		}
+	}
+	if !hasGroup {
+		return to, mimeBody, nil
+	}
+
+	groups, err := su.client.ListContactGroups()
+	if err != nil {
+		return nil, "", errors.Wrap(err, "backend: cannot list contact groups")
+	}
+
+	members := map[string][]*mail.Address{}
+	expandedTo := []string{}
+	seen := map[string]bool{}
+
+	for _, address := range to {
+		localPart, ok := getContactGroupName(address)
+		if !ok {
+			if !seen[address] {
+				seen[address] = true
+				expandedTo = append(expandedTo, address)
+			}
+			continue
+		}
+
+		groupMembers, err := su.getContactGroupMembers(groups, localPart)
+		if err != nil {
+			return nil, "", err
+		}
+		members[address] = groupMembers
+
+		for _, member := range groupMembers {
+			if !seen[member.Address] {
+				seen[member.Address] = true
+				expandedTo = append(expandedTo, member.Address)
+			}
+		}
+	}
+
+	m.ToList = expandAddressList(m.ToList, members)
+	m.CCList = expandAddressList(m.CCList, members)
+	m.BCCList = expandAddressList(m.BCCList, members)
+
+	if m.Header == nil {
+		m.Header = mail.Header{}
+	}
+	setRecipientHeaders(textproto.MIMEHeader(m.Header), m)
+
+	if mimeBody, err = setMIMEBodyRecipients(mimeBody, m); err != nil {
+		return nil, "", err
+	}
+	return expandedTo, mimeBody, nil
+}
+
+func (su *smtpUser) getContactGroupMembers(groups []*pmapi.Label, localPart string) ([]*mail.Address, error) {
+	var group *pmapi.Label
+	for _, g := range groups {
+		if matchContactGroupName(g.Name, localPart) {
+			group = g
+			break
+		}
+	}
+	if group == nil {
+		return nil, errInvalidRecipient.wrap(errors.New("unknown contact group " + localPart))
+	}
+
+	contactEmails := []pmapi.ContactEmail{}
+	for page := 0; ; page++ {
+		pageEmails, err := su.client.GetContactEmailsByGroup(group.ID, page, contactGroupPageSize)
+		if err != nil {
+			return nil, errors.Wrap(err, "backend: cannot get contact group members")
+		}
+		contactEmails = append(contactEmails, pageEmails...)
+		if len(pageEmails) < contactGroupPageSize {
+			break
+		}
+	}
+	if len(contactEmails) == 0 {
+		return nil, errInvalidRecipient.wrap(errors.New("contact group " + group.Name + " has no members"))
+	}
+
+	addresses := []*mail.Address{}
+	for _, contactEmail := range contactEmails {
+		addresses = append(addresses, &mail.Address{Name: contactEmail.Name, Address: contactEmail.Email})
+	}
+	return addresses, nil
+}
+
+// expandAddressList replaces group addresses in the list with its members
+// while keeping the order and skipping addresses already in the list.
+func expandAddressList(list []*mail.Address, members map[string][]*mail.Address) []*mail.Address {
+	expanded := []*mail.Address{}
+	seen := map[string]bool{}
+	add := func(address *mail.Address) {
+		if !seen[address.Address] {
+			seen[address.Address] = true
+			expanded = append(expanded, address)
+		}
+	}
+
+	for _, address := range list {
+		groupMembers, ok := members[address.Address]
+		if !ok {
+			add(address)
+			continue
+		}
+		for _, member := range groupMembers {
+			add(member)
+		}
+	}
+	return expanded
+}
+
+// setRecipientHeaders sets To and Cc to the visible recipients of the message
+// and removes Bcc, because headers are the same for all recipients.
+func setRecipientHeaders(h textproto.MIMEHeader, m *pmapi.Message) {
+	h.Del("Bcc")
+	h.Del("To")
+	h.Del("Cc")
+	if len(m.ToList) > 0 {
+		h.Set("To", formatAddressList(m.ToList))
+	}
+	if len(m.CCList) > 0 {
+		h.Set("Cc", formatAddressList(m.CCList))
+	}
+}
+
+// setMIMEBodyRecipients replaces recipient headers of the top level of the
+// MIME body. The body itself is kept as it is and the header is written with
+// the same line endings as the original MIME body.
+func setMIMEBodyRecipients(mimeBody string, m *pmapi.Message) (string, error) {
+	eol := "\r\n"
+	if firstLine := strings.Index(mimeBody, "\n"); firstLine >= 0 && !strings.HasSuffix(mimeBody[:firstLine], "\r") {
+		eol = "\n"
+	}
+
+	// Body consisting only of the header does not have to end with blank line.
+	if !hasHeaderEnd(mimeBody) {
+		mimeBody = strings.TrimRight(mimeBody, "\r\n") + eol + eol
+	}
+
+	mm, err := mail.ReadMessage(strings.NewReader(mimeBody))
+	if err != nil {
+		return "", errors.Wrap(err, "backend: cannot parse MIME body")
+	}
+	body, err := ioutil.ReadAll(mm.Body)
+	if err != nil {
+		return "", errors.Wrap(err, "backend: cannot read MIME body")
+	}
+
+	header := textproto.MIMEHeader(mm.Header)
+	setRecipientHeaders(header, m)
+
+	newHeader := &strings.Builder{}
+	if err := http.Header(header).Write(newHeader); err != nil {
+		return "", errors.Wrap(err, "backend: cannot write MIME header")
+	}
+
+	return strings.ReplaceAll(newHeader.String(), "\r\n", eol) + eol + string(body), nil
+}
+
+// hasHeaderEnd checks whether the MIME body has the blank line separating header and body.
+func hasHeaderEnd(mimeBody string) bool {
+	return strings.HasPrefix(mimeBody, "\n") || strings.HasPrefix(mimeBody, "\r\n") ||
+		strings.Contains(mimeBody, "\n\n") || strings.Contains(mimeBody, "\n\r\n")
+}
+
+func formatAddressList(addresses []*mail.Address) string {
+	formatted := []string{}
+	for _, address := range addresses {
+		formatted = append(formatted, address.String())
+	}
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,212 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"fmt"
+	"net/mail"
+	"testing"
+
+	bridgemocks "github.com/ProtonMail/proton-bridge/internal/bridge/mocks"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetContactGroupName(t *testing.T) {
+	testCases := []struct {
+		address   string
+		wantName  string
+		wantGroup bool
+	}{
+		{"family@groups.bridge.local", "family", true},
+		{"Work-Team@GROUPS.bridge.local", "Work-Team", true},
+		{"user@pm.me", "", false},
+		{"groups.bridge.local", "", false},
+		{"@groups.bridge.local", "", false},
+		{"user@sub.groups.bridge.local", "", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // bind
+		t.Run(tc.address, func(t *testing.T) {
+			name, ok := getContactGroupName(tc.address)
+			assert.Equal(t, tc.wantGroup, ok)
+			assert.Equal(t, tc.wantName, name)
+		})
+	}
+}
+
+func TestMatchContactGroupName(t *testing.T) {
+	assert.True(t, matchContactGroupName("Family", "family"))
+	assert.True(t, matchContactGroupName("Work Team", "work-team"))
+	assert.False(t, matchContactGroupName("Work Team", "work"))
+}
+
+func TestExpandContactGroups(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := bridgemocks.NewMockPMAPIProvider(mockCtrl)
+	su := &smtpUser{client: client}
+
+	client.EXPECT().ListContactGroups().Return([]*pmapi.Label{
+		{ID: "otherID", Name: "Other"},
+		{ID: "familyID", Name: "Family"},
+	}, nil)
+	client.EXPECT().GetContactEmailsByGroup("familyID", 0, contactGroupPageSize).Return([]pmapi.ContactEmail{
+		{Name: "Alice", Email: "alice@pm.me"},
+		{Name: "Bob", Email: "bob@pm.me"},
+	}, nil)
+
+	m := &pmapi.Message{
+		Header: mail.Header{},
+		ToList: []*mail.Address{
+			{Address: "bob@pm.me"},
+			{Address: "family@groups.bridge.local"},
+		},
+		CCList: []*mail.Address{
+			{Address: "carol@pm.me"},
+		},
+	}
+
+	mimeBody := "From: me@pm.me\r\nTo: bob@pm.me,\r\n family@groups.bridge.local\r\nCc: carol@pm.me\r\nSubject: Hi\r\n\r\nTo: body line\r\n"
+
+	to, mimeBody, err := su.expandContactGroups(m, []string{"bob@pm.me", "family@groups.bridge.local", "carol@pm.me"}, mimeBody)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"bob@pm.me", "alice@pm.me", "carol@pm.me"}, to)
+	assert.Equal(t, []*mail.Address{
+		{Address: "bob@pm.me"},
+		{Name: "Alice", Address: "alice@pm.me"},
+	}, m.ToList)
+	assert.Equal(t, []*mail.Address{{Address: "carol@pm.me"}}, m.CCList)
+	assert.Equal(t, `<bob@pm.me>, "Alice" <alice@pm.me>`, m.Header.Get("To"))
+	assert.Equal(t, "Cc: <carol@pm.me>\r\nFrom: me@pm.me\r\nSubject: Hi\r\nTo: <bob@pm.me>, \"Alice\" <alice@pm.me>\r\n\r\nTo: body line\r\n", mimeBody)
+}
+
+func TestExpandContactGroups_Bcc(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := bridgemocks.NewMockPMAPIProvider(mockCtrl)
+	su := &smtpUser{client: client}
+
+	client.EXPECT().ListContactGroups().Return([]*pmapi.Label{{ID: "familyID", Name: "Family"}}, nil)
+	client.EXPECT().GetContactEmailsByGroup("familyID", 0, contactGroupPageSize).Return([]pmapi.ContactEmail{
+		{Email: "alice@pm.me"},
+	}, nil)
+
+	m := &pmapi.Message{
+		Header:  mail.Header{"Bcc": []string{"family@groups.bridge.local"}},
+		ToList:  []*mail.Address{{Address: "bob@pm.me"}},
+		BCCList: []*mail.Address{{Address: "family@groups.bridge.local"}},
+	}
+	mimeBody := "To: bob@pm.me\r\nBcc: family@groups.bridge.local\r\n\nBody\r\n"
+
+	to, mimeBody, err := su.expandContactGroups(m, []string{"bob@pm.me", "family@groups.bridge.local"}, mimeBody)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"bob@pm.me", "alice@pm.me"}, to)
+	assert.Equal(t, []*mail.Address{{Address: "alice@pm.me"}}, m.BCCList)
+	assert.Empty(t, m.Header.Get("Bcc"))
+	assert.NotContains(t, mimeBody, "alice@pm.me")
+	assert.NotContains(t, mimeBody, "groups.bridge.local")
+}
+
+func TestSetMIMEBodyRecipients(t *testing.T) {
+	m := &pmapi.Message{
+		ToList: []*mail.Address{{Address: "alice@pm.me"}},
+	}
+
+	tests := []struct {
+		mimeBody, want string
+	}{
+		{
+			"From: me@pm.me\nTo: family@groups.bridge.local\n\nBody\nTo: body line\n",
+			"From: me@pm.me\nTo: <alice@pm.me>\n\nBody\nTo: body line\n",
+		},
+		{
+			"From: me@pm.me\r\nTo: family@groups.bridge.local\r\n\r\nBody\r\n",
+			"From: me@pm.me\r\nTo: <alice@pm.me>\r\n\r\nBody\r\n",
+		},
+		{
+			"From: me@pm.me\nTo: family@groups.bridge.local\n",
+			"From: me@pm.me\nTo: <alice@pm.me>\n\n",
+		},
+		{
+			"From: me@pm.me\r\nBcc: family@groups.bridge.local",
+			"From: me@pm.me\r\nTo: <alice@pm.me>\r\n\r\n",
+		},
+	}
+
+	for _, test := range tests {
+		mimeBody, err := setMIMEBodyRecipients(test.mimeBody, m)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, mimeBody)
+	}
+}
+
+func TestExpandContactGroups_Pagination(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := bridgemocks.NewMockPMAPIProvider(mockCtrl)
+	su := &smtpUser{client: client}
+
+	fullPage := []pmapi.ContactEmail{}
+	for i := 0; i < contactGroupPageSize; i++ {
+		fullPage = append(fullPage, pmapi.ContactEmail{Email: fmt.Sprintf("member%d@pm.me", i)})
+	}
+
+	client.EXPECT().ListContactGroups().Return([]*pmapi.Label{{ID: "familyID", Name: "Family"}}, nil)
+	gomock.InOrder(
+		client.EXPECT().GetContactEmailsByGroup("familyID", 0, contactGroupPageSize).Return(fullPage, nil),
+		client.EXPECT().GetContactEmailsByGroup("familyID", 1, contactGroupPageSize).Return([]pmapi.ContactEmail{{Email: "last@pm.me"}}, nil),
+	)
+
+	to, _, err := su.expandContactGroups(&pmapi.Message{}, []string{"family@groups.bridge.local"}, "")
+	require.NoError(t, err)
+	assert.Len(t, to, contactGroupPageSize+1)
+	assert.Equal(t, "last@pm.me", to[contactGroupPageSize])
+}
+
+func TestExpandContactGroups_NoGroup(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	su := &smtpUser{client: bridgemocks.NewMockPMAPIProvider(mockCtrl)}
+
+	to, mimeBody, err := su.expandContactGroups(&pmapi.Message{}, []string{"bob@pm.me"}, "To: bob@pm.me\r\n\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bob@pm.me"}, to)
+	assert.Equal(t, "To: bob@pm.me\r\n\n", mimeBody)
+}
+
+func TestExpandContactGroups_UnknownGroup(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	client := bridgemocks.NewMockPMAPIProvider(mockCtrl)
+	su := &smtpUser{client: client}
+
+	client.EXPECT().ListContactGroups().Return([]*pmapi.Label{}, nil)
+
+	_, _, err := su.expandContactGroups(&pmapi.Message{}, []string{"family@groups.bridge.local"}, "")
+	assert.Error(t, err)
+}
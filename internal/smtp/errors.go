@@ -0,0 +1,163 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/pkg/errors"
+)
+
+// enhancedCode is a status code as defined by RFC 3463.
+type enhancedCode [3]int
+
+func (c enhancedCode) String() string {
+	return fmt.Sprintf("%d.%d.%d", c[0], c[1], c[2])
+}
+
+// smtpError is an error returned to the SMTP client. The reply code tells
+// the client whether it should try again later (4xx) or bounce the message (5xx).
+type smtpError struct {
+	Code         int
+	EnhancedCode enhancedCode
+	Message      string
+
+	// err is the original cause of the failure.
+	err error
+}
+
+func newSMTPError(code int, enhanced enhancedCode, message string) *smtpError {
+	return &smtpError{
+		Code:         code,
+		EnhancedCode: enhanced,
+		Message:      message,
+	}
+}
+
+// wrap returns copy of the error with the given cause.
+func (e *smtpError) wrap(err error) *smtpError {
+	wrapped := *e
+	wrapped.err = err
+	return &wrapped
+}
+
+func (e *smtpError) Error() string {
+	if e.err == nil {
+		return e.EnhancedCode.String() + " " + e.Message
+	}
+	return e.EnhancedCode.String() + " " + e.Message + ": " + e.err.Error()
+}
+
+// IsTemporary returns whether the client should try to send the message again later.
+func (e *smtpError) IsTemporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+//nolint[gochecknoglobals]
+var (
+	// Transient failures.
+	errAPINotReachable      = newSMTPError(451, enhancedCode{4, 4, 1}, "Cannot reach the server, try again later")
+	errConnectionFailure    = newSMTPError(451, enhancedCode{4, 4, 2}, "Connection to the server failed, try again later")
+	errUpgradeApplication   = newSMTPError(451, enhancedCode{4, 3, 5}, "Bridge upgrade required")
+	errRateLimited          = newSMTPError(451, enhancedCode{4, 7, 0}, "Too many requests, try again later")
+	errInvalidToken         = newSMTPError(454, enhancedCode{4, 7, 0}, "Temporary authentication failure")
+	errMessageIsSending     = newSMTPError(451, enhancedCode{4, 3, 0}, "Message is still being sent, try again later")
+	errOutgoingRulesInvalid = newSMTPError(451, enhancedCode{4, 3, 5}, "Outgoing rules file is invalid, fix it to send messages")
+
+	// Permanent failures.
+	errInvalidSender       = newSMTPError(553, enhancedCode{5, 7, 1}, "Sender address is not owned by user")
+	errNoRecipient         = newSMTPError(503, enhancedCode{5, 5, 1}, "No recipient specified")
+	errInvalidRecipient    = newSMTPError(550, enhancedCode{5, 1, 1}, "Invalid recipient")
+	errRecipientKey        = newSMTPError(554, enhancedCode{5, 7, 5}, "Cannot encrypt message for recipient")
+	errInvalidMessage      = newSMTPError(554, enhancedCode{5, 6, 0}, "Cannot parse message")
+	errMessageSizeExceeded = newSMTPError(552, enhancedCode{5, 3, 4}, "Message size exceeds limit")
+	errSendingCanceled     = newSMTPError(554, enhancedCode{5, 7, 0}, "Sending was canceled by user")
+	errTransactionFailed   = newSMTPError(554, enhancedCode{5, 0, 0}, "Transaction failed")
+	errAPIRejectedMessage  = newSMTPError(554, enhancedCode{5, 7, 0}, "Message was rejected by the server")
+	errRejectedByRule      = newSMTPError(550, enhancedCode{5, 7, 1}, "Message was rejected by outgoing rule")
+)
+
+// toSMTPError classifies the error returned during sending and maps it onto
+// an SMTP reply code. Errors which are not known are treated as permanent.
+func toSMTPError(err error) *smtpError {
+	if smtpErr, ok := err.(*smtpError); ok {
+		return smtpErr
+	}
+
+	cause := errors.Cause(err)
+
+	switch cause {
+	case pmapi.ErrAPINotReachable:
+		return errAPINotReachable.wrap(err)
+	case pmapi.ErrUpgradeApplication:
+		return errUpgradeApplication.wrap(err)
+	case pmapi.ErrInvalidToken:
+		return errInvalidToken.wrap(err)
+	case store.ErrMessageIsSending:
+		return errMessageIsSending.wrap(err)
+	case goSMTPBackend.ErrDataTooLarge:
+		return errMessageSizeExceeded.wrap(err)
+	}
+
+	switch typedErr := cause.(type) {
+	case *smtpError:
+		return typedErr
+	case *pmapi.Error:
+		return apiErrorToSMTPError(err, *typedErr)
+	case pmapi.Error:
+		return apiErrorToSMTPError(err, typedErr)
+	case net.Error:
+		if typedErr.Timeout() {
+			return errConnectionFailure.wrap(err)
+		}
+	}
+
+	return errTransactionFailed.wrap(err)
+}
+
+func apiErrorToSMTPError(err error, apiErr pmapi.Error) *smtpError {
+	if apiErr.StatusCode == http.StatusTooManyRequests {
+		return errRateLimited.wrap(err)
+	}
+
+	switch apiErr.Code {
+	case pmapi.BansRequests:
+		return errRateLimited.wrap(err)
+	case pmapi.APIOffline:
+		return errAPINotReachable.wrap(err)
+	}
+	return errAPIRejectedMessage.wrap(err)
+}
+
+// goSMTPError converts the error to the error type of go-smtp. The go-smtp
+// server writes its own reply code only for its error type (the one behind
+// `ErrDataTooLarge`); any other error is reported as 554. The type is not
+// exported by go-smtp, therefore a copy of `ErrDataTooLarge` is used.
+// The reply contains only the fixed text of the error; the cause can contain
+// internal details or line breaks and is only logged.
+func (e *smtpError) goSMTPError() error {
+	goSMTPErr := *goSMTPBackend.ErrDataTooLarge
+	goSMTPErr.Code = e.Code
+	goSMTPErr.Message = e.EnhancedCode.String() + " " + e.Message
+	return &goSMTPErr
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/internal/store"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	goSMTPBackend "github.com/emersion/go-smtp"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type testTimeoutError struct{}
+
+func (testTimeoutError) Error() string   { return "i/o timeout" }
+func (testTimeoutError) Timeout() bool   { return true }
+func (testTimeoutError) Temporary() bool { return true }
+
+func TestToSMTPError(t *testing.T) {
+	testCases := []struct {
+		name          string
+		err           error
+		wantCode      int
+		wantEnhanced  string
+		wantTemporary bool
+	}{
+		{"api not reachable", pmapi.ErrAPINotReachable, 451, "4.4.1", true},
+		{"wrapped api not reachable", errors.Wrap(pmapi.ErrAPINotReachable, "failed to create draft"), 451, "4.4.1", true},
+		{"upgrade", pmapi.ErrUpgradeApplication, 451, "4.3.5", true},
+		{"invalid token", pmapi.ErrInvalidToken, 454, "4.7.0", true},
+		{"bans requests", &pmapi.Error{Code: pmapi.BansRequests}, 451, "4.7.0", true},
+		{"too many requests", &pmapi.Error{StatusCode: 429, ErrorMessage: "Too Many Requests"}, 451, "4.7.0", true},
+		{"api offline", pmapi.Error{Code: pmapi.APIOffline}, 451, "4.4.1", true},
+		{"api rejected", &pmapi.Error{Code: 2001, ErrorMessage: "Invalid"}, 554, "5.7.0", false},
+		{"timeout", testTimeoutError{}, 451, "4.4.2", true},
+		{"message is sending", store.ErrMessageIsSending, 451, "4.3.0", true},
+		{"data too large", goSMTPBackend.ErrDataTooLarge, 552, "5.3.4", false},
+		{"invalid sender", errInvalidSender, 553, "5.7.1", false},
+		{"no recipient", errNoRecipient, 503, "5.5.1", false},
+		{"recipient key", errRecipientKey.wrap(errors.New("no key")), 554, "5.7.5", false},
+		{"canceled", errSendingCanceled, 554, "5.7.0", false},
+		{"wrapped smtp error", errors.Wrap(errInvalidRecipient, "group"), 550, "5.1.1", false},
+		{"unknown", errors.New("unknown"), 554, "5.0.0", false},
+	}
+	for _, tc := range testCases {
+		tc := tc // bind
+		t.Run(tc.name, func(t *testing.T) {
+			smtpErr := toSMTPError(tc.err)
+			assert.Equal(t, tc.wantCode, smtpErr.Code)
+			assert.Equal(t, tc.wantEnhanced, smtpErr.EnhancedCode.String())
+			assert.Equal(t, tc.wantTemporary, smtpErr.IsTemporary())
+		})
+	}
+}
+
+func TestSMTPError_Error(t *testing.T) {
+	assert.Equal(t, "5.7.1 Sender address is not owned by user", errInvalidSender.Error())
+	assert.Equal(t, "5.7.0 Message was rejected by the server: reason", errAPIRejectedMessage.wrap(errors.New("reason")).Error())
+}
+
+func TestSMTPError_GoSMTPError(t *testing.T) {
+	err := errAPINotReachable.wrap(errors.New("dial tcp:\r\n500 internal")).goSMTPError()
+
+	// go-smtp uses reply code only of its own error type.
+	want := *goSMTPBackend.ErrDataTooLarge
+	want.Code = 451
+	want.Message = "4.4.1 Cannot reach the server, try again later"
+	assert.Equal(t, &want, err)
+
+	// The error of go-smtp itself is not changed.
+	assert.Equal(t, "Maximum message size exceeded", goSMTPBackend.ErrDataTooLarge.Error())
+}
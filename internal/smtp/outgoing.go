@@ -0,0 +1,317 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strings"
+
+	pmmime "github.com/ProtonMail/proton-bridge/pkg/mime"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+// Types of rules which can be used in the outgoing rules file.
+const (
+	outgoingRuleDisclaimer     = "disclaimer"
+	outgoingRuleBlockDomains   = "block-domains"
+	outgoingRuleRequireSubject = "require-subject"
+)
+
+// outgoingRuleConfig is one item of the outgoing rules file, for example:
+//
+//	[
+//	  {"Type": "disclaimer", "Text": "Sent from my office."},
+//	  {"Type": "block-domains", "Domains": ["example.com"]},
+//	  {"Type": "require-subject", "Pattern": "\\[TICKET-[0-9]+\\]"}
+//	]
+type outgoingRuleConfig struct {
+	Type    string
+	Text    string
+	Domains []string
+	Pattern string
+}
+
+// outgoingMessage is the parsed message passed through the outgoing rules
+// before the draft is created. Rules can modify it or reject it.
+type outgoingMessage struct {
+	message   *pmapi.Message
+	to        []string
+	mimeBody  string
+	plainBody string
+}
+
+type outgoingRule interface {
+	apply(*outgoingMessage) error
+}
+
+// outgoingPipeline runs all configured rules on outgoing messages in order.
+// The first rule rejecting the message stops the pipeline.
+type outgoingPipeline struct {
+	rules []outgoingRule
+}
+
+// loadOutgoingPipeline reads rules from the file. Missing file means there
+// are no rules and nil pipeline is returned.
+// outgoingRulesVersion identifies the content of the rules file
+// to know when the rules have to be loaded again.
+type outgoingRulesVersion struct {
+	modTime int64
+	size    int64
+}
+
+// getOutgoingRulesVersion returns zero version when the file does not exist.
+func getOutgoingRulesVersion(path string) outgoingRulesVersion {
+	info, err := os.Stat(path)
+	if err != nil {
+		return outgoingRulesVersion{}
+	}
+	return outgoingRulesVersion{modTime: info.ModTime().UnixNano(), size: info.Size()}
+}
+
+func loadOutgoingPipeline(path string) (*outgoingPipeline, error) {
+	data, err := ioutil.ReadFile(path) //nolint[gosec]
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	configs := []outgoingRuleConfig{}
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, errors.Wrap(err, "cannot parse outgoing rules")
+	}
+
+	return newOutgoingPipeline(configs)
+}
+
+func newOutgoingPipeline(configs []outgoingRuleConfig) (*outgoingPipeline, error) {
+	pipeline := &outgoingPipeline{}
+	for i, config := range configs {
+		rule, err := newOutgoingRule(config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule #%d", i+1)
+		}
+		pipeline.rules = append(pipeline.rules, rule)
+	}
+	return pipeline, nil
+}
+
+func newOutgoingRule(config outgoingRuleConfig) (outgoingRule, error) {
+	switch strings.ToLower(config.Type) {
+	case outgoingRuleDisclaimer:
+		if config.Text == "" {
+			return nil, errors.New("disclaimer text is empty")
+		}
+		return &disclaimerRule{text: config.Text}, nil
+	case outgoingRuleBlockDomains:
+		if len(config.Domains) == 0 {
+			return nil, errors.New("no domain to block")
+		}
+		domains := []string{}
+		for _, domain := range config.Domains {
+			domains = append(domains, strings.ToLower(strings.TrimPrefix(domain, "@")))
+		}
+		return &blockDomainsRule{domains: domains}, nil
+	case outgoingRuleRequireSubject:
+		pattern, err := regexp.Compile(config.Pattern)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid subject pattern")
+		}
+		return &requireSubjectRule{pattern: pattern}, nil
+	}
+	return nil, errors.Errorf("unknown rule type %q", config.Type)
+}
+
+// run applies all rules to the message. It is safe to call on nil pipeline.
+func (p *outgoingPipeline) run(om *outgoingMessage) error {
+	if p == nil {
+		return nil
+	}
+	for _, rule := range p.rules {
+		if err := rule.apply(om); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blockDomainsRule rejects messages to any recipient in one of the domains
+// or their subdomains.
+type blockDomainsRule struct {
+	domains []string
+}
+
+func (r *blockDomainsRule) apply(om *outgoingMessage) error {
+	for _, recipient := range om.to {
+		at := strings.LastIndex(recipient, "@")
+		if at < 0 {
+			continue
+		}
+		recipientDomain := strings.ToLower(recipient[at+1:])
+		for _, domain := range r.domains {
+			if recipientDomain == domain || strings.HasSuffix(recipientDomain, "."+domain) {
+				return errRejectedByRule.wrap(errors.Errorf("sending to %s is not allowed", domain))
+			}
+		}
+	}
+	return nil
+}
+
+// requireSubjectRule rejects messages with subject not matching the pattern.
+type requireSubjectRule struct {
+	pattern *regexp.Regexp
+}
+
+func (r *requireSubjectRule) apply(om *outgoingMessage) error {
+	if !r.pattern.MatchString(om.message.Subject) {
+		return errRejectedByRule.wrap(errors.Errorf("subject has to match %q", r.pattern.String()))
+	}
+	return nil
+}
+
+// disclaimerRule appends the text to the end of every body of the message.
+type disclaimerRule struct {
+	text string
+}
+
+func (r *disclaimerRule) apply(om *outgoingMessage) error {
+	if om.message.MIMEType == "text/html" {
+		om.message.Body += r.htmlText()
+	} else {
+		om.message.Body += r.plainText()
+	}
+
+	if om.plainBody != "" {
+		om.plainBody += r.plainText()
+	}
+
+	mimeBody, err := r.appendToMIMEBody(om.mimeBody)
+	if err != nil {
+		return errors.Wrap(err, "cannot add disclaimer")
+	}
+	om.mimeBody = mimeBody
+
+	return nil
+}
+
+func (r *disclaimerRule) plainText() string {
+	return "\r\n\r\n" + r.text
+}
+
+func (r *disclaimerRule) htmlText() string {
+	text := html.EscapeString(r.text)
+	text = strings.Replace(text, "\n", "<br>", -1)
+	return "<br><br><div>" + text + "</div>"
+}
+
+// appendToMIMEBody visits the MIME body again to append the disclaimer
+// to every text part which is not an attachment.
+func (r *disclaimerRule) appendToMIMEBody(mimeBody string) (string, error) {
+	mm, err := mail.ReadMessage(strings.NewReader(mimeBody))
+	if err != nil {
+		return "", err
+	}
+
+	printAccepter := pmmime.NewMIMEPrinter()
+	disclaimerAppender := newDisclaimerAppender(printAccepter, r)
+	visitor := pmmime.NewMimeVisitor(disclaimerAppender)
+	if err := pmmime.VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+		return "", err
+	}
+
+	return printAccepter.String(), nil
+}
+
+// disclaimerAppender is VisitAcceptor appending the disclaimer to text parts.
+// Changed parts are always re-encoded as quoted-printable UTF-8.
+type disclaimerAppender struct {
+	target pmmime.VisitAcceptor
+	rule   *disclaimerRule
+}
+
+func newDisclaimerAppender(targetAccepter pmmime.VisitAcceptor, rule *disclaimerRule) *disclaimerAppender {
+	return &disclaimerAppender{
+		target: targetAccepter,
+		rule:   rule,
+	}
+}
+
+func (da *disclaimerAppender) Accept(partReader io.Reader, header textproto.MIMEHeader, hasPlainSibling bool, isFirst, isLast bool) error {
+	if !isFirst || !pmmime.IsLeaf(header) {
+		return da.target.Accept(partReader, header, hasPlainSibling, isFirst, isLast)
+	}
+
+	mediaType, params, err := pmmime.ParseMediaType(header.Get("Content-Type"))
+	if header.Get("Content-Type") == "" {
+		mediaType, params, err = "text/plain", map[string]string{}, nil
+	}
+	disp, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	if err != nil || disp == "attachment" || (mediaType != "text/plain" && mediaType != "text/html") {
+		return da.target.Accept(partReader, header, hasPlainSibling, isFirst, isLast)
+	}
+
+	decodedPart := pmmime.DecodeContentEncoding(partReader, header.Get("Content-Transfer-Encoding"))
+	if decodedPart == nil {
+		log.Warnf("Unsupported Content-Transfer-Encoding '%v', disclaimer not added", header.Get("Content-Transfer-Encoding"))
+		return da.target.Accept(partReader, header, hasPlainSibling, isFirst, isLast)
+	}
+	decoded, err := ioutil.ReadAll(decodedPart)
+	if err != nil {
+		return err
+	}
+	if decoded, err = pmmime.DecodeCharset(decoded, params); err != nil {
+		return err
+	}
+
+	if mediaType == "text/html" {
+		decoded = append(decoded, []byte(da.rule.htmlText())...)
+	} else {
+		decoded = append(decoded, []byte(da.rule.plainText())...)
+	}
+
+	encoded := &bytes.Buffer{}
+	w := quotedprintable.NewWriter(encoded)
+	if _, err := w.Write(decoded); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	newHeader := textproto.MIMEHeader{}
+	for k, v := range header {
+		newHeader[k] = v
+	}
+	params["charset"] = "utf-8"
+	newHeader.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+	newHeader.Set("Content-Transfer-Encoding", "quoted-printable")
+
+	return da.target.Accept(encoded, newHeader, hasPlainSibling, isFirst, isLast)
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/message"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadOutgoingPipeline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outgoing-rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "outgoing_rules.json")
+
+	pipeline, err := loadOutgoingPipeline(path)
+	require.NoError(t, err)
+	assert.Nil(t, pipeline)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[
+		{"Type": "disclaimer", "Text": "Disclaimer"},
+		{"Type": "block-domains", "Domains": ["example.com"]},
+		{"Type": "require-subject", "Pattern": "TICKET-[0-9]+"}
+	]`), 0600))
+	pipeline, err = loadOutgoingPipeline(path)
+	require.NoError(t, err)
+	assert.Len(t, pipeline.rules, 3)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"Type": "unknown"}]`), 0600))
+	_, err = loadOutgoingPipeline(path)
+	assert.Error(t, err)
+}
+
+func TestNewOutgoingRule_Invalid(t *testing.T) {
+	testCases := []outgoingRuleConfig{
+		{Type: "disclaimer"},
+		{Type: "block-domains"},
+		{Type: "require-subject", Pattern: "["},
+		{Type: "unknown"},
+	}
+	for _, tc := range testCases {
+		_, err := newOutgoingRule(tc)
+		assert.Error(t, err, tc.Type)
+	}
+}
+
+func TestOutgoingPipeline_Nil(t *testing.T) {
+	var pipeline *outgoingPipeline
+	assert.NoError(t, pipeline.run(&outgoingMessage{}))
+}
+
+func TestBlockDomainsRule(t *testing.T) {
+	rule, err := newOutgoingRule(outgoingRuleConfig{Type: "block-domains", Domains: []string{"Example.com"}})
+	require.NoError(t, err)
+
+	assert.NoError(t, rule.apply(&outgoingMessage{to: []string{"user@pm.me", "user@notexample.com"}}))
+
+	err = rule.apply(&outgoingMessage{to: []string{"user@pm.me", "user@EXAMPLE.com"}})
+	assert.Equal(t, 550, toSMTPError(err).Code)
+
+	err = rule.apply(&outgoingMessage{to: []string{"user@mail.example.com"}})
+	assert.Equal(t, 550, toSMTPError(err).Code)
+}
+
+func TestRequireSubjectRule(t *testing.T) {
+	rule, err := newOutgoingRule(outgoingRuleConfig{Type: "require-subject", Pattern: `\[TICKET-[0-9]+\]`})
+	require.NoError(t, err)
+
+	assert.NoError(t, rule.apply(&outgoingMessage{message: &pmapi.Message{Subject: "Re: [TICKET-42] Bug"}}))
+
+	err = rule.apply(&outgoingMessage{message: &pmapi.Message{Subject: "Bug"}})
+	assert.Equal(t, "5.7.1", toSMTPError(err).EnhancedCode.String())
+}
+
+func TestDisclaimerRule(t *testing.T) {
+	raw := "From: Sender <sender@pm.me>\r\n" +
+		"To: Receiver <receiver@pm.me>\r\n" +
+		"Subject: Test\r\n" +
+		"Content-Type: multipart/mixed; boundary=longrandomstring\r\n" +
+		"\r\n" +
+		"--longrandomstring\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=E9\r\n" +
+		"--longrandomstring\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: attachment; filename=notes.txt\r\n" +
+		"\r\n" +
+		"attachment\r\n" +
+		"--longrandomstring--\r\n"
+
+	m, mimeBody, plainBody, _, err := message.Parse(strings.NewReader(raw), "", "")
+	require.NoError(t, err)
+
+	pipeline, err := newOutgoingPipeline([]outgoingRuleConfig{{Type: "disclaimer", Text: "Disclaimer <1>"}})
+	require.NoError(t, err)
+
+	om := &outgoingMessage{message: m, mimeBody: mimeBody, plainBody: plainBody}
+	require.NoError(t, pipeline.run(om))
+
+	assert.True(t, strings.HasSuffix(m.Body, "Disclaimer <1>"), m.Body)
+	assert.True(t, strings.HasSuffix(om.plainBody, "Disclaimer <1>"), om.plainBody)
+
+	assert.Contains(t, om.mimeBody, "Caf=C3=A9\r\n\r\nDisclaimer <1>")
+	assert.Contains(t, om.mimeBody, "charset=utf-8")
+	assert.Equal(t, 1, strings.Count(om.mimeBody, "Disclaimer"))
+
+	// Result has to be still valid message which can be parsed again.
+	_, _, _, atts, err := message.Parse(strings.NewReader(om.mimeBody), "", "")
+	require.NoError(t, err)
+	assert.Len(t, atts, 1)
+}
+
+func TestDisclaimerRule_HTML(t *testing.T) {
+	raw := "From: Sender <sender@pm.me>\r\n" +
+		"To: Receiver <receiver@pm.me>\r\n" +
+		"Subject: Test\r\n" +
+		"Content-Type: text/html\r\n" +
+		"\r\n" +
+		"<p>Hello</p>\r\n"
+
+	m, mimeBody, plainBody, _, err := message.Parse(strings.NewReader(raw), "", "")
+	require.NoError(t, err)
+
+	rule := &disclaimerRule{text: "Disclaimer <1>"}
+	om := &outgoingMessage{message: m, mimeBody: mimeBody, plainBody: plainBody}
+	require.NoError(t, rule.apply(om))
+
+	assert.True(t, strings.HasSuffix(m.Body, "<div>Disclaimer &lt;1&gt;</div>"), m.Body)
+	assert.Contains(t, om.mimeBody, "<div>Disclaimer &lt;1&gt;</div>")
+	assert.Contains(t, om.mimeBody, "Disclaimer <1>")
+}
+
+type testOutgoingRulesConfig string
+
+func (path testOutgoingRulesConfig) GetOutgoingRulesPath() string {
+	return string(path)
+}
+
+func TestSMTPBackend_InvalidOutgoingRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outgoing-rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "outgoing_rules.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"Type": "unknown"}]`), 0600))
+
+	sb := newSMTPBackend(nil, nil, nil, testOutgoingRulesConfig(path), nil)
+
+	// Nothing can be sent while the rules are invalid.
+	_, err = sb.getOutgoingPipeline()
+	require.Error(t, err)
+	smtpErr := toSMTPError(err)
+	assert.Equal(t, errOutgoingRulesInvalid.Code, smtpErr.Code)
+	assert.True(t, smtpErr.IsTemporary())
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"Type": "block-domains", "Domains": ["example.com"]}]`), 0600))
+	pipeline, err := sb.getOutgoingPipeline()
+	require.NoError(t, err)
+	assert.Len(t, pipeline.rules, 1)
+}
+
+func TestSMTPBackend_ReloadOutgoingRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outgoing-rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir) //nolint[errcheck]
+
+	path := filepath.Join(dir, "outgoing_rules.json")
+	sb := newSMTPBackend(nil, nil, nil, testOutgoingRulesConfig(path), nil)
+
+	pipeline, err := sb.getOutgoingPipeline()
+	require.NoError(t, err)
+	assert.Nil(t, pipeline)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"Type": "require-subject"}]`), 0600))
+	pipeline, err = sb.getOutgoingPipeline()
+	require.NoError(t, err)
+	assert.Len(t, pipeline.rules, 1)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`[{"Type": "require-subject"}, {"Type": "block-domains", "Domains": ["example.com"]}]`), 0600))
+	modTime := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	pipeline, err = sb.getOutgoingPipeline()
+	require.NoError(t, err)
+	assert.Len(t, pipeline.rules, 2)
+
+	require.NoError(t, os.Remove(path))
+	pipeline, err = sb.getOutgoingPipeline()
+	require.NoError(t, err)
+	assert.Nil(t, pipeline)
+}
@@ -33,4 +33,7 @@ type storeUserProvider interface {
 		attachedPublicKeyName string,
 		parentID string) (*pmapi.Message, []*pmapi.Attachment, error)
 	SendMessage(messageID string, req *pmapi.SendMessageReq) error
+	StartSending(message *pmapi.Message) (hash string, wasSent bool, err error)
+	RecordSendingMessage(hash, messageID string) error
+	FinishSending(hash string, sent bool)
 }
@@ -21,8 +21,8 @@ package smtp
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
-	"fmt"
 	"io"
 	"math/rand"
 	"mime"
@@ -50,6 +50,11 @@ type smtpUser struct {
 	client        bridge.PMAPIProvider
 	storeUser     storeUserProvider
 	addressID     string
+
+	// ctx is canceled on logout to abort API lookups of the connection.
+	// Sending itself is not aborted so the result is always recorded.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // newSMTPUser returns struct implementing go-smtp/session interface.
@@ -68,6 +73,8 @@ func newSMTPUser(
 		return nil, errors.New("user database is not initialized")
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	return &smtpUser{
 		panicHandler:  panicHandler,
 		eventListener: eventListener,
@@ -76,22 +83,35 @@ func newSMTPUser(
 		client:        client,
 		storeUser:     storeUser,
 		addressID:     addressID,
+		ctx:           ctx,
+		cancel:        cancel,
 	}, nil
 }
 
 // Send sends an email from the given address to the given addresses with the given body.
-func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err error) { //nolint[funlen]
+// Errors are returned with SMTP reply codes so the client knows whether to retry or bounce.
+func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) error {
 	// Called from go-smtp in goroutines - we need to handle panics for each function.
 	defer su.panicHandler.HandlePanic()
 
+	if err := su.send(from, to, messageReader); err != nil {
+		smtpErr := toSMTPError(err)
+		log.WithError(err).WithField("code", smtpErr.Code).Warn("Sending failed")
+		return smtpErr.goSMTPError()
+	}
+	return nil
+}
+
+func (su *smtpUser) send(from string, to []string, messageReader io.Reader) (err error) { //nolint[funlen]
 	mailSettings, err := su.client.GetMailSettings()
 	if err != nil {
 		return err
 	}
 
-	var addr *pmapi.Address = su.client.Addresses().ByEmail(from)
+	// Plus-addressed and catch-all senders are sent from the owning address.
+	var addr *pmapi.Address = su.client.Addresses().BySender(from)
 	if addr == nil {
-		err = errors.New("backend: invalid email address: not owned by user")
+		err = errInvalidSender
 		return
 	}
 	kr := addr.KeyRing()
@@ -108,13 +128,31 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 
 	message, mimeBody, plainBody, attReaders, err := message.Parse(messageReader, attachedPublicKey, attachedPublicKeyName)
 	if err != nil {
-		return
+		return errInvalidMessage.wrap(err)
 	}
-	clearBody := message.Body
 
 	externalID := message.Header.Get("Message-Id")
 	externalID = strings.Trim(externalID, "<>")
 
+	// Contact groups have to be expanded before anything else is done with
+	// recipients, so that every member gets its own encryption decision.
+	if to, mimeBody, err = su.expandContactGroups(message, to, mimeBody); err != nil {
+		return err
+	}
+
+	// User-defined rules can change the message or reject it before
+	// anything is uploaded to the server.
+	pipeline, err := su.backend.getOutgoingPipeline()
+	if err != nil {
+		return err
+	}
+	outgoing := &outgoingMessage{message: message, to: to, mimeBody: mimeBody, plainBody: plainBody}
+	if err = pipeline.run(outgoing); err != nil {
+		return err
+	}
+	mimeBody, plainBody = outgoing.mimeBody, outgoing.plainBody
+	clearBody := message.Body
+
 	draftID, parentID := su.handleReferencesHeader(message)
 
 	if err = su.handleSenderAndRecipients(message, addr, from, to); err != nil {
@@ -133,32 +171,28 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 	message.ExternalID = externalID
 
 	// If Outlook does not get a response quickly, it will try to send the message again, leading
-	// to sending the same message multiple times. In case we detect the same message is in the
-	// sending queue, we wait a minute to finish the first request. If the message is still being
-	// sent after the timeout, we return an error back to the client. The UX is not the best,
-	// but it's better than sending the message many times. If the message was sent, we simply return
-	// nil to indicate it's OK.
-	sendRecorderMessageHash := su.backend.sendRecorder.getMessageHash(message)
-	isSending, wasSent := su.backend.sendRecorder.isSendingOrSent(su.client, sendRecorderMessageHash)
-	if isSending {
-		log.Debug("Message is in send queue, waiting")
-		time.Sleep(60 * time.Second)
-		isSending, wasSent = su.backend.sendRecorder.isSendingOrSent(su.client, sendRecorderMessageHash)
-	}
-	if isSending {
-		log.Debug("Message is still in send queue, returning error")
-		return errors.New("message is sending")
+	// to sending the same message multiple times. The store waits for the first request to finish
+	// and tells us whether the message was sent already.
+	sendRecorderMessageHash, wasSent, err := su.storeUser.StartSending(message)
+	if err != nil {
+		log.WithError(err).Debug("Message is still in send queue, returning error")
+		return err
 	}
 	if wasSent {
 		log.Debug("Message was already sent")
 		return nil
 	}
+	defer func() {
+		su.storeUser.FinishSending(sendRecorderMessageHash, err == nil)
+	}()
 
 	message, atts, err := su.storeUser.CreateDraft(kr, message, attReaders, attachedPublicKey, attachedPublicKeyName, parentID)
 	if err != nil {
 		return
 	}
-	su.backend.sendRecorder.addMessage(sendRecorderMessageHash, message.ID)
+	if err := su.storeUser.RecordSendingMessage(sendRecorderMessageHash, message.ID); err != nil {
+		log.WithError(err).Warn("Cannot record sending message")
+	}
 
 	// We always have to create a new draft even if there already is one,
 	// because clients don't necessarily save the draft before sending, which
@@ -245,10 +279,9 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		}
 
 		// PMEL 4.
-		apiRawKeyList, isInternal, err := su.client.GetPublicKeysForEmail(email)
+		apiRawKeyList, isInternal, err := su.client.GetPublicKeysForEmailContext(su.ctx, email)
 		if err != nil {
-			err = fmt.Errorf("backend: cannot get recipients' public keys: %v", err)
-			return err
+			return errors.Wrap(err, "backend: cannot get recipients' public keys")
 		}
 
 		var apiKeys []*pmcrypto.KeyRing
@@ -265,7 +298,7 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 			containsUnencryptedRecipients = true
 		}
 		if err != nil {
-			return errors.New("error sending to user " + email + ": " + err.Error())
+			return errRecipientKey.wrap(errors.New("error sending to user " + email + ": " + err.Error()))
 		}
 
 		var signature int
@@ -334,7 +367,7 @@ func (su *smtpUser) Send(from string, to []string, messageReader io.Reader) (err
 		}
 		if !su.continueSendingUnencryptedMail(subject) {
 			_ = su.client.DeleteMessages([]string{message.ID})
-			return errors.New("sending was canceled by user")
+			return errSendingCanceled
 		}
 	}
 
@@ -421,8 +454,18 @@ func isDraft(m *pmapi.Message) bool {
 	return false
 }
 
+// getSenderAddress returns the address used as the sender of the message.
+// The plus part of the address is kept with the owning address. Any other
+// address on the catch-all domain is used as is because the API allows it.
+func getSenderAddress(from string, addr *pmapi.Address) string {
+	if addr.CatchAll && !strings.EqualFold(pmapi.SanitizeEmail(from), addr.Email) {
+		return from
+	}
+	return pmapi.ConstructAddress(from, addr.Email)
+}
+
 func (su *smtpUser) handleSenderAndRecipients(m *pmapi.Message, addr *pmapi.Address, from string, to []string) (err error) {
-	from = pmapi.ConstructAddress(from, addr.Email)
+	from = getSenderAddress(from, addr)
 
 	// Check sender.
 	if m.Sender == nil {
@@ -433,7 +476,7 @@ func (su *smtpUser) handleSenderAndRecipients(m *pmapi.Message, addr *pmapi.Addr
 
 	// Check recipients.
 	if len(to) == 0 {
-		err = errors.New("backend: no recipient specified")
+		err = errNoRecipient
 		return
 	}
 
@@ -509,5 +552,6 @@ func (su *smtpUser) continueSendingUnencryptedMail(subject string) bool {
 // Logout is called when this User will no longer be used.
 func (su *smtpUser) Logout() error {
 	log.Debug("SMTP client logged out user ", su.addressID)
+	su.cancel()
 	return nil
 }
@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package smtp
+
+import (
+	"net/mail"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSenderAddress(t *testing.T) {
+	address := &pmapi.Address{Email: "me@pm.me"}
+	catchAllAddress := &pmapi.Address{Email: "info@custom.com", CatchAll: true}
+
+	testCases := []struct {
+		from       string
+		addr       *pmapi.Address
+		wantSender string
+	}{
+		{"me@pm.me", address, "me@pm.me"},
+		{"ME@pm.me", address, "me@pm.me"},
+		{"me+lists@pm.me", address, "me+lists@pm.me"},
+		{"info@custom.com", catchAllAddress, "info@custom.com"},
+		{"info+tag@custom.com", catchAllAddress, "info+tag@custom.com"},
+		{"sales@custom.com", catchAllAddress, "sales@custom.com"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.wantSender, getSenderAddress(tc.from, tc.addr), tc.from)
+	}
+}
+
+func TestHandleSenderAndRecipients_Alias(t *testing.T) {
+	su := &smtpUser{}
+	addr := &pmapi.Address{Email: "me@pm.me"}
+
+	m := &pmapi.Message{Sender: &mail.Address{Name: "Me", Address: "me+lists@pm.me"}}
+	require.NoError(t, su.handleSenderAndRecipients(m, addr, "me+lists@pm.me", []string{"to@pm.me"}))
+	assert.Equal(t, "me+lists@pm.me", m.Sender.Address)
+	assert.Empty(t, m.ReplyTos)
+
+	replyTo := []*mail.Address{{Address: "other@pm.me"}}
+	m = &pmapi.Message{Sender: &mail.Address{Address: "me+lists@pm.me"}, ReplyTos: replyTo}
+	require.NoError(t, su.handleSenderAndRecipients(m, addr, "me+lists@pm.me", []string{"to@pm.me"}))
+	assert.Equal(t, replyTo, m.ReplyTos)
+}
@@ -24,7 +24,8 @@ import (
 )
 
 // Address holds mailboxes for IMAP user (login address). In combined mode
-// there is only one address, in split mode there is one object per address.
+// there is only one address, in split mode there is one object per address
+// and in hybrid mode one object per address group.
 type Address struct {
 	store     *Store
 	address   string
@@ -66,10 +67,8 @@ func (storeAddress *Address) init(foldersAndLabels []*pmapi.Label) (err error) {
 
 	err = storeAddress.store.db.Update(func(tx *bolt.Tx) error {
 		for _, label := range foldersAndLabels {
-			prefix := getLabelPrefix(label)
-
 			var mailbox *Mailbox
-			if mailbox, err = txNewMailbox(tx, storeAddress, label.ID, prefix, label.Name, label.Color); err != nil {
+			if mailbox, err = txNewMailbox(tx, storeAddress, label); err != nil {
 				storeAddress.log.
 					WithError(err).
 					WithField("labelID", label.ID).
@@ -82,9 +81,56 @@ func (storeAddress *Address) init(foldersAndLabels []*pmapi.Label) (err error) {
 		return nil
 	})
 
+	storeAddress.updateMailboxNames()
+
 	return
 }
 
+// updateMailboxNames sets IMAP names of all mailboxes according to the label
+// hierarchy. The name of nested mailbox consists of names of all its parents.
+func (storeAddress *Address) updateMailboxNames() {
+	for _, mailbox := range storeAddress.mailboxes {
+		mailbox.labelName = mailbox.labelPrefix + storeAddress.getMailboxPath(mailbox)
+	}
+}
+
+// getMailboxPath returns names of the mailbox and its parents separated by
+// the delimiter. Parents which are unknown or of other type are left out.
+func (storeAddress *Address) getMailboxPath(mailbox *Mailbox) string {
+	path := mailbox.name
+	visited := map[string]bool{mailbox.labelID: true}
+	for parentID := mailbox.parentID; parentID != ""; {
+		parent, ok := storeAddress.mailboxes[parentID]
+		if !ok || visited[parentID] || parent.labelPrefix != mailbox.labelPrefix {
+			break
+		}
+		visited[parentID] = true
+		path = parent.name + PathDelimiter + path
+		parentID = parent.parentID
+	}
+	return path
+}
+
+// getChildMailboxIDs returns IDs of all mailboxes nested in the mailbox.
+func (storeAddress *Address) getChildMailboxIDs(labelID string) (ids []string) {
+	for _, mailbox := range storeAddress.mailboxes {
+		visited := map[string]bool{mailbox.labelID: true}
+		for parentID := mailbox.parentID; parentID != "" && !visited[parentID]; {
+			if parentID == labelID {
+				ids = append(ids, mailbox.labelID)
+				break
+			}
+			parent, ok := storeAddress.mailboxes[parentID]
+			if !ok {
+				break
+			}
+			visited[parentID] = true
+			parentID = parent.parentID
+		}
+	}
+	return ids
+}
+
 // getLabelPrefix returns the correct prefix for a pmapi label according to whether it is exclusive or not.
 func getLabelPrefix(l *pmapi.Label) string {
 	switch {
@@ -107,6 +153,25 @@ func (storeAddress *Address) AddressID() string {
 	return storeAddress.addressID
 }
 
+// ListsAddressID returns whether messages of the address with the given ID
+// are listed under this address, i.e. the address is in the same group.
+func (storeAddress *Address) ListsAddressID(addressID string) bool {
+	mode, err := storeAddress.store.getAddressMode()
+	if err != nil {
+		storeAddress.log.WithError(err).Error("Could not determine address mode")
+		return false
+	}
+
+	if mode == combinedMode {
+		return true
+	}
+
+	storeAddress.store.lock.RLock()
+	defer storeAddress.store.lock.RUnlock()
+
+	return storeAddress.store.getStoreAddressID(addressID) == storeAddress.addressID
+}
+
 // APIAddress returns the `pmapi.Address` struct.
 func (storeAddress *Address) APIAddress() *pmapi.Address {
 	return storeAddress.store.api.Addresses().ByEmail(storeAddress.address)
@@ -69,19 +69,21 @@ func (storeAddress *Address) deleteMailbox(labelID string) error {
 
 // createOrUpdateMailboxEvent creates or updates the mailbox in the structure.
 // This is called from the event loop.
+// Names of all children are updated as well when the mailbox is renamed or moved.
 func (storeAddress *Address) createOrUpdateMailboxEvent(label *pmapi.Label) error {
-	prefix := getLabelPrefix(label)
 	mailbox, ok := storeAddress.mailboxes[label.ID]
 	if !ok {
-		mailbox, err := newMailbox(storeAddress, label.ID, prefix, label.Name, label.Color)
+		mailbox, err := newMailbox(storeAddress, label)
 		if err != nil {
 			return err
 		}
 		storeAddress.mailboxes[label.ID] = mailbox
 	} else {
-		mailbox.labelName = prefix + label.Name
+		mailbox.name = label.Name
+		mailbox.parentID = label.ParentID
 		mailbox.color = label.Color
 	}
+	storeAddress.updateMailboxNames()
 	return nil
 }
 
@@ -94,6 +96,7 @@ func (storeAddress *Address) deleteMailboxEvent(labelID string) error {
 		return nil
 	}
 	delete(storeAddress.mailboxes, labelID)
+	storeAddress.updateMailboxNames()
 	return storeMailbox.deleteMailboxEvent()
 }
 
@@ -18,6 +18,7 @@
 package store
 
 import (
+	"context"
 	"time"
 
 	bridgeEvents "github.com/ProtonMail/proton-bridge/internal/events"
@@ -37,6 +38,11 @@ type eventLoop struct {
 	notifyStopCh   chan struct{}
 	isRunning      bool
 	hasInternet    bool
+	backoff        *eventLoopBackoff
+
+	// ctx is canceled when the loop is stopped to abort in-flight requests.
+	ctx    context.Context
+	cancel context.CancelFunc
 
 	log *logrus.Entry
 
@@ -55,6 +61,7 @@ func newEventLoop(cache *Cache, store *Store, api PMAPIProvider, user BridgeUser
 		currentEventID: cache.getEventID(user.ID()),
 		pollCh:         make(chan chan struct{}),
 		isRunning:      false,
+		backoff:        newEventLoopBackoff(defaultEventLoopBackoffConfig()),
 
 		log: eventLog,
 
@@ -69,10 +76,19 @@ func (loop *eventLoop) IsRunning() bool {
 	return loop.isRunning
 }
 
+// context returns the context of the running loop. Requests of the loop
+// have background priority to not slow down requests of email clients.
+func (loop *eventLoop) context() context.Context {
+	if loop.ctx == nil {
+		return pmapi.WithPriority(context.Background(), pmapi.PriorityBackground)
+	}
+	return loop.ctx
+}
+
 func (loop *eventLoop) setFirstEventID() (err error) {
 	loop.log.Trace("Setting first event ID")
 
-	event, err := loop.apiClient.GetEvent("")
+	event, err := loop.apiClient.GetEventContext(loop.context(), "")
 	if err != nil {
 		loop.log.WithError(err).Error("Could not get latest event ID")
 		return
@@ -100,6 +116,7 @@ func (loop *eventLoop) pollNow() {
 func (loop *eventLoop) stop() {
 	if loop.isRunning {
 		loop.isRunning = false
+		loop.cancel()
 		close(loop.stopCh)
 
 		select {
@@ -120,6 +137,7 @@ func (loop *eventLoop) start() { // nolint[funlen]
 	}()
 	loop.stopCh = make(chan struct{})
 	loop.notifyStopCh = make(chan struct{})
+	loop.ctx, loop.cancel = context.WithCancel(pmapi.WithPriority(context.Background(), pmapi.PriorityBackground))
 	loop.isRunning = true
 
 	events := make(chan *pmapi.Event)
@@ -135,6 +153,20 @@ func (loop *eventLoop) start() { // nolint[funlen]
 
 	loop.hasInternet = true
 
+	// retry wakes the loop up when the backoff after failure is over.
+	retry := time.NewTimer(time.Hour)
+	retry.Stop()
+	defer retry.Stop()
+
+	// Operations queued while offline are replayed as soon as the connection
+	// is back, reported by event loop of any user or by the queue itself.
+	internetOffCh := make(chan string)
+	internetOnCh := make(chan string)
+	loop.events.Add(bridgeEvents.InternetOffEvent, internetOffCh)
+	loop.events.Add(bridgeEvents.InternetOnEvent, internetOnCh)
+	defer loop.events.Remove(bridgeEvents.InternetOffEvent, internetOffCh)
+	defer loop.events.Remove(bridgeEvents.InternetOnEvent, internetOnCh)
+
 	go loop.pollNow()
 
 	for {
@@ -145,6 +177,29 @@ func (loop *eventLoop) start() { // nolint[funlen]
 			return
 		case eventProcessedCh = <-loop.pollCh:
 		case <-t.C:
+		case <-retry.C:
+		case <-internetOffCh:
+			loop.hasInternet = false
+			continue
+		case <-internetOnCh:
+			// The event is polled again after the replay to get the state
+			// including the replayed changes.
+			if !loop.store.replayWriteQueue() {
+				continue
+			}
+			loop.log.Debug("Write queue replayed, polling the event")
+		}
+
+		// Do not poll before backoff is over; who asked to poll gets
+		// the current state from the database.
+		if loop.backoff.shouldWait(time.Now()) {
+			if eventProcessedCh != nil {
+				eventProcessedCh <- struct{}{}
+			}
+			continue
+		}
+		if loop.backoff.needsRestart(time.Now()) {
+			loop.restart()
 		}
 
 		// Before we fetch the first event, check whether this is the first time we've
@@ -166,11 +221,10 @@ func (loop *eventLoop) start() { // nolint[funlen]
 		if eventProcessedCh != nil {
 			eventProcessedCh <- struct{}{}
 		}
-		if err != nil {
+		if classifyEventError(err) == eventErrorUnauthorized {
 			loop.log.WithError(err).Error("Cannot process event, stopping event loop")
 			// When event loop stops, the only way to start it again is by login.
-			// It should stop only when user is logged out but even if there is other
-			// serious error, logout is intended action.
+			// Other errors are retried, logout is only for invalid authorization.
 			if errLogout := loop.user.Logout(); errLogout != nil {
 				loop.log.
 					WithError(errLogout).
@@ -178,6 +232,18 @@ func (loop *eventLoop) start() { // nolint[funlen]
 			}
 			return
 		}
+		// Request aborted by stop is not a failure of the API.
+		if loop.context().Err() != nil {
+			continue
+		}
+		if err != nil {
+			retry.Reset(loop.failure(err))
+			continue
+		}
+		if loop.backoff.success() {
+			loop.log.Info("Event loop recovered")
+			loop.emitStatus(bridgeEvents.EventLoopRunning, 0, nil)
+		}
 
 		if more {
 			go loop.pollNow()
@@ -185,6 +251,60 @@ func (loop *eventLoop) start() { // nolint[funlen]
 	}
 }
 
+// failure records the failed poll and returns the time to wait before
+// the next attempt.
+func (loop *eventLoop) failure(err error) time.Duration {
+	delay := loop.backoff.failure(time.Now())
+
+	state := bridgeEvents.EventLoopBackoff
+	if loop.backoff.isOpen {
+		state = bridgeEvents.EventLoopCircuitOpen
+	}
+	loop.log.
+		WithError(err).
+		WithField("failures", loop.backoff.failures).
+		WithField("retryIn", delay).
+		Warn("Cannot process event, backing off")
+	loop.emitStatus(state, delay, err)
+
+	return delay
+}
+
+// restart starts the loop again after the circuit was open. The event is
+// processed again from the last successfully processed one. If the loop
+// keeps failing after several restarts, the event is probably not possible
+// to process and the loop starts from the latest event with full sync
+// to not miss any change.
+func (loop *eventLoop) restart() {
+	dropEvent := loop.backoff.restart()
+	loop.log.WithField("restarts", loop.backoff.restarts).Warn("Restarting event loop")
+
+	loop.currentEventID = loop.cache.getEventID(loop.user.ID())
+	if dropEvent {
+		loop.log.WithField("eventID", loop.currentEventID).Error("Event loop keeps failing, dropping event and starting full sync")
+		if err := loop.setFirstEventID(); err != nil {
+			loop.log.WithError(err).Warn("Could not set latest event ID")
+		}
+		loop.store.Resync()
+	}
+
+	loop.emitStatus(bridgeEvents.EventLoopRestarted, 0, nil)
+}
+
+func (loop *eventLoop) emitStatus(state string, retryIn time.Duration, err error) {
+	status := bridgeEvents.EventLoopStatus{
+		UserID:   loop.user.ID(),
+		State:    state,
+		Failures: loop.backoff.failures,
+		Restarts: loop.backoff.restarts,
+		RetryIn:  retryIn,
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	loop.events.Emit(bridgeEvents.EventLoopStatusEvent, status.Encode())
+}
+
 // isBeforeFirstStart returns whether the initial event ID was already set or not.
 func (loop *eventLoop) isBeforeFirstStart() bool {
 	return loop.currentEventID == ""
@@ -196,10 +316,11 @@ func (loop *eventLoop) isBeforeFirstStart() bool {
 func (loop *eventLoop) processNextEvent() (more bool, err error) { // nolint[funlen]
 	l := loop.log.WithField("currentEventID", loop.currentEventID)
 
-	// We only want to consider invalid tokens as real errors because all other errors might fix themselves eventually
-	// (e.g. no internet, ulimit reached etc.)
+	// Errors which have their own handling (no internet, ulimit reached etc.)
+	// are not returned. Returned errors are handled by backoff, or by logout
+	// in case of invalid authorization, see `classifyEventError`.
 	defer func() {
-		if errors.Cause(err) == pmapi.ErrAPINotReachable {
+		if classifyEventError(err) == eventErrorOffline {
 			l.Warn("Internet unavailable")
 			loop.events.Emit(bridgeEvents.InternetOffEvent, "")
 			loop.hasInternet = false
@@ -212,24 +333,16 @@ func (loop *eventLoop) processNextEvent() (more bool, err error) { // nolint[fun
 			err = nil
 		}
 
-		if errors.Cause(err) == pmapi.ErrUpgradeApplication {
+		if classifyEventError(err) == eventErrorUpgrade {
 			l.Warn("Need to upgrade application")
 			loop.events.Emit(bridgeEvents.UpgradeApplicationEvent, "")
 			err = nil
 		}
-
-		_, errUnauthorized := errors.Cause(err).(*pmapi.ErrUnauthorized)
-
-		// All errors except Invalid Token (which is not possible to recover from) are ignored.
-		if err != nil && !errUnauthorized && errors.Cause(err) != pmapi.ErrInvalidToken {
-			l.WithError(err).Trace("Error skipped")
-			err = nil
-		}
 	}()
 
 	l.Trace("Polling next event")
 	var event *pmapi.Event
-	if event, err = loop.apiClient.GetEvent(loop.currentEventID); err != nil {
+	if event, err = loop.apiClient.GetEventContext(loop.context(), loop.currentEventID); err != nil {
 		return false, errors.Wrap(err, "failed to get event")
 	}
 
@@ -238,8 +351,18 @@ func (loop *eventLoop) processNextEvent() (more bool, err error) { // nolint[fun
 	if !loop.hasInternet {
 		loop.events.Emit(bridgeEvents.InternetOnEvent, "")
 		loop.hasInternet = true
+
+		// Operations made while offline are replayed on `InternetOnEvent`
+		// and the event is polled again after that. Processing it now would
+		// only overwrite local changes with the older state from the server.
+		if !loop.store.writeQueue.isEmpty() {
+			l.Debug("Event left till write queue is replayed")
+			return false, nil
+		}
 	}
 
+	loop.store.resolveWriteQueueConflicts(event)
+
 	if err = loop.processEvent(event); err != nil {
 		return false, errors.Wrap(err, "failed to process event")
 	}
@@ -413,7 +536,7 @@ func (loop *eventLoop) processMessages(eventLog *logrus.Entry, messages []*pmapi
 			msg, err = loop.store.getMessageFromDB(message.ID)
 			if err == ErrNoSuchAPIID {
 				msgLog.WithError(err).Warning("Cannot get message from DB for updating. Trying fetch...")
-				msg, err = loop.store.fetchMessage(message.ID)
+				msg, err = loop.store.fetchMessage(loop.context(), message.ID)
 				// If message does not exist anywhere, update event is probably old and off topic - skip it.
 				if err == ErrNoSuchAPIID {
 					msgLog.Warn("Skipping message update, because message does not exist nor in local DB or on API")
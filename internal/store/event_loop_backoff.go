@@ -0,0 +1,157 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+)
+
+type eventErrorClass int
+
+const (
+	eventErrorNone eventErrorClass = iota
+	// eventErrorOffline is handled by waiting for the internet connection.
+	eventErrorOffline
+	// eventErrorUpgrade is handled by asking user to upgrade bridge.
+	eventErrorUpgrade
+	// eventErrorUnauthorized is the only error which logs user out.
+	eventErrorUnauthorized
+	// eventErrorTransient covers everything else. Such errors can be bad
+	// luck (server issue, broken response, ...) and are retried with backoff.
+	eventErrorTransient
+)
+
+func classifyEventError(err error) eventErrorClass {
+	if err == nil {
+		return eventErrorNone
+	}
+
+	cause := errors.Cause(err)
+	if _, ok := cause.(*pmapi.ErrUnauthorized); ok {
+		return eventErrorUnauthorized
+	}
+
+	switch cause {
+	case pmapi.ErrAPINotReachable:
+		return eventErrorOffline
+	case pmapi.ErrUpgradeApplication:
+		return eventErrorUpgrade
+	case pmapi.ErrInvalidToken:
+		return eventErrorUnauthorized
+	}
+
+	return eventErrorTransient
+}
+
+type eventLoopBackoffConfig struct {
+	// initialDelay is the delay after the first failure. It is doubled
+	// with every next failure up to maxDelay.
+	initialDelay time.Duration
+	maxDelay     time.Duration
+
+	// breakerThreshold is the number of failures in a row after which
+	// the circuit opens and the event loop is not polling for breakerCooldown.
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	// maxRestarts is the number of restarts after open circuit without any
+	// successful poll after which the event loop gives up the current
+	// event and starts from the latest one with full sync.
+	maxRestarts int
+}
+
+func defaultEventLoopBackoffConfig() eventLoopBackoffConfig {
+	return eventLoopBackoffConfig{
+		initialDelay:     10 * time.Second,
+		maxDelay:         5 * time.Minute,
+		breakerThreshold: 8,
+		breakerCooldown:  30 * time.Minute,
+		maxRestarts:      3,
+	}
+}
+
+// eventLoopBackoff keeps the state of failed polls.
+type eventLoopBackoff struct {
+	config eventLoopBackoffConfig
+
+	failures    int
+	restarts    int
+	isOpen      bool
+	nextAttempt time.Time
+}
+
+func newEventLoopBackoff(config eventLoopBackoffConfig) *eventLoopBackoff {
+	return &eventLoopBackoff{config: config}
+}
+
+// failure records the failed poll and returns the delay before next attempt.
+func (b *eventLoopBackoff) failure(now time.Time) time.Duration {
+	b.failures++
+
+	delay := b.config.initialDelay
+	for i := 1; i < b.failures && delay < b.config.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > b.config.maxDelay {
+		delay = b.config.maxDelay
+	}
+
+	if b.failures >= b.config.breakerThreshold {
+		b.isOpen = true
+		delay = b.config.breakerCooldown
+	}
+
+	b.nextAttempt = now.Add(delay)
+	return delay
+}
+
+// success resets the state and returns whether the loop was failing before.
+func (b *eventLoopBackoff) success() (wasFailing bool) {
+	wasFailing = b.failures > 0 || b.restarts > 0
+	b.failures = 0
+	b.restarts = 0
+	b.isOpen = false
+	b.nextAttempt = time.Time{}
+	return
+}
+
+// shouldWait returns whether the next attempt should not be done yet.
+func (b *eventLoopBackoff) shouldWait(now time.Time) bool {
+	return now.Before(b.nextAttempt)
+}
+
+// needsRestart returns whether the circuit is open and its cooldown is over.
+func (b *eventLoopBackoff) needsRestart(now time.Time) bool {
+	return b.isOpen && !b.shouldWait(now)
+}
+
+// restart closes the circuit and returns whether the loop restarted too many
+// times and the current event should be dropped.
+func (b *eventLoopBackoff) restart() (dropEvent bool) {
+	b.isOpen = false
+	b.failures = 0
+	b.restarts++
+	if b.restarts > b.config.maxRestarts {
+		b.restarts = 0
+		return true
+	}
+	return false
+}
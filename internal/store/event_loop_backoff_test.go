@@ -0,0 +1,130 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	"github.com/pkg/errors"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyEventError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want eventErrorClass
+	}{
+		{nil, eventErrorNone},
+		{errors.Wrap(pmapi.ErrAPINotReachable, "failed to get event"), eventErrorOffline},
+		{pmapi.ErrUpgradeApplication, eventErrorUpgrade},
+		{pmapi.ErrInvalidToken, eventErrorUnauthorized},
+		{errors.Wrap(&pmapi.ErrUnauthorized{}, "failed to get event"), eventErrorUnauthorized},
+		{errors.New("failed to process event"), eventErrorTransient},
+		{&pmapi.Error{Code: 500}, eventErrorTransient},
+	}
+	for _, tc := range tests {
+		a.Equal(t, tc.want, classifyEventError(tc.err), "%v", tc.err)
+	}
+}
+
+func TestEventLoopBackoff(t *testing.T) {
+	b := newEventLoopBackoff(eventLoopBackoffConfig{
+		initialDelay:     time.Second,
+		maxDelay:         5 * time.Second,
+		breakerThreshold: 5,
+		breakerCooldown:  time.Minute,
+		maxRestarts:      1,
+	})
+	now := time.Now()
+
+	a.False(t, b.shouldWait(now))
+	a.Equal(t, time.Second, b.failure(now))
+	a.True(t, b.shouldWait(now))
+	a.False(t, b.shouldWait(now.Add(time.Second)))
+	a.Equal(t, 2*time.Second, b.failure(now))
+	a.Equal(t, 4*time.Second, b.failure(now))
+	a.Equal(t, 5*time.Second, b.failure(now))
+	a.False(t, b.isOpen)
+
+	// Circuit opens after threshold.
+	a.Equal(t, time.Minute, b.failure(now))
+	a.True(t, b.isOpen)
+	a.False(t, b.needsRestart(now.Add(time.Second)))
+	a.True(t, b.needsRestart(now.Add(time.Minute)))
+
+	a.False(t, b.restart())
+	a.False(t, b.isOpen)
+	a.Equal(t, time.Second, b.failure(now))
+
+	// Too many restarts drop the event.
+	a.True(t, b.restart())
+
+	b.failure(now)
+	a.True(t, b.success())
+	a.False(t, b.success())
+	a.False(t, b.shouldWait(now))
+}
+
+func TestEventLoopBacksOffInsteadOfLogout(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.api.EXPECT().GetEventContext(gomock.Any(), "latestEventID").Return(nil, errors.New("bad luck"))
+	statusCh := make(chan events.EventLoopStatus, 1)
+	m.events.EXPECT().Emit(events.EventLoopStatusEvent, gomock.Any()).Do(func(_, data string) {
+		status, err := events.DecodeEventLoopStatus(data)
+		require.NoError(t, err)
+		statusCh <- status
+	})
+
+	m.newStoreNoEvents(true)
+
+	select {
+	case status := <-statusCh:
+		a.Equal(t, "userID", status.UserID)
+		a.Equal(t, events.EventLoopBackoff, status.State)
+		a.Equal(t, 1, status.Failures)
+		a.Equal(t, 10*time.Second, status.RetryIn)
+		a.Equal(t, "failed to get event: bad luck", status.Error)
+	case <-time.After(time.Second):
+		require.Fail(t, "status was not emitted")
+	}
+	a.True(t, m.store.eventLoop.IsRunning())
+}
+
+func TestEventLoopLogoutWhenUnauthorized(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.api.EXPECT().GetEventContext(gomock.Any(), "latestEventID").Return(nil, pmapi.ErrInvalidToken)
+	loggedOut := make(chan struct{})
+	m.user.EXPECT().Logout().Do(func() { close(loggedOut) })
+
+	m.newStoreNoEvents(true)
+
+	select {
+	case <-loggedOut:
+	case <-time.After(time.Second):
+		require.Fail(t, "user was not logged out")
+	}
+}
@@ -0,0 +1,627 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// IntegrityIssue is one inconsistency found in the local database.
+type IntegrityIssue struct {
+	// Mailbox is the address and the name of the affected mailbox.
+	// It is empty for issues which are not related to one mailbox.
+	Mailbox     string
+	Description string
+	Fixed       bool
+}
+
+func (issue IntegrityIssue) String() string {
+	status := "not fixed"
+	if issue.Fixed {
+		status = "fixed"
+	}
+	if issue.Mailbox == "" {
+		return fmt.Sprintf("%s (%s)", issue.Description, status)
+	}
+	return fmt.Sprintf("%s: %s (%s)", issue.Mailbox, issue.Description, status)
+}
+
+// IntegrityReport is the result of CheckIntegrity.
+type IntegrityReport struct {
+	Issues []IntegrityIssue
+
+	// UIDValidityChanged is set when some mailbox had to be rebuilt with
+	// new UIDs and email clients will download its messages again.
+	UIDValidityChanged bool
+}
+
+func (report *IntegrityReport) add(mailbox string, fixed bool, format string, args ...interface{}) {
+	report.Issues = append(report.Issues, IntegrityIssue{
+		Mailbox:     mailbox,
+		Description: fmt.Sprintf(format, args...),
+		Fixed:       fixed,
+	})
+}
+
+// Unfixed returns the number of issues which were not repaired.
+func (report *IntegrityReport) Unfixed() (count int) {
+	for _, issue := range report.Issues {
+		if !issue.Fixed {
+			count++
+		}
+	}
+	return
+}
+
+// CheckIntegrity checks the consistency of IMAP UIDs, API IDs, metadata,
+// mailbox membership and counts with the API. When repair is set, it fixes
+// everything which can be fixed locally. UIDVALIDITY is changed only when
+// UIDs of some mailbox cannot be trusted anymore and the mailbox must be
+// rebuilt. Issues which cannot be fixed locally (e.g. counts which differ
+// from the API) are only reported; those need a resync.
+func (store *Store) CheckIntegrity(repair bool) (*IntegrityReport, error) {
+	// Counts are fetched before locking the store to not block it by network.
+	apiCounts, apiErr := store.api.CountMessages("")
+
+	report, orphans, err := store.checkIntegrity(false, nil, apiCounts, apiErr)
+	if err != nil {
+		return nil, err
+	}
+
+	if repair && len(report.Issues) > 0 {
+		// Orphans are fetched again, they most likely have labels which
+		// were not known when they were stored. Only messages which are
+		// not on API anymore are removed.
+		refetchReport := &IntegrityReport{}
+		refetched := store.refetchOrphans(refetchReport, orphans)
+
+		if report, _, err = store.checkIntegrity(true, refetched, apiCounts, apiErr); err != nil {
+			return nil, err
+		}
+		report.Issues = append(refetchReport.Issues, report.Issues...)
+	}
+
+	if report.UIDValidityChanged {
+		if err := store.increaseMailboxesVersion(); err != nil {
+			return nil, errors.Wrap(err, "cannot change UIDVALIDITY")
+		}
+	}
+
+	store.log.
+		WithField("repair", repair).
+		WithField("issues", len(report.Issues)).
+		WithField("unfixed", report.Unfixed()).
+		Info("Store integrity checked")
+
+	return report, nil
+}
+
+// checkIntegrity runs the check in one transaction. Only the repair holds
+// the store lock for the whole time to not be in conflict with changes from
+// events; the check alone uses the state of mailboxes at its beginning.
+func (store *Store) checkIntegrity(repair bool, refetched map[string]*pmapi.Message, apiCounts []*pmapi.MessagesCount, apiErr error) (report *IntegrityReport, orphans []string, err error) {
+	report = &IntegrityReport{}
+	if apiErr != nil {
+		report.add("", false, "cannot compare counts with API: %v", apiErr)
+	}
+
+	if repair {
+		store.lock.Lock()
+		defer store.lock.Unlock()
+	} else {
+		store.lock.RLock()
+	}
+	isSyncRunning := store.isSyncRunning
+	mode, err := store.getAddressMode()
+	mailboxes := store.getAllMailboxes()
+	if !repair {
+		store.lock.RUnlock()
+	}
+
+	if isSyncRunning {
+		return nil, nil, errors.New("cannot check the store while sync is running")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	check := func(tx *bolt.Tx) error {
+		metadata, txOrphans, err := store.txCheckMetadata(tx, report, mode, mailboxes, refetched)
+		if err != nil {
+			return err
+		}
+		orphans = txOrphans
+
+		if err := store.txCheckMailboxBuckets(tx, report, mailboxes); err != nil {
+			return err
+		}
+
+		for _, storeMailbox := range mailboxes {
+			if err := storeMailbox.txCheckIntegrity(tx, report, mode, metadata); err != nil {
+				return errors.Wrapf(err, "cannot check mailbox %s", storeMailbox.labelName)
+			}
+		}
+
+		if apiErr == nil {
+			return store.txCheckCounts(tx, report, metadata, mailboxes, apiCounts)
+		}
+		return nil
+	}
+
+	if repair {
+		err = store.db.Update(check)
+	} else {
+		err = store.db.View(check)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return report, orphans, nil
+}
+
+// refetchOrphans fetches metadata of orphan messages from API. Orphans which
+// are not on API anymore are returned with nil metadata. Orphans which could
+// not be fetched are not returned at all.
+func (store *Store) refetchOrphans(report *IntegrityReport, orphans []string) (refetched map[string]*pmapi.Message) {
+	refetched = map[string]*pmapi.Message{}
+
+	for len(orphans) > 0 {
+		pageSize := maxFilterPageSize
+		if len(orphans) < pageSize {
+			pageSize = len(orphans)
+		}
+		page := orphans[:pageSize]
+		orphans = orphans[pageSize:]
+
+		msgs, _, err := store.api.ListMessagesContext(pmapi.WithPriority(context.Background(), pmapi.PriorityBackground), &pmapi.MessagesFilter{
+			ID:       page,
+			PageSize: pageSize,
+		})
+		if err != nil {
+			report.add("", false, "cannot fetch orphan messages from API: %v", err)
+			return
+		}
+
+		for _, apiID := range page {
+			refetched[apiID] = nil
+		}
+		for _, msg := range msgs {
+			if _, ok := refetched[msg.ID]; ok {
+				refetched[msg.ID] = msg
+			}
+		}
+	}
+
+	return refetched
+}
+
+// getAllMailboxes returns mailboxes of all addresses sorted by their buckets.
+func (store *Store) getAllMailboxes() (mailboxes []*Mailbox) {
+	for _, storeAddress := range store.addresses {
+		for _, storeMailbox := range storeAddress.mailboxes {
+			mailboxes = append(mailboxes, storeMailbox)
+		}
+	}
+	sort.Slice(mailboxes, func(i, j int) bool {
+		return string(mailboxes[i].getBucketName()) < string(mailboxes[j].getBucketName())
+	})
+	return
+}
+
+func (storeMailbox *Mailbox) integrityName() string {
+	return storeMailbox.storeAddress.address + "/" + storeMailbox.labelName
+}
+
+// checkedMetadata are parsed messages in the order of the metadata bucket.
+type checkedMetadata struct {
+	ids      []string
+	messages map[string]*pmapi.Message
+}
+
+// txLoadMetadata parses all messages in the metadata bucket.
+func (store *Store) txLoadMetadata(tx *bolt.Tx, report *IntegrityReport) (*checkedMetadata, error) {
+	metadata := &checkedMetadata{messages: map[string]*pmapi.Message{}}
+
+	err := tx.Bucket(metadataBucket).ForEach(func(k, v []byte) error {
+		apiID := string(k)
+		msg := &pmapi.Message{}
+		if err := json.Unmarshal(v, msg); err != nil {
+			report.add("", false, "metadata of message %s cannot be parsed: %v", apiID, err)
+			return nil
+		}
+
+		metadata.ids = append(metadata.ids, apiID)
+		metadata.messages[apiID] = msg
+		return nil
+	})
+
+	return metadata, err
+}
+
+// txCheckMetadata loads all metadata and finds orphans, messages which would
+// not be listed in any mailbox. Orphans in `refetched` are replaced by their
+// metadata from API or removed when they are not on API anymore or do not
+// belong to any mailbox even on API; mailboxes are then fixed by the mailbox
+// checks.
+func (store *Store) txCheckMetadata(tx *bolt.Tx, report *IntegrityReport, mode addressMode, mailboxes []*Mailbox, refetched map[string]*pmapi.Message) (metadata *checkedMetadata, orphans []string, err error) {
+	metadata, err = store.txLoadMetadata(tx, report)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	belongs := func(msg *pmapi.Message) bool {
+		for _, storeMailbox := range mailboxes {
+			if storeMailbox.belongsToMailbox(mode, msg) {
+				return true
+			}
+		}
+		return false
+	}
+
+	belongingIDs := []string{}
+
+	for _, apiID := range metadata.ids {
+		if belongs(metadata.messages[apiID]) {
+			belongingIDs = append(belongingIDs, apiID)
+			continue
+		}
+		orphans = append(orphans, apiID)
+
+		msg, ok := refetched[apiID]
+		switch {
+		case !tx.Writable() || !ok:
+			report.add("", false, "message %s does not belong to any mailbox", apiID)
+			delete(metadata.messages, apiID)
+		case msg == nil:
+			report.add("", true, "message %s does not belong to any mailbox", apiID)
+			delete(metadata.messages, apiID)
+			if err := tx.Bucket(metadataBucket).Delete([]byte(apiID)); err != nil {
+				return nil, nil, errors.Wrap(err, "cannot delete orphan metadata")
+			}
+		case !belongs(msg):
+			report.add("", true, "message %s does not belong to any mailbox on API either, metadata was removed", apiID)
+			delete(metadata.messages, apiID)
+			if err := tx.Bucket(metadataBucket).Delete([]byte(apiID)); err != nil {
+				return nil, nil, errors.Wrap(err, "cannot delete orphan metadata")
+			}
+		default:
+			report.add("", true, "message %s does not belong to any mailbox, metadata was fetched again", apiID)
+			if err := store.txPutMessage(tx.Bucket(metadataBucket), msg); err != nil {
+				return nil, nil, errors.Wrap(err, "cannot store fetched orphan metadata")
+			}
+			metadata.messages[apiID] = msg
+			belongingIDs = append(belongingIDs, apiID)
+		}
+	}
+	metadata.ids = belongingIDs
+
+	return metadata, orphans, nil
+}
+
+// txCheckMailboxBuckets removes buckets of mailboxes which no longer exist.
+func (store *Store) txCheckMailboxBuckets(tx *bolt.Tx, report *IntegrityReport, mailboxes []*Mailbox) error {
+	known := map[string]bool{}
+	for _, storeMailbox := range mailboxes {
+		known[string(storeMailbox.getBucketName())] = true
+	}
+
+	stale := []string{}
+	if err := tx.Bucket(mailboxesBucket).ForEach(func(k, _ []byte) error {
+		if !known[string(k)] {
+			stale = append(stale, string(k))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, name := range stale {
+		report.add("", tx.Writable(), "bucket %s does not belong to any mailbox", name)
+		if tx.Writable() {
+			if err := tx.Bucket(mailboxesBucket).DeleteBucket([]byte(name)); err != nil {
+				return errors.Wrap(err, "cannot delete stale mailbox bucket")
+			}
+		}
+	}
+	return nil
+}
+
+// txCheckIntegrity checks the mapping between UIDs and API IDs and whether
+// the mailbox contains exactly the messages which belong to it.
+func (storeMailbox *Mailbox) txCheckIntegrity(tx *bolt.Tx, report *IntegrityReport, mode addressMode, metadata *checkedMetadata) error { //nolint[funlen]
+	name := storeMailbox.integrityName()
+	fix := tx.Writable()
+
+	bucket := storeMailbox.txGetBucket(tx)
+	if bucket == nil || bucket.Bucket(imapIDsBucket) == nil || bucket.Bucket(apiIDsBucket) == nil {
+		report.add(name, fix, "mailbox buckets are missing")
+		return storeMailbox.txRebuild(tx, report, mode, metadata)
+	}
+
+	imapBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+	apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
+
+	// UIDs pointing to API IDs which point back to a different UID.
+	// When both point to the same message, the UID is a duplicate.
+	duplicateUIDs := [][]byte{}
+	missingAPIIDs := []string{}
+	apiIDs := []string{}
+	uids := map[string][]byte{}
+	maxUID := uint32(0)
+	invalidUID := false
+
+	if err := imapBucket.ForEach(func(uidb, apiIDb []byte) error {
+		if len(uidb) != 4 {
+			invalidUID = true
+			return nil
+		}
+		if uid := btoi(uidb); uid > maxUID {
+			maxUID = uid
+		}
+
+		apiID := string(apiIDb)
+		if _, ok := uids[apiID]; ok {
+			duplicateUIDs = append(duplicateUIDs, uidb)
+			return nil
+		}
+		uids[apiID] = uidb
+		apiIDs = append(apiIDs, apiID)
+
+		if got := apiBucket.Get(apiIDb); got == nil || btoi(got) != btoi(uidb) {
+			missingAPIIDs = append(missingAPIIDs, apiID)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if invalidUID {
+		report.add(name, fix, "mailbox contains invalid UIDs")
+		return storeMailbox.txRebuild(tx, report, mode, metadata)
+	}
+
+	// API IDs whose messages have no UID at all.
+	danglingAPIIDs := []string{}
+	if err := apiBucket.ForEach(func(apiIDb, _ []byte) error {
+		if _, ok := uids[string(apiIDb)]; !ok {
+			danglingAPIIDs = append(danglingAPIIDs, string(apiIDb))
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, uidb := range duplicateUIDs {
+		report.add(name, fix, "UID %d is a duplicate of message %s", btoi(uidb), string(imapBucket.Get(uidb)))
+		if fix {
+			if err := imapBucket.Delete(uidb); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, apiID := range missingAPIIDs {
+		uidb := uids[apiID]
+		report.add(name, fix, "API ID of message %s does not point to UID %d", apiID, btoi(uidb))
+		if fix {
+			if err := apiBucket.Put([]byte(apiID), uidb); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, apiID := range danglingAPIIDs {
+		report.add(name, fix, "API ID of message %s points to missing UID", apiID)
+		if fix {
+			if err := apiBucket.Delete([]byte(apiID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Next UID must be always higher than any existing one.
+	if uint64(maxUID) > imapBucket.Sequence() {
+		report.add(name, fix, "next UID %d is not higher than existing UID %d", imapBucket.Sequence()+1, maxUID)
+		if fix {
+			if err := imapBucket.SetSequence(uint64(maxUID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return storeMailbox.txCheckMembership(tx, report, mode, metadata, apiIDs)
+}
+
+// txCheckMembership removes messages which do not belong to the mailbox and
+// adds missing ones with new UIDs.
+func (storeMailbox *Mailbox) txCheckMembership(tx *bolt.Tx, report *IntegrityReport, mode addressMode, metadata *checkedMetadata, apiIDs []string) error {
+	name := storeMailbox.integrityName()
+	fix := tx.Writable()
+
+	// Messages without metadata have to be removed first, otherwise mailbox
+	// status updates issued by txDeleteMessage cannot count messages.
+	inMailbox := map[string]bool{}
+	notBelonging := []string{}
+	for _, apiID := range apiIDs {
+		inMailbox[apiID] = true
+		msg, ok := metadata.messages[apiID]
+		if ok {
+			if !storeMailbox.belongsToMailbox(mode, msg) {
+				notBelonging = append(notBelonging, apiID)
+			}
+			continue
+		}
+		report.add(name, fix, "message %s has no metadata", apiID)
+		if fix {
+			if err := storeMailbox.txRemoveWithoutMetadata(tx, apiID); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, apiID := range notBelonging {
+		report.add(name, fix, "message %s does not belong to the mailbox", apiID)
+		if fix {
+			if err := storeMailbox.txDeleteMessage(tx, apiID); err != nil {
+				return err
+			}
+		}
+	}
+
+	missing := []*pmapi.Message{}
+	for _, apiID := range metadata.ids {
+		msg := metadata.messages[apiID]
+		if !inMailbox[apiID] && storeMailbox.belongsToMailbox(mode, msg) {
+			report.add(name, fix, "message %s is missing in the mailbox", apiID)
+			missing = append(missing, msg)
+		}
+	}
+	if fix && len(missing) > 0 {
+		return storeMailbox.txCreateOrUpdateMessages(tx, missing)
+	}
+	return nil
+}
+
+// txRemoveWithoutMetadata removes the message from the mailbox buckets
+// without the mailbox status update.
+func (storeMailbox *Mailbox) txRemoveWithoutMetadata(tx *bolt.Tx, apiID string) error {
+	apiBucket := storeMailbox.txGetAPIIDsBucket(tx)
+	imapBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+
+	uidb := apiBucket.Get([]byte(apiID))
+	if uidb == nil {
+		return nil
+	}
+
+	seqNum, seqNumErr := storeMailbox.txGetSequenceNumberOfUID(imapBucket, uidb)
+
+	if err := imapBucket.Delete(uidb); err != nil {
+		return errors.Wrap(err, "cannot delete from IMAP bucket")
+	}
+	if err := apiBucket.Delete([]byte(apiID)); err != nil {
+		return errors.Wrap(err, "cannot delete from API bucket")
+	}
+
+	if seqNumErr == nil {
+		storeMailbox.store.imapDeleteMessage(storeMailbox.storeAddress.address, storeMailbox.labelName, seqNum)
+	}
+	return nil
+}
+
+// txRebuild recreates the mailbox buckets from metadata. All messages get
+// new UIDs and therefore UIDVALIDITY has to be changed.
+func (storeMailbox *Mailbox) txRebuild(tx *bolt.Tx, report *IntegrityReport, mode addressMode, metadata *checkedMetadata) error {
+	if !tx.Writable() {
+		return nil
+	}
+
+	bucketName := storeMailbox.getBucketName()
+	if tx.Bucket(mailboxesBucket).Bucket(bucketName) != nil {
+		if err := tx.Bucket(mailboxesBucket).DeleteBucket(bucketName); err != nil {
+			return errors.Wrap(err, "cannot delete broken mailbox")
+		}
+	}
+	if err := initMailboxBucket(tx, bucketName); err != nil {
+		return errors.Wrap(err, "cannot create mailbox")
+	}
+
+	msgs := []*pmapi.Message{}
+	for _, apiID := range metadata.ids {
+		if msg := metadata.messages[apiID]; storeMailbox.belongsToMailbox(mode, msg) {
+			msgs = append(msgs, msg)
+		}
+	}
+
+	report.UIDValidityChanged = true
+	return storeMailbox.txCreateOrUpdateMessages(tx, msgs)
+}
+
+// txCheckCounts updates counts stored in the counts bucket by counts from API
+// and reports labels whose local messages differ from the API. Counts which
+// were never set (e.g. in a new store before the first event) are skipped.
+func (store *Store) txCheckCounts(tx *bolt.Tx, report *IntegrityReport, metadata *checkedMetadata, mailboxes []*Mailbox, apiCounts []*pmapi.MessagesCount) error {
+	fix := tx.Writable()
+	countsBkt := tx.Bucket(countsBucket)
+
+	for _, countsOnAPI := range apiCounts {
+		if skipThisLabel(countsOnAPI.LabelID) {
+			continue
+		}
+
+		counts, err := txGetCountsFromBucketOrNew(countsBkt, countsOnAPI.LabelID)
+		if err != nil {
+			return err
+		}
+		isSet := counts.TotalOnAPI != 0 || counts.UnreadOnAPI != 0
+		if isSet && (counts.TotalOnAPI != uint(countsOnAPI.Total) || counts.UnreadOnAPI != uint(countsOnAPI.Unread)) {
+			report.add("", fix, "stored counts of label %s differ from API", countsOnAPI.LabelID)
+			if fix {
+				counts.TotalOnAPI = uint(countsOnAPI.Total)
+				counts.UnreadOnAPI = uint(countsOnAPI.Unread)
+				if err := counts.txWriteToBucket(countsBkt); err != nil {
+					return err
+				}
+			}
+		}
+
+		total, unread, found := uint(0), uint(0), false
+		for _, storeMailbox := range mailboxes {
+			if storeMailbox.labelID != countsOnAPI.LabelID {
+				continue
+			}
+			found = true
+			mboxTotal, mboxUnread := storeMailbox.txCountFromMetadata(tx, metadata)
+			total += mboxTotal
+			unread += mboxUnread
+		}
+		if found && (total != uint(countsOnAPI.Total) || unread != uint(countsOnAPI.Unread)) {
+			report.add("", false,
+				"label %s has %d messages (%d unread) locally but %d (%d unread) on API, resync is needed",
+				countsOnAPI.LabelID, total, unread, countsOnAPI.Total, countsOnAPI.Unread,
+			)
+		}
+	}
+
+	return nil
+}
+
+// txCountFromMetadata counts messages like txGetCounts but it does not fail
+// for messages without metadata which are possible during a check.
+func (storeMailbox *Mailbox) txCountFromMetadata(tx *bolt.Tx, metadata *checkedMetadata) (total, unread uint) {
+	imapBucket := storeMailbox.txGetIMAPIDsBucket(tx)
+	if imapBucket == nil {
+		return
+	}
+	_ = imapBucket.ForEach(func(_, apiID []byte) error {
+		if msg, ok := metadata.messages[string(apiID)]; ok {
+			total++
+			if msg.Unread == 1 {
+				unread++
+			}
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,223 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func checkIntegrityIssues(t *testing.T, m *mocksForStore, repair bool, apiCounts []*pmapi.MessagesCount, wantIssues ...string) *IntegrityReport {
+	m.api.EXPECT().CountMessages("").Return(apiCounts, nil)
+	report, err := m.store.CheckIntegrity(repair)
+	require.NoError(t, err)
+
+	var gotIssues []string
+	for _, issue := range report.Issues {
+		gotIssues = append(gotIssues, issue.String())
+	}
+	a.Equal(t, wantIssues, gotIssues)
+	return report
+}
+
+func corruptStore(t *testing.T, m *mocksForStore, corrupt func(tx *bolt.Tx, inbox, allMail *Mailbox) error) {
+	storeAddress := m.store.addresses[addrID1]
+	require.NoError(t, m.store.db.Update(func(tx *bolt.Tx) error {
+		return corrupt(tx, storeAddress.mailboxes[pmapi.InboxLabel], storeAddress.mailboxes[pmapi.AllMailLabel])
+	}))
+}
+
+func TestCheckIntegrityOfConsistentStore(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	// Counts on API are not set in a new store yet, that is not an issue.
+	apiCounts := []*pmapi.MessagesCount{
+		{LabelID: pmapi.InboxLabel, Total: 1, Unread: 1},
+	}
+	report := checkIntegrityIssues(t, m, false, apiCounts)
+	a.Equal(t, 0, report.Unfixed())
+
+	checkIntegrityIssues(t, m, true, apiCounts)
+}
+
+func TestRepairIntegrityKeepsUIDValidity(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 0, []string{pmapi.AllMailLabel})
+	uidValidity := m.store.getMailboxesVersion()
+
+	corruptStore(t, m, func(tx *bolt.Tx, inbox, allMail *Mailbox) error {
+		// API ID of msg1 points to wrong UID.
+		require.NoError(t, inbox.txGetAPIIDsBucket(tx).Put([]byte("msg1"), itob(7)))
+		// Dangling API ID.
+		require.NoError(t, inbox.txGetAPIIDsBucket(tx).Put([]byte("msg9"), itob(9)))
+		// Message without metadata.
+		require.NoError(t, inbox.txGetIMAPIDsBucket(tx).Put(itob(3), []byte("msg8")))
+		require.NoError(t, inbox.txGetAPIIDsBucket(tx).Put([]byte("msg8"), itob(3)))
+		// Message which does not belong to Inbox.
+		require.NoError(t, inbox.txGetIMAPIDsBucket(tx).Put(itob(4), []byte("msg3")))
+		require.NoError(t, inbox.txGetAPIIDsBucket(tx).Put([]byte("msg3"), itob(4)))
+		// Message missing in All Mail.
+		require.NoError(t, allMail.txGetIMAPIDsBucket(tx).Delete(itob(2)))
+		require.NoError(t, allMail.txGetAPIIDsBucket(tx).Delete([]byte("msg2")))
+		// Orphan metadata, msg5 is not on API anymore and msg6 has
+		// labels on API which were not stored.
+		for _, apiID := range []string{"msg5", "msg6"} {
+			data, err := json.Marshal(&pmapi.Message{ID: apiID, LabelIDs: []string{pmapi.StarredLabel}})
+			require.NoError(t, err)
+			require.NoError(t, tx.Bucket(metadataBucket).Put([]byte(apiID), data))
+		}
+		return nil
+	})
+
+	m.api.EXPECT().ListMessagesContext(gomock.Any(), &pmapi.MessagesFilter{ID: []string{"msg5", "msg6"}, PageSize: 2}).
+		Return([]*pmapi.Message{
+			getTestMessage("msg6", "Test message 6", addrID1, 0, []string{pmapi.AllMailLabel}),
+		}, 1, nil)
+
+	apiCounts := []*pmapi.MessagesCount{
+		{LabelID: pmapi.InboxLabel, Total: 2, Unread: 0},
+		{LabelID: pmapi.AllMailLabel, Total: 4, Unread: 0},
+	}
+	checkIntegrityIssues(t, m, true, apiCounts,
+		"message msg5 does not belong to any mailbox (fixed)",
+		"message msg6 does not belong to any mailbox, metadata was fetched again (fixed)",
+		"niceaddress@pm.me/INBOX: API ID of message msg1 does not point to UID 1 (fixed)",
+		"niceaddress@pm.me/INBOX: API ID of message msg9 points to missing UID (fixed)",
+		"niceaddress@pm.me/INBOX: next UID 3 is not higher than existing UID 4 (fixed)",
+		"niceaddress@pm.me/INBOX: message msg8 has no metadata (fixed)",
+		"niceaddress@pm.me/INBOX: message msg3 does not belong to the mailbox (fixed)",
+		"niceaddress@pm.me/All Mail: message msg2 is missing in the mailbox (fixed)",
+		"niceaddress@pm.me/All Mail: message msg6 is missing in the mailbox (fixed)",
+	)
+
+	a.Equal(t, uidValidity, m.store.getMailboxesVersion())
+	checkMailboxMessageIDs(t, m, pmapi.InboxLabel, []wantID{{"msg1", 1}, {"msg2", 2}})
+	checkMailboxMessageIDs(t, m, pmapi.AllMailLabel, []wantID{{"msg1", 1}, {"msg3", 3}, {"msg2", 4}, {"msg6", 5}})
+	checkAllMessageIDs(t, m, []string{"msg1", "msg2", "msg3", "msg6"})
+
+	checkIntegrityIssues(t, m, false, apiCounts)
+}
+
+func TestRepairIntegrityKeepsOrphanWhenAPIFails(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	corruptStore(t, m, func(tx *bolt.Tx, _, _ *Mailbox) error {
+		data, err := json.Marshal(&pmapi.Message{ID: "msg5", LabelIDs: []string{pmapi.StarredLabel}})
+		require.NoError(t, err)
+		return tx.Bucket(metadataBucket).Put([]byte("msg5"), data)
+	})
+
+	m.api.EXPECT().ListMessagesContext(gomock.Any(), gomock.Any()).Return(nil, 0, errors.New("no connection"))
+
+	checkIntegrityIssues(t, m, true, nil,
+		"cannot fetch orphan messages from API: no connection (not fixed)",
+		"message msg5 does not belong to any mailbox (not fixed)",
+	)
+	checkAllMessageIDs(t, m, []string{"msg1", "msg5"})
+}
+
+func TestRepairIntegrityRemovesOrphanNotBelongingToMailboxOnAPI(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	corruptStore(t, m, func(tx *bolt.Tx, _, _ *Mailbox) error {
+		data, err := json.Marshal(&pmapi.Message{ID: "msg5", LabelIDs: []string{pmapi.StarredLabel}})
+		require.NoError(t, err)
+		return tx.Bucket(metadataBucket).Put([]byte("msg5"), data)
+	})
+
+	m.api.EXPECT().ListMessagesContext(gomock.Any(), &pmapi.MessagesFilter{ID: []string{"msg5"}, PageSize: 1}).
+		Return([]*pmapi.Message{
+			getTestMessage("msg5", "Test message 5", addrID1, 0, []string{pmapi.StarredLabel}),
+		}, 1, nil)
+
+	checkIntegrityIssues(t, m, true, nil,
+		"message msg5 does not belong to any mailbox on API either, metadata was removed (fixed)",
+	)
+	checkAllMessageIDs(t, m, []string{"msg1"})
+
+	// Second run has nothing to fix.
+	checkIntegrityIssues(t, m, true, nil)
+}
+
+func TestRepairIntegrityRebuildsBrokenMailbox(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	uidValidity := m.store.getMailboxesVersion()
+
+	corruptStore(t, m, func(tx *bolt.Tx, inbox, _ *Mailbox) error {
+		return inbox.txGetIMAPIDsBucket(tx).Put([]byte("broken"), []byte("msg1"))
+	})
+
+	report := checkIntegrityIssues(t, m, false, nil,
+		"niceaddress@pm.me/INBOX: mailbox contains invalid UIDs (not fixed)",
+	)
+	a.False(t, report.UIDValidityChanged)
+
+	report = checkIntegrityIssues(t, m, true, nil,
+		"niceaddress@pm.me/INBOX: mailbox contains invalid UIDs (fixed)",
+	)
+	a.True(t, report.UIDValidityChanged)
+	a.Equal(t, uidValidity+1, m.store.getMailboxesVersion())
+	checkMailboxMessageIDs(t, m, pmapi.InboxLabel, []wantID{{"msg1", 1}})
+}
+
+func TestCheckIntegrityReportsCountsDifferentFromAPI(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	corruptStore(t, m, func(tx *bolt.Tx, _, _ *Mailbox) error {
+		counts := &mailboxCounts{LabelID: pmapi.InboxLabel, TotalOnAPI: 1, UnreadOnAPI: 1}
+		return counts.txWriteToBucket(tx.Bucket(countsBucket))
+	})
+
+	checkIntegrityIssues(t, m, true, []*pmapi.MessagesCount{
+		{LabelID: pmapi.InboxLabel, Total: 2, Unread: 1},
+	},
+		"stored counts of label 0 differ from API (fixed)",
+		"label 0 has 1 messages (1 unread) locally but 2 (1 unread) on API, resync is needed (not fixed)",
+	)
+}
@@ -34,29 +34,36 @@ type Mailbox struct {
 
 	labelID     string
 	labelPrefix string
-	labelName   string
+	labelName   string // Full IMAP name including prefix and names of parents.
+	name        string // Name of the label as it is on API.
+	parentID    string
 	color       string
 
 	log *logrus.Entry
 }
 
-func newMailbox(storeAddress *Address, labelID, labelPrefix, labelName, color string) (mb *Mailbox, err error) {
+func newMailbox(storeAddress *Address, label *pmapi.Label) (mb *Mailbox, err error) {
 	_ = storeAddress.store.db.Update(func(tx *bolt.Tx) error {
-		mb, err = txNewMailbox(tx, storeAddress, labelID, labelPrefix, labelName, color)
+		mb, err = txNewMailbox(tx, storeAddress, label)
 		return err
 	})
 	return
 }
 
-func txNewMailbox(tx *bolt.Tx, storeAddress *Address, labelID, labelPrefix, labelName, color string) (*Mailbox, error) {
-	l := log.WithField("addrID", storeAddress.addressID).WithField("labelID", labelID)
+// txNewMailbox creates the mailbox of the label. Its IMAP name is set
+// only once all parents are known, see `Address.updateMailboxNames`.
+func txNewMailbox(tx *bolt.Tx, storeAddress *Address, label *pmapi.Label) (*Mailbox, error) {
+	l := log.WithField("addrID", storeAddress.addressID).WithField("labelID", label.ID)
+	prefix := getLabelPrefix(label)
 	mb := &Mailbox{
 		store:        storeAddress.store,
 		storeAddress: storeAddress,
-		labelID:      labelID,
-		labelPrefix:  labelPrefix,
-		labelName:    labelPrefix + labelName,
-		color:        color,
+		labelID:      label.ID,
+		labelPrefix:  prefix,
+		labelName:    prefix + label.Name,
+		name:         label.Name,
+		parentID:     label.ParentID,
+		color:        label.Color,
 		log:          l,
 	}
 
@@ -156,6 +163,11 @@ func (storeMailbox *Mailbox) Name() string {
 	return storeMailbox.labelName
 }
 
+// ParentID returns ID of the parent mailbox, empty for top level mailboxes.
+func (storeMailbox *Mailbox) ParentID() string {
+	return storeMailbox.parentID
+}
+
 // Color returns the color of mailbox.
 func (storeMailbox *Mailbox) Color() string {
 	return storeMailbox.color
@@ -182,6 +194,8 @@ func (storeMailbox *Mailbox) IsSystem() bool {
 }
 
 // Rename updates the mailbox by calling an API.
+// The new name can have different parents, in which case the mailbox is moved
+// under them together with all its children. Missing parents are created.
 // Change has to be propagated to all the same mailboxes in all addresses.
 // The propagation is processed by the event loop.
 func (storeMailbox *Mailbox) Rename(newName string) error {
@@ -189,20 +203,16 @@ func (storeMailbox *Mailbox) Rename(newName string) error {
 		return fmt.Errorf("cannot rename system mailboxes")
 	}
 
-	if storeMailbox.IsFolder() {
-		if !strings.HasPrefix(newName, UserFoldersPrefix) {
-			return fmt.Errorf("cannot rename folder to non-folder")
-		}
-
-		newName = strings.TrimPrefix(newName, UserFoldersPrefix)
+	if storeMailbox.IsFolder() && !strings.HasPrefix(newName, UserFoldersPrefix) {
+		return fmt.Errorf("cannot rename folder to non-folder")
 	}
 
-	if storeMailbox.IsLabel() {
-		if !strings.HasPrefix(newName, UserLabelsPrefix) {
-			return fmt.Errorf("cannot rename label to non-label")
-		}
+	if storeMailbox.IsLabel() && !strings.HasPrefix(newName, UserLabelsPrefix) {
+		return fmt.Errorf("cannot rename label to non-label")
+	}
 
-		newName = strings.TrimPrefix(newName, UserLabelsPrefix)
+	if strings.HasPrefix(newName, storeMailbox.labelName+PathDelimiter) {
+		return fmt.Errorf("cannot move mailbox under itself")
 	}
 
 	return storeMailbox.storeAddress.updateMailbox(storeMailbox.labelID, newName, storeMailbox.color)
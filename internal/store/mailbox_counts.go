@@ -68,6 +68,7 @@ type mailboxCounts struct {
 	IsFolder    bool
 	TotalOnAPI  uint
 	UnreadOnAPI uint
+	ParentID    string
 }
 
 func txGetCountsFromBucketOrNew(bkt *bolt.Bucket, labelID string) (*mailboxCounts, error) {
@@ -92,13 +93,13 @@ func (mc *mailboxCounts) txWriteToBucket(bucket *bolt.Bucket) error {
 
 func getSystemFolders() []*mailboxCounts {
 	return []*mailboxCounts{
-		{pmapi.InboxLabel, "INBOX", "#000", -1000, true, 0, 0},
-		{pmapi.SentLabel, "Sent", "#000", -9, true, 0, 0},
-		{pmapi.ArchiveLabel, "Archive", "#000", -8, true, 0, 0},
-		{pmapi.SpamLabel, "Spam", "#000", -7, true, 0, 0},
-		{pmapi.TrashLabel, "Trash", "#000", -6, true, 0, 0},
-		{pmapi.AllMailLabel, "All Mail", "#000", -5, true, 0, 0},
-		{pmapi.DraftLabel, "Drafts", "#000", -4, true, 0, 0},
+		{pmapi.InboxLabel, "INBOX", "#000", -1000, true, 0, 0, ""},
+		{pmapi.SentLabel, "Sent", "#000", -9, true, 0, 0, ""},
+		{pmapi.ArchiveLabel, "Archive", "#000", -8, true, 0, 0, ""},
+		{pmapi.SpamLabel, "Spam", "#000", -7, true, 0, 0, ""},
+		{pmapi.TrashLabel, "Trash", "#000", -6, true, 0, 0, ""},
+		{pmapi.AllMailLabel, "All Mail", "#000", -5, true, 0, 0, ""},
+		{pmapi.DraftLabel, "Drafts", "#000", -4, true, 0, 0, ""},
 	}
 }
 
@@ -126,6 +127,7 @@ func (mc *mailboxCounts) getPMLabel() *pmapi.Label {
 		Order:     mc.Order,
 		Type:      pmapi.LabelTypeMailbox,
 		Exclusive: mc.isExclusive(),
+		ParentID:  mc.ParentID,
 	}
 }
 
@@ -159,6 +161,7 @@ func (store *Store) createOrUpdateMailboxCountsBuckets(labels []*pmapi.Label) er
 			mailbox.Color = label.Color
 			mailbox.Order = label.Order
 			mailbox.IsFolder = label.Exclusive == 1
+			mailbox.ParentID = label.ParentID
 
 			// Write.
 			if err = mailbox.txWriteToBucket(countsBkt); err != nil {
@@ -18,6 +18,8 @@
 package store
 
 import (
+	"context"
+
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -35,9 +37,9 @@ func (storeMailbox *Mailbox) GetMessage(apiID string) (*Message, error) {
 }
 
 // FetchMessage fetches the message with the given `apiID`, stores it in the database, and returns a new store message
-// wrapping it.
-func (storeMailbox *Mailbox) FetchMessage(apiID string) (*Message, error) {
-	msg, err := storeMailbox.store.fetchMessage(apiID)
+// wrapping it. The request is aborted when `ctx` is canceled.
+func (storeMailbox *Mailbox) FetchMessage(ctx context.Context, apiID string) (*Message, error) {
+	msg, err := storeMailbox.store.fetchMessage(ctx, apiID)
 	if err != nil {
 		return nil, err
 	}
@@ -72,6 +74,7 @@ func (storeMailbox *Mailbox) ImportMessage(msg *pmapi.Message, body []byte, labe
 // LabelMessages adds the label by calling an API.
 // It has to be propagated to all the same messages in all mailboxes.
 // The propagation is processed by the event loop.
+// When the API is not reachable, the change is applied locally and queued.
 func (storeMailbox *Mailbox) LabelMessages(apiIDs []string) error {
 	log.WithFields(logrus.Fields{
 		"messages": apiIDs,
@@ -79,7 +82,7 @@ func (storeMailbox *Mailbox) LabelMessages(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Labeling messages")
 	defer storeMailbox.pollNow()
-	return storeMailbox.api().LabelMessages(apiIDs, storeMailbox.labelID)
+	return storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpLabel, apiIDs, storeMailbox.labelID))
 }
 
 // UnlabelMessages removes the label by calling an API.
@@ -92,7 +95,7 @@ func (storeMailbox *Mailbox) UnlabelMessages(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Unlabeling messages")
 	defer storeMailbox.pollNow()
-	return storeMailbox.api().UnlabelMessages(apiIDs, storeMailbox.labelID)
+	return storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpUnlabel, apiIDs, storeMailbox.labelID))
 }
 
 // MarkMessagesRead marks the message read by calling an API.
@@ -116,7 +119,7 @@ func (storeMailbox *Mailbox) MarkMessagesRead(apiIDs []string) error {
 			ids = append(ids, apiID)
 		}
 	}
-	return storeMailbox.api().MarkMessagesRead(ids)
+	return storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpRead, ids, ""))
 }
 
 // MarkMessagesUnread marks the message unread by calling an API.
@@ -128,7 +131,7 @@ func (storeMailbox *Mailbox) MarkMessagesUnread(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Marking messages as unread")
 	defer storeMailbox.pollNow()
-	return storeMailbox.api().MarkMessagesUnread(apiIDs)
+	return storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpUnread, apiIDs, ""))
 }
 
 // MarkMessagesStarred adds the Starred label by calling an API.
@@ -141,7 +144,7 @@ func (storeMailbox *Mailbox) MarkMessagesStarred(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Marking messages as starred")
 	defer storeMailbox.pollNow()
-	return storeMailbox.api().LabelMessages(apiIDs, pmapi.StarredLabel)
+	return storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpLabel, apiIDs, pmapi.StarredLabel))
 }
 
 // MarkMessagesUnstarred removes the Starred label by calling an API.
@@ -154,7 +157,7 @@ func (storeMailbox *Mailbox) MarkMessagesUnstarred(apiIDs []string) error {
 		"mailbox":  storeMailbox.Name,
 	}).Trace("Marking messages as unstarred")
 	defer storeMailbox.pollNow()
-	return storeMailbox.api().UnlabelMessages(apiIDs, pmapi.StarredLabel)
+	return storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpUnlabel, apiIDs, pmapi.StarredLabel))
 }
 
 // DeleteMessages deletes messages.
@@ -196,18 +199,14 @@ func (storeMailbox *Mailbox) DeleteMessages(apiIDs []string) error {
 				messageIDsToDelete = append(messageIDsToDelete, apiID)
 			}
 		}
-		if len(messageIDsToUnlabel) > 0 {
-			if err := storeMailbox.api().UnlabelMessages(messageIDsToUnlabel, storeMailbox.labelID); err != nil {
-				log.WithError(err).Warning("Cannot unlabel before deleting")
-			}
+		if err := storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpUnlabel, messageIDsToUnlabel, storeMailbox.labelID)); err != nil {
+			log.WithError(err).Warning("Cannot unlabel before deleting")
 		}
-		if len(messageIDsToDelete) > 0 {
-			if err := storeMailbox.api().DeleteMessages(messageIDsToDelete); err != nil {
-				return err
-			}
+		if err := storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpDelete, messageIDsToDelete, "")); err != nil {
+			return err
 		}
 	default:
-		if err := storeMailbox.api().UnlabelMessages(apiIDs, storeMailbox.labelID); err != nil {
+		if err := storeMailbox.store.runOrQueueOperation(newWriteOperation(writeOpUnlabel, apiIDs, storeMailbox.labelID)); err != nil {
 			return err
 		}
 	}
@@ -229,22 +228,24 @@ func (storeMailbox *Mailbox) txSkipAndRemoveFromMailbox(tx *bolt.Tx, msg *pmapi.
 		return
 	}
 
-	skipAndRemove = true
+	skipAndRemove = !storeMailbox.belongsToMailbox(mode, msg)
+	return skipAndRemove
+}
 
-	// If it's split mode and it shouldn't be under this address, it should be skipped and removed.
-	if mode == splitMode && storeMailbox.storeAddress.addressID != msg.AddressID {
-		return
+// belongsToMailbox returns whether the message should be listed in this mailbox.
+func (storeMailbox *Mailbox) belongsToMailbox(mode addressMode, msg *pmapi.Message) bool {
+	// If it's split or hybrid mode and it shouldn't be under this address, it doesn't belong here.
+	if mode != combinedMode && storeMailbox.store.getStoreAddressID(msg.AddressID) != storeMailbox.storeAddress.addressID {
+		return false
 	}
 
-	// If the message belongs in this mailbox, don't skip/remove it.
 	for _, labelID := range msg.LabelIDs {
 		if labelID == storeMailbox.labelID {
-			skipAndRemove = false
-			return
+			return true
 		}
 	}
 
-	return skipAndRemove
+	return false
 }
 
 // txCreateOrUpdateMessages will delete, create or update message from mailbox.
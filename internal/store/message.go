@@ -49,6 +49,15 @@ func (message *Message) ID() string {
 	return message.msg.ID
 }
 
+// ConversationID returns ID of the conversation the message belongs to on
+// our API. Message without conversation is the only one in its own.
+func (message *Message) ConversationID() string {
+	if message.msg.ConversationID == "" {
+		return message.msg.ID
+	}
+	return message.msg.ConversationID
+}
+
 // UID returns message UID for IMAP, specific for mailbox used to get the message.
 func (message *Message) UID() (uint32, error) {
 	return message.storeMailbox.getUID(message.ID())
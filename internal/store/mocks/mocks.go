@@ -94,6 +94,20 @@ func (mr *MockBridgeUserMockRecorder) GetAddressID(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAddressID", reflect.TypeOf((*MockBridgeUser)(nil).GetAddressID), arg0)
 }
 
+// GetConfiguredAddressGroups mocks base method
+func (m *MockBridgeUser) GetConfiguredAddressGroups() [][]string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetConfiguredAddressGroups")
+	ret0, _ := ret[0].([][]string)
+	return ret0
+}
+
+// GetConfiguredAddressGroups indicates an expected call of GetConfiguredAddressGroups
+func (mr *MockBridgeUserMockRecorder) GetConfiguredAddressGroups() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetConfiguredAddressGroups", reflect.TypeOf((*MockBridgeUser)(nil).GetConfiguredAddressGroups))
+}
+
 // GetPrimaryAddress mocks base method
 func (m *MockBridgeUser) GetPrimaryAddress() string {
 	m.ctrl.T.Helper()
@@ -0,0 +1,326 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrMessageIsSending is returned when the same message is still being sent
+// and the first send did not finish in time.
+var ErrMessageIsSending = errors.New("message is sending") //nolint[gochecknoglobals]
+
+type messageGetter interface {
+	GetMessage(string) (*pmapi.Message, error)
+}
+
+// sendRecord is the value stored in the send recorder bucket.
+// Subject and recipients are kept to detect hash collisions.
+type sendRecord struct {
+	MessageID  string
+	Time       int64
+	Subject    string
+	Recipients []string
+}
+
+func newSendRecord(message *pmapi.Message) *sendRecord {
+	return &sendRecord{
+		Subject:    message.Subject,
+		Recipients: getMessageRecipients(message),
+	}
+}
+
+func (r *sendRecord) matches(other *sendRecord) bool {
+	if r.Subject != other.Subject || len(r.Recipients) != len(other.Recipients) {
+		return false
+	}
+	for i := range r.Recipients {
+		if r.Recipients[i] != other.Recipients[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type pendingSend struct {
+	record *sendRecord
+	done   chan struct{}
+}
+
+// sendRecorder prevents sending the same message several times.
+// If Outlook does not get a response quickly, it will try to send the message again, leading
+// to sending the same message multiple times. In case we detect the same message is in the
+// sending queue, we wait for the first request to finish. If the message is still being
+// sent after the timeout, we return an error back to the client. The UX is not the best,
+// but it's better than sending the message many times. If the message was sent, we simply return
+// that it was sent to indicate it's OK.
+// Hashes are kept in the database to survive restarts.
+type sendRecorder struct {
+	config  config.SendRecorderConfig
+	db      *bolt.DB
+	api     messageGetter
+	lock    *sync.Mutex
+	pending map[string]*pendingSend
+}
+
+func newSendRecorder(cfg config.SendRecorderConfig, db *bolt.DB, api messageGetter) *sendRecorder {
+	return &sendRecorder{
+		config:  cfg,
+		db:      db,
+		api:     api,
+		lock:    &sync.Mutex{},
+		pending: map[string]*pendingSend{},
+	}
+}
+
+func getMessageHash(message *pmapi.Message) string {
+	h := sha256.New()
+	_, _ = h.Write([]byte(message.AddressID + message.Subject))
+	if message.Sender != nil {
+		_, _ = h.Write([]byte(message.Sender.Address))
+	}
+	for _, to := range message.ToList {
+		_, _ = h.Write([]byte(to.Address))
+	}
+	for _, to := range message.CCList {
+		_, _ = h.Write([]byte(to.Address))
+	}
+	for _, to := range message.BCCList {
+		_, _ = h.Write([]byte(to.Address))
+	}
+	_, _ = h.Write([]byte(message.Body))
+	for _, att := range message.Attachments {
+		_, _ = h.Write([]byte(att.Name + att.MIMEType + fmt.Sprintf("%d", att.Size)))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+func getMessageRecipients(message *pmapi.Message) (recipients []string) {
+	for _, list := range [][]*mail.Address{message.ToList, message.CCList, message.BCCList} {
+		for _, address := range list {
+			recipients = append(recipients, address.Address)
+		}
+	}
+	return
+}
+
+// start checks whether the message is being sent or was sent already.
+// If the same message is being sent right now, it waits for it to finish.
+// When the message should be sent, it is marked as pending and `finish`
+// has to be called once sending is over.
+func (q *sendRecorder) start(message *pmapi.Message) (hash string, wasSent bool, err error) {
+	hash = getMessageHash(message)
+	record := newSendRecord(message)
+
+	timeout := time.NewTimer(q.config.WaitTimeout)
+	defer timeout.Stop()
+
+	for {
+		q.lock.Lock()
+		pending, ok := q.pending[hash]
+		if !ok {
+			// The message is marked as pending before the check so the lock
+			// does not have to be held while asking API about the previous send.
+			q.pending[hash] = &pendingSend{record: record, done: make(chan struct{})}
+			q.lock.Unlock()
+
+			isSending, wasSent := q.isSendingOrSent(hash, record)
+			if isSending || wasSent {
+				q.release(hash)
+			}
+			if isSending {
+				return "", false, ErrMessageIsSending
+			}
+			return hash, wasSent, nil
+		}
+		q.lock.Unlock()
+
+		// Different message with the same hash cannot be recorded
+		// while the first one is pending, so it is sent without it.
+		if !pending.record.matches(record) {
+			log.WithField("hash", hash).Warn("Send recorder hash collision, sending without recording")
+			return "", false, nil
+		}
+
+		log.Debug("Message is in send queue, waiting")
+		select {
+		case <-pending.done:
+		case <-timeout.C:
+			log.Debug("Message is still in send queue, returning error")
+			return "", false, ErrMessageIsSending
+		}
+	}
+}
+
+// setMessageID stores the ID of the draft which is being sent.
+func (q *sendRecorder) setMessageID(hash, messageID string) error {
+	if hash == "" {
+		return nil
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	pending, ok := q.pending[hash]
+	if !ok {
+		return errors.New("message is not pending")
+	}
+	pending.record.MessageID = messageID
+	pending.record.Time = time.Now().Unix()
+
+	return q.db.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(pending.record)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(sendRecorderBucket).Put([]byte(hash), b)
+	})
+}
+
+// finish releases all duplicates waiting for the message. If the message was
+// not sent, the record is removed to allow sending it again.
+func (q *sendRecorder) finish(hash string, sent bool) {
+	if hash == "" {
+		return
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if !sent {
+		if err := q.db.Update(func(tx *bolt.Tx) error {
+			return tx.Bucket(sendRecorderBucket).Delete([]byte(hash))
+		}); err != nil {
+			log.WithError(err).Warn("Cannot remove send record")
+		}
+	}
+
+	q.releaseLocked(hash)
+}
+
+// release removes the message from pending ones and wakes up duplicates.
+func (q *sendRecorder) release(hash string) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.releaseLocked(hash)
+}
+
+func (q *sendRecorder) releaseLocked(hash string) {
+	if pending, ok := q.pending[hash]; ok {
+		close(pending.done)
+		delete(q.pending, hash)
+	}
+}
+
+func (q *sendRecorder) isSendingOrSent(hash string, record *sendRecord) (isSending bool, wasSent bool) {
+	q.deleteExpiredKeys()
+
+	stored, err := q.getRecord(hash)
+	if err != nil || stored == nil {
+		return
+	}
+	if !stored.matches(record) {
+		log.WithField("hash", hash).Warn("Send recorder hash collision, ignoring previous message")
+		return
+	}
+	message, err := q.api.GetMessage(stored.MessageID)
+	// Message could be deleted or there could be an internet issue or whatever,
+	// so let's assume the message was not sent.
+	if err != nil {
+		return
+	}
+	if message.Type == pmapi.MessageTypeDraft {
+		if time.Since(time.Unix(message.Time, 0)) > q.config.SendingTimeout {
+			return
+		}
+		isSending = true
+	}
+	// MessageTypeInboxAndSent can be when message was sent to myself.
+	if message.Type == pmapi.MessageTypeSent || message.Type == pmapi.MessageTypeInboxAndSent {
+		wasSent = true
+	}
+	return
+}
+
+func (q *sendRecorder) getRecord(hash string) (record *sendRecord, err error) {
+	err = q.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(sendRecorderBucket).Get([]byte(hash))
+		if value == nil {
+			return nil
+		}
+		record = &sendRecord{}
+		return json.Unmarshal(value, record)
+	})
+	return
+}
+
+func (q *sendRecorder) deleteExpiredKeys() {
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(sendRecorderBucket)
+		expired := [][]byte{}
+		err := b.ForEach(func(k, v []byte) error {
+			record := &sendRecord{}
+			if err := json.Unmarshal(v, record); err != nil || time.Since(time.Unix(record.Time, 0)) > q.config.Expiration {
+				expired = append(expired, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Warn("Cannot delete expired send records")
+	}
+}
+
+// StartSending checks whether the same message is being sent or was sent
+// recently. When it was sent already, `wasSent` is true and nothing should
+// be done. Otherwise the message should be sent and `FinishSending` must be
+// called with the returned hash once sending is over. The hash is empty when
+// the message cannot be recorded, which is handled by the other methods.
+func (store *Store) StartSending(message *pmapi.Message) (hash string, wasSent bool, err error) {
+	return store.sendRecorder.start(message)
+}
+
+// RecordSendingMessage stores the ID of the draft being sent for the message hash.
+func (store *Store) RecordSendingMessage(hash, messageID string) error {
+	return store.sendRecorder.setMessageID(hash, messageID)
+}
+
+// FinishSending marks the sending as finished and wakes up any duplicates waiting for it.
+func (store *Store) FinishSending(hash string, sent bool) {
+	store.sendRecorder.finish(hash, sent)
+}
@@ -0,0 +1,312 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/config"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+type testSendRecorderGetMessageMock struct {
+	message *pmapi.Message
+	err     error
+}
+
+func (m *testSendRecorderGetMessageMock) GetMessage(messageID string) (*pmapi.Message, error) {
+	return m.message, m.err
+}
+
+func newTestSendRecorderConfig() config.SendRecorderConfig {
+	return config.SendRecorderConfig{
+		Expiration:     30 * time.Minute,
+		SendingTimeout: 10 * time.Minute,
+		WaitTimeout:    60 * time.Second,
+	}
+}
+
+func newTestSendRecorder(t *testing.T, cfg config.SendRecorderConfig, api messageGetter) (*sendRecorder, func()) {
+	dir, err := ioutil.TempDir("", "send-recorder-test")
+	require.NoError(t, err)
+
+	db, err := openBoltDatabase(filepath.Join(dir, "test.db"))
+	require.NoError(t, err)
+
+	return newSendRecorder(cfg, db, api), func() {
+		require.NoError(t, db.Close())
+		require.NoError(t, os.RemoveAll(dir))
+	}
+}
+
+func putTestSendRecord(t *testing.T, q *sendRecorder, hash string, record *sendRecord) {
+	require.NoError(t, q.db.Update(func(tx *bolt.Tx) error {
+		b, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(sendRecorderBucket).Put([]byte(hash), b)
+	}))
+}
+
+func newTestSendRecorderMessage() *pmapi.Message {
+	return &pmapi.Message{
+		AddressID: "address123",
+		Subject:   "Subject #1",
+		Sender: &mail.Address{
+			Address: "from@pm.me",
+		},
+		ToList: []*mail.Address{
+			{Address: "to@pm.me"},
+		},
+		CCList:  []*mail.Address{},
+		BCCList: []*mail.Address{},
+		Body:    "body",
+		Attachments: []*pmapi.Attachment{
+			{
+				Name:     "att1",
+				MIMEType: "image/png",
+				Size:     12345,
+			},
+		},
+	}
+}
+
+func TestSendRecorder_getMessageHash(t *testing.T) {
+	hash := getMessageHash(newTestSendRecorderMessage())
+
+	testCases := []struct {
+		name        string
+		change      func(*pmapi.Message)
+		expectEqual bool
+	}{
+		{"same", func(m *pmapi.Message) {}, true},
+		{"AddressID", func(m *pmapi.Message) { m.AddressID = "..." }, false},
+		{"subject", func(m *pmapi.Message) { m.Subject = "Subject #1." }, false},
+		{"sender", func(m *pmapi.Message) { m.Sender.Address = "sender@pm.me" }, false},
+		{"ToList changed address", func(m *pmapi.Message) { m.ToList[0].Address = "other@pm.me" }, false},
+		{"ToList more addresses", func(m *pmapi.Message) { m.ToList = append(m.ToList, &mail.Address{Address: "another@pm.me"}) }, false},
+		{"CCList", func(m *pmapi.Message) { m.CCList = []*mail.Address{{Address: "to@pm.me"}} }, false},
+		{"BCCList", func(m *pmapi.Message) { m.BCCList = []*mail.Address{{Address: "to@pm.me"}} }, false},
+		{"body", func(m *pmapi.Message) { m.Body = "body." }, false},
+		{"no attachment", func(m *pmapi.Message) { m.Attachments = []*pmapi.Attachment{} }, false},
+		{"attachment name", func(m *pmapi.Message) { m.Attachments[0].Name = "..." }, false},
+		{"attachment MIMEType", func(m *pmapi.Message) { m.Attachments[0].MIMEType = "image/jpeg" }, false},
+		{"attachment size", func(m *pmapi.Message) { m.Attachments[0].Size = 42 }, false},
+	}
+	for _, tc := range testCases {
+		tc := tc // bind
+		t.Run(tc.name, func(t *testing.T) {
+			message := newTestSendRecorderMessage()
+			tc.change(message)
+			newHash := getMessageHash(message)
+			if tc.expectEqual {
+				assert.Equal(t, hash, newHash)
+			} else {
+				assert.NotEqual(t, hash, newHash)
+			}
+		})
+	}
+}
+
+func TestSendRecorder_isSendingOrSent(t *testing.T) {
+	testCases := []struct {
+		hash          string
+		message       *pmapi.Message
+		err           error
+		wantIsSending bool
+		wantWasSent   bool
+	}{
+		{"badhash", &pmapi.Message{Type: pmapi.MessageTypeDraft}, nil, false, false},
+		{"hash", nil, errors.New("message not found"), false, false},
+		{"hash", &pmapi.Message{Type: pmapi.MessageTypeInbox}, nil, false, false},
+		{"hash", &pmapi.Message{Type: pmapi.MessageTypeDraft, Time: time.Now().Add(-20 * time.Minute).Unix()}, nil, false, false},
+		{"hash", &pmapi.Message{Type: pmapi.MessageTypeDraft, Time: time.Now().Unix()}, nil, true, false},
+		{"hash", &pmapi.Message{Type: pmapi.MessageTypeSent}, nil, false, true},
+		{"hash", &pmapi.Message{Type: pmapi.MessageTypeInboxAndSent}, nil, false, true},
+	}
+	for i, tc := range testCases {
+		tc := tc // bind
+		t.Run(fmt.Sprintf("%d / %v / %v / %v", i, tc.hash, tc.message, tc.err), func(t *testing.T) {
+			messageGetter := &testSendRecorderGetMessageMock{message: tc.message, err: tc.err}
+			q, cleanup := newTestSendRecorder(t, newTestSendRecorderConfig(), messageGetter)
+			defer cleanup()
+
+			record := newSendRecord(newTestSendRecorderMessage())
+			q.pending["hash"] = &pendingSend{record: record, done: make(chan struct{})}
+			require.NoError(t, q.setMessageID("hash", "messageID"))
+
+			isSending, wasSent := q.isSendingOrSent(tc.hash, record)
+			assert.Equal(t, tc.wantIsSending, isSending, "isSending does not match")
+			assert.Equal(t, tc.wantWasSent, wasSent, "wasSent does not match")
+		})
+	}
+}
+
+func TestSendRecorder_isSendingOrSent_collision(t *testing.T) {
+	messageGetter := &testSendRecorderGetMessageMock{message: &pmapi.Message{Type: pmapi.MessageTypeSent}}
+	q, cleanup := newTestSendRecorder(t, newTestSendRecorderConfig(), messageGetter)
+	defer cleanup()
+
+	message := newTestSendRecorderMessage()
+	q.pending["hash"] = &pendingSend{record: newSendRecord(message), done: make(chan struct{})}
+	require.NoError(t, q.setMessageID("hash", "messageID"))
+
+	message.Subject = "Different subject with the same hash"
+	isSending, wasSent := q.isSendingOrSent("hash", newSendRecord(message))
+	assert.False(t, isSending)
+	assert.False(t, wasSent)
+}
+
+func TestSendRecorder_deleteExpiredKeys(t *testing.T) {
+	cfg := newTestSendRecorderConfig()
+	cfg.Expiration = time.Minute
+	q, cleanup := newTestSendRecorder(t, cfg, &testSendRecorderGetMessageMock{})
+	defer cleanup()
+
+	putTestSendRecord(t, q, "hash1", &sendRecord{MessageID: "msg1", Time: time.Now().Unix()})
+	putTestSendRecord(t, q, "hash2", &sendRecord{MessageID: "msg2", Time: time.Now().Add(-2 * time.Minute).Unix()})
+
+	q.deleteExpiredKeys()
+
+	record, err := q.getRecord("hash1")
+	require.NoError(t, err)
+	assert.NotNil(t, record)
+	record, err = q.getRecord("hash2")
+	require.NoError(t, err)
+	assert.Nil(t, record)
+}
+
+func TestSendRecorder_duplicateWaitsForFirstSend(t *testing.T) {
+	messageGetter := &testSendRecorderGetMessageMock{message: &pmapi.Message{Type: pmapi.MessageTypeSent}}
+	q, cleanup := newTestSendRecorder(t, newTestSendRecorderConfig(), messageGetter)
+	defer cleanup()
+
+	hash, wasSent, err := q.start(newTestSendRecorderMessage())
+	require.NoError(t, err)
+	require.False(t, wasSent)
+	require.NoError(t, q.setMessageID(hash, "messageID"))
+
+	duplicateDone := make(chan bool)
+	go func() {
+		_, wasSent, err := q.start(newTestSendRecorderMessage())
+		assert.NoError(t, err)
+		duplicateDone <- wasSent
+	}()
+
+	select {
+	case <-duplicateDone:
+		t.Fatal("duplicate should wait for the first send")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	q.finish(hash, true)
+	assert.True(t, <-duplicateDone)
+}
+
+func TestSendRecorder_duplicateSendsAgainIfFirstFailed(t *testing.T) {
+	q, cleanup := newTestSendRecorder(t, newTestSendRecorderConfig(), &testSendRecorderGetMessageMock{err: errors.New("no message")})
+	defer cleanup()
+
+	hash, _, err := q.start(newTestSendRecorderMessage())
+	require.NoError(t, err)
+	require.NoError(t, q.setMessageID(hash, "messageID"))
+	q.finish(hash, false)
+
+	record, err := q.getRecord(hash)
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	newHash, wasSent, err := q.start(newTestSendRecorderMessage())
+	require.NoError(t, err)
+	assert.False(t, wasSent)
+	assert.Equal(t, hash, newHash)
+}
+
+func TestSendRecorder_duplicateTimeout(t *testing.T) {
+	cfg := newTestSendRecorderConfig()
+	cfg.WaitTimeout = 10 * time.Millisecond
+	q, cleanup := newTestSendRecorder(t, cfg, &testSendRecorderGetMessageMock{})
+	defer cleanup()
+
+	_, _, err := q.start(newTestSendRecorderMessage())
+	require.NoError(t, err)
+
+	_, _, err = q.start(newTestSendRecorderMessage())
+	assert.Equal(t, ErrMessageIsSending, err)
+}
+
+type testSendRecorderBlockingGetter struct {
+	called  chan struct{}
+	release chan struct{}
+}
+
+func (g *testSendRecorderBlockingGetter) GetMessage(messageID string) (*pmapi.Message, error) {
+	close(g.called)
+	<-g.release
+	return &pmapi.Message{Type: pmapi.MessageTypeSent}, nil
+}
+
+func TestSendRecorder_lockNotHeldDuringAPICall(t *testing.T) {
+	getter := &testSendRecorderBlockingGetter{called: make(chan struct{}), release: make(chan struct{})}
+	q, cleanup := newTestSendRecorder(t, newTestSendRecorderConfig(), getter)
+	defer cleanup()
+
+	message := newTestSendRecorderMessage()
+	record := newSendRecord(message)
+	record.MessageID = "messageID"
+	record.Time = time.Now().Unix()
+	putTestSendRecord(t, q, getMessageHash(message), record)
+
+	firstDone := make(chan bool)
+	go func() {
+		_, wasSent, err := q.start(message)
+		assert.NoError(t, err)
+		firstDone <- wasSent
+	}()
+	<-getter.called
+
+	otherMessage := newTestSendRecorderMessage()
+	otherMessage.Subject = "Other subject"
+	otherDone := make(chan error)
+	go func() {
+		_, _, err := q.start(otherMessage)
+		otherDone <- err
+	}()
+
+	select {
+	case err := <-otherDone:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("other message should not wait for API call of the first one")
+	}
+
+	close(getter.release)
+	assert.True(t, <-firstDone)
+}
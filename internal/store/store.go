@@ -24,6 +24,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/listener"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/hashicorp/go-multierror"
@@ -52,7 +53,7 @@ var (
 	// * metadata
 	//   * {messageID} -> message data (subject, from, to, time, headers, body size, ...)
 	// * counts
-	//   * {mailboxID} -> mailboxCounts: totalOnAPI, unreadOnAPI, labelName, labelColor, labelIsExclusive
+	//   * {mailboxID} -> mailboxCounts: totalOnAPI, unreadOnAPI, labelName, labelColor, labelIsExclusive, parentID
 	// * address_info
 	//   * {index} -> {address, addressID}
 	// * address_mode
@@ -63,21 +64,27 @@ var (
 	//   * sync_state -> string timestamp when it was last synced (when missing, sync should be ongoing)
 	//   * ids_ranges -> json array of groups with start and end message ID (when missing, there is no ongoing sync)
 	//   * ids_to_be_deleted -> json array of message IDs to be deleted after sync (when missing, there is no ongoing sync)
+	// * send_recorder
+	//   * {messageHash} -> sendRecord: messageID, time, subject and recipients of recently sent message
+	// * write_queue
+	//   * {sequence} -> writeOperation: type, message IDs and label of operation waiting for the API
 	// * mailboxes
 	//   * {addressID+mailboxID}
 	//     * imap_ids
 	//       * {imapUID} -> string messageID
 	//     * api_ids
 	//       * {messageID} -> uint32 imapUID
-	metadataBucket    = []byte("metadata")          //nolint[gochecknoglobals]
-	countsBucket      = []byte("counts")            //nolint[gochecknoglobals]
-	addressInfoBucket = []byte("address_info")      //nolint[gochecknoglobals]
-	addressModeBucket = []byte("address_mode")      //nolint[gochecknoglobals]
-	syncStateBucket   = []byte("sync_state")        //nolint[gochecknoglobals]
-	mailboxesBucket   = []byte("mailboxes")         //nolint[gochecknoglobals]
-	imapIDsBucket     = []byte("imap_ids")          //nolint[gochecknoglobals]
-	apiIDsBucket      = []byte("api_ids")           //nolint[gochecknoglobals]
-	mboxVersionBucket = []byte("mailboxes_version") //nolint[gochecknoglobals]
+	metadataBucket     = []byte("metadata")          //nolint[gochecknoglobals]
+	countsBucket       = []byte("counts")            //nolint[gochecknoglobals]
+	addressInfoBucket  = []byte("address_info")      //nolint[gochecknoglobals]
+	addressModeBucket  = []byte("address_mode")      //nolint[gochecknoglobals]
+	syncStateBucket    = []byte("sync_state")        //nolint[gochecknoglobals]
+	mailboxesBucket    = []byte("mailboxes")         //nolint[gochecknoglobals]
+	imapIDsBucket      = []byte("imap_ids")          //nolint[gochecknoglobals]
+	apiIDsBucket       = []byte("api_ids")           //nolint[gochecknoglobals]
+	mboxVersionBucket  = []byte("mailboxes_version") //nolint[gochecknoglobals]
+	sendRecorderBucket = []byte("send_recorder")     //nolint[gochecknoglobals]
+	writeQueueBucket   = []byte("write_queue")       //nolint[gochecknoglobals]
 
 	// ErrNoSuchAPIID when mailbox does not have API ID.
 	ErrNoSuchAPIID = errors.New("no such api id") //nolint[gochecknoglobals]
@@ -93,6 +100,7 @@ type Store struct {
 	eventLoop    *eventLoop
 	user         BridgeUser
 	api          PMAPIProvider
+	events       listener.Listener
 
 	log *logrus.Entry
 
@@ -104,7 +112,20 @@ type Store struct {
 	imapUpdates chan interface{}
 
 	isSyncRunning bool
+	isSyncPaused  bool
+	syncStop      chan struct{}
+	syncDone      chan struct{}
+	syncProgress  *syncProgress
 	addressMode   addressMode
+
+	// addressGroups are configured groups of addresses in hybrid mode and
+	// addressGroupIDs maps every address ID to the ID of its store address.
+	addressGroups    [][]string
+	addressGroupIDs  map[string]string
+	primaryAddressID string
+
+	sendRecorder *sendRecorder
+	writeQueue   *writeQueue
 }
 
 // New creates or opens a store for the given `user`.
@@ -115,6 +136,7 @@ func New(
 	events listener.Listener,
 	path string,
 	cache *Cache,
+	sendRecorderConfig config.SendRecorderConfig,
 ) (store *Store, err error) {
 	if user == nil || api == nil || events == nil || cache == nil {
 		return nil, fmt.Errorf("missing parameters - user: %v, api: %v, events: %v, cache: %v", user, api, events, cache)
@@ -141,11 +163,15 @@ func New(
 		panicHandler: panicHandler,
 		api:          api,
 		user:         user,
+		events:       events,
 		cache:        cache,
 		filePath:     path,
 		db:           bdb,
 		lock:         &sync.RWMutex{},
 		log:          l,
+		sendRecorder: newSendRecorder(sendRecorderConfig, bdb, api),
+		syncProgress: newSyncProgress(user.ID(), events),
+		writeQueue:   newWriteQueue(bdb),
 	}
 
 	if err = store.init(firstInit); err != nil {
@@ -210,6 +236,14 @@ func openBoltDatabase(filePath string) (db *bolt.DB, err error) {
 			return
 		}
 
+		if _, err = tx.CreateBucketIfNotExists(sendRecorderBucket); err != nil {
+			return
+		}
+
+		if _, err = tx.CreateBucketIfNotExists(writeQueueBucket); err != nil {
+			return
+		}
+
 		return
 	}
 
@@ -230,12 +264,7 @@ func (store *Store) init(firstInit bool) (err error) {
 	// If it's the first time we are creating the store, use the mode set in the
 	// user's credentials, otherwise read it from the DB (if present).
 	if firstInit {
-		if store.user.IsCombinedAddressMode() {
-			err = store.setAddressMode(combinedMode)
-		} else {
-			err = store.setAddressMode(splitMode)
-		}
-		if err != nil {
+		if err = store.initAddressMode(); err != nil {
 			return errors.Wrap(err, "first init setting store address mode")
 		}
 	} else if store.addressMode, err = store.getAddressMode(); err != nil {
@@ -245,6 +274,10 @@ func (store *Store) init(firstInit bool) (err error) {
 		}
 	}
 
+	if store.addressGroups, err = store.getAddressGroupsFromDB(); err != nil {
+		return errors.Wrap(err, "reading store address groups")
+	}
+
 	store.log.WithField("mode", store.addressMode).Debug("Initialising store")
 
 	labels, err := store.initCounts()
@@ -292,7 +325,8 @@ func (store *Store) initCounts() (labels []*pmapi.Label, err error) {
 }
 
 // initAddresses creates address objects in the store for each necessary address.
-// In combined mode this means just one mailbox for all addresses but in split mode this means one mailbox per address.
+// In combined mode this means just one mailbox for all addresses, in split mode this means one mailbox per address
+// and in hybrid mode one mailbox per address group.
 func (store *Store) initAddresses(labels []*pmapi.Label) (err error) {
 	store.addresses = make(map[string]*Address)
 
@@ -309,12 +343,10 @@ func (store *Store) initAddresses(labels []*pmapi.Label) (err error) {
 		return
 	}
 
-	// If in combined mode, we only need the user's primary address.
-	if store.addressMode == combinedMode {
-		addrInfo = addrInfo[:1]
-	}
-
-	for _, addr := range addrInfo {
+	// Every group of addresses needs only one store address. In combined mode
+	// it is the user's primary address, in split mode every address.
+	for _, group := range store.setAddressGroupIDs(addrInfo) {
+		addr := group[0]
 		if err = store.addAddress(addr.Address, addr.AddressID, labels); err != nil {
 			store.log.WithField("address", addr.Address).WithError(err).Error("Could not add address to store")
 		}
@@ -18,6 +18,9 @@
 package store
 
 import (
+	"encoding/json"
+	"strings"
+
 	"github.com/pkg/errors"
 	bolt "go.etcd.io/bbolt"
 )
@@ -27,7 +30,9 @@ type addressMode string
 const (
 	splitMode    addressMode = "split"
 	combinedMode addressMode = "combined"
+	hybridMode   addressMode = "hybrid"
 	modeKey                  = "mode"
+	groupsKey                = "groups"
 )
 
 // getAddressMode returns the current address mode (split or combined) of the store.
@@ -56,11 +61,33 @@ func (store *Store) getAddressMode() (mode addressMode, err error) {
 	return
 }
 
+// initAddressMode sets the address mode and groups from the user's
+// credentials when the store is created for the first time.
+func (store *Store) initAddressMode() error {
+	if store.user.IsCombinedAddressMode() {
+		return store.setAddressMode(combinedMode)
+	}
+
+	if groups := store.user.GetConfiguredAddressGroups(); len(groups) > 0 {
+		if err := store.setAddressGroups(groups); err != nil {
+			return err
+		}
+		return store.setAddressMode(hybridMode)
+	}
+
+	return store.setAddressMode(splitMode)
+}
+
 // IsCombinedMode returns whether the store is set to combined mode.
 func (store *Store) IsCombinedMode() bool {
 	return store.addressMode == combinedMode
 }
 
+// IsHybridMode returns whether the store is set to hybrid mode.
+func (store *Store) IsHybridMode() bool {
+	return store.addressMode == hybridMode
+}
+
 // UseCombinedMode sets whether the store should be set to combined mode.
 func (store *Store) UseCombinedMode(useCombined bool) (err error) {
 	if useCombined {
@@ -72,7 +99,41 @@ func (store *Store) UseCombinedMode(useCombined bool) (err error) {
 	return
 }
 
-// switchAddressMode sets the address mode to the given value and rebuilds the mailboxes.
+// UseHybridMode sets the store to hybrid mode with the given address groups.
+// Every group is a list of addresses which share one IMAP login and mailbox
+// tree. Addresses which are not in any group are combined with the primary
+// address.
+func (store *Store) UseHybridMode(groups [][]string) (err error) {
+	if len(groups) == 0 {
+		return errors.New("hybrid mode needs at least one address group")
+	}
+
+	if store.addressMode == hybridMode && equalAddressGroups(store.addressGroups, groups) {
+		log.Debug("The store is using the correct address groups")
+		return
+	}
+
+	if err = store.setAddressGroups(groups); err != nil {
+		log.WithError(err).Error("Could not set store address groups")
+		return
+	}
+
+	if store.addressMode != hybridMode {
+		if err = store.setAddressMode(hybridMode); err != nil {
+			log.WithError(err).Error("Could not set store address mode")
+			return
+		}
+	}
+
+	if err = store.reinitAddresses(); err != nil {
+		log.WithError(err).Error("Could not update mailboxes after changing address groups")
+		return
+	}
+
+	return
+}
+
+// switchAddressMode sets the address mode to the given value and updates the mailboxes.
 func (store *Store) switchAddressMode(mode addressMode) (err error) {
 	if store.addressMode == mode {
 		log.Debug("The store is using the correct address mode")
@@ -84,8 +145,8 @@ func (store *Store) switchAddressMode(mode addressMode) (err error) {
 		return
 	}
 
-	if err = store.RebuildMailboxes(); err != nil {
-		log.WithError(err).Error("Could not rebuild mailboxes after switching address mode")
+	if err = store.reinitAddresses(); err != nil {
+		log.WithError(err).Error("Could not update mailboxes after switching address mode")
 		return
 	}
 
@@ -110,3 +171,143 @@ func (store *Store) setAddressMode(mode addressMode) (err error) {
 
 	return
 }
+
+// GetAddressGroups returns addresses grouped by the current address mode.
+// The first address of every group is used as IMAP login.
+func (store *Store) GetAddressGroups() ([][]AddressInfo, error) {
+	addrInfo, err := store.GetAddressInfo()
+	if err != nil {
+		return nil, err
+	}
+	return groupAddresses(store.addressMode, store.addressGroups, addrInfo), nil
+}
+
+// getAddressGroupsFromDB returns address groups used in hybrid mode.
+func (store *Store) getAddressGroupsFromDB() (groups [][]string, err error) {
+	err = store.db.View(func(tx *bolt.Tx) error {
+		dbGroups := tx.Bucket(addressModeBucket).Get([]byte(groupsKey))
+		if dbGroups == nil {
+			return nil
+		}
+		return json.Unmarshal(dbGroups, &groups)
+	})
+	return
+}
+
+// setAddressGroups sets address groups used in hybrid mode.
+// It writes to database and updates the local value in the store object.
+func (store *Store) setAddressGroups(groups [][]string) (err error) {
+	store.log.WithField("groups", groups).Info("Setting store address groups")
+
+	dbGroups, err := json.Marshal(groups)
+	if err != nil {
+		return
+	}
+
+	tx := func(tx *bolt.Tx) (err error) {
+		b := tx.Bucket(addressModeBucket)
+		return b.Put([]byte(groupsKey), dbGroups)
+	}
+
+	if err = store.db.Update(tx); err != nil {
+		return
+	}
+
+	store.addressGroups = groups
+
+	return
+}
+
+// setAddressGroupIDs groups the addresses by the current address mode and
+// remembers which store address lists messages of which address.
+// The store lock must be held by the caller.
+func (store *Store) setAddressGroupIDs(addrInfo []AddressInfo) (groups [][]AddressInfo) {
+	groups = groupAddresses(store.addressMode, store.addressGroups, addrInfo)
+
+	groupIDs := map[string]string{}
+	for _, group := range groups {
+		for _, addr := range group {
+			groupIDs[addr.AddressID] = group[0].AddressID
+		}
+	}
+	store.addressGroupIDs = groupIDs
+	if len(groups) > 0 {
+		store.primaryAddressID = groups[0][0].AddressID
+	}
+
+	return groups
+}
+
+// getStoreAddressID returns the ID of the store address which lists messages
+// of the given address. The value is written only with the store lock held,
+// callers which do not hold the lock have to take it for reading.
+func (store *Store) getStoreAddressID(addressID string) string {
+	if storeAddressID, ok := store.addressGroupIDs[addressID]; ok {
+		return storeAddressID
+	}
+	// Messages of deleted addresses are listed under the primary address
+	// in hybrid mode, the same as in combined mode.
+	if store.addressMode == hybridMode {
+		return store.primaryAddressID
+	}
+	return addressID
+}
+
+// groupAddresses splits addresses into groups by the address mode. Every group
+// has its own store address (IMAP login) named after the first address in the
+// group. The first group always starts with the primary address.
+func groupAddresses(mode addressMode, configured [][]string, addrInfo []AddressInfo) (groups [][]AddressInfo) {
+	switch mode {
+	case combinedMode:
+		return [][]AddressInfo{addrInfo}
+	case hybridMode:
+		groupIndex := map[string]int{}
+		for index, group := range configured {
+			for _, address := range group {
+				groupIndex[strings.ToLower(address)] = index + 1
+			}
+		}
+
+		groups = make([][]AddressInfo, len(configured)+1)
+		for index, addr := range addrInfo {
+			// The primary address always stays in the first group.
+			if index == 0 {
+				groups[0] = append(groups[0], addr)
+				continue
+			}
+			groupIdx := groupIndex[strings.ToLower(addr.Address)]
+			groups[groupIdx] = append(groups[groupIdx], addr)
+		}
+
+		// Groups with deleted or disabled addresses only are skipped.
+		nonEmpty := groups[:0]
+		for _, group := range groups {
+			if len(group) > 0 {
+				nonEmpty = append(nonEmpty, group)
+			}
+		}
+		return nonEmpty
+	default:
+		for _, addr := range addrInfo {
+			groups = append(groups, []AddressInfo{addr})
+		}
+		return groups
+	}
+}
+
+func equalAddressGroups(a, b [][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return false
+		}
+		for j := range a[i] {
+			if !strings.EqualFold(a[i][j], b[i][j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupAddresses(t *testing.T) {
+	primary := AddressInfo{Address: "primary@pm.me", AddressID: "1"}
+	alias := AddressInfo{Address: "alias@pm.me", AddressID: "2"}
+	work := AddressInfo{Address: "work@pm.me", AddressID: "3"}
+	other := AddressInfo{Address: "other@pm.me", AddressID: "4"}
+	addrInfo := []AddressInfo{primary, alias, work, other}
+
+	a.Equal(t, [][]AddressInfo{addrInfo}, groupAddresses(combinedMode, nil, addrInfo))
+	a.Equal(t, [][]AddressInfo{{primary}, {alias}, {work}, {other}}, groupAddresses(splitMode, nil, addrInfo))
+	a.Equal(t, [][]AddressInfo{{primary, alias}, {work, other}}, groupAddresses(hybridMode, [][]string{{"Work@pm.me", "other@pm.me"}}, addrInfo))
+
+	// Primary address always stays in the first group and empty groups are skipped.
+	a.Equal(t, [][]AddressInfo{{primary, alias, other}, {work}}, groupAddresses(hybridMode, [][]string{{"primary@pm.me"}, {"deleted@pm.me"}, {"work@pm.me"}}, addrInfo))
+}
+
+func TestUseHybridModeListsMessagesByGroup(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+
+	msg1 := getTestMessage("msg1", "Test message 1", addr1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg1.AddressID = addrID1
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg1))
+	msg2 := getTestMessage("msg2", "Test message 2", addr2, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	msg2.AddressID = addrID2
+	require.NoError(t, m.store.createOrUpdateMessageEvent(msg2))
+
+	require.NoError(t, m.store.UseHybridMode([][]string{{addr2}}))
+	a.True(t, m.store.IsHybridMode())
+	a.False(t, m.store.IsCombinedMode())
+
+	groups, err := m.store.GetAddressGroups()
+	require.NoError(t, err)
+	a.Equal(t, [][]AddressInfo{
+		{{Address: addr1, AddressID: addrID1}},
+		{{Address: addr2, AddressID: addrID2}},
+	}, groups)
+
+	require.Len(t, m.store.addresses, 2)
+	checkMailboxMessageIDs(t, m, pmapi.InboxLabel, []wantID{{"msg1", 1}})
+
+	ids, err := m.store.addresses[addrID2].mailboxes[pmapi.InboxLabel].GetAPIIDsFromSequenceRange(1, 0)
+	require.NoError(t, err)
+	a.Equal(t, []string{"msg2"}, ids)
+
+	a.True(t, m.store.addresses[addrID1].ListsAddressID(addrID1))
+	a.False(t, m.store.addresses[addrID1].ListsAddressID(addrID2))
+	// Messages of unknown addresses are listed with the primary address.
+	a.True(t, m.store.addresses[addrID1].ListsAddressID("deletedAddressID"))
+}
+
+func TestSwitchAddressModeKeepsUIDs(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	uidValidity := m.store.getMailboxesVersion()
+
+	for _, msg := range []struct{ id, addressID string }{
+		{"msg1", addrID1},
+		{"msg2", addrID2},
+		{"msg3", addrID1},
+	} {
+		apiMsg := getTestMessage(msg.id, msg.id, addr1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+		apiMsg.AddressID = msg.addressID
+		require.NoError(t, m.store.createOrUpdateMessageEvent(apiMsg))
+	}
+
+	// No API call is expected, everything is done from local data.
+	require.NoError(t, m.store.UseCombinedMode(false))
+	a.False(t, m.store.IsCombinedMode())
+	a.Equal(t, uidValidity, m.store.getMailboxesVersion())
+	checkMailboxMessageIDs(t, m, pmapi.InboxLabel, []wantID{{"msg1", 1}, {"msg3", 3}})
+
+	require.NoError(t, m.store.UseCombinedMode(true))
+	a.True(t, m.store.IsCombinedMode())
+	a.Equal(t, uidValidity, m.store.getMailboxesVersion())
+	checkMailboxMessageIDs(t, m, pmapi.InboxLabel, []wantID{{"msg1", 1}, {"msg3", 3}, {"msg2", 4}})
+	checkAllMessageIDs(t, m, []string{"msg1", "msg2", "msg3"})
+}
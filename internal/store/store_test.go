@@ -18,13 +18,16 @@
 package store
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
 	bridgemocks "github.com/ProtonMail/proton-bridge/internal/bridge/mocks"
+	"github.com/ProtonMail/proton-bridge/internal/events"
 	storeMocks "github.com/ProtonMail/proton-bridge/internal/store/mocks"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/golang/mock/gomock"
@@ -52,6 +55,17 @@ type mocksForStore struct {
 
 	tmpDir string
 	cache  *Cache
+
+	// listeners are channels the store subscribed to by event name.
+	listeners     map[string]chan<- string
+	listenersLock sync.Mutex
+}
+
+func (mocks *mocksForStore) getListener(eventName string) chan<- string {
+	mocks.listenersLock.Lock()
+	defer mocks.listenersLock.Unlock()
+
+	return mocks.listeners[eventName]
 }
 
 func initMocks(tb testing.TB) (*mocksForStore, func()) {
@@ -68,6 +82,18 @@ func initMocks(tb testing.TB) (*mocksForStore, func()) {
 	// Called during clean-up.
 	mocks.panicHandler.EXPECT().HandlePanic().AnyTimes()
 
+	// Sync progress is reported by every store sync.
+	mocks.events.EXPECT().Emit(events.SyncProgressEvent, gomock.Any()).AnyTimes()
+
+	// Event loop listens to connection changes.
+	mocks.listeners = map[string]chan<- string{}
+	mocks.events.EXPECT().Add(gomock.Any(), gomock.Any()).Do(func(eventName string, channel chan<- string) {
+		mocks.listenersLock.Lock()
+		defer mocks.listenersLock.Unlock()
+		mocks.listeners[eventName] = channel
+	}).AnyTimes()
+	mocks.events.EXPECT().Remove(gomock.Any(), gomock.Any()).AnyTimes()
+
 	var err error
 	mocks.tmpDir, err = ioutil.TempDir("", "store-test")
 	require.NoError(tb, err)
@@ -98,7 +124,7 @@ func (mocks *mocksForStore) newStoreNoEvents(combinedMode bool) { //nolint[unpar
 	})
 	mocks.api.EXPECT().ListLabels()
 	mocks.api.EXPECT().CountMessages("")
-	mocks.api.EXPECT().GetEvent(gomock.Any()).
+	mocks.api.EXPECT().GetEventContext(gomock.Any(), gomock.Any()).
 		Return(&pmapi.Event{
 			EventID: "latestEventID",
 		}, nil).AnyTimes()
@@ -107,8 +133,8 @@ func (mocks *mocksForStore) newStoreNoEvents(combinedMode bool) { //nolint[unpar
 	firstSyncWaiter := sync.WaitGroup{}
 	firstSyncWaiter.Add(1)
 	mocks.api.EXPECT().
-		ListMessages(gomock.Any()).
-		DoAndReturn(func(*pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+		ListMessagesContext(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(context.Context, *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
 			firstSyncWaiter.Done()
 			return []*pmapi.Message{}, 0, nil
 		})
@@ -121,9 +147,11 @@ func (mocks *mocksForStore) newStoreNoEvents(combinedMode bool) { //nolint[unpar
 		mocks.events,
 		filepath.Join(mocks.tmpDir, "mailbox-test.db"),
 		mocks.cache,
+		newTestSendRecorderConfig(),
 	)
 	require.NoError(mocks.tb, err)
 
 	// Wait for sync to finish.
 	firstSyncWaiter.Wait()
+	require.Eventually(mocks.tb, mocks.store.isSyncFinished, time.Second, 10*time.Millisecond)
 }
@@ -18,9 +18,12 @@
 package store
 
 import (
+	"context"
 	"math"
 	"sync"
+	"sync/atomic"
 
+	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 )
@@ -31,24 +34,44 @@ const (
 	maxFilterPageSize      = 150
 )
 
+// errSyncStopped is returned by syncAllMail when the sync was stopped
+// before it finished, for example when the user paused it.
+var errSyncStopped = errors.New("sync was stopped") //nolint[gochecknoglobals]
+
 type storeSynchronizer interface {
 	getAllMessageIDs() ([]string, error)
 	createOrUpdateMessagesEvent([]*pmapi.Message) error
 	deleteMessagesEvent([]string) error
 	saveSyncState(finishTime int64, idRanges []*syncIDRange, idsToBeDeleted []string)
+	updateSyncProgress(phase string, processed, total int)
 }
 
 type messageLister interface {
 	ListMessages(*pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
 }
 
-func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api messageLister, syncState *syncState) error {
+// backgroundMessageLister lists messages with background priority so that
+// sync does not slow down requests of email clients.
+type backgroundMessageLister struct {
+	api PMAPIProvider
+}
+
+func (l backgroundMessageLister) ListMessages(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+	return l.api.ListMessagesContext(pmapi.WithPriority(context.Background(), pmapi.PriorityBackground), filter)
+}
+
+// syncAllMail syncs all messages. When `stop` is closed, workers finish
+// the current page and errSyncStopped is returned; the sync continues from
+// the same place next time.
+func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api messageLister, syncState *syncState, stop <-chan struct{}) error { //nolint[funlen]
 	labelID := pmapi.AllMailLabel
 
 	// When the full sync starts (i.e. is not already in progress), we need to load
 	//  - all message IDs in database, so we can see which messages we need to remove at the end of the sync
 	//  - ID ranges which indicate how to split work into multiple workers
 	if !syncState.isIncomplete() {
+		store.updateSyncProgress(events.SyncPhasePreparing, 0, 0)
+
 		if err := syncState.loadMessageIDsToBeDeleted(); err != nil {
 			return errors.Wrap(err, "failed to load message IDs")
 		}
@@ -61,9 +84,35 @@ func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api message
 
 	wg := &sync.WaitGroup{}
 
-	shouldStop := 0 // Using integer to have it atomic.
+	shouldStop := int32(0) // Using integer to have it atomic.
 	var resultError error
 
+	// Sync could be stopped while it was preparing.
+	select {
+	case <-stop:
+		return errSyncStopped
+	default:
+	}
+
+	processed, total := syncState.getProgress()
+	store.updateSyncProgress(events.SyncPhaseSyncing, processed, total)
+
+	done := make(chan struct{})
+	defer close(done)
+	wasStopped := false
+	go func() {
+		defer panicHandler.HandlePanic()
+
+		select {
+		case <-stop:
+			syncState.lock.Lock()
+			wasStopped = true
+			atomic.StoreInt32(&shouldStop, 1)
+			syncState.lock.Unlock()
+		case <-done:
+		}
+	}()
+
 	for _, idRange := range syncState.idRanges {
 		wg.Add(1)
 		idRange := idRange // Bind for goroutine.
@@ -73,15 +122,27 @@ func syncAllMail(panicHandler PanicHandler, store storeSynchronizer, api message
 
 			err := syncBatch(labelID, store, api, syncState, idRange, &shouldStop)
 			if err != nil {
-				shouldStop = 1
+				atomic.StoreInt32(&shouldStop, 1)
+				syncState.lock.Lock()
 				resultError = errors.Wrap(err, "failed to sync group")
+				syncState.lock.Unlock()
 			}
 		}()
 	}
 
 	wg.Wait()
 
+	syncState.lock.RLock()
+	isStopped := wasStopped
+	syncState.lock.RUnlock()
+	if resultError == nil && isStopped {
+		return errSyncStopped
+	}
+
 	if resultError == nil {
+		processed, total := syncState.getProgress()
+		store.updateSyncProgress(events.SyncPhaseDeleting, processed, total)
+
 		if err := syncState.deleteMessagesToBeDeleted(); err != nil {
 			return errors.Wrap(err, "failed to delete messages")
 		}
@@ -109,6 +170,7 @@ func findIDRanges(labelID string, api messageLister, syncState *syncState) error
 	}
 
 	if workers == 1 {
+		syncState.setIDRangesTotal(count, count)
 		return nil
 	}
 
@@ -132,6 +194,8 @@ func findIDRanges(labelID string, api messageLister, syncState *syncState) error
 		syncState.addIDRange(splitID)
 	}
 
+	syncState.setIDRangesTotal(count, step*maxFilterPageSize)
+
 	return nil
 }
 
@@ -163,11 +227,11 @@ func syncBatch( //nolint[funlen]
 	api messageLister,
 	syncState *syncState,
 	idRange *syncIDRange,
-	shouldStop *int,
+	shouldStop *int32,
 ) error {
 	log.WithField("start", idRange.StartID).WithField("stop", idRange.StopID).Info("Starting sync batch")
 	for {
-		if *shouldStop == 1 || idRange.isFinished() {
+		if atomic.LoadInt32(shouldStop) == 1 || idRange.isFinished() {
 			break
 		}
 
@@ -207,6 +271,15 @@ func syncBatch( //nolint[funlen]
 			return errors.Wrap(err, "failed to create or update messages")
 		}
 
+		// The message with EndID was already processed with the previous page.
+		newMessages := len(messages)
+		if filter.EndID != "" && messages[0].ID == filter.EndID {
+			newMessages--
+		}
+		idRange.addProcessed(newMessages)
+		processed, total := syncState.getProgress()
+		store.updateSyncProgress(events.SyncPhaseSyncing, processed, total)
+
 		pageLastMessageID := messages[len(messages)-1].ID
 		if !desc {
 			idRange.setStartID(pageLastMessageID)
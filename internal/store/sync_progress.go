@@ -0,0 +1,113 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/listener"
+)
+
+// syncProgressEmitInterval is the minimal time between two progress events
+// in the same phase. Sync can process several pages per second and frontends
+// do not need to know about every one of them.
+const syncProgressEmitInterval = time.Second
+
+// syncProgress keeps the progress of the running sync and emits it to
+// frontends as SyncProgressEvent.
+type syncProgress struct {
+	lock   *sync.Mutex
+	userID string
+	events listener.Listener
+
+	phase     string
+	processed int
+	total     int
+
+	// startTime and startProcessed are used to estimate the remaining time.
+	// The sync can continue where it left off, so only messages processed
+	// since the start of this run are counted.
+	startTime      time.Time
+	startProcessed int
+
+	lastEmit time.Time
+}
+
+func newSyncProgress(userID string, events listener.Listener) *syncProgress {
+	return &syncProgress{
+		lock:   &sync.Mutex{},
+		userID: userID,
+		events: events,
+		phase:  "",
+	}
+}
+
+// update sets the new state and emits it. Changes in the same phase
+// are emitted at most once per `syncProgressEmitInterval`.
+func (p *syncProgress) update(phase string, processed, total int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	phaseChanged := p.phase != phase
+	if phase == events.SyncPhaseSyncing && (phaseChanged || processed < p.startProcessed) {
+		p.startTime = time.Now()
+		p.startProcessed = processed
+	}
+
+	p.phase = phase
+	if phase != events.SyncPhasePaused && phase != events.SyncPhaseFailed {
+		p.processed = processed
+		p.total = total
+	}
+
+	if !phaseChanged && time.Since(p.lastEmit) < syncProgressEmitInterval {
+		return
+	}
+	p.lastEmit = time.Now()
+
+	if p.events != nil {
+		p.events.Emit(events.SyncProgressEvent, p.get().Encode())
+	}
+}
+
+// getProgress returns the current progress with estimated remaining time.
+func (p *syncProgress) getProgress() events.SyncProgress {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.get()
+}
+
+func (p *syncProgress) get() events.SyncProgress {
+	progress := events.SyncProgress{
+		UserID:    p.userID,
+		Phase:     p.phase,
+		Processed: p.processed,
+		Total:     p.total,
+	}
+
+	done := p.processed - p.startProcessed
+	if p.phase == events.SyncPhaseSyncing && done > 0 && p.total > p.processed {
+		elapsed := time.Since(p.startTime)
+		progress.ETA = time.Duration(float64(elapsed) / float64(done) * float64(p.total-p.processed)).Round(time.Second)
+	}
+
+	return progress
+}
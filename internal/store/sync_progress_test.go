@@ -0,0 +1,74 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	storeMocks "github.com/ProtonMail/proton-bridge/internal/store/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncProgress_EmitsPhaseChanges(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	listener := storeMocks.NewMockListener(ctrl)
+	progress := newSyncProgress("userID", listener)
+
+	emitted := []events.SyncProgress{}
+	listener.EXPECT().Emit(events.SyncProgressEvent, gomock.Any()).Do(func(_, data string) {
+		p, err := events.DecodeSyncProgress(data)
+		require.NoError(t, err)
+		emitted = append(emitted, p)
+	}).Times(3)
+
+	progress.update(events.SyncPhasePreparing, 0, 0)
+	progress.update(events.SyncPhaseSyncing, 0, 1000)
+	// Same phase is not emitted more often than once per second.
+	progress.update(events.SyncPhaseSyncing, 150, 1000)
+	progress.update(events.SyncPhaseFinished, 1000, 1000)
+
+	require.Len(t, emitted, 3)
+	assert.Equal(t, events.SyncPhasePreparing, emitted[0].Phase)
+	assert.Equal(t, events.SyncPhaseSyncing, emitted[1].Phase)
+	assert.Equal(t, "userID", emitted[2].UserID)
+	assert.Equal(t, events.SyncPhaseFinished, emitted[2].Phase)
+	assert.Equal(t, float64(100), emitted[2].Percent())
+}
+
+func TestSyncProgress_ETA(t *testing.T) {
+	progress := newSyncProgress("userID", nil)
+
+	progress.update(events.SyncPhaseSyncing, 200, 1000)
+	progress.startTime = time.Now().Add(-10 * time.Second)
+	progress.update(events.SyncPhaseSyncing, 400, 1000)
+
+	current := progress.getProgress()
+	assert.Equal(t, 40.0, current.Percent())
+	assert.InDelta(t, 30*time.Second, current.ETA, float64(time.Second))
+
+	progress.update(events.SyncPhasePaused, 0, 0)
+	current = progress.getProgress()
+	assert.Equal(t, 400, current.Processed)
+	assert.Equal(t, time.Duration(0), current.ETA)
+}
@@ -182,6 +182,41 @@ func (s *syncState) deleteMessagesToBeDeleted() error {
 	return nil
 }
 
+// setIDRangesTotal splits the total count of messages to all ID ranges.
+// Ranges are split by pages, so all ranges but the last one have the same
+// number of messages.
+func (s *syncState) setIDRangesTotal(total, perRange int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.idRanges) == 0 {
+		return
+	}
+
+	lastRange := s.idRanges[len(s.idRanges)-1]
+	lastRange.Total = total
+	for _, idRange := range s.idRanges[:len(s.idRanges)-1] {
+		idRange.Total = perRange
+		lastRange.Total -= perRange
+	}
+	if lastRange.Total < 0 {
+		lastRange.Total = 0
+	}
+}
+
+// getProgress returns the number of processed messages and the total
+// number of messages to be synced.
+func (s *syncState) getProgress() (processed, total int) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	for _, idRange := range s.idRanges {
+		processed += idRange.Processed
+		total += idRange.Total
+	}
+	return
+}
+
 // getIDsToBeDeleted is helper to convert internal map for easier
 // manipulation to array.
 func (s *syncState) getIDsToBeDeleted() []string {
@@ -193,10 +228,20 @@ func (s *syncState) getIDsToBeDeleted() []string {
 }
 
 // syncIDRange holds range which IDs need to be synced.
+// Processed and Total are used only to report the progress of the sync.
 type syncIDRange struct {
 	syncState *syncState
 	StartID   string
 	StopID    string
+	Processed int
+	Total     int
+}
+
+func (r *syncIDRange) addProcessed(count int) {
+	r.syncState.lock.Lock()
+	defer r.syncState.lock.Unlock()
+
+	r.Processed += count
 }
 
 func (r *syncIDRange) setStartID(startID string) {
@@ -107,6 +107,9 @@ func (m *mockStoreSynchronizer) deleteMessagesEvent([]string) error {
 func (m *mockStoreSynchronizer) saveSyncState(finishTime int64, idRanges []*syncIDRange, idsToBeDeleted []string) {
 }
 
+func (m *mockStoreSynchronizer) updateSyncProgress(phase string, processed, total int) {
+}
+
 func newTestSyncState(store storeSynchronizer, splitIDs ...string) *syncState {
 	syncState := newSyncState(store, 0, []*syncIDRange{}, []string{})
 	syncState.initIDRanges()
@@ -178,7 +181,7 @@ func TestSyncAllMail(t *testing.T) { //nolint[funlen]
 			}
 			syncState := newSyncState(store, 0, tc.idRanges, tc.idsToBeDeleted)
 
-			err := syncAllMail(m.panicHandler, store, api, syncState)
+			err := syncAllMail(m.panicHandler, store, api, syncState, nil)
 			require.Nil(t, err)
 
 			// Check all messages were created or updated.
@@ -226,7 +229,7 @@ func TestSyncAllMail_FailedListing(t *testing.T) {
 	}
 	syncState := newTestSyncState(store)
 
-	err := syncAllMail(m.panicHandler, store, api, syncState)
+	err := syncAllMail(m.panicHandler, store, api, syncState, nil)
 	require.EqualError(t, err, "failed to sync group: failed to list messages: error")
 }
 
@@ -245,10 +248,49 @@ func TestSyncAllMail_FailedCreateOrUpdateMessage(t *testing.T) {
 	}
 	syncState := newTestSyncState(store)
 
-	err := syncAllMail(m.panicHandler, store, api, syncState)
+	err := syncAllMail(m.panicHandler, store, api, syncState, nil)
 	require.EqualError(t, err, "failed to sync group: failed to create or update messages: error")
 }
 
+func TestSyncAllMail_Progress(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	numberOfMessages := 10000
+
+	store := &mockStoreSynchronizer{}
+	api := &mockLister{
+		messageIDs: generateIDs(1, numberOfMessages),
+	}
+	syncState := newSyncState(store, 0, []*syncIDRange{}, []string{})
+
+	err := syncAllMail(m.panicHandler, store, api, syncState, nil)
+	require.Nil(t, err)
+
+	processed, total := syncState.getProgress()
+	assert.Equal(t, numberOfMessages, total)
+	// Messages on the border of two ranges are processed by both workers.
+	assert.InDelta(t, numberOfMessages, processed, float64(len(syncState.idRanges)))
+}
+
+func TestSyncAllMail_Stopped(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	store := &mockStoreSynchronizer{}
+	api := &mockLister{
+		messageIDs: generateIDs(1, 10000),
+	}
+	syncState := newSyncState(store, 0, []*syncIDRange{}, []string{})
+
+	stop := make(chan struct{})
+	close(stop)
+
+	err := syncAllMail(m.panicHandler, store, api, syncState, stop)
+	require.Equal(t, errSyncStopped, err)
+	assert.True(t, syncState.isIncomplete())
+}
+
 func TestFindIDRanges(t *testing.T) { //nolint[funlen]
 	store := &mockStoreSynchronizer{}
 	syncState := newTestSyncState(store)
@@ -504,6 +546,6 @@ func TestSyncBatch_FailedCreateOrUpdateMessage(t *testing.T) {
 func testSyncBatch(t *testing.T, store storeSynchronizer, api messageLister, rangeIdx int, splitIDs ...string) error { //nolint[unparam]
 	syncState := newTestSyncState(store, splitIDs...)
 	idRange := syncState.idRanges[rangeIdx]
-	shouldStop := 0
+	shouldStop := int32(0)
 	return syncBatch(pmapi.AllMailLabel, store, api, syncState, idRange, &shouldStop)
 }
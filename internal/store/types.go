@@ -18,6 +18,7 @@
 package store
 
 import (
+	"context"
 	"io"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
@@ -32,11 +33,12 @@ type PMAPIProvider interface {
 	CurrentUser() (*pmapi.User, error)
 	Addresses() pmapi.AddressList
 
-	GetEvent(eventID string) (*pmapi.Event, error)
+	GetEventContext(ctx context.Context, eventID string) (*pmapi.Event, error)
 
 	CountMessages(addressID string) ([]*pmapi.MessagesCount, error)
-	ListMessages(filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
+	ListMessagesContext(ctx context.Context, filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error)
 	GetMessage(apiID string) (*pmapi.Message, error)
+	GetMessageContext(ctx context.Context, apiID string) (*pmapi.Message, error)
 	Import([]*pmapi.ImportMsgReq) ([]*pmapi.ImportMsgRes, error)
 	DeleteMessages(apiIDs []string) error
 	LabelMessages(apiIDs []string, labelID string) error
@@ -61,6 +63,7 @@ type BridgeUser interface {
 	GetAddressID(address string) (string, error)
 	IsConnected() bool
 	IsCombinedAddressMode() bool
+	GetConfiguredAddressGroups() [][]string
 	GetPrimaryAddress() string
 	GetStoreAddresses() []string
 	UpdateUser() error
@@ -72,6 +72,73 @@ func (store *Store) RebuildMailboxes() (err error) {
 	return store.initMailboxesBucket()
 }
 
+// reinitAddresses recreates store addresses for the current address mode and
+// updates membership of their mailboxes from the metadata bucket. It uses only
+// local data, no API call is needed. Messages which stay in a mailbox keep
+// their UIDs and added messages get new UIDs higher than all previous ones,
+// therefore UIDVALIDITY changes only if some mailbox is broken and has to be
+// rebuilt from scratch.
+func (store *Store) reinitAddresses() error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	labels, err := store.getLabelsFromLocalStorage()
+	if err != nil {
+		return errors.Wrap(err, "failed to get local labels")
+	}
+
+	addrInfo, err := store.getAddressInfoFromStore()
+	if err != nil {
+		return errors.Wrap(err, "failed to get addresses and address IDs")
+	}
+
+	// We need at least one address to continue.
+	if len(addrInfo) < 1 {
+		return errors.New("no addresses to initialise")
+	}
+
+	store.addresses = make(map[string]*Address)
+	for _, group := range store.setAddressGroupIDs(addrInfo) {
+		if err := store.addAddress(group[0].Address, group[0].AddressID, labels); err != nil {
+			return errors.Wrap(err, "failed to add address to store")
+		}
+	}
+
+	// Messages which do not belong to any mailbox in the new mode are kept
+	// in the metadata for the case the mode is switched back.
+	report := &IntegrityReport{}
+	err = store.db.Update(func(tx *bolt.Tx) error {
+		metadata, err := store.txLoadMetadata(tx, report)
+		if err != nil {
+			return err
+		}
+
+		for _, storeMailbox := range store.getAllMailboxes() {
+			if err := storeMailbox.txCheckIntegrity(tx, report, store.addressMode, metadata); err != nil {
+				return errors.Wrapf(err, "cannot update mailbox %s", storeMailbox.labelName)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if report.UIDValidityChanged {
+		if err := store.increaseMailboxesVersion(); err != nil {
+			return errors.Wrap(err, "cannot change UIDVALIDITY")
+		}
+	}
+
+	store.log.
+		WithField("mode", store.addressMode).
+		WithField("changes", len(report.Issues)).
+		WithField("uidValidityChanged", report.UIDValidityChanged).
+		Info("Mailboxes updated for address mode")
+
+	return nil
+}
+
 // createOrDeleteAddressesEvent creates address objects in the store for each necessary address
 // and deletes any address objects that shouldn't be there.
 // It doesn't do anything to addresses that are rightfully there.
@@ -82,19 +149,24 @@ func (store *Store) createOrDeleteAddressesEvent() (err error) {
 		return errors.Wrap(err, "failed to initialise label counts")
 	}
 
-	addrInfo, err := store.GetAddressInfo()
+	allAddrInfo, err := store.GetAddressInfo()
 	if err != nil {
 		return errors.Wrap(err, "failed to get addresses and address IDs")
 	}
 
 	// We need at least one address to continue.
-	if len(addrInfo) < 1 {
+	if len(allAddrInfo) < 1 {
 		return errors.New("no addresses to initialise")
 	}
 
-	// If in combined mode, we only need the user's primary address.
-	if store.addressMode == combinedMode {
-		addrInfo = addrInfo[:1]
+	// Address groups are read by mailboxes while messages are listed.
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	// Every group of addresses needs only one store address.
+	var addrInfo []AddressInfo
+	for _, group := range store.setAddressGroupIDs(allAddrInfo) {
+		addrInfo = append(addrInfo, group[0])
 	}
 
 	// Go through all addresses that *should* be there.
@@ -36,17 +36,7 @@ func (store *Store) createMailbox(name string) error {
 		return fmt.Errorf("mailbox %v already exists", name)
 	}
 
-	color := store.leastUsedColor()
-
-	var exclusive int
-	switch {
-	case strings.HasPrefix(name, UserLabelsPrefix):
-		name = strings.TrimPrefix(name, UserLabelsPrefix)
-		exclusive = 0
-	case strings.HasPrefix(name, UserFoldersPrefix):
-		name = strings.TrimPrefix(name, UserFoldersPrefix)
-		exclusive = 1
-	default:
+	if !strings.HasPrefix(name, UserLabelsPrefix) && !strings.HasPrefix(name, UserFoldersPrefix) {
 		// Ideally we would throw an error here, but then Outlook for
 		// macOS keeps trying to make an IMAP Drafts folder and popping
 		// up the error to the user.
@@ -55,15 +45,61 @@ func (store *Store) createMailbox(name string) error {
 		return nil
 	}
 
-	_, err := store.api.CreateLabel(&pmapi.Label{
-		Name:      name,
-		Color:     color,
+	parentID, labelName, exclusive, err := store.getOrCreateParentLabel(name)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.api.CreateLabel(&pmapi.Label{
+		Name:      labelName,
+		Color:     store.leastUsedColor(),
 		Exclusive: exclusive,
 		Type:      pmapi.LabelTypeMailbox,
+		ParentID:  parentID,
 	})
 	return err
 }
 
+// getOrCreateParentLabel splits the IMAP name of nested mailbox to the ID
+// of the parent label and the name of the label itself. Parents which do
+// not exist yet are created, as IMAP requires when creating a mailbox.
+func (store *Store) getOrCreateParentLabel(name string) (parentID, labelName string, exclusive int, err error) {
+	prefix := UserLabelsPrefix
+	if strings.HasPrefix(name, UserFoldersPrefix) {
+		prefix = UserFoldersPrefix
+		exclusive = 1
+	}
+
+	names := strings.Split(strings.TrimSuffix(strings.TrimPrefix(name, prefix), PathDelimiter), PathDelimiter)
+	for _, n := range names {
+		if n == "" {
+			return "", "", 0, fmt.Errorf("invalid mailbox name %v", name)
+		}
+	}
+
+	for idx, parentName := range names[:len(names)-1] {
+		if parent, err := store.getMailbox(prefix + strings.Join(names[:idx+1], PathDelimiter)); err == nil {
+			parentID = parent.labelID
+			continue
+		}
+
+		log.WithField("name", parentName).Debug("Creating parent mailbox")
+		created, err := store.api.CreateLabel(&pmapi.Label{
+			Name:      parentName,
+			Color:     store.leastUsedColor(),
+			Exclusive: exclusive,
+			Type:      pmapi.LabelTypeMailbox,
+			ParentID:  parentID,
+		})
+		if err != nil {
+			return "", "", 0, err
+		}
+		parentID = created.ID
+	}
+
+	return parentID, names[len(names)-1], exclusive, nil
+}
+
 // allAddressesHaveMailbox returns whether each address has a mailbox with the given labelID.
 func (store *Store) allAddressesHaveMailbox(labelID string) bool {
 	store.lock.RLock()
@@ -128,15 +164,22 @@ func (store *Store) leastUsedColor() string {
 	return leastUsed
 }
 
-// updateMailbox updates the mailbox via the API.
+// updateMailbox updates the mailbox via the API. The new name is the full
+// IMAP name, the label is moved to other parent if it differs.
 // The store mailbox is updated later by processing an event.
 func (store *Store) updateMailbox(labelID, newName, color string) error {
 	defer store.eventLoop.pollNow()
 
-	_, err := store.api.UpdateLabel(&pmapi.Label{
-		ID:    labelID,
-		Name:  newName,
-		Color: color,
+	parentID, labelName, _, err := store.getOrCreateParentLabel(newName)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.api.UpdateLabel(&pmapi.Label{
+		ID:       labelID,
+		Name:     labelName,
+		Color:    color,
+		ParentID: parentID,
 	})
 	return err
 }
@@ -212,17 +255,21 @@ func (store *Store) createOrUpdateMailboxEvent(label *pmapi.Label) error {
 	return nil
 }
 
-// deleteMailboxEvent deletes the mailbox in the store.
+// deleteMailboxEvent deletes the mailbox and all its children in the store.
+// API deletes children together with the parent, so they are deleted right
+// away instead of being shown as top-level mailboxes until their events come.
 // This is called from the event loop.
 func (store *Store) deleteMailboxEvent(labelID string) error {
 	store.lock.Lock()
 	defer store.lock.Unlock()
 
-	_ = store.removeMailboxCount(labelID)
-
 	for _, a := range store.addresses {
-		if err := a.deleteMailboxEvent(labelID); err != nil {
-			return err
+		labelIDs := append(a.getChildMailboxIDs(labelID), labelID)
+		for _, id := range labelIDs {
+			_ = store.removeMailboxCount(id)
+			if err := a.deleteMailboxEvent(id); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
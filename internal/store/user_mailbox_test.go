@@ -0,0 +1,63 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteMailboxEventDeletesChildren(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+
+	for _, label := range []*pmapi.Label{
+		{ID: "parent", Name: "Parent", Type: pmapi.LabelTypeMailbox, Exclusive: 1},
+		{ID: "child", Name: "Child", ParentID: "parent", Type: pmapi.LabelTypeMailbox, Exclusive: 1},
+		{ID: "grandchild", Name: "Grandchild", ParentID: "child", Type: pmapi.LabelTypeMailbox, Exclusive: 1},
+		{ID: "other", Name: "Other", Type: pmapi.LabelTypeMailbox, Exclusive: 1},
+	} {
+		require.NoError(t, m.store.createOrUpdateMailboxEvent(label))
+	}
+
+	storeAddress := m.store.addresses[addrID1]
+	_, err := storeAddress.GetMailbox("Folders/Parent/Child/Grandchild")
+	require.NoError(t, err)
+
+	require.NoError(t, m.store.deleteMailboxEvent("parent"))
+
+	for _, name := range []string{"Folders/Parent", "Folders/Parent/Child", "Folders/Child", "Folders/Grandchild"} {
+		_, err := storeAddress.GetMailbox(name)
+		require.Error(t, err, name)
+	}
+	_, err = storeAddress.GetMailbox("Folders/Other")
+	require.NoError(t, err)
+
+	counts, err := m.store.getOnAPICounts()
+	require.NoError(t, err)
+	for _, count := range counts {
+		require.NotContains(t, []string{"parent", "child", "grandchild"}, count.LabelID)
+	}
+
+	// Events of the children deleted by API are ignored.
+	require.NoError(t, m.store.deleteMailboxEvent("child"))
+}
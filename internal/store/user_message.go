@@ -18,15 +18,15 @@
 package store
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"io"
-	"io/ioutil"
 	"net/mail"
 	"net/textproto"
 	"strings"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -65,15 +65,15 @@ func (store *Store) CreateDraft(
 			Name:     attachedPublicKeyName + ".asc",
 			MIMEType: "application/pgp-key",
 			Header:   textproto.MIMEHeader{},
+			Size:     int64(len(attachedPublicKey)),
 		}
 		attachments = append(attachments, publicKeyAttachment)
 	}
 
 	for idx, attachment := range attachments {
 		attachment.MessageID = draft.ID
-		attachmentBody, _ := ioutil.ReadAll(attachmentReaders[idx])
 
-		createdAttachment, err := store.createAttachment(kr, attachment, attachmentBody)
+		createdAttachment, err := store.createAttachment(kr, attachment, attachmentReaders[idx])
 		if err != nil {
 			return nil, nil, errors.Wrap(err, "failed to create attachment for draft")
 		}
@@ -92,18 +92,25 @@ func (store *Store) getDraftAction(message *pmapi.Message) int {
 	return pmapi.DraftActionReply
 }
 
-func (store *Store) createAttachment(kr *pmcrypto.KeyRing, attachment *pmapi.Attachment, attachmentBody []byte) (*pmapi.Attachment, error) {
-	r := bytes.NewReader(attachmentBody)
-	sigReader, err := attachment.DetachedSign(kr, r)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to sign attachment")
-	}
+// createAttachment encrypts, signs and uploads the attachment read from r.
+// The attachment is read only once while it is being uploaded and the progress
+// of the upload is reported against its size known from parsing.
+func (store *Store) createAttachment(kr *pmcrypto.KeyRing, attachment *pmapi.Attachment, r io.Reader) (*pmapi.Attachment, error) {
+	progress := events.NewTransferProgressReporter(store.events, events.TransferProgress{
+		UserID:    store.UserID(),
+		Direction: events.TransferUpload,
+		Name:      attachment.Name,
+	})
+	defer progress.Finish()
 
-	r = bytes.NewReader(attachmentBody)
-	encReader, err := attachment.Encrypt(kr, r)
+	encReader, sigReader, err := attachment.EncryptAndSign(kr, pmapi.NewProgressReader(r, attachment.Size, progress.Update))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to encrypt attachment")
 	}
+	// Closing stops the encryption and the signing when the upload fails
+	// before all data is read.
+	defer encReader.Close() //nolint[errcheck]
+	defer sigReader.Close() //nolint[errcheck]
 
 	createdAttachment, err := store.api.CreateAttachment(attachment, encReader, sigReader)
 	if err != nil {
@@ -114,10 +121,26 @@ func (store *Store) createAttachment(kr *pmcrypto.KeyRing, attachment *pmapi.Att
 }
 
 // SendMessage sends the message.
+// Sent copy returned by API is stored right away, same as web client shows it,
+// so it is in the Sent folder with the sender it was sent as (for example,
+// plus-addressed alias) before the event arrives.
 func (store *Store) SendMessage(messageID string, req *pmapi.SendMessageReq) error {
 	defer store.eventLoop.pollNow()
-	_, _, err := store.api.SendMessage(messageID, req)
-	return err
+	sent, parent, err := store.api.SendMessage(messageID, req)
+	if err != nil {
+		return err
+	}
+
+	msgs := []*pmapi.Message{}
+	for _, msg := range []*pmapi.Message{sent, parent} {
+		if msg != nil {
+			msgs = append(msgs, msg)
+		}
+	}
+	if err := store.createOrUpdateMessagesEvent(msgs); err != nil {
+		store.log.WithError(err).Warn("Cannot store sent message")
+	}
+	return nil
 }
 
 // getAllMessageIDs returns all API IDs of messages in the local database.
@@ -146,8 +169,8 @@ func (store *Store) getMessageFromDB(apiID string) (msg *pmapi.Message, err erro
 // message is not in the database, it will try to fetch it from the server.
 // NOTE: Do not update the database here to prevent issues (extreme edge case).
 // The database will be updated by the event loop anyway.
-func (store *Store) fetchMessage(apiID string) (msg *pmapi.Message, err error) {
-	if msg, err = store.api.GetMessage(apiID); err != nil {
+func (store *Store) fetchMessage(ctx context.Context, apiID string) (msg *pmapi.Message, err error) {
+	if msg, err = store.api.GetMessageContext(ctx, apiID); err != nil {
 		if err.Error() == "Message does not exist" {
 			return nil, ErrNoSuchAPIID
 		}
@@ -238,7 +261,10 @@ func (store *Store) createOrUpdateMessagesEvent(msgs []*pmapi.Message) error { /
 		return err
 	}
 
-	// Update mailboxes.
+	// Update mailboxes. Addresses and their groups can be changed by events.
+	store.lock.RLock()
+	defer store.lock.RUnlock()
+
 	err = store.db.Update(func(tx *bolt.Tx) error {
 		for _, a := range store.addresses {
 			if err := a.txCreateOrUpdateMessages(tx, msgs); err != nil {
@@ -264,7 +290,8 @@ func clearNonMetadata(onlyMeta *pmapi.Message) {
 
 // txUpdateMetadaFromDB changes the the onlyMeta data.
 // If there is stored message in metaBucket the size, header and MIMEType are
-// not changed if already set. To change these:
+// not changed if already set. Conversation ID is kept when the update does
+// not contain it. To change these:
 // * size must be updated by Message.SetSize
 // * contentType and header must be updated by Message.SetContentTypeAndHeader
 func txUpdateMetadaFromDB(metaBucket *bolt.Bucket, onlyMeta *pmapi.Message, log *logrus.Entry) {
@@ -279,9 +306,10 @@ func txUpdateMetadaFromDB(metaBucket *bolt.Bucket, onlyMeta *pmapi.Message, log
 
 	// It is faster to unmarshal only the needed items.
 	stored := &struct {
-		Size     int64
-		Header   string
-		MIMEType string
+		Size           int64
+		Header         string
+		MIMEType       string
+		ConversationID string
 	}{}
 	if err := json.Unmarshal(msgb, stored); err != nil {
 		log.WithError(err).
@@ -292,6 +320,9 @@ func txUpdateMetadaFromDB(metaBucket *bolt.Bucket, onlyMeta *pmapi.Message, log
 	// Keep already calculated size and content type.
 	onlyMeta.Size = stored.Size
 	onlyMeta.MIMEType = stored.MIMEType
+	if onlyMeta.ConversationID == "" {
+		onlyMeta.ConversationID = stored.ConversationID
+	}
 	if stored.Header != "" && stored.Header != "(No Header)" {
 		tmpMsg, err := mail.ReadMessage(
 			strings.NewReader(stored.Header + "\r\n\r\n"),
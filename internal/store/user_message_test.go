@@ -22,6 +22,7 @@ import (
 	"testing"
 
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
 	a "github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -111,6 +112,30 @@ func TestCreateOrUpdateMessageMetadata(t *testing.T) {
 	a.Equal(t, wantHeader, msg.Header)
 }
 
+func TestCreateOrUpdateMessageKeepsConversationID(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+
+	msg := getTestMessage("msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel})
+	msg.ConversationID = "conversation1"
+	require.Nil(t, m.store.createOrUpdateMessageEvent(msg))
+
+	// Update without conversation ID does not remove it.
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel})
+
+	storeMsg, err := m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel].GetMessage("msg1")
+	require.Nil(t, err)
+	a.Equal(t, "conversation1", storeMsg.ConversationID())
+
+	// Message without conversation is in its own.
+	storeMsg, err = m.store.addresses[addrID1].mailboxes[pmapi.AllMailLabel].GetMessage("msg2")
+	require.Nil(t, err)
+	a.Equal(t, "msg2", storeMsg.ConversationID())
+}
+
 func TestDeleteMessage(t *testing.T) {
 	m, clear := initMocks(t)
 	defer clear()
@@ -125,6 +150,30 @@ func TestDeleteMessage(t *testing.T) {
 	checkMailboxMessageIDs(t, m, pmapi.AllMailLabel, []wantID{{"msg2", 2}})
 }
 
+func TestSendMessageStoresSentCopy(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "parent", "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	sent := getTestMessage("sent", "Re: Test message", "me+lists@pm.me", 0, []string{pmapi.AllMailLabel, pmapi.SentLabel})
+	parent := getTestMessage("parent", "Test message", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	parent.Flags = pmapi.FlagReplied
+	m.api.EXPECT().SendMessage("sent", gomock.Any()).Return(sent, parent, nil)
+
+	require.NoError(t, m.store.SendMessage("sent", &pmapi.SendMessageReq{}))
+
+	msg, err := m.store.getMessageFromDB("sent")
+	require.NoError(t, err)
+	a.Equal(t, "me+lists@pm.me", msg.Sender.Address)
+	checkMailboxMessageIDs(t, m, pmapi.SentLabel, []wantID{{"sent", 1}})
+
+	msg, err = m.store.getMessageFromDB("parent")
+	require.NoError(t, err)
+	a.Equal(t, int64(pmapi.FlagReplied), msg.Flags)
+}
+
 func insertMessage(t *testing.T, m *mocksForStore, id, subject, sender string, unread int, labelIDs []string) { //nolint[unparam]
 	msg := getTestMessage(id, subject, sender, unread, labelIDs)
 	require.Nil(t, m.store.createOrUpdateMessageEvent(msg))
@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/ProtonMail/proton-bridge/internal/events"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -116,6 +117,26 @@ func (store *Store) isSynced(countsOnAPI []*pmapi.MessagesCount) (bool, error) {
 //  * Database has only syncStateKey with time when database was last synced.
 //    `triggerSync` will reset it and start full sync again.
 func (store *Store) triggerSync() {
+	store.lock.Lock()
+	if store.isSyncPaused {
+		store.lock.Unlock()
+		store.log.Info("Store sync is paused, not triggering")
+		return
+	}
+	// The check has to be done before the sync state is touched, otherwise
+	// the finish time of the running sync would be cleared.
+	if store.isSyncRunning {
+		store.lock.Unlock()
+		store.log.Info("Store sync is already ongoing")
+		return
+	}
+	store.isSyncRunning = true
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	store.syncStop = stop
+	store.syncDone = done
+	store.lock.Unlock()
+
 	syncState := store.loadSyncState()
 
 	// We first clear the last sync state in case this sync fails.
@@ -125,35 +146,122 @@ func (store *Store) triggerSync() {
 	go func() {
 		defer store.panicHandler.HandlePanic()
 
-		store.log.Debug("Store sync triggered")
-
-		store.lock.Lock()
-		if store.isSyncRunning {
-			store.lock.Unlock()
-			store.log.Info("Store sync is already ongoing")
-			return
-		}
-		store.isSyncRunning = true
-		store.lock.Unlock()
-
 		defer func() {
 			store.lock.Lock()
 			store.isSyncRunning = false
+			store.syncStop = nil
+			store.syncDone = nil
 			store.lock.Unlock()
+			close(done)
 		}()
 
+		store.log.Debug("Store sync triggered")
 		store.log.WithField("isIncomplete", syncState.isIncomplete()).Info("Store sync started")
 
-		err := syncAllMail(store.panicHandler, store, store.api, syncState)
+		err := syncAllMail(store.panicHandler, store, backgroundMessageLister{store.api}, syncState, stop)
+		processed, total := syncState.getProgress()
+		if err == errSyncStopped {
+			store.log.Info("Store sync stopped")
+			store.updateSyncProgress(events.SyncPhasePaused, processed, total)
+			return
+		}
 		if err != nil {
 			log.WithError(err).Error("Store sync failed")
+			store.updateSyncProgress(events.SyncPhaseFailed, processed, total)
 			return
 		}
 
 		syncState.setFinishTime()
+		store.updateSyncProgress(events.SyncPhaseFinished, processed, total)
 	}()
 }
 
+// stopSync stops the running sync and waits until it's stopped.
+func (store *Store) stopSync() {
+	store.lock.Lock()
+	stop, done := store.syncStop, store.syncDone
+	store.syncStop = nil
+	store.lock.Unlock()
+
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+}
+
+// updateSyncProgress is called by the sync to report its progress.
+func (store *Store) updateSyncProgress(phase string, processed, total int) {
+	store.syncProgress.update(phase, processed, total)
+}
+
+// GetSyncProgress returns the progress of the running sync or, if the sync
+// is not running, the state of the last one stored in the database.
+func (store *Store) GetSyncProgress() events.SyncProgress {
+	store.lock.RLock()
+	isSyncRunning, isSyncPaused := store.isSyncRunning, store.isSyncPaused
+	store.lock.RUnlock()
+
+	if isSyncRunning {
+		return store.syncProgress.getProgress()
+	}
+
+	syncState := store.loadSyncState()
+	processed, total := syncState.getProgress()
+	progress := events.SyncProgress{
+		UserID:    store.user.ID(),
+		Phase:     events.SyncPhaseIdle,
+		Processed: processed,
+		Total:     total,
+	}
+	switch {
+	case syncState.isFinished():
+		progress.Phase = events.SyncPhaseFinished
+	case isSyncPaused:
+		progress.Phase = events.SyncPhasePaused
+	case store.syncProgress.getProgress().Phase == events.SyncPhaseFailed:
+		progress.Phase = events.SyncPhaseFailed
+	}
+	return progress
+}
+
+// PauseSync stops the running sync and prevents starting a new one until
+// `ResumeSync` is called. Synced messages are kept and the sync continues
+// where it left off. Pause is not kept after restart of the bridge.
+func (store *Store) PauseSync() {
+	store.lock.Lock()
+	store.isSyncPaused = true
+	store.lock.Unlock()
+
+	store.stopSync()
+
+	processed, total := store.loadSyncState().getProgress()
+	store.updateSyncProgress(events.SyncPhasePaused, processed, total)
+}
+
+// ResumeSync continues the sync paused by `PauseSync`.
+func (store *Store) ResumeSync() {
+	store.lock.Lock()
+	store.isSyncPaused = false
+	store.lock.Unlock()
+
+	store.triggerSync()
+}
+
+// Resync drops the state of the sync and starts the full sync from the
+// beginning. Messages are not removed from the database before the sync
+// finishes, so clients stay synced during the resync.
+func (store *Store) Resync() {
+	store.lock.Lock()
+	store.isSyncPaused = false
+	store.lock.Unlock()
+
+	store.stopSync()
+
+	store.saveSyncState(0, []*syncIDRange{}, []string{})
+	store.triggerSync()
+}
+
 // isSyncFinished returns whether the database has finished a sync.
 func (store *Store) isSyncFinished() (isSynced bool) {
 	return store.loadSyncState().isFinished()
@@ -0,0 +1,464 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	bridgeEvents "github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Types of operations kept in the write queue.
+const (
+	writeOpLabel   = "label"
+	writeOpUnlabel = "unlabel"
+	writeOpRead    = "read"
+	writeOpUnread  = "unread"
+	writeOpDelete  = "delete"
+)
+
+// writeOperation is one IMAP mutation which could not be sent to the API.
+type writeOperation struct {
+	seq uint32
+
+	Type       string
+	MessageIDs []string
+	LabelID    string `json:",omitempty"`
+	Time       int64
+}
+
+func newWriteOperation(opType string, apiIDs []string, labelID string) *writeOperation {
+	return &writeOperation{
+		Type:       opType,
+		MessageIDs: apiIDs,
+		LabelID:    labelID,
+		Time:       time.Now().Unix(),
+	}
+}
+
+func (op *writeOperation) String() string {
+	if op.LabelID != "" {
+		return fmt.Sprintf("%s %d message(s) with label %s", op.Type, len(op.MessageIDs), op.LabelID)
+	}
+	return fmt.Sprintf("%s %d message(s)", op.Type, len(op.MessageIDs))
+}
+
+// removeMessageIDs drops the given IDs from the operation.
+func (op *writeOperation) removeMessageIDs(removed map[string]bool) (changed bool) {
+	ids := []string{}
+	for _, id := range op.MessageIDs {
+		if removed[id] {
+			changed = true
+			continue
+		}
+		ids = append(ids, id)
+	}
+	op.MessageIDs = ids
+	return changed
+}
+
+// writeQueue is the persistent journal of operations waiting for the API.
+// When the API is not reachable, mutations are applied to the local metadata
+// right away and stored here. Operations are replayed in the same order once
+// the connection is back. While the queue is not empty, new mutations are
+// queued as well to keep the order.
+type writeQueue struct {
+	db *bolt.DB
+
+	// replayLock makes sure only one replay is running.
+	replayLock *sync.Mutex
+}
+
+func newWriteQueue(db *bolt.DB) *writeQueue {
+	return &writeQueue{
+		db:         db,
+		replayLock: &sync.Mutex{},
+	}
+}
+
+func (q *writeQueue) isEmpty() (isEmpty bool) {
+	_ = q.db.View(func(tx *bolt.Tx) error {
+		key, _ := tx.Bucket(writeQueueBucket).Cursor().First()
+		isEmpty = key == nil
+		return nil
+	})
+	return
+}
+
+func (q *writeQueue) push(op *writeOperation) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(writeQueueBucket)
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		op.seq = uint32(seq)
+		data, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		return b.Put(itob(op.seq), data)
+	})
+}
+
+// first returns the oldest operation or nil when the queue is empty.
+func (q *writeQueue) first() (op *writeOperation, err error) {
+	err = q.db.View(func(tx *bolt.Tx) error {
+		key, value := tx.Bucket(writeQueueBucket).Cursor().First()
+		if key == nil {
+			return nil
+		}
+		op = &writeOperation{}
+		if err := json.Unmarshal(value, op); err != nil {
+			return err
+		}
+		op.seq = btoi(key)
+		return nil
+	})
+	return
+}
+
+func (q *writeQueue) all() (ops []*writeOperation, err error) {
+	err = q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(writeQueueBucket).ForEach(func(key, value []byte) error {
+			op := &writeOperation{}
+			if err := json.Unmarshal(value, op); err != nil {
+				return err
+			}
+			op.seq = btoi(key)
+			ops = append(ops, op)
+			return nil
+		})
+	})
+	return
+}
+
+func (q *writeQueue) update(op *writeOperation) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		data, err := json.Marshal(op)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(writeQueueBucket).Put(itob(op.seq), data)
+	})
+}
+
+func (q *writeQueue) remove(op *writeOperation) error {
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(writeQueueBucket).Delete(itob(op.seq))
+	})
+}
+
+// runOrQueueOperation sends the operation to the API. If the API is not
+// reachable or older operations are still waiting in the queue, the operation
+// is applied to the local metadata and queued instead.
+func (store *Store) runOrQueueOperation(op *writeOperation) error {
+	if len(op.MessageIDs) == 0 {
+		return nil
+	}
+
+	if store.writeQueue.isEmpty() {
+		err := store.runOperation(op)
+		if errors.Cause(err) != pmapi.ErrAPINotReachable {
+			return err
+		}
+		// The queue is replayed once the event loop reports the connection
+		// is back by `InternetOnEvent`.
+		store.events.Emit(bridgeEvents.InternetOffEvent, "")
+	}
+
+	store.log.WithField("operation", op).Info("API is not reachable, queueing operation")
+	if err := store.writeQueue.push(op); err != nil {
+		return errors.Wrap(err, "failed to queue operation")
+	}
+	return store.applyOperationLocally(op)
+}
+
+// runOperation calls the API.
+func (store *Store) runOperation(op *writeOperation) error {
+	switch op.Type {
+	case writeOpLabel:
+		return store.api.LabelMessages(op.MessageIDs, op.LabelID)
+	case writeOpUnlabel:
+		return store.api.UnlabelMessages(op.MessageIDs, op.LabelID)
+	case writeOpRead:
+		return store.api.MarkMessagesRead(op.MessageIDs)
+	case writeOpUnread:
+		return store.api.MarkMessagesUnread(op.MessageIDs)
+	case writeOpDelete:
+		return store.api.DeleteMessages(op.MessageIDs)
+	}
+	return fmt.Errorf("unknown operation type %q", op.Type)
+}
+
+// applyOperationLocally changes the metadata in the database the same way
+// the event from the API would do after the operation.
+func (store *Store) applyOperationLocally(op *writeOperation) error {
+	if op.Type == writeOpDelete {
+		return store.deleteMessagesEvent(op.MessageIDs)
+	}
+
+	msgs := []*pmapi.Message{}
+	for _, apiID := range op.MessageIDs {
+		msg, err := store.getMessageFromDB(apiID)
+		if err != nil {
+			store.log.WithError(err).WithField("msgID", apiID).Warn("Cannot apply queued operation locally")
+			continue
+		}
+		switch op.Type {
+		case writeOpLabel:
+			if !hasLabel(msg, op.LabelID) {
+				msg.LabelIDs = append(msg.LabelIDs, op.LabelID)
+			}
+		case writeOpUnlabel:
+			labelIDs := []string{}
+			for _, labelID := range msg.LabelIDs {
+				if labelID != op.LabelID {
+					labelIDs = append(labelIDs, labelID)
+				}
+			}
+			msg.LabelIDs = labelIDs
+		case writeOpRead:
+			msg.Unread = 0
+		case writeOpUnread:
+			msg.Unread = 1
+		}
+		msgs = append(msgs, msg)
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return store.createOrUpdateMessagesEvent(msgs)
+}
+
+func hasLabel(msg *pmapi.Message, labelID string) bool {
+	for _, id := range msg.LabelIDs {
+		if id == labelID {
+			return true
+		}
+	}
+	return false
+}
+
+// Results of comparing queued operation with the change made on the server.
+const (
+	writeOpNotAffected = iota
+	writeOpAlreadyDone
+	writeOpConflict
+)
+
+// rebaseOnUpdate compares the operation with the update of one of its
+// messages made on the server while the operation was queued. When the
+// operation is neither done on the server already nor in conflict with it,
+// the update is changed to not overwrite the local change of the operation.
+// Only explicit changes of the same label or of the unread state conflict.
+func (op *writeOperation) rebaseOnUpdate(updates *pmapi.EventMessageUpdated) int {
+	switch op.Type {
+	case writeOpLabel, writeOpUnlabel:
+		wantLabel := op.Type == writeOpLabel
+		if containsString(updates.LabelIDsAdded, op.LabelID) {
+			return rebaseResult(wantLabel)
+		}
+		if containsString(updates.LabelIDsRemoved, op.LabelID) {
+			return rebaseResult(!wantLabel)
+		}
+		if updates.LabelIDs == nil {
+			return writeOpNotAffected
+		}
+		if containsString(updates.LabelIDs, op.LabelID) == wantLabel {
+			return writeOpAlreadyDone
+		}
+		if wantLabel {
+			updates.LabelIDs = append(updates.LabelIDs, op.LabelID)
+		} else {
+			labelIDs := []string{}
+			for _, labelID := range updates.LabelIDs {
+				if labelID != op.LabelID {
+					labelIDs = append(labelIDs, labelID)
+				}
+			}
+			updates.LabelIDs = labelIDs
+		}
+	case writeOpRead, writeOpUnread:
+		if updates.Unread == nil {
+			return writeOpNotAffected
+		}
+		return rebaseResult((*updates.Unread == 1) == (op.Type == writeOpUnread))
+	}
+	return writeOpNotAffected
+}
+
+func rebaseResult(isSameChange bool) int {
+	if isSameChange {
+		return writeOpAlreadyDone
+	}
+	return writeOpConflict
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveWriteQueueConflicts reconciles queued operations with the changes
+// other clients made on the server while bridge was offline. It has to be
+// called before the event is processed:
+//   - messages deleted on the server are dropped from the operations,
+//   - messages whose label or unread state was already changed the same way
+//     on the server are dropped from the operations,
+//   - messages whose label or unread state was changed the opposite way are
+//     dropped from the operations as well, the change on the server wins
+//     and frontends are notified,
+//   - other updates of queued messages are changed to keep the local changes
+//     of the operations and updates of messages deleted locally are skipped.
+func (store *Store) resolveWriteQueueConflicts(event *pmapi.Event) {
+	if len(event.Messages) == 0 || store.writeQueue.isEmpty() {
+		return
+	}
+
+	ops, err := store.writeQueue.all()
+	if err != nil {
+		store.log.WithError(err).Error("Cannot load write queue")
+		return
+	}
+
+	changed := map[*writeOperation]bool{}
+	conflicts := map[*writeOperation]bool{}
+	messages := []*pmapi.EventMessage{}
+	for _, msgEvent := range event.Messages {
+		skipEvent := false
+		for _, op := range ops {
+			if !containsString(op.MessageIDs, msgEvent.ID) {
+				continue
+			}
+
+			result := writeOpNotAffected
+			switch msgEvent.Action {
+			case pmapi.EventDelete:
+				result = writeOpAlreadyDone
+			case pmapi.EventUpdate, pmapi.EventUpdateFlags:
+				if msgEvent.Updated == nil {
+					continue
+				}
+				if op.Type == writeOpDelete {
+					skipEvent = true
+					continue
+				}
+				result = op.rebaseOnUpdate(msgEvent.Updated)
+			}
+
+			if result == writeOpNotAffected {
+				continue
+			}
+			if result == writeOpConflict {
+				store.log.WithField("operation", op).WithField("msgID", msgEvent.ID).Warn("Queued operation conflicts with change on server")
+				conflicts[op] = true
+			}
+			op.removeMessageIDs(map[string]bool{msgEvent.ID: true})
+			changed[op] = true
+		}
+		if !skipEvent {
+			messages = append(messages, msgEvent)
+		}
+	}
+	event.Messages = messages
+
+	for _, op := range ops {
+		if !changed[op] {
+			continue
+		}
+		if conflicts[op] {
+			store.events.Emit(bridgeEvents.WriteQueueRejectedEvent, fmt.Sprintf("%s: %s conflicts with change on server", store.user.GetPrimaryAddress(), op))
+		}
+		if len(op.MessageIDs) == 0 {
+			err = store.writeQueue.remove(op)
+		} else {
+			err = store.writeQueue.update(op)
+		}
+		if err != nil {
+			store.log.WithError(err).Error("Cannot update write queue")
+		}
+	}
+}
+
+// replayWriteQueue sends queued operations to the API in the order they
+// were made. Replay stops when the API is not reachable again. Operations
+// rejected by the API are dropped, the affected messages are fetched again
+// to undo the local change and frontends are notified. It returns whether
+// any operation was sent to the API.
+func (store *Store) replayWriteQueue() (replayed bool) {
+	store.writeQueue.replayLock.Lock()
+	defer store.writeQueue.replayLock.Unlock()
+
+	for {
+		op, err := store.writeQueue.first()
+		if err != nil {
+			store.log.WithError(err).Error("Cannot load write queue")
+			return
+		}
+		if op == nil {
+			return
+		}
+
+		err = store.runOperation(op)
+		if errors.Cause(err) == pmapi.ErrAPINotReachable {
+			store.log.Info("API is not reachable, replay of write queue postponed")
+			return
+		}
+		replayed = true
+		if err != nil {
+			store.log.WithError(err).WithField("operation", op).Warn("Queued operation was rejected")
+			store.revertOperation(op)
+			store.events.Emit(bridgeEvents.WriteQueueRejectedEvent, fmt.Sprintf("%s: %s was rejected: %v", store.user.GetPrimaryAddress(), op, err))
+		} else {
+			store.log.WithField("operation", op).Debug("Queued operation replayed")
+		}
+
+		if err := store.writeQueue.remove(op); err != nil {
+			store.log.WithError(err).Error("Cannot remove operation from write queue")
+			return
+		}
+	}
+}
+
+// revertOperation replaces the local change of rejected operation
+// by the current state on the server.
+func (store *Store) revertOperation(op *writeOperation) {
+	for _, apiID := range op.MessageIDs {
+		msg, err := store.fetchMessage(context.Background(), apiID)
+		if err == ErrNoSuchAPIID {
+			err = store.deleteMessageEvent(apiID)
+		} else if err == nil {
+			err = store.createOrUpdateMessageEvent(msg)
+		}
+		if err != nil {
+			store.log.WithError(err).WithField("msgID", apiID).Warn("Cannot revert rejected operation")
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	bridgemocks "github.com/ProtonMail/proton-bridge/internal/bridge/mocks"
+	"github.com/ProtonMail/proton-bridge/internal/events"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/golang/mock/gomock"
+	a "github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStoreWithoutEventLoop creates the store and stops its event loop
+// so the test controls when the write queue is replayed.
+func newStoreWithoutEventLoop(m *mocksForStore) {
+	m.newStoreNoEvents(true)
+	require.Eventually(m.tb, m.store.eventLoop.IsRunning, time.Second, 10*time.Millisecond)
+	m.store.CloseEventLoop()
+}
+
+func checkQueuedOperations(t *testing.T, m *mocksForStore, wantTypes ...string) {
+	ops, err := m.store.writeQueue.all()
+	require.NoError(t, err)
+	var gotTypes []string
+	for _, op := range ops {
+		gotTypes = append(gotTypes, op.Type)
+	}
+	a.Equal(t, wantTypes, gotTypes)
+}
+
+func TestWriteQueueOfflineOperationsAreQueuedAndReplayed(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.ArchiveLabel).Return(pmapi.ErrAPINotReachable)
+	m.events.EXPECT().Emit(events.InternetOffEvent, "")
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpLabel, []string{"msg1"}, pmapi.ArchiveLabel)))
+	// API is not called while older operations wait in the queue.
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpUnlabel, []string{"msg1"}, pmapi.InboxLabel)))
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpRead, []string{"msg1"}, "")))
+
+	checkQueuedOperations(t, m, writeOpLabel, writeOpUnlabel, writeOpRead)
+
+	msg, err := m.store.getMessageFromDB("msg1")
+	require.NoError(t, err)
+	a.Equal(t, []string{pmapi.AllMailLabel, pmapi.ArchiveLabel}, msg.LabelIDs)
+	a.Equal(t, 0, msg.Unread)
+	checkMailboxMessageIDs(t, m, pmapi.ArchiveLabel, []wantID{{"msg1", 1}})
+
+	// Replay stops when the API is still not reachable.
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.ArchiveLabel).Return(pmapi.ErrAPINotReachable)
+	m.store.replayWriteQueue()
+	checkQueuedOperations(t, m, writeOpLabel, writeOpUnlabel, writeOpRead)
+
+	gomock.InOrder(
+		m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.ArchiveLabel).Return(nil),
+		m.api.EXPECT().UnlabelMessages([]string{"msg1"}, pmapi.InboxLabel).Return(nil),
+		m.api.EXPECT().MarkMessagesRead([]string{"msg1"}).Return(nil),
+	)
+	m.store.replayWriteQueue()
+	checkQueuedOperations(t, m)
+}
+
+func TestWriteQueueRejectedOperationIsReverted(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	m.api.EXPECT().UnlabelMessages([]string{"msg1"}, pmapi.InboxLabel).Return(pmapi.ErrAPINotReachable)
+	m.events.EXPECT().Emit(events.InternetOffEvent, "")
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpUnlabel, []string{"msg1"}, pmapi.InboxLabel)))
+	msg, err := m.store.getMessageFromDB("msg1")
+	require.NoError(t, err)
+	a.Equal(t, []string{pmapi.AllMailLabel}, msg.LabelIDs)
+
+	m.api.EXPECT().UnlabelMessages([]string{"msg1"}, pmapi.InboxLabel).Return(errors.New("message is locked"))
+	m.api.EXPECT().GetMessageContext(gomock.Any(), "msg1").Return(getTestMessage("msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel}), nil)
+	m.user.EXPECT().GetPrimaryAddress().Return(addr1)
+	m.events.EXPECT().Emit(events.WriteQueueRejectedEvent, gomock.Any())
+	m.store.replayWriteQueue()
+
+	checkQueuedOperations(t, m)
+	checkMailboxMessageIDs(t, m, pmapi.InboxLabel, []wantID{{"msg1", 2}})
+}
+
+func TestWriteQueueDeletedMessagesAreDroppedFromQueue(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	m.api.EXPECT().MarkMessagesUnread([]string{"msg1", "msg2"}).Return(pmapi.ErrAPINotReachable)
+	m.events.EXPECT().Emit(events.InternetOffEvent, "")
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpUnread, []string{"msg1", "msg2"}, "")))
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpDelete, []string{"msg2"}, "")))
+
+	m.store.resolveWriteQueueConflicts(&pmapi.Event{
+		Messages: []*pmapi.EventMessage{
+			{EventItem: pmapi.EventItem{ID: "msg2", Action: pmapi.EventDelete}},
+		},
+	})
+	checkQueuedOperations(t, m, writeOpUnread)
+
+	m.api.EXPECT().MarkMessagesUnread([]string{"msg1"}).Return(nil)
+	m.store.replayWriteQueue()
+	checkQueuedOperations(t, m)
+}
+
+func TestWriteQueueEventIsLeftTillReplay(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.ArchiveLabel).Return(pmapi.ErrAPINotReachable)
+	m.events.EXPECT().Emit(events.InternetOffEvent, "")
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpLabel, []string{"msg1"}, pmapi.ArchiveLabel)))
+
+	// Events are polled by separate mock to not match the expectations
+	// of the store creation.
+	eventAPI := bridgemocks.NewMockPMAPIProvider(m.ctrl)
+	m.store.eventLoop.apiClient = eventAPI
+	m.store.eventLoop.hasInternet = false
+
+	// The event has the state from before the replay and must not
+	// overwrite the queued change.
+	eventAPI.EXPECT().GetEventContext(gomock.Any(), "latestEventID").Return(&pmapi.Event{
+		EventID: "event1",
+		Messages: []*pmapi.EventMessage{{
+			EventItem: pmapi.EventItem{ID: "msg1", Action: pmapi.EventUpdateFlags},
+			Updated:   &pmapi.EventMessageUpdated{ID: "msg1", LabelIDs: []string{pmapi.AllMailLabel, pmapi.InboxLabel}},
+		}},
+	}, nil)
+	m.events.EXPECT().Emit(events.InternetOnEvent, "")
+	_, err := m.store.eventLoop.processNextEvent()
+	require.NoError(t, err)
+
+	checkQueuedOperations(t, m, writeOpLabel)
+	a.Equal(t, "latestEventID", m.store.eventLoop.currentEventID)
+	msg, err := m.store.getMessageFromDB("msg1")
+	require.NoError(t, err)
+	a.Equal(t, []string{pmapi.AllMailLabel, pmapi.InboxLabel, pmapi.ArchiveLabel}, msg.LabelIDs)
+}
+
+func TestWriteQueueReplayedWhenInternetIsBack(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	m.newStoreNoEvents(true)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 0, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.ArchiveLabel).Return(pmapi.ErrAPINotReachable)
+	m.events.EXPECT().Emit(events.InternetOffEvent, "")
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpLabel, []string{"msg1"}, pmapi.ArchiveLabel)))
+	checkQueuedOperations(t, m, writeOpLabel)
+
+	m.api.EXPECT().LabelMessages([]string{"msg1"}, pmapi.ArchiveLabel).Return(nil)
+	require.Eventually(t, func() bool { return m.getListener(events.InternetOnEvent) != nil }, time.Second, 10*time.Millisecond)
+	m.getListener(events.InternetOnEvent) <- ""
+
+	require.Eventually(t, m.store.writeQueue.isEmpty, time.Second, 10*time.Millisecond)
+}
+
+func TestWriteQueueConflictsWithChangesOnServer(t *testing.T) {
+	m, clear := initMocks(t)
+	defer clear()
+
+	newStoreWithoutEventLoop(m)
+	insertMessage(t, m, "msg1", "Test message 1", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg2", "Test message 2", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+	insertMessage(t, m, "msg3", "Test message 3", addrID1, 1, []string{pmapi.AllMailLabel, pmapi.InboxLabel})
+
+	m.api.EXPECT().LabelMessages([]string{"msg1", "msg2", "msg3"}, pmapi.ArchiveLabel).Return(pmapi.ErrAPINotReachable)
+	m.events.EXPECT().Emit(events.InternetOffEvent, "")
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpLabel, []string{"msg1", "msg2", "msg3"}, pmapi.ArchiveLabel)))
+	require.NoError(t, m.store.runOrQueueOperation(newWriteOperation(writeOpRead, []string{"msg1", "msg2"}, "")))
+
+	read, unread := 0, 1
+	event := &pmapi.Event{
+		Messages: []*pmapi.EventMessage{
+			// Archive label was removed by other client.
+			{
+				EventItem: pmapi.EventItem{ID: "msg1", Action: pmapi.EventUpdateFlags},
+				Updated:   &pmapi.EventMessageUpdated{ID: "msg1", LabelIDsRemoved: []string{pmapi.ArchiveLabel}, Unread: &read},
+			},
+			// Message was marked as unread by other client.
+			{
+				EventItem: pmapi.EventItem{ID: "msg2", Action: pmapi.EventUpdateFlags},
+				Updated:   &pmapi.EventMessageUpdated{ID: "msg2", Unread: &unread},
+			},
+			// Other label was changed.
+			{
+				EventItem: pmapi.EventItem{ID: "msg3", Action: pmapi.EventUpdateFlags},
+				Updated:   &pmapi.EventMessageUpdated{ID: "msg3", LabelIDs: []string{pmapi.AllMailLabel, pmapi.StarredLabel}},
+			},
+		},
+	}
+
+	m.user.EXPECT().GetPrimaryAddress().Return(addr1).Times(2)
+	m.events.EXPECT().Emit(events.WriteQueueRejectedEvent, gomock.Any()).Times(2)
+	m.store.resolveWriteQueueConflicts(event)
+
+	ops, err := m.store.writeQueue.all()
+	require.NoError(t, err)
+	// The read state of msg1 was already changed on server
+	// and read state of msg2 was changed back by other client.
+	require.Len(t, ops, 1)
+	a.Equal(t, []string{"msg2", "msg3"}, ops[0].MessageIDs)
+
+	// Update of msg3 keeps the queued label.
+	a.Equal(t, []string{pmapi.AllMailLabel, pmapi.StarredLabel, pmapi.ArchiveLabel}, event.Messages[2].Updated.LabelIDs)
+}
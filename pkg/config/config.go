@@ -49,6 +49,27 @@ type Config struct {
 	appDirs        appDirProvider
 	appDirsVersion appDirProvider
 	apiConfig      *pmapi.ClientConfig
+
+	sendRecorderConfig SendRecorderConfig
+}
+
+// SendRecorderConfig configures the deduplication of sent messages.
+type SendRecorderConfig struct {
+	// Expiration is how long the hash of a sent message is remembered.
+	// It's hard to find a good expiration time.
+	// On the one hand, a user could set up some cron job sending the same message over and over again (heartbeat).
+	// On the the other, a user could put the device into sleep mode while sending.
+	// Changing the expiration time will always make one of the edge cases worse.
+	// But both edge cases are something we don't care much about. Important thing is we don't send the same message many times.
+	Expiration time.Duration
+
+	// SendingTimeout is how long a draft is considered to be still sending.
+	// If message is in draft for a long time, we assume there is some problem
+	// and message will not be sent anymore.
+	SendingTimeout time.Duration
+
+	// WaitTimeout is how long a duplicate waits for the first send to finish.
+	WaitTimeout time.Duration
 }
 
 // New returns fully initialized config struct.
@@ -80,6 +101,18 @@ func newConfig(appName, version, revision, cacheVersion string, appDirs, appDirs
 			},
 			// TokenManager should not be required, but PMAPI still doesn't handle not-set cases everywhere.
 			TokenManager: pmapi.NewTokenManager(),
+			// Requests are not limited by rate, requests of the user are only
+			// paused when the API asks the user to slow down.
+			Scheduler: pmapi.NewScheduler(0, 0),
+			// Shared by all clients so switching to an alternative route applies to all of them.
+			Routing: pmapi.NewRouting(pmapi.DefaultRootURL),
+			// Shared by all clients to have metrics of all requests together.
+			Metrics: pmapi.NewAPIMetrics(),
+		},
+		sendRecorderConfig: SendRecorderConfig{
+			Expiration:     30 * time.Minute,
+			SendingTimeout: 10 * time.Minute,
+			WaitTimeout:    60 * time.Second,
 		},
 	}
 }
@@ -208,6 +241,11 @@ func (c *Config) GetTLSKeyPath() string {
 	return filepath.Join(c.appDirs.UserConfig(), "key.pem")
 }
 
+// GetOutgoingRulesPath returns path to file with user-defined rules applied to outgoing messages.
+func (c *Config) GetOutgoingRulesPath() string {
+	return filepath.Join(c.appDirs.UserConfig(), "outgoing_rules.json")
+}
+
 // GetDBDir returns folder for db files.
 func (c *Config) GetDBDir() string {
 	return filepath.Join(c.appDirsVersion.UserCache())
@@ -243,6 +281,17 @@ func (c *Config) GetAPIConfig() *pmapi.ClientConfig {
 	return c.apiConfig
 }
 
+// SetTracer sets the tracer of IMAP commands and API requests they cause.
+// It has to be set before the bridge and its IMAP backend are created.
+func (c *Config) SetTracer(tracer pmapi.Tracer) {
+	c.apiConfig.Tracer = tracer
+}
+
+// GetSendRecorderConfig returns config for deduplication of sent messages.
+func (c *Config) GetSendRecorderConfig() SendRecorderConfig {
+	return c.sendRecorderConfig
+}
+
 // GetDefaultAPIPort returns default Bridge local API port.
 func (c *Config) GetDefaultAPIPort() int {
 	return 1042
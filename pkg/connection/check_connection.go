@@ -37,9 +37,14 @@ var (
 // One endpoint is part of the protonmail API, while the other is not.
 // This allows us to determine whether there is a problem with the connection itself or only a problem with our API.
 // Two errors can be returned, ErrNoInternetConnection or ErrCanNotReachAPI.
-func CheckInternetConnection() error {
+// The API is reached using the routing, nil means the default one.
+func CheckInternetConnection(routing *pmapi.Routing) error {
+	if routing == nil {
+		routing = pmapi.NewRouting(pmapi.DefaultRootURL)
+	}
+
 	client := &http.Client{
-		Transport: pmapi.NewPMAPIPinning(pmapi.CurrentUserAgent).TransportWithPinning(),
+		Transport: pmapi.NewPMAPIPinning(pmapi.CurrentUserAgent, routing).TransportWithPinning(),
 	}
 
 	// Do not cumulate timeouts, use goroutines.
@@ -51,7 +56,7 @@ func CheckInternetConnection() error {
 	go checkConnection(client, "http://protonstatus.com/vpn_status", retStatus)
 
 	// Check of API reachability also uses a fast endpoint.
-	go checkConnection(client, pmapi.GlobalGetRootURL()+"/tests/ping", retAPI)
+	go checkConnection(client, routing.RootURL()+"/tests/ping", retAPI)
 
 	errStatus := <-retStatus
 	errAPI := <-retAPI
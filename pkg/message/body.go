@@ -18,6 +18,7 @@
 package message
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
 	"io"
@@ -46,13 +47,18 @@ func WriteBody(w io.Writer, kr *pmcrypto.KeyRing, m *pmapi.Message) error {
 	return err
 }
 
+// WriteAttachmentBody decrypts the attachment read from r and writes it base64
+// encoded to w. The attachment is decrypted while it is written, so only small
+// part of it is held in memory at once.
 func WriteAttachmentBody(w io.Writer, kr *pmcrypto.KeyRing, m *pmapi.Message, att *pmapi.Attachment, r io.Reader) (err error) {
 	// Decrypt it
 	var dr io.Reader
-	dr, err = att.Decrypt(r, kr)
+	head := &headRecorder{r: r, recording: true}
+	dr, err = att.Decrypt(head, kr)
+	head.recording = false
 	if err == openpgperrors.ErrKeyIncorrect {
 		// Do not fail if attachment is encrypted with a different key.
-		dr = r
+		dr = io.MultiReader(&head.buf, r)
 		err = nil
 		att.Name += ".gpg"
 		att.MIMEType = "application/pgp-encrypted"
@@ -66,10 +72,28 @@ func WriteAttachmentBody(w io.Writer, kr *pmcrypto.KeyRing, m *pmapi.Message, at
 	bw := base64.NewEncoder(base64.StdEncoding, ww)
 
 	var n int64
-	if n, err = io.Copy(bw, dr); err != nil {
+	if n, err = io.Copy(bw, dr); err == pmapi.ErrAttachmentIntegrity {
+		return
+	} else if err != nil {
 		err = fmt.Errorf("cannot write attachment: %v (wrote %v bytes)", err, n)
 	}
 
 	_ = bw.Close()
 	return
 }
+
+// headRecorder keeps the beginning of the encrypted attachment read before
+// decryption fails, so the attachment can be passed on as it is.
+type headRecorder struct {
+	r         io.Reader
+	buf       bytes.Buffer
+	recording bool
+}
+
+func (h *headRecorder) Read(p []byte) (n int, err error) {
+	n, err = h.r.Read(p)
+	if h.recording {
+		_, _ = h.buf.Write(p[:n])
+	}
+	return
+}
@@ -143,6 +143,7 @@ func combineParts(m *pmapi.Message, parts []io.Reader, headers []textproto.MIMEH
 			if _, err = io.Copy(b, d); err != nil {
 				continue
 			}
+			att.Size = int64(b.Len())
 			if foundText && att.ContentID == "" && strings.Contains(mediaType, "image") {
 				// Treat this as an inline attachment even though it is not marked as one.
 				hasher := sha256.New()
@@ -19,6 +19,7 @@ package message
 
 import (
 	"fmt"
+	"io/ioutil"
 	"path/filepath"
 	"runtime"
 	"sort"
@@ -100,6 +101,35 @@ func TestGetSection(t *testing.T) {
 	}
 }
 
+func TestGetSectionReader(t *testing.T) {
+	bs, err := NewBodyStructure(strings.NewReader(sampleMail))
+	require.NoError(t, err)
+
+	mailReader := strings.NewReader(sampleMail)
+	for _, try := range testPaths {
+		// Correctness of the structure is checked by other tests.
+		if _, err := bs.getInfo(try.path); err != nil {
+			continue
+		}
+
+		section, err := bs.GetSection(mailReader, try.path)
+		require.NoError(t, err)
+		sectionReader, err := bs.GetSectionReader(mailReader, try.path)
+		require.NoError(t, err)
+		fromReader, err := ioutil.ReadAll(sectionReader)
+		require.NoError(t, err)
+		require.Equal(t, string(section), string(fromReader))
+
+		content, err := bs.GetSectionContent(mailReader, try.path)
+		require.NoError(t, err)
+		contentReader, err := bs.GetSectionContentReader(mailReader, try.path)
+		require.NoError(t, err)
+		fromReader, err = ioutil.ReadAll(contentReader)
+		require.NoError(t, err)
+		require.Equal(t, string(content), string(fromReader))
+	}
+}
+
 /* Structure example:
 HEADER     ([RFC-2822] header of the message)
 TEXT       ([RFC-2822] text body of the message) MULTIPART/MIXED
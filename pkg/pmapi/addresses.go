@@ -72,6 +72,7 @@ type Address struct {
 	Signature   string
 	MemberID    string `json:",omitempty"`
 	MemberName  string `json:",omitempty"`
+	CatchAll    bool   `json:",omitempty"`
 
 	HasKeys int
 	Keys    PMKeys
@@ -130,6 +131,35 @@ func (l AddressList) ByEmail(email string) *Address {
 	return nil
 }
 
+// BySender gets the address which can send as the email. Plus-addressed
+// emails belong to their base address and any email on a custom domain
+// belongs to the enabled catch-all address of that domain.
+// Returns nil if no address is found.
+func (l AddressList) BySender(email string) *Address {
+	if addr := l.ByEmail(email); addr != nil {
+		return addr
+	}
+
+	domain := emailDomain(email)
+	if domain == "" {
+		return nil
+	}
+	for _, addr := range l {
+		if addr.CatchAll && addr.Status == EnabledAddress && strings.EqualFold(emailDomain(addr.Email), domain) {
+			return addr
+		}
+	}
+	return nil
+}
+
+func emailDomain(email string) string {
+	splitAt := strings.Split(email, "@")
+	if len(splitAt) != 2 {
+		return ""
+	}
+	return splitAt[1]
+}
+
 func SanitizeEmail(email string) string {
 	splitAt := strings.Split(email, "@")
 	if len(splitAt) != 2 {
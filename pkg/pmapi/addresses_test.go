@@ -88,3 +88,30 @@ func TestAddressList(t *testing.T) {
 		t.Errorf("Main() expected:\n%v\n but have:\n%v\n", testAddressList[1], addr)
 	}
 }
+
+func TestAddressList_BySender(t *testing.T) {
+	addresses := AddressList{
+		&Address{ID: "1", Email: "me@pm.me", Status: EnabledAddress},
+		&Address{ID: "2", Email: "info@custom.com", Status: EnabledAddress, CatchAll: true},
+		&Address{ID: "3", Email: "old@disabled.com", Status: DisabledAddress, CatchAll: true},
+	}
+
+	testCases := []struct {
+		email    string
+		wantAddr *Address
+	}{
+		{"me@pm.me", addresses[0]},
+		{"Me+lists@PM.me", addresses[0]},
+		{"other@pm.me", nil},
+		{"info@custom.com", addresses[1]},
+		{"anything@Custom.com", addresses[1]},
+		{"anything+tag@custom.com", addresses[1]},
+		{"anything@disabled.com", nil},
+		{"invalid", nil},
+	}
+	for _, tc := range testCases {
+		if addr := addresses.BySender(tc.email); addr != tc.wantAddr {
+			t.Errorf("BySender(%s) expected:\n%v\n but have:\n%v\n", tc.email, tc.wantAddr, addr)
+		}
+	}
+}
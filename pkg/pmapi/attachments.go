@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -131,6 +132,15 @@ func (a *Attachment) DetachedSign(kr *pmcrypto.KeyRing, att io.Reader) (signed i
 	return signAttachment(kr, att)
 }
 
+// EncryptAndSign encrypts and signs an attachment reading it only once.
+// The encrypted data is produced as it is read and the signature is available
+// after all encrypted data was read, which is the order CreateAttachment
+// uploads them in. Both returned readers should be closed when they are not
+// read to the end.
+func (a *Attachment) EncryptAndSign(kr *pmcrypto.KeyRing, att io.Reader) (encrypted, signature io.ReadCloser, err error) {
+	return encryptAndSignAttachment(kr, att, a.Name)
+}
+
 type CreateAttachmentRes struct {
 	Res
 
@@ -178,6 +188,8 @@ func writeAttachment(w *multipart.Writer, att *Attachment, r io.Reader, sig io.R
 // CreateAttachment uploads an attachment. It must be already encrypted and contain a MessageID.
 //
 // The returned created attachment contains the new attachment ID and its size.
+// The readers are not closed, readers from EncryptAndSign have to be closed
+// by the caller.
 func (c *Client) CreateAttachment(att *Attachment, r io.Reader, sig io.Reader) (created *Attachment, err error) {
 	req, w, err := NewMultipartRequest("POST", "/attachments")
 	if err != nil {
@@ -244,12 +256,18 @@ func (c *Client) DeleteAttachment(attID string) (err error) {
 
 // GetAttachment gets an attachment's content. The returned data is encrypted.
 func (c *Client) GetAttachment(id string) (att io.ReadCloser, err error) {
+	return c.GetAttachmentContext(context.Background(), id)
+}
+
+// GetAttachmentContext gets an attachment's content. The download, including
+// reading of the returned body, is canceled with the context.
+func (c *Client) GetAttachmentContext(ctx context.Context, id string) (att io.ReadCloser, err error) {
 	if id == "" {
 		err = errors.New("pmapi: cannot get an attachment with an empty id")
 		return
 	}
 
-	req, err := NewRequest("GET", "/attachments/"+id, nil)
+	req, err := NewRequestWithContext(ctx, "GET", "/attachments/"+id, nil)
 	if err != nil {
 		return
 	}
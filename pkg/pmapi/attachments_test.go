@@ -33,6 +33,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/openpgp"
 )
 
 var testAttachment = &Attachment{
@@ -139,17 +140,30 @@ func TestClient_CreateAttachment(t *testing.T) {
 	}))
 	defer s.Close()
 
-	r := strings.NewReader(testAttachmentCleartext) // In reality, this thing is encrypted
+	r := &closeRecorder{Reader: strings.NewReader(testAttachmentCleartext)} // In reality, this thing is encrypted
 	created, err := c.CreateAttachment(testAttachment, r, strings.NewReader(""))
 	if err != nil {
 		t.Fatal("Expected no error while creating attachment, got:", err)
 	}
+	if r.closed {
+		t.Error("Expected reader of the caller not to be closed")
+	}
 
 	if created.ID != testAttachment.ID {
 		t.Errorf("Invalid attachment id: expected %v but got %v", testAttachment.ID, created.ID)
 	}
 }
 
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
 func TestClient_DeleteAttachment(t *testing.T) {
 	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		Ok(t, checkMethodAndPath(r, "DELETE", "/attachments/"+testAttachment.ID))
@@ -213,6 +227,52 @@ func TestAttachment_Decrypt(t *testing.T) {
 	decryptAndCheck(t, dataReader)
 }
 
+func TestAttachment_DecryptIntegrity(t *testing.T) {
+	dataBytes, _ := base64.StdEncoding.DecodeString(testAttachmentEncrypted)
+
+	// The last byte is part of the modification detection code.
+	dataBytes[len(dataBytes)-1] ^= 0xff
+
+	r, err := testAttachment.Decrypt(bytes.NewBuffer(dataBytes), testPrivateKeyRing)
+	assert.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Equal(t, ErrAttachmentIntegrity, err)
+}
+
+func TestAttachment_EncryptAndSign(t *testing.T) {
+	var transferred, total int64
+	data := NewProgressReader(strings.NewReader(testAttachmentCleartext), int64(len(testAttachmentCleartext)), func(n, t int64) {
+		transferred, total = n, t
+	})
+
+	enc, sig, err := testAttachment.EncryptAndSign(testPrivateKeyRing, data)
+	assert.NoError(t, err)
+
+	// Data has to be read first, the signature is ready after that.
+	b, err := ioutil.ReadAll(enc)
+	assert.NoError(t, err)
+	signature, err := ioutil.ReadAll(sig)
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(len(testAttachmentCleartext)), transferred)
+	assert.Equal(t, int64(len(testAttachmentCleartext)), total)
+
+	decryptAndCheck(t, bytes.NewBuffer(b))
+	_, err = openpgp.CheckDetachedSignature(testPrivateKeyRing.GetEntities(), strings.NewReader(testAttachmentCleartext), bytes.NewReader(signature), nil)
+	assert.NoError(t, err)
+}
+
+func TestAttachment_EncryptAndSignClosed(t *testing.T) {
+	enc, sig, err := testAttachment.EncryptAndSign(testPrivateKeyRing, strings.NewReader(testAttachmentCleartext))
+	assert.NoError(t, err)
+
+	// Closing stops the encryption and the signing without reading the data.
+	assert.NoError(t, enc.Close())
+	assert.NoError(t, sig.Close())
+	_, err = ioutil.ReadAll(sig)
+	assert.Error(t, err)
+}
+
 func decryptAndCheck(t *testing.T, data io.Reader) {
 	r, err := testAttachment.Decrypt(data, testPrivateKeyRing)
 	assert.Nil(t, err)
@@ -23,7 +23,6 @@ import (
 	"errors"
 	"net/http"
 	"strings"
-	"time"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
 	"github.com/ProtonMail/proton-bridge/pkg/srp"
@@ -301,16 +300,15 @@ func (c *Client) Auth(username, password string, info *AuthInfo) (auth *Auth, er
 	}
 
 	auth = authRes.getAuth()
-	c.uid = auth.UID()
-	c.accessToken = auth.accessToken
+	c.setAuth(auth.UID(), auth.accessToken, auth.ExpiresIn)
 
 	if c.auths != nil {
 		c.auths <- auth
 	}
 
 	if c.tokenManager != nil {
-		c.tokenManager.SetToken(c.userID, c.uid+":"+auth.RefreshToken)
-		c.log.Info("Set token from auth " + c.uid + ":" + auth.RefreshToken)
+		c.tokenManager.SetToken(c.userID, auth.UID()+":"+auth.RefreshToken)
+		c.log.Info("Set token from auth " + auth.UID() + ":" + auth.RefreshToken)
 	}
 
 	// Auth has to be fully unlocked to get key salt. During `Auth` it can happen
@@ -322,7 +320,6 @@ func (c *Client) Auth(username, password string, info *AuthInfo) (auth *Auth, er
 		}
 	}
 
-	c.expiresAt = time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
 	return auth, err
 }
 
@@ -432,7 +429,9 @@ func (c *Client) AuthRefresh(uidAndRefreshToken string) (auth *Auth, err error)
 	}
 
 	// UID must be set for `x-pm-uid` header field, see backend-communication#11
+	c.authLocker.Lock()
 	c.uid = split[0]
+	c.authLocker.Unlock()
 
 	req, err := NewJSONRequest("POST", "/auth/refresh", refreshReq)
 	if err != nil {
@@ -449,20 +448,18 @@ func (c *Client) AuthRefresh(uidAndRefreshToken string) (auth *Auth, err error)
 
 	auth = res.getAuth()
 	// UID should never change after auth, see backend-communication#11
-	auth.uid = c.uid
+	auth.uid = split[0]
 	if c.auths != nil {
 		c.auths <- auth
 	}
 
-	c.uid = auth.UID()
-	c.accessToken = auth.accessToken
+	c.setAuth(auth.UID(), auth.accessToken, auth.ExpiresIn)
 
 	if c.tokenManager != nil {
-		c.tokenManager.SetToken(c.userID, c.uid+":"+res.RefreshToken)
-		c.log.Info("Set token from auth refresh " + c.uid + ":" + res.RefreshToken)
+		c.tokenManager.SetToken(c.userID, auth.UID()+":"+res.RefreshToken)
+		c.log.Info("Set token from auth refresh " + auth.UID() + ":" + res.RefreshToken)
 	}
 
-	c.expiresAt = time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
 	return auth, err
 }
 
@@ -492,8 +489,7 @@ func (c *Client) Logout() (err error) {
 	// regardless of what happens, but we currently don't have a way to prevent ourselves
 	// from using a logged out client. So for now, it's down here, as it was in Charles release.
 	// defer func() {
-	c.uid = ""
-	c.accessToken = ""
+	c.setAuth("", "", 0)
 	c.kr = nil
 	// c.addresses = nil
 	c.user = nil
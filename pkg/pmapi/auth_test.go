@@ -21,6 +21,8 @@ import (
 	"encoding/json"
 	"math/rand"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -364,3 +366,97 @@ func TestClient_DoUnauthorized(t *testing.T) {
 
 	defer Ok(t, res.Body.Close())
 }
+
+func TestClient_DoUnauthorizedConcurrent(t *testing.T) {
+	var refreshes int32
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/auth/refresh" {
+			atomic.AddInt32(&refreshes, 1)
+			// Slow refresh lets other requests fail with the expired token meanwhile.
+			time.Sleep(100 * time.Millisecond)
+			writeJSONResponsefromFile(t, w, routeAuthRefresh(t, w, req), 0)
+			return
+		}
+		if isAuthReq(req, testUID, testAccessToken) != nil {
+			writeJSONResponsefromFile(t, w, httpResponse(http.StatusUnauthorized), 0)
+			return
+		}
+		writeJSONResponsefromFile(t, w, httpResponse(http.StatusOK), 0)
+	}))
+	defer s.Close()
+
+	// Two clients of the same user share the token manager.
+	other := newTestClient()
+	other.tokenManager = c.tokenManager
+	other.routing = c.routing
+	c.tokenManager.SetToken(c.userID, testUID+":"+testRefreshToken)
+	for _, client := range []*Client{c, other} {
+		client.uid = testUID
+		client.accessToken = testAccessTokenOld
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		client := []*Client{c, other}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, err := NewRequest("GET", "/", nil)
+			a.NoError(t, err)
+
+			res, err := client.Do(req, false)
+			if a.NoError(t, err) {
+				a.Equal(t, http.StatusOK, res.StatusCode)
+				a.NoError(t, res.Body.Close())
+			}
+		}()
+	}
+	wg.Wait()
+
+	r.Equal(t, int32(1), atomic.LoadInt32(&refreshes))
+	_, accessToken := c.getAuth()
+	r.Equal(t, testAccessToken, accessToken)
+	_, accessToken = other.getAuth()
+	r.Equal(t, testAccessToken, accessToken)
+	r.Equal(t, testUID+":"+testRefreshTokenNew, c.tokenManager.GetToken(c.userID))
+}
+
+func TestTokenManager_RefreshSingleFlight(t *testing.T) {
+	tm := NewTokenManager()
+	newAuth := &Auth{accessToken: "new"}
+
+	calls := 0
+	unblock := make(chan struct{})
+	refreshFunc := func() (*Auth, error) {
+		calls++
+		<-unblock
+		return newAuth, nil
+	}
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			auth, err := tm.refresh("user", "old", refreshFunc)
+			a.NoError(t, err)
+			a.Equal(t, newAuth, auth)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(unblock)
+	wg.Wait()
+	r.Equal(t, 1, calls)
+
+	// Late request with the old token gets the last result.
+	auth, err := tm.refresh("user", "old", refreshFunc)
+	r.NoError(t, err)
+	r.Equal(t, newAuth, auth)
+	r.Equal(t, 1, calls)
+
+	// Rejected new token is refreshed again.
+	_, err = tm.refresh("user", "new", refreshFunc)
+	r.NoError(t, err)
+	r.Equal(t, 2, calls)
+}
@@ -27,10 +27,12 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
@@ -69,12 +71,23 @@ func (err *ErrUnauthorized) Error() string {
 type TokenManager struct {
 	tokensLocker sync.Locker
 	tokenMap     map[string]string
+	refreshes    map[string]*tokenRefresh
+	refreshed    map[string]*Auth // The result of the last refresh.
+}
+
+// tokenRefresh is the running refresh of the token of one user.
+type tokenRefresh struct {
+	done chan struct{}
+	auth *Auth
+	err  error
 }
 
 func NewTokenManager() *TokenManager {
 	tm := &TokenManager{
 		tokensLocker: &sync.Mutex{},
 		tokenMap:     map[string]string{},
+		refreshes:    map[string]*tokenRefresh{},
+		refreshed:    map[string]*Auth{},
 	}
 	return tm
 }
@@ -91,6 +104,40 @@ func (tm *TokenManager) SetToken(userID, token string) {
 	defer tm.tokensLocker.Unlock()
 
 	tm.tokenMap[userID] = token
+	delete(tm.refreshed, userID)
+}
+
+// refresh calls the refresh function only once at a time for the user.
+// Callers coming while the refresh is running wait for it and get the same
+// result instead of refreshing again with the already used refresh token,
+// which would fail and log the user out. Callers whose access token was
+// already refreshed get the result of the last refresh.
+func (tm *TokenManager) refresh(userID, usedAccessToken string, refreshFunc func() (*Auth, error)) (*Auth, error) {
+	tm.tokensLocker.Lock()
+	if auth, ok := tm.refreshed[userID]; ok && auth.accessToken != usedAccessToken {
+		tm.tokensLocker.Unlock()
+		return auth, nil
+	}
+	if running, ok := tm.refreshes[userID]; ok {
+		tm.tokensLocker.Unlock()
+		<-running.done
+		return running.auth, running.err
+	}
+	running := &tokenRefresh{done: make(chan struct{})}
+	tm.refreshes[userID] = running
+	tm.tokensLocker.Unlock()
+
+	running.auth, running.err = refreshFunc()
+
+	tm.tokensLocker.Lock()
+	delete(tm.refreshes, userID)
+	if running.err == nil {
+		tm.refreshed[userID] = running.auth
+	}
+	tm.tokensLocker.Unlock()
+	close(running.done)
+
+	return running.auth, running.err
 }
 
 // ClientConfig contains Client configuration.
@@ -119,22 +166,43 @@ type ClientConfig struct {
 	// MinSpeed specifies minimum Bytes per second or the request will be canceled.
 	// Zero means no limitation.
 	MinSpeed int64
+
+	// Scheduler limits the rate of requests of each user and pauses requests
+	// when the API asks to slow down. It should be shared by all clients.
+	// Nil means no limits.
+	Scheduler *Scheduler
+
+	// Routing determines the API root URL. It should be shared by all clients
+	// and by the dialer of the Transport. Nil means DefaultRootURL without
+	// alternative routing.
+	Routing *Routing
+
+	// Metrics receives measurements of all requests. It should be shared
+	// by all clients. Nil means no measurements.
+	Metrics MetricsCollector
+
+	// Tracer creates a span for each request as a child of the span in the
+	// request context. Nil means no tracing.
+	Tracer Tracer
 }
 
 // Client to communicate with API.
 type Client struct {
 	auths chan<- *Auth // Channel that sends Auth responses back to the bridge.
 
-	log    *logrus.Entry
-	config *ClientConfig
-	client *http.Client
-	conrep ConnectionReporter
+	log     *logrus.Entry
+	config  *ClientConfig
+	client  *http.Client
+	conrep  ConnectionReporter
+	routing *Routing
+
+	userProxyChanges uint32 // Value of routing.userProxyChanges when connections were last closed.
 
-	uid           string
-	accessToken   string
-	userID        string // Twice here because Username is not unique.
-	requestLocker sync.Locker
-	keyLocker     sync.Locker
+	authLocker  sync.Locker // Guards uid, accessToken and expiresAt used by concurrent requests.
+	uid         string
+	accessToken string
+	userID      string // Twice here because Username is not unique.
+	keyLocker   sync.Locker
 
 	tokenManager *TokenManager
 	expiresAt    time.Time
@@ -171,17 +239,52 @@ func NewClient(cfg *ClientConfig, userID string) *Client {
 		"userID": userID,
 	})
 
+	routing := cfg.Routing
+	if routing == nil {
+		routing = NewRouting(DefaultRootURL)
+	}
+
 	return &Client{
-		log:           log,
-		config:        cfg,
-		client:        hc,
-		tokenManager:  cfg.TokenManager,
-		userID:        userID,
-		requestLocker: &sync.Mutex{},
-		keyLocker:     &sync.Mutex{},
+		log:              log,
+		config:           cfg,
+		client:           hc,
+		routing:          routing,
+		userProxyChanges: routing.getUserProxyChanges(),
+		tokenManager:     cfg.TokenManager,
+		userID:           userID,
+		authLocker:       &sync.Mutex{},
+		keyLocker:        &sync.Mutex{},
+	}
+}
+
+// closeConnectionsIfProxyChanged closes kept-alive connections made through
+// the previous user proxy, otherwise requests would keep using it.
+func (c *Client) closeConnectionsIfProxyChanged() {
+	changes := c.routing.getUserProxyChanges()
+	if atomic.SwapUint32(&c.userProxyChanges, changes) != changes {
+		c.log.Info("Proxy changed, closing idle connections")
+		c.client.CloseIdleConnections()
 	}
 }
 
+// getAuth returns the current session of the client.
+func (c *Client) getAuth() (uid, accessToken string) {
+	c.authLocker.Lock()
+	defer c.authLocker.Unlock()
+
+	return c.uid, c.accessToken
+}
+
+// setAuth sets the session used by all following requests.
+func (c *Client) setAuth(uid, accessToken string, expiresIn int) {
+	c.authLocker.Lock()
+	defer c.authLocker.Unlock()
+
+	c.uid = uid
+	c.accessToken = accessToken
+	c.expiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+}
+
 // SetConnectionReporter sets the connection reporter used by the client to report when
 // internet connection is lost.
 func (c *Client) SetConnectionReporter(conrep ConnectionReporter) {
@@ -201,36 +304,62 @@ func (c *Client) reportLostConnection() {
 
 // Do makes an API request. It does not check for HTTP status code errors.
 func (c *Client) Do(req *http.Request, retryUnauthorized bool) (res *http.Response, err error) {
-	// Copy the request body in case we need to retry it.
-	var bodyBuffer []byte
-	if req.Body != nil {
-		defer req.Body.Close() //nolint[errcheck]
-		bodyBuffer, err = ioutil.ReadAll(req.Body)
-
-		if err != nil {
-			return nil, err
-		}
+	req, span := c.instrumentRequest(req)
+	defer func() { EndSpan(span, err) }()
 
-		r := bytes.NewReader(bodyBuffer)
-		req.Body = ioutil.NopCloser(r)
+	bodyBuffer, err := bufferRequestBody(req)
+	if err != nil {
+		return nil, err
 	}
 
 	return c.doBuffered(req, bodyBuffer, retryUnauthorized)
 }
 
+// bufferRequestBody copies the request body in case we need to retry it.
+// Bodies which cannot be re-opened, such as multipart uploads written by
+// another goroutine, are streamed instead and such requests are not retried.
+func bufferRequestBody(req *http.Request) (bodyBuffer []byte, err error) {
+	if req.Body == nil || !isRetryable(req) {
+		return nil, nil
+	}
+
+	defer req.Body.Close() //nolint[errcheck]
+	if bodyBuffer, err = ioutil.ReadAll(req.Body); err != nil {
+		return nil, err
+	}
+
+	req.Body = ioutil.NopCloser(bytes.NewReader(bodyBuffer))
+	return bodyBuffer, nil
+}
+
+// isRetryable returns whether the request can be sent again. Requests with
+// a body which cannot be re-opened can be sent only once.
+func isRetryable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
 // If needed it retries using req and buffered body.
 func (c *Client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthorized bool) (res *http.Response, err error) { // nolint[funlen]
 	isAuthReq := strings.Contains(req.URL.Path, "/auth")
+	ri := getRequestInstrumentation(req)
+
+	if !req.URL.IsAbs() {
+		if req.URL, err = url.Parse(c.routing.RootURL() + req.URL.String()); err != nil {
+			return
+		}
+		req.Host = req.URL.Host
+	}
 
 	req.Header.Set("x-pm-appversion", c.config.AppVersion)
 	req.Header.Set("x-pm-apiversion", strconv.Itoa(Version))
 
-	if c.uid != "" {
-		req.Header.Set("x-pm-uid", c.uid)
+	uid, accessToken := c.getAuth()
+	if uid != "" {
+		req.Header.Set("x-pm-uid", uid)
 	}
 
-	if c.accessToken != "" {
-		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
 	}
 
 	c.log.Debugln("Requesting ", req.Method, req.URL.RequestURI())
@@ -245,8 +374,23 @@ func (c *Client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 		c.log.Tracef("REQBODY '%s'", string(bodyBuffer))
 	}
 
+	if c.config.Scheduler != nil {
+		if err = c.config.Scheduler.wait(req.Context(), c.userID); err != nil {
+			return nil, err
+		}
+	}
+
+	c.closeConnectionsIfProxyChanged()
+
 	hasBody := len(bodyBuffer) > 0
+	start := time.Now()
 	if res, err = c.client.Do(req); err != nil {
+		// Canceled request does not mean the connection is lost.
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			c.observeRequest(ri, 0, ErrorCategoryCanceled, time.Since(start))
+			return nil, ctxErr
+		}
+		c.observeRequest(ri, 0, ErrorCategoryNetwork, time.Since(start))
 		if res == nil {
 			c.log.WithError(err).Error("Cannot get response")
 			err = ErrAPINotReachable
@@ -254,14 +398,22 @@ func (c *Client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 		}
 		return
 	}
+	c.observeRequest(ri, res.StatusCode, getErrorCategory(res.StatusCode), time.Since(start))
 
 	resDate := res.Header.Get("Date")
 	if resDate != "" {
 		if serverTime, err := http.ParseTime(resDate); err == nil {
-			pmcrypto.GetGopenPGP().UpdateTime(serverTime.Unix())
+			updateServerTime(serverTime.Unix())
 		}
 	}
 
+	if !isRetryable(req) {
+		if res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusTooManyRequests {
+			c.log.Warnf("Not retrying %s with streamed body after http code %d", req.URL.Path, res.StatusCode)
+		}
+		return res, err
+	}
+
 	if res.StatusCode == http.StatusUnauthorized {
 		if hasBody {
 			r := bytes.NewReader(bodyBuffer)
@@ -291,9 +443,12 @@ func (c *Client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 		}
 
 		c.log.Warningf("Retrying %s after %ds induced by http code %d", req.URL.Path, retryAfter, res.StatusCode)
-		time.Sleep(time.Duration(retryAfter) * time.Second)
+		c.observeRetry(ri, ErrorCategoryRateLimited)
 		_, _ = io.Copy(ioutil.Discard, res.Body)
 		_ = res.Body.Close()
+		if err = c.waitBeforeRetry(req.Context(), time.Duration(retryAfter)*time.Second); err != nil {
+			return nil, err
+		}
 		return c.doBuffered(req, bodyBuffer, false)
 	}
 
@@ -304,18 +459,13 @@ func (c *Client) doBuffered(req *http.Request, bodyBuffer []byte, retryUnauthori
 // If the API returns a non-2xx HTTP status code, the error returned will contain status
 // and response as plaintext. API errors must be checked by the caller.
 // It is performed buffered, in case we need to retry.
-func (c *Client) DoJSON(req *http.Request, data interface{}) error {
-	// Copy the request body in case we need to retry it
-	var reqBodyBuffer []byte
-
-	if req.Body != nil {
-		defer req.Body.Close() //nolint[errcheck]
-		var err error
-		if reqBodyBuffer, err = ioutil.ReadAll(req.Body); err != nil {
-			return err
-		}
+func (c *Client) DoJSON(req *http.Request, data interface{}) (err error) {
+	req, span := c.instrumentRequest(req)
+	defer func() { EndSpan(span, err) }()
 
-		req.Body = ioutil.NopCloser(bytes.NewReader(reqBodyBuffer))
+	reqBodyBuffer, err := bufferRequestBody(req)
+	if err != nil {
+		return err
 	}
 
 	return c.doJSONBuffered(req, reqBodyBuffer, data)
@@ -324,6 +474,7 @@ func (c *Client) DoJSON(req *http.Request, data interface{}) error {
 // doJSONBuffered performs a buffered json request (see DoJSON for more information).
 func (c *Client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data interface{}) error { // nolint[funlen]
 	req.Header.Set("Accept", "application/vnd.protonmail.v1+json")
+	ri := getRequestInstrumentation(req)
 
 	var cancelRequest context.CancelFunc
 	if c.config.MinSpeed > 0 {
@@ -376,10 +527,16 @@ func (c *Client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data in
 	// Retry induced by API code.
 	errCode := &Res{}
 	if err := json.Unmarshal(resBody, errCode); err == nil {
-		if errCode.Code == BansRequests {
+		if errCode.Code != 0 && errCode.Code != CodeOk && errCode.Code != CodeMultipleOk {
+			c.observeAPIError(ri, errCode.Code)
+		}
+		if errCode.Code == BansRequests && isRetryable(req) {
 			retryAfter := 3
 			c.log.Warningf("Retrying %s after %ds induced by API code %d", req.URL.Path, retryAfter, errCode.Code)
-			time.Sleep(time.Duration(retryAfter) * time.Second)
+			c.observeRetry(ri, ErrorCategoryRateLimited)
+			if err := c.waitBeforeRetry(req.Context(), time.Duration(retryAfter)*time.Second); err != nil {
+				return err
+			}
 			if len(reqBodyBuffer) > 0 {
 				req.Body = ioutil.NopCloser(bytes.NewReader(reqBodyBuffer))
 			}
@@ -393,7 +550,10 @@ func (c *Client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data in
 			r := bytes.NewReader(bytes.ReplaceAll(resBody, []byte("\n"), []byte("\\n")))
 			plaintext, err := html2text.FromReader(r)
 			if err == nil {
-				return fmt.Errorf("Error: \n\n" + res.Status + "\n\n" + plaintext)
+				return &Error{
+					StatusCode:   res.StatusCode,
+					ErrorMessage: "Error: \n\n" + res.Status + "\n\n" + plaintext,
+				}
 			}
 		}
 
@@ -419,6 +579,41 @@ func (c *Client) doJSONBuffered(req *http.Request, reqBodyBuffer []byte, data in
 	return nil
 }
 
+// serverTimeLocker serializes updates of the time used by gopenpgp which is
+// global and not safe for concurrent updates by parallel requests.
+var serverTimeLocker = &sync.Mutex{} //nolint[gochecknoglobals]
+
+func updateServerTime(serverTime int64) {
+	serverTimeLocker.Lock()
+	defer serverTimeLocker.Unlock()
+
+	pmcrypto.GetGopenPGP().UpdateTime(serverTime)
+}
+
+// waitBeforeRetry waits before the request is retried when the API asks to
+// slow down. With scheduler, all requests of the user are paused and the
+// retried request waits in the scheduler.
+func (c *Client) waitBeforeRetry(ctx context.Context, retryAfter time.Duration) error {
+	if c.config.Scheduler != nil {
+		c.config.Scheduler.throttle(c.userID, retryAfter)
+		return nil
+	}
+	return sleepWithContext(ctx, retryAfter)
+}
+
+// sleepWithContext waits for the duration or until the context is done.
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (c *Client) readAllMinSpeed(data io.Reader, cancelRequest context.CancelFunc) ([]byte, error) {
 	firstReadTimeout := c.config.FirstReadTimeout
 	if firstReadTimeout == 0 {
@@ -441,21 +636,19 @@ func (c *Client) readAllMinSpeed(data io.Reader, cancelRequest context.CancelFun
 	return ioutil.ReadAll(&buffer)
 }
 
-func (c *Client) refreshAccessToken() (err error) {
+// refreshAccessToken refreshes the access token which was rejected.
+// The refresh is shared by all requests and clients of the user through
+// TokenManager.
+func (c *Client) refreshAccessToken(rejectedAccessToken string) (err error) {
 	c.log.Debug("Refreshing token")
-	refreshToken := c.tokenManager.GetToken(c.userID)
-	c.log.WithField("token", refreshToken).Info("Current refresh token")
-	if refreshToken == "" {
-		if c.auths != nil {
-			c.auths <- nil
-		}
-		if c.tokenManager != nil {
-			c.tokenManager.SetToken(c.userID, "")
+	auth, err := c.tokenManager.refresh(c.userID, rejectedAccessToken, func() (*Auth, error) {
+		refreshToken := c.tokenManager.GetToken(c.userID)
+		c.log.WithField("token", refreshToken).Info("Current refresh token")
+		if refreshToken == "" {
+			return nil, ErrInvalidToken
 		}
-		return ErrInvalidToken
-	}
-
-	auth, err := c.AuthRefresh(refreshToken)
+		return c.AuthRefresh(refreshToken)
+	})
 	if err != nil {
 		c.log.WithError(err).WithField("auths", c.auths).Debug("Token refreshing failed")
 		// The refresh failed, so we should log the user out.
@@ -468,8 +661,7 @@ func (c *Client) refreshAccessToken() (err error) {
 		}
 		return
 	}
-	c.uid = auth.UID()
-	c.accessToken = auth.accessToken
+	c.setAuth(auth.UID(), auth.accessToken, auth.ExpiresIn)
 	return err
 }
 
@@ -480,16 +672,16 @@ func (c *Client) handleStatusUnauthorized(req *http.Request, reqBodyBuffer []byt
 	// so try again without refreshing the access token.
 	if !retry {
 		c.log.Debug("Handling unauthorized status by retrying")
-		c.requestLocker.Lock()
-		defer c.requestLocker.Unlock()
-
 		_, _ = io.Copy(ioutil.Discard, res.Body)
 		_ = res.Body.Close()
+		c.observeRetry(getRequestInstrumentation(req), ErrorCategoryUnauthorized)
 		return c.doBuffered(req, reqBodyBuffer, true)
 	}
 
 	// This is already a retry, so we will try to refresh the access token before trying again.
-	if err = c.refreshAccessToken(); err != nil {
+	// When it was already refreshed by another request, the request is just replayed with the new one.
+	rejectedAccessToken := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if err = c.refreshAccessToken(rejectedAccessToken); err != nil {
 		c.log.WithError(err).Warn("Cannot refresh token")
 		err = &ErrUnauthorized{err}
 		return
@@ -499,5 +691,6 @@ func (c *Client) handleStatusUnauthorized(req *http.Request, reqBodyBuffer []byt
 		c.log.WithError(err).Warn("Failed to read out response body")
 	}
 	_ = res.Body.Close()
+	c.observeRetry(getRequestInstrumentation(req), ErrorCategoryUnauthorized)
 	return c.doBuffered(req, reqBodyBuffer, true)
 }
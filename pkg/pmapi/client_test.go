@@ -113,6 +113,67 @@ func TestClient_DoRetryAfter(t *testing.T) {
 	require.True(t, isInRange, "Waited time: %v", waitedTime)
 }
 
+func TestClient_DoStreamedBodyNotRetried(t *testing.T) {
+	const testReqBody = "streamed body"
+
+	finish, c := newTestServerCallbacks(t,
+		func(tb testing.TB, w http.ResponseWriter, req *http.Request) string {
+			body, err := ioutil.ReadAll(req.Body)
+			require.NoError(t, err)
+			require.Equal(t, testReqBody, string(body))
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return ""
+		},
+	)
+	defer finish()
+
+	// Body written by another goroutine cannot be re-opened to be sent again.
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = io.WriteString(pw, testReqBody)
+		_ = pw.Close()
+	}()
+
+	req, err := NewRequest("POST", "/", pr)
+	require.NoError(t, err)
+
+	res, err := c.Do(req, true)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+}
+
+func TestClient_DoRetryAfterThrottlesScheduler(t *testing.T) {
+	var reported time.Duration
+
+	finish, c := newTestServerCallbacks(t,
+		func(tb testing.TB, w http.ResponseWriter, req *http.Request) string {
+			w.Header().Set("content-type", "application/json;charset=utf-8")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return ""
+		},
+		func(tb testing.TB, w http.ResponseWriter, req *http.Request) string {
+			w.Header().Set("content-type", "application/json;charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			return "/HTTP_200.json"
+		},
+	)
+	defer finish()
+
+	cfg := *testClientConfig
+	cfg.Scheduler = NewScheduler(10, 10)
+	cfg.Scheduler.ReportThrottled = func(retryAfter time.Duration) {
+		reported = retryAfter
+	}
+	c.config = &cfg
+
+	require.Nil(t, c.SendSimpleMetric("some_category", "some_action", "some_label"))
+	require.True(t, 1*time.Second <= reported && reported <= 11*time.Second, "Reported time: %v", reported)
+	require.False(t, time.Now().Before(cfg.Scheduler.ThrottledUntil(c.userID)), "request was retried before throttling is over")
+}
+
 type slowTransport struct {
 	transport      http.RoundTripper
 	firstBodySleep time.Duration
@@ -213,3 +274,47 @@ func routeSlow(delay time.Duration) func(tb testing.TB, w http.ResponseWriter, r
 		return ""
 	}
 }
+
+type testConnectionReporter struct {
+	lost bool
+}
+
+func (r *testConnectionReporter) NotifyConnectionLost() error {
+	r.lost = true
+	return nil
+}
+
+func TestClient_DoCanceledContext(t *testing.T) {
+	unblock := make(chan struct{})
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer s.Close()
+	defer close(unblock)
+
+	conrep := &testConnectionReporter{}
+	c.SetConnectionReporter(conrep)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := c.GetMessageContext(ctx, "messageID")
+	require.Equal(t, context.Canceled, err)
+	require.False(t, conrep.lost, "canceled request must not report lost connection")
+}
+
+func TestClient_DoRetryAfterCanceledContext(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "10")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	testStart := time.Now()
+	_, err := c.GetEventContext(ctx, "eventID")
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.True(t, time.Since(testStart) < time.Second, "waiting for retry was not canceled")
+}
@@ -22,11 +22,11 @@ import (
 	"runtime"
 )
 
-// RootURL is the API root URL.
+// DefaultRootURL is the API root URL used by routing when none is given.
 //
 // This can be changed using build flags: pmapi_local for "http://localhost/api",
 // pmapi_dev or pmapi_prod. Default is pmapi_prod.
-var RootURL = "https://api.protonmail.ch" //nolint[gochecknoglobals]
+var DefaultRootURL = "https://api.protonmail.ch" //nolint[gochecknoglobals]
 
 // CurrentUserAgent is the default User-Agent for go-pmapi lib. This can be changed to program
 // version and email client.
@@ -235,6 +235,29 @@ func (c *Client) GetContactEmailByEmail(email string, page int, pageSize int) (c
 	return
 }
 
+// GetContactEmailsByGroup gets all contact emails belonging to the contact group with the specified label ID.
+func (c *Client) GetContactEmailsByGroup(groupID string, page int, pageSize int) (contactEmails []ContactEmail, err error) {
+	v := url.Values{}
+	v.Set("Page", strconv.Itoa(page))
+	if pageSize > 0 {
+		v.Set("PageSize", strconv.Itoa(pageSize))
+	}
+	v.Set("LabelID", groupID)
+
+	req, err := NewRequest("GET", "/contacts/emails?"+v.Encode(), nil)
+	if err != nil {
+		return
+	}
+
+	var res ContactsEmailsRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+
+	contactEmails, err = res.ContactEmails, res.Err()
+	return
+}
+
 //============================ CREATE ====================================
 
 type CardsList struct {
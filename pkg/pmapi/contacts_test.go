@@ -494,6 +494,24 @@ func TestContact_GetAllContactsEmails(t *testing.T) {
 	}
 }
 
+func TestContact_GetContactEmailsByGroup(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Ok(t, checkMethodAndPath(r, "GET", "/contacts/emails?LabelID=groupID&Page=0&PageSize=1000"))
+
+		fmt.Fprint(w, testGetContactsEmailsResponseBody)
+	}))
+	defer s.Close()
+
+	contactsEmails, err := c.GetContactEmailsByGroup("groupID", 0, 1000)
+	if err != nil {
+		t.Fatal("Expected no error while getting contact group emails, got:", err)
+	}
+
+	if !reflect.DeepEqual(contactsEmails, testGetContactsEmails) {
+		t.Fatalf("Invalid contact group emails: expected %+v, got %+v", testGetContactsEmails, contactsEmails)
+	}
+}
+
 var testUpdateContactReq = UpdateContactReq{
 	Cards: []Card{
 		{
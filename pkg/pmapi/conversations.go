@@ -17,6 +17,10 @@
 
 package pmapi
 
+import (
+	"net/mail"
+)
+
 // ConversationsCount have same structure as MessagesCount.
 type ConversationsCount MessagesCount
 
@@ -27,8 +31,90 @@ type ConversationsCountsRes struct {
 	Counts []*ConversationsCount
 }
 
-// Conversation contains one body and multiple metadata.
-type Conversation struct{}
+// ConversationLabel holds counts of conversation messages with the label.
+type ConversationLabel struct {
+	ID                    string
+	ContextNumMessages    int
+	ContextNumUnread      int
+	ContextTime           int64
+	ContextSize           int64
+	ContextNumAttachments int
+}
+
+// Conversation groups messages of one thread. All messages of the
+// conversation have its ID set as ConversationID.
+type Conversation struct {
+	ID             string
+	Order          int64
+	Subject        string
+	Senders        []*mail.Address
+	Recipients     []*mail.Address
+	NumMessages    int
+	NumUnread      int
+	NumAttachments int
+	ExpirationTime int64 // Unix time
+	Size           int64
+	Time           int64 // Unix time
+	Labels         []*ConversationLabel
+}
+
+// HasLabelID returns whether the conversation has the label.
+func (c *Conversation) HasLabelID(labelID string) bool {
+	for _, label := range c.Labels {
+		if label.ID == labelID {
+			return true
+		}
+	}
+	return false
+}
+
+type ConversationsListRes struct {
+	Res
+
+	Total         int
+	Conversations []*Conversation
+}
+
+// ListConversations gets conversation metadata. The filter has the same
+// meaning as for messages.
+func (c *Client) ListConversations(filter *MessagesFilter) (conversations []*Conversation, total int, err error) {
+	req, err := NewRequest("GET", "/conversations", nil)
+	if err != nil {
+		return
+	}
+
+	req.URL.RawQuery = filter.urlValues().Encode()
+	var res ConversationsListRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+
+	conversations, total, err = res.Conversations, res.Total, res.Err()
+	return
+}
+
+type ConversationRes struct {
+	Res
+
+	Conversation *Conversation
+	Messages     []*Message
+}
+
+// GetConversation retrieves a conversation with metadata of all its messages.
+func (c *Client) GetConversation(id string) (conversation *Conversation, msgs []*Message, err error) {
+	req, err := NewRequest("GET", "/conversations/"+id, nil)
+	if err != nil {
+		return
+	}
+
+	var res ConversationRes
+	if err = c.DoJSON(req, &res); err != nil {
+		return
+	}
+
+	conversation, msgs, err = res.Conversation, res.Messages, res.Err()
+	return
+}
 
 // CountConversations counts conversations by label.
 func (c *Client) CountConversations(addressID string) (counts []*ConversationsCount, err error) {
@@ -0,0 +1,112 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"fmt"
+	"net/http"
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testConversationsBody = `{
+    "Code": 1000,
+    "Total": 1,
+    "Conversations": [
+        {
+            "ID": "conversationID",
+            "Order": 42,
+            "Subject": "Hello",
+            "Senders": [{"Address": "sender@pm.me", "Name": "Sender"}],
+            "Recipients": [{"Address": "recipient@pm.me", "Name": ""}],
+            "NumMessages": 2,
+            "NumUnread": 1,
+            "NumAttachments": 0,
+            "ExpirationTime": 0,
+            "Size": 1024,
+            "Time": 1580000000,
+            "Labels": [
+                {"ID": "0", "ContextNumMessages": 1, "ContextNumUnread": 1, "ContextTime": 1580000000, "ContextSize": 512, "ContextNumAttachments": 0},
+                {"ID": "7", "ContextNumMessages": 1, "ContextNumUnread": 0, "ContextTime": 1570000000, "ContextSize": 512, "ContextNumAttachments": 0}
+            ]
+        }
+    ]
+}
+`
+
+var testConversation = &Conversation{
+	ID:          "conversationID",
+	Order:       42,
+	Subject:     "Hello",
+	Senders:     []*mail.Address{{Address: "sender@pm.me", Name: "Sender"}},
+	Recipients:  []*mail.Address{{Address: "recipient@pm.me"}},
+	NumMessages: 2,
+	NumUnread:   1,
+	Size:        1024,
+	Time:        1580000000,
+	Labels: []*ConversationLabel{
+		{ID: InboxLabel, ContextNumMessages: 1, ContextNumUnread: 1, ContextTime: 1580000000, ContextSize: 512},
+		{ID: SentLabel, ContextNumMessages: 1, ContextTime: 1570000000, ContextSize: 512},
+	},
+}
+
+const testConversationBody = `{
+    "Code": 1000,
+    "Conversation": {"ID": "conversationID", "Subject": "Hello", "NumMessages": 2},
+    "Messages": [
+        {"ID": "msg1", "ConversationID": "conversationID", "Subject": "Hello", "Time": 1570000000},
+        {"ID": "msg2", "ConversationID": "conversationID", "Subject": "Re: Hello", "Time": 1580000000}
+    ]
+}
+`
+
+func TestClient_ListConversations(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Ok(t, checkMethodAndPath(r, "GET", "/conversations?LabelID=0&Page=1"))
+
+		fmt.Fprint(w, testConversationsBody)
+	}))
+	defer s.Close()
+
+	conversations, total, err := c.ListConversations(&MessagesFilter{LabelID: InboxLabel, Page: 1})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []*Conversation{testConversation}, conversations)
+	assert.True(t, conversations[0].HasLabelID(SentLabel))
+	assert.False(t, conversations[0].HasLabelID(TrashLabel))
+}
+
+func TestClient_GetConversation(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Ok(t, checkMethodAndPath(r, "GET", "/conversations/conversationID"))
+
+		fmt.Fprint(w, testConversationBody)
+	}))
+	defer s.Close()
+
+	conversation, msgs, err := c.GetConversation("conversationID")
+	require.NoError(t, err)
+	assert.Equal(t, "conversationID", conversation.ID)
+	assert.Equal(t, 2, conversation.NumMessages)
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "msg1", msgs[0].ID)
+	assert.Equal(t, "conversationID", msgs[1].ConversationID)
+}
@@ -112,6 +112,9 @@ type DialerWithPinning struct {
 	// It is used only if set.
 	ReportCertIssueLocal func()
 
+	// routing is used to dial the API.
+	routing *Routing
+
 	// proxyManager manages API proxies.
 	proxyManager *proxyManager
 
@@ -119,21 +122,28 @@ type DialerWithPinning struct {
 	log logrus.FieldLogger
 }
 
-func NewDialerWithPinning(reportURI string, report TLSReport) *DialerWithPinning {
+// NewDialerWithPinning returns dialer which dials the API using the routing.
+// If routing is nil, DefaultRootURL without alternative routing is used.
+func NewDialerWithPinning(reportURI string, report TLSReport, routing *Routing) *DialerWithPinning {
 	log := logrus.WithField("pkg", "pmapi/tls-pinning")
 
-	proxyManager := newProxyManager(dohProviders, proxyQuery)
+	if routing == nil {
+		routing = NewRouting(DefaultRootURL)
+	}
+
+	proxyManager := newProxyManager(dohProviders, proxyQuery, routing)
 
 	return &DialerWithPinning{
 		isReported:   false,
 		reportURI:    reportURI,
 		report:       report,
+		routing:      routing,
 		proxyManager: proxyManager,
 		log:          log,
 	}
 }
 
-func NewPMAPIPinning(appVersion string) *DialerWithPinning {
+func NewPMAPIPinning(appVersion string, routing *Routing) *DialerWithPinning {
 	return NewDialerWithPinning(
 		"https://reports.protonmail.ch/reports/tls",
 		TLSReport{
@@ -154,6 +164,7 @@ func NewPMAPIPinning(appVersion string) *DialerWithPinning {
 				`pin-sha256="C2UxW0T1Ckl9s+8cXfjXxlEqwAfPM4HiW2y3UdtBeCw="`, // proxy backup 3
 			},
 		},
+		routing,
 	)
 }
 
@@ -197,7 +208,7 @@ func (p *DialerWithPinning) reportCertIssueRemote() {
 
 	p.log.Debugf("report req: %+v\n", req)
 
-	c := &http.Client{}
+	c := &http.Client{Transport: &http.Transport{Proxy: p.routing.userProxyOrEnvironment}}
 	res, err := c.Do(req)
 	p.log.Debugf("res: %+v\nerr: %v", res, err)
 	if err != nil {
@@ -233,7 +244,7 @@ func marshalCert7468(certs []*x509.Certificate) (pemCerts []string) {
 
 func (p *DialerWithPinning) TransportWithPinning() *http.Transport {
 	return &http.Transport{
-		Proxy:                 http.ProxyFromEnvironment,
+		Proxy:                 p.routing.proxyForRequest,
 		DialTLS:               p.dialAndCheckFingerprints,
 		MaxIdleConns:          100,
 		IdleConnTimeout:       5 * time.Minute,
@@ -258,7 +269,7 @@ func (p *DialerWithPinning) TransportWithPinning() *http.Transport {
 //   p.ReportCertIssueLocal() and p.reportCertIssueRemote() if they are not nil.
 func (p *DialerWithPinning) dialAndCheckFingerprints(network, address string) (conn net.Conn, err error) {
 	// If DoH is enabled, we hardfail on fingerprint mismatches.
-	if globalIsDoHAllowed() && p.isReported {
+	if p.routing.isDoHAllowed() && p.isReported {
 		return nil, ErrTLSMatch
 	}
 
@@ -295,8 +306,9 @@ func (p *DialerWithPinning) dialWithProxyFallback(network, address string) (conn
 
 	// If DoH is not allowed, give up. Or, if we are dialing something other than the API
 	// (e.g. we dial protonmail.com/... to check for updates), there's also no point in
-	// continuing since a proxy won't help us reach that.
-	if !globalIsDoHAllowed() || host != stripProtocol(GlobalGetRootURL()) {
+	// continuing since a proxy won't help us reach that. The proxy set by the user takes
+	// precedence over alternative routing; DoH queries would not go through it anyway.
+	if !p.routing.isDoHAllowed() || p.routing.getUserProxy() != nil || host != stripProtocol(p.routing.RootURL()) {
 		return
 	}
 
@@ -329,10 +341,14 @@ func (p *DialerWithPinning) dial(network, address string) (conn net.Conn, err er
 
 	// If we are not dialing the standard API then we should skip cert verification checks.
 	var tlsConfig *tls.Config = nil
-	if address != stripProtocol(globalOriginalURL) {
+	if address != stripProtocol(p.routing.originalURL) {
 		tlsConfig = &tls.Config{InsecureSkipVerify: true} // nolint[gosec]
 	}
 
+	if proxyURL := p.routing.getUserProxy(); proxyURL != nil {
+		return dialTLSThroughProxy(dialer, proxyURL, network, address, tlsConfig)
+	}
+
 	return tls.DialWithDialer(dialer, network, address, tlsConfig)
 }
 
@@ -32,7 +32,8 @@ var testLiveConfig = &ClientConfig{
 
 func newTestDialerWithPinning() (*int, *DialerWithPinning) {
 	called := 0
-	p := NewPMAPIPinning(testLiveConfig.AppVersion)
+	testLiveConfig.Routing = NewRouting(liveAPI)
+	p := NewPMAPIPinning(testLiveConfig.AppVersion, testLiveConfig.Routing)
 	p.ReportCertIssueLocal = func() { called++ }
 	testLiveConfig.Transport = p.TransportWithPinning()
 	return &called, p
@@ -41,7 +42,6 @@ func newTestDialerWithPinning() (*int, *DialerWithPinning) {
 func TestTLSPinValid(t *testing.T) {
 	called, _ := newTestDialerWithPinning()
 
-	RootURL = liveAPI
 	client := NewClient(testLiveConfig, "pmapi"+t.Name())
 
 	_, err := client.AuthInfo("this.address.is.disabled")
@@ -55,7 +55,6 @@ func TestTLSPinBackup(t *testing.T) {
 	p.report.KnownPins[1] = p.report.KnownPins[0]
 	p.report.KnownPins[0] = ""
 
-	RootURL = liveAPI
 	client := NewClient(testLiveConfig, "pmapi"+t.Name())
 
 	_, err := client.AuthInfo("this.address.is.disabled")
@@ -70,7 +69,6 @@ func _TestTLSPinNoMatch(t *testing.T) { // nolint[unused]
 		p.report.KnownPins[i] = "testing"
 	}
 
-	RootURL = liveAPI
 	client := NewClient(testLiveConfig, "pmapi"+t.Name())
 
 	_, err := client.AuthInfo("this.address.is.disabled")
@@ -94,11 +92,10 @@ func _TestTLSPinInvalid(t *testing.T) { // nolint[unused]
 
 	client := NewClient(testLiveConfig, "pmapi"+t.Name())
 
-	RootURL = liveAPI
 	_, err := client.AuthInfo("this.address.is.disabled")
 	Ok(t, err)
 
-	RootURL = ts.URL
+	testLiveConfig.Routing.setRootURL(ts.URL)
 	_, err = client.AuthInfo("this.address.is.disabled")
 	Assert(t, err != nil, "error is expected but have %v", err)
 
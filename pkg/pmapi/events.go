@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/mail"
@@ -173,13 +174,18 @@ type LatestEventRes struct {
 // GetEvent returns a summary of events that occurred since last. To get the latest event,
 // provide an empty last value. The latest event is always empty.
 func (c *Client) GetEvent(last string) (event *Event, err error) {
-	return c.getEvent(last, 1)
+	return c.GetEventContext(context.Background(), last)
 }
 
-func (c *Client) getEvent(last string, numberOfMergedEvents int) (event *Event, err error) {
+// GetEventContext gets an event like GetEvent. The requests are canceled with the context.
+func (c *Client) GetEventContext(ctx context.Context, last string) (event *Event, err error) {
+	return c.getEvent(ctx, last, 1)
+}
+
+func (c *Client) getEvent(ctx context.Context, last string, numberOfMergedEvents int) (event *Event, err error) {
 	var req *http.Request
 	if last == "" {
-		req, err = NewRequest("GET", "/events/latest", nil)
+		req, err = NewRequestWithContext(ctx, "GET", "/events/latest", nil)
 		if err != nil {
 			return
 		}
@@ -191,7 +197,7 @@ func (c *Client) getEvent(last string, numberOfMergedEvents int) (event *Event,
 
 		event, err = res.Event, res.Err()
 	} else {
-		req, err = NewRequest("GET", "/events/"+last, nil)
+		req, err = NewRequestWithContext(ctx, "GET", "/events/"+last, nil)
 		if err != nil {
 			return
 		}
@@ -208,7 +214,7 @@ func (c *Client) getEvent(last string, numberOfMergedEvents int) (event *Event,
 
 		if event.More == 1 && numberOfMergedEvents < maxNumberOfMergedEvents {
 			var moreEvents *Event
-			if moreEvents, err = c.getEvent(event.EventID, numberOfMergedEvents+1); err != nil {
+			if moreEvents, err = c.getEvent(ctx, event.EventID, numberOfMergedEvents+1); err != nil {
 				return
 			}
 			event = mergeEvents(event, moreEvents)
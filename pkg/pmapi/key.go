@@ -18,6 +18,7 @@
 package pmapi
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -87,10 +88,16 @@ const (
 
 // GetPublicKeysForEmail returns all sending public keys for the given email address.
 func (c *Client) GetPublicKeysForEmail(email string) (keys []PublicKey, internal bool, err error) {
+	return c.GetPublicKeysForEmailContext(context.Background(), email)
+}
+
+// GetPublicKeysForEmailContext returns public keys like GetPublicKeysForEmail.
+// The request is canceled with the context.
+func (c *Client) GetPublicKeysForEmailContext(ctx context.Context, email string) (keys []PublicKey, internal bool, err error) {
 	email = url.QueryEscape(email)
 
 	var req *http.Request
-	if req, err = NewRequest("GET", "/keys?Email="+email, nil); err != nil {
+	if req, err = NewRequestWithContext(ctx, "GET", "/keys?Email="+email, nil); err != nil {
 		return
 	}
 
@@ -19,14 +19,17 @@ package pmapi
 
 import (
 	"bytes"
+	"crypto"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"sync"
 
 	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"golang.org/x/crypto/openpgp"
+	openpgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/openpgp/packet"
 )
 
 // clearableKey is a region of memory intended to hold a private key and which can be securely
@@ -186,6 +189,11 @@ func unlockKeyRingNoErrorWhenAlreadyUnlocked(kr *pmcrypto.KeyRing, passphrase []
 // ErrNoKeyringAvailable represents an error caused by a keyring being nil or having no entities.
 var ErrNoKeyringAvailable = errors.New("no keyring available")
 
+// ErrAttachmentIntegrity is returned by the reader of a decrypted attachment
+// when the integrity check at the end of the data fails. Everything read from
+// the reader before has to be thrown away.
+var ErrAttachmentIntegrity = errors.New("attachment integrity check failed")
+
 func (c *Client) encrypt(plain string, signer *pmcrypto.KeyRing) (armored string, err error) {
 	return encrypt(c.kr, plain, signer)
 }
@@ -244,52 +252,176 @@ func (c *Client) verify(plain, amroredSignature string) (err error) {
 	return c.kr.VerifyDetached(plainMessage, pgpSignature, verifyTime)
 }
 
-func encryptAttachment(kr *pmcrypto.KeyRing, data io.Reader, filename string) (encrypted io.Reader, err error) {
+// attachmentConfig returns the configuration used to encrypt and sign
+// attachments, the same as gopenpgp uses for in-memory attachments.
+func attachmentConfig() *packet.Config {
+	return &packet.Config{
+		DefaultCipher: packet.CipherAES256,
+		DefaultHash:   crypto.SHA512,
+		Time:          pmcrypto.GetGopenPGP().GetTime,
+	}
+}
+
+// encryptAttachment returns reader of the encrypted data. The data is read and
+// encrypted only as the returned reader is read, so no more than a small
+// buffer of the attachment is held in memory.
+func encryptAttachment(kr *pmcrypto.KeyRing, data io.Reader, filename string) (encrypted io.ReadCloser, err error) {
 	if kr == nil || kr.FirstKey() == nil {
 		return nil, ErrNoKeyringAvailable
 	}
-	dataBytes, err := ioutil.ReadAll(data)
-	if err != nil {
-		return
-	}
-	plainMessage := pmcrypto.NewPlainMessage(dataBytes)
-	// We use only primary key to encrypt the message. Our keyring contains all keys (primary, old and deacivated ones).
-	pgpSplitMessage, err := kr.FirstKey().EncryptAttachment(plainMessage, filename)
-	if err != nil {
-		return
-	}
-	packets := append(pgpSplitMessage.KeyPacket, pgpSplitMessage.DataPacket...)
-	return bytes.NewReader(packets), nil
+
+	pr, pw := io.Pipe()
+
+	// Encrypt writes the key packets right away, so it has to run
+	// alongside the reader of the pipe as well.
+	go func() {
+		// We use only primary key to encrypt the message. Our keyring contains all keys (primary, old and deacivated ones).
+		hints := &openpgp.FileHints{FileName: filename}
+		w, err := openpgp.Encrypt(pw, kr.FirstKey().GetEntities(), nil, hints, attachmentConfig())
+		if err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(w, data); err != nil {
+			_ = pw.CloseWithError(err)
+			return
+		}
+		_ = pw.CloseWithError(w.Close())
+	}()
+
+	return pr, nil
 }
 
+// decryptAttachment returns reader of the decrypted data. The data is read and
+// decrypted only as the returned reader is read. The integrity of the data is
+// known only at the end, so the reader returns ErrAttachmentIntegrity instead
+// of io.EOF when the check fails.
 func decryptAttachment(kr *pmcrypto.KeyRing, keyPackets []byte, data io.Reader) (decrypted io.Reader, err error) {
 	if kr == nil {
 		return nil, ErrNoKeyringAvailable
 	}
-	dataBytes, err := ioutil.ReadAll(data)
+	encrypted := io.MultiReader(bytes.NewReader(keyPackets), data)
+	md, err := openpgp.ReadMessage(encrypted, kr.GetEntities(), nil, attachmentConfig())
 	if err != nil {
 		return
 	}
-	pgpSplitMessage := pmcrypto.NewPGPSplitMessage(keyPackets, dataBytes)
-	plainMessage, err := kr.DecryptAttachment(pgpSplitMessage)
+	return &integrityReader{md: md}, nil
+}
+
+// integrityReader reports failed MDC or signature checks done by openpgp
+// at the end of the decrypted data as ErrAttachmentIntegrity.
+type integrityReader struct {
+	md *openpgp.MessageDetails
+}
+
+func (r *integrityReader) Read(p []byte) (n int, err error) {
+	n, err = r.md.UnverifiedBody.Read(p)
+	if err == io.EOF && r.md.SignedBy != nil && r.md.SignatureError != nil && r.md.SignatureError != openpgperrors.ErrSignatureExpired {
+		return n, ErrAttachmentIntegrity
+	}
+	if _, ok := err.(openpgperrors.SignatureError); ok {
+		return n, ErrAttachmentIntegrity
+	}
+	return
+}
+
+func encryptAndSignAttachment(kr *pmcrypto.KeyRing, data io.Reader, filename string) (encrypted, signature io.ReadCloser, err error) {
+	if kr == nil {
+		return nil, nil, ErrNoKeyringAvailable
+	}
+	signer, err := kr.GetSigningEntity()
 	if err != nil {
 		return
 	}
-	return plainMessage.NewReader(), nil
+
+	pr, pw := io.Pipe()
+	sig := &pendingSignature{pipe: pr, done: make(chan struct{})}
+	go func() {
+		defer close(sig.done)
+		// DetachSign ignores errors of reading the data, the signature
+		// of incomplete data must not be used though.
+		data := &errorRecorder{r: pr}
+		if sig.err = openpgp.DetachSign(&sig.buf, signer, data, attachmentConfig()); sig.err == nil {
+			sig.err = data.err
+		}
+		_ = pr.CloseWithError(sig.err)
+	}()
+
+	if encrypted, err = encryptAttachment(kr, &signingReader{r: data, w: pw}, filename); err != nil {
+		_ = sig.Close()
+		return nil, nil, err
+	}
+
+	return encrypted, sig, nil
+}
+
+// signingReader passes everything read from r also to the signer.
+type signingReader struct {
+	r io.Reader
+	w *io.PipeWriter
+}
+
+func (s *signingReader) Read(p []byte) (n int, err error) {
+	n, err = s.r.Read(p)
+	if n > 0 {
+		if _, werr := s.w.Write(p[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	if err == io.EOF {
+		_ = s.w.Close()
+	} else if err != nil {
+		_ = s.w.CloseWithError(err)
+	}
+	return
+}
+
+// errorRecorder keeps the first error other than io.EOF returned by r.
+type errorRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errorRecorder) Read(p []byte) (n int, err error) {
+	n, err = e.r.Read(p)
+	if err != nil && err != io.EOF && e.err == nil {
+		e.err = err
+	}
+	return
+}
+
+// pendingSignature is read once the signer read all data.
+type pendingSignature struct {
+	pipe *io.PipeReader
+	done chan struct{}
+	buf  bytes.Buffer
+	err  error
+}
+
+func (s *pendingSignature) Read(p []byte) (int, error) {
+	<-s.done
+	if s.err != nil {
+		return 0, s.err
+	}
+	return s.buf.Read(p)
+}
+
+// Close stops the signer if it did not read all data yet.
+func (s *pendingSignature) Close() error {
+	return s.pipe.CloseWithError(errors.New("pmapi: attachment signature closed"))
 }
 
 func signAttachment(encrypter *pmcrypto.KeyRing, data io.Reader) (signature io.Reader, err error) {
 	if encrypter == nil {
 		return nil, ErrNoKeyringAvailable
 	}
-	dataBytes, err := ioutil.ReadAll(data)
+	signer, err := encrypter.GetSigningEntity()
 	if err != nil {
 		return
 	}
-	plainMessage := pmcrypto.NewPlainMessage(dataBytes)
-	sig, err := encrypter.SignDetached(plainMessage)
-	if err != nil {
+	var sig bytes.Buffer
+	if err = openpgp.DetachSign(&sig, signer, data, attachmentConfig()); err != nil {
 		return
 	}
-	return bytes.NewReader(sig.GetBinary()), nil
+	return &sig, nil
 }
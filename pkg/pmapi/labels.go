@@ -34,6 +34,9 @@ const (
 
 	LabelTypeMailbox      = 1
 	LabelTypeContactGroup = 2
+
+	// LabelPathDelimiter separates names of nested labels in LabelPath.
+	LabelPathDelimiter = "/"
 )
 
 // IsSystemLabel checks if a label is a pre-defined system label.
@@ -86,6 +89,27 @@ type Label struct {
 	Exclusive int
 	Type      int
 	Notify    int
+
+	// ParentID is the ID of the parent folder or label. It is empty
+	// for the top level ones.
+	ParentID string
+}
+
+// LabelPath returns the name of the label prefixed by names of all its
+// parents found in labels.
+func LabelPath(labels []*Label, label *Label) string {
+	byID := map[string]*Label{}
+	for _, l := range labels {
+		byID[l.ID] = l
+	}
+
+	path := label.Name
+	visited := map[string]bool{label.ID: true}
+	for parent, ok := byID[label.ParentID]; ok && !visited[parent.ID]; parent, ok = byID[parent.ParentID] {
+		visited[parent.ID] = true
+		path = parent.Name + LabelPathDelimiter + path
+	}
+	return path
 }
 
 type LabelListRes struct {
@@ -184,3 +184,26 @@ func TestClient_DeleteLabel(t *testing.T) {
 		t.Fatal("Expected no error while deleting label, got:", err)
 	}
 }
+
+func TestLabelPath(t *testing.T) {
+	labels := []*Label{
+		{ID: "top", Name: "Top"},
+		{ID: "middle", Name: "Middle", ParentID: "top"},
+		{ID: "bottom", Name: "Bottom", ParentID: "middle"},
+		{ID: "orphan", Name: "Orphan", ParentID: "unknown"},
+		{ID: "loop", Name: "Loop", ParentID: "loop"},
+	}
+
+	wantPaths := map[string]string{
+		"top":    "Top",
+		"middle": "Top/Middle",
+		"bottom": "Top/Middle/Bottom",
+		"orphan": "Orphan",
+		"loop":   "Loop",
+	}
+	for _, label := range labels {
+		if path := LabelPath(labels, label); path != wantPaths[label.ID] {
+			t.Errorf("Invalid path of %s: expected %q, got %q", label.ID, wantPaths[label.ID], path)
+		}
+	}
+}
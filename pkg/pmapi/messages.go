@@ -19,6 +19,7 @@ package pmapi
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"encoding/base64"
@@ -145,7 +146,7 @@ const messageIDPageSize = 100
 type Message struct {
 	ID             string `json:",omitempty"`
 	Order          int64  `json:",omitempty"`
-	ConversationID string `json:",omitempty"` // only filter
+	ConversationID string `json:",omitempty"`
 	Subject        string
 	Unread         int
 	Type           int
@@ -468,7 +469,12 @@ type MessagesListRes struct {
 
 // ListMessages gets message metadata.
 func (c *Client) ListMessages(filter *MessagesFilter) (msgs []*Message, total int, err error) {
-	req, err := NewRequest("GET", "/messages", nil)
+	return c.ListMessagesContext(context.Background(), filter)
+}
+
+// ListMessagesContext gets message metadata. The request is canceled with the context.
+func (c *Client) ListMessagesContext(ctx context.Context, filter *MessagesFilter) (msgs []*Message, total int, err error) {
+	req, err := NewRequestWithContext(ctx, "GET", "/messages", nil)
 	if err != nil {
 		return
 	}
@@ -479,7 +485,7 @@ func (c *Client) ListMessages(filter *MessagesFilter) (msgs []*Message, total in
 		// If the URI was too long and we searched with IDs, we will try again without the API IDs.
 		if strings.Contains(err.Error(), "api returned: 414") && len(filter.ID) > 0 {
 			filter.ID = []string{}
-			return c.ListMessages(filter)
+			return c.ListMessagesContext(ctx, filter)
 		}
 		return
 	}
@@ -522,7 +528,12 @@ type MessageRes struct {
 
 // GetMessage retrieves a message.
 func (c *Client) GetMessage(id string) (msg *Message, err error) {
-	req, err := NewRequest("GET", "/messages/"+id, nil)
+	return c.GetMessageContext(context.Background(), id)
+}
+
+// GetMessageContext retrieves a message. The request is canceled with the context.
+func (c *Client) GetMessageContext(ctx context.Context, id string) (msg *Message, err error) {
+	req, err := NewRequestWithContext(ctx, "GET", "/messages/"+id, nil)
 	if err != nil {
 		return
 	}
@@ -20,6 +20,7 @@ package pmapi
 import (
 	"crypto/tls"
 	"encoding/base64"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
@@ -43,63 +44,79 @@ var dohProviders = []string{ //nolint[gochecknoglobals]
 	"https://dns.google/dns-query",
 }
 
-// globalAllowDoH controls whether or not to enable use of DoH/Proxy in pmapi.
-var globalAllowDoH = false // nolint[golint]
+// Routing holds how the API is reached: the root URL, whether alternative routing
+// via proxies found by DoH is allowed and the proxy set by the user. One routing
+// should be shared by all clients and dialers of the application (see ClientConfig),
+// so that switching to a proxy applies to all of them.
+type Routing struct {
+	lock sync.RWMutex
 
-// globalProxyMutex allows threadsafe modification of proxy state.
-var globalProxyMutex = sync.RWMutex{} // nolint[golint]
+	originalURL string   // The API URL to return to after using a proxy.
+	rootURL     string   // The API URL currently used.
+	allowDoH    bool     // Whether to use DoH to find a proxy when the API is blocked.
+	userProxy   *url.URL // The proxy set by the user, nil if not set.
 
-// globalOriginalURL backs up the original API url so it can be restored later.
-var globalOriginalURL = RootURL // nolint[golint]
+	userProxyChanges uint32 // Incremented with every change of userProxy.
+}
 
-// globalIsDoHAllowed returns whether or not to use DoH.
-func globalIsDoHAllowed() bool { // nolint[golint]
-	globalProxyMutex.RLock()
-	defer globalProxyMutex.RUnlock()
+// NewRouting returns routing to the given API URL without alternative routing.
+func NewRouting(rootURL string) *Routing {
+	return &Routing{
+		originalURL: rootURL,
+		rootURL:     rootURL,
+	}
+}
 
-	return globalAllowDoH
+// RootURL returns the API URL currently used.
+func (r *Routing) RootURL() string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.rootURL
 }
 
-// GlobalAllowDoH enables DoH.
-func GlobalAllowDoH() { // nolint[golint]
-	globalProxyMutex.Lock()
-	defer globalProxyMutex.Unlock()
+// AllowDoH enables alternative routing.
+func (r *Routing) AllowDoH() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 
-	globalAllowDoH = true
+	r.allowDoH = true
 }
 
-// GlobalDisallowDoH disables DoH and sets the RootURL back to what it was.
-func GlobalDisallowDoH() { // nolint[golint]
-	globalProxyMutex.Lock()
-	defer globalProxyMutex.Unlock()
+// DisallowDoH disables alternative routing and sets the root URL back to what it was.
+func (r *Routing) DisallowDoH() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 
-	globalAllowDoH = false
-	RootURL = globalOriginalURL
+	r.allowDoH = false
+	r.rootURL = r.originalURL
 }
 
-// globalSetRootURL sets the global RootURL.
-func globalSetRootURL(url string) { // nolint[golint]
-	globalProxyMutex.Lock()
-	defer globalProxyMutex.Unlock()
+// isDoHAllowed returns whether or not to use DoH.
+func (r *Routing) isDoHAllowed() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 
-	RootURL = url
+	return r.allowDoH
 }
 
-// GlobalGetRootURL returns the global RootURL.
-func GlobalGetRootURL() (url string) { // nolint[golint]
-	globalProxyMutex.RLock()
-	defer globalProxyMutex.RUnlock()
+// setRootURL sets the API URL currently used.
+func (r *Routing) setRootURL(url string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 
-	return RootURL
+	r.rootURL = url
 }
 
 // isProxyEnabled returns whether or not we are currently using a proxy.
-func isProxyEnabled() bool { // nolint[golint]
-	return globalOriginalURL != GlobalGetRootURL()
+func (r *Routing) isProxyEnabled() bool {
+	return r.originalURL != r.RootURL()
 }
 
 // proxyManager manages known proxies.
 type proxyManager struct {
+	routing *Routing // Routing which is switched to found proxies.
+
 	// dohLookup is used to look up the given query at the given DoH provider, returning the TXT records>
 	dohLookup func(query, provider string) (urls []string, err error)
 
@@ -115,8 +132,9 @@ type proxyManager struct {
 
 // newProxyManager creates a new proxyManager that queries the given DoH providers
 // to retrieve DNS records for the given query string.
-func newProxyManager(providers []string, query string) (p *proxyManager) { // nolint[unparam]
+func newProxyManager(providers []string, query string, routing *Routing) (p *proxyManager) { // nolint[unparam]
 	p = &proxyManager{
+		routing:       routing,
 		providers:     providers,
 		query:         query,
 		useDuration:   proxyRevertTime,
@@ -147,7 +165,7 @@ func (p *proxyManager) findProxy() (proxy string, err error) {
 		}
 
 		for _, proxy := range p.proxyCache {
-			if proxy != stripProtocol(GlobalGetRootURL()) && p.canReach(proxy) {
+			if proxy != stripProtocol(p.routing.RootURL()) && p.canReach(proxy) {
 				proxyResult <- proxy
 				return
 			}
@@ -173,18 +191,18 @@ func (p *proxyManager) findProxy() (proxy string, err error) {
 
 // useProxy sets the proxy server to use. It returns to the original RootURL after 24 hours.
 func (p *proxyManager) useProxy(proxy string) {
-	if !isProxyEnabled() {
+	if !p.routing.isProxyEnabled() {
 		p.disableProxyAfter(p.useDuration)
 	}
 
-	globalSetRootURL(https(proxy))
+	p.routing.setRootURL(https(proxy))
 }
 
 // disableProxyAfter disables the proxy after the given amount of time.
 func (p *proxyManager) disableProxyAfter(d time.Duration) {
 	go func() {
 		<-time.After(d)
-		globalSetRootURL(globalOriginalURL)
+		p.routing.setRootURL(p.routing.originalURL)
 	}()
 }
 
@@ -197,7 +215,7 @@ func (p *proxyManager) refreshProxyCache() error {
 			p.proxyCache = proxies
 
 			// We also want to allow bridge to switch back to the standard API at any time.
-			p.proxyCache = append(p.proxyCache, globalOriginalURL)
+			p.proxyCache = append(p.proxyCache, p.routing.originalURL)
 
 			logrus.WithField("proxies", proxies).Info("Available proxies")
 
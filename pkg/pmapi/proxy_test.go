@@ -33,13 +33,10 @@ const (
 )
 
 func TestProxyManager_FindProxy(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{proxy.URL}, nil }
 
 	url, err := p.findProxy()
@@ -48,9 +45,6 @@ func TestProxyManager_FindProxy(t *testing.T) {
 }
 
 func TestProxyManager_FindProxy_ChooseReachableProxy(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	badProxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	goodProxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 
@@ -58,7 +52,7 @@ func TestProxyManager_FindProxy_ChooseReachableProxy(t *testing.T) {
 	badProxy.Close()
 	defer goodProxy.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{badProxy.URL, goodProxy.URL}, nil }
 
 	url, err := p.findProxy()
@@ -67,9 +61,6 @@ func TestProxyManager_FindProxy_ChooseReachableProxy(t *testing.T) {
 }
 
 func TestProxyManager_FindProxy_FailIfNoneReachable(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	badProxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	anotherBadProxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 
@@ -77,7 +68,7 @@ func TestProxyManager_FindProxy_FailIfNoneReachable(t *testing.T) {
 	badProxy.Close()
 	anotherBadProxy.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{badProxy.URL, anotherBadProxy.URL}, nil }
 
 	_, err := p.findProxy()
@@ -85,13 +76,10 @@ func TestProxyManager_FindProxy_FailIfNoneReachable(t *testing.T) {
 }
 
 func TestProxyManager_FindProxy_LookupTimeout(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 	p.lookupTimeout = time.Second
 	p.dohLookup = func(q, p string) ([]string, error) { time.Sleep(2 * time.Second); return nil, nil }
 
@@ -101,15 +89,12 @@ func TestProxyManager_FindProxy_LookupTimeout(t *testing.T) {
 }
 
 func TestProxyManager_FindProxy_FindTimeout(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	slowProxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		time.Sleep(2 * time.Second)
 	}))
 	defer slowProxy.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 	p.findTimeout = time.Second
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{slowProxy.URL}, nil }
 
@@ -119,26 +104,20 @@ func TestProxyManager_FindProxy_FindTimeout(t *testing.T) {
 }
 
 func TestProxyManager_UseProxy(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{proxy.URL}, nil }
 
 	url, err := p.findProxy()
 	require.NoError(t, err)
 
 	p.useProxy(url)
-	require.Equal(t, proxy.URL, GlobalGetRootURL())
+	require.Equal(t, proxy.URL, p.routing.RootURL())
 }
 
 func TestProxyManager_UseProxy_MultipleTimes(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	proxy1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy1.Close()
 	proxy2 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
@@ -146,13 +125,13 @@ func TestProxyManager_UseProxy_MultipleTimes(t *testing.T) {
 	proxy3 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy3.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{proxy1.URL}, nil }
 	url, err := p.findProxy()
 	require.NoError(t, err)
 	p.useProxy(url)
-	require.Equal(t, proxy1.URL, GlobalGetRootURL())
+	require.Equal(t, proxy1.URL, p.routing.RootURL())
 
 	// Have to wait so as to not get rejected.
 	time.Sleep(proxyLookupWait)
@@ -161,7 +140,7 @@ func TestProxyManager_UseProxy_MultipleTimes(t *testing.T) {
 	url, err = p.findProxy()
 	require.NoError(t, err)
 	p.useProxy(url)
-	require.Equal(t, proxy2.URL, GlobalGetRootURL())
+	require.Equal(t, proxy2.URL, p.routing.RootURL())
 
 	// Have to wait so as to not get rejected.
 	time.Sleep(proxyLookupWait)
@@ -170,17 +149,14 @@ func TestProxyManager_UseProxy_MultipleTimes(t *testing.T) {
 	url, err = p.findProxy()
 	require.NoError(t, err)
 	p.useProxy(url)
-	require.Equal(t, proxy3.URL, GlobalGetRootURL())
+	require.Equal(t, proxy3.URL, p.routing.RootURL())
 }
 
 func TestProxyManager_UseProxy_RevertAfterTime(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 	p.useDuration = time.Second
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{proxy.URL}, nil }
 
@@ -189,20 +165,18 @@ func TestProxyManager_UseProxy_RevertAfterTime(t *testing.T) {
 	require.Equal(t, proxy.URL, url)
 
 	p.useProxy(url)
-	require.Equal(t, proxy.URL, GlobalGetRootURL())
+	require.Equal(t, proxy.URL, p.routing.RootURL())
 
 	time.Sleep(2 * time.Second)
-	require.Equal(t, globalOriginalURL, GlobalGetRootURL())
+	require.Equal(t, p.routing.originalURL, p.routing.RootURL())
 }
 
 func TestProxyManager_UseProxy_RevertIfProxyStopsWorkingAndOriginalAPIIsReachable(t *testing.T) {
-	// Don't block the API here because we want it to be working so the test can find it.
-	defer unblockAPI()
-
 	proxy := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	// Don't block the API here because we want it to be working so the test can find it.
+	p := newProxyManager([]string{"not used"}, "not used", NewRouting(DefaultRootURL))
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{proxy.URL}, nil }
 
 	url, err := p.findProxy()
@@ -210,7 +184,7 @@ func TestProxyManager_UseProxy_RevertIfProxyStopsWorkingAndOriginalAPIIsReachabl
 	require.Equal(t, proxy.URL, url)
 
 	p.useProxy(url)
-	require.Equal(t, proxy.URL, GlobalGetRootURL())
+	require.Equal(t, proxy.URL, p.routing.RootURL())
 
 	// Simulate that the proxy stops working.
 	proxy.Close()
@@ -219,29 +193,26 @@ func TestProxyManager_UseProxy_RevertIfProxyStopsWorkingAndOriginalAPIIsReachabl
 	// We should now find the original API URL if it is working again.
 	url, err = p.findProxy()
 	require.NoError(t, err)
-	require.Equal(t, globalOriginalURL, url)
+	require.Equal(t, p.routing.originalURL, url)
 
 	p.useProxy(url)
-	require.Equal(t, globalOriginalURL, GlobalGetRootURL())
+	require.Equal(t, p.routing.originalURL, p.routing.RootURL())
 }
 
 func TestProxyManager_UseProxy_FindSecondAlternativeIfFirstFailsAndAPIIsStillBlocked(t *testing.T) {
-	blockAPI()
-	defer unblockAPI()
-
 	proxy1 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy1.Close()
 	proxy2 := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
 	defer proxy2.Close()
 
-	p := newProxyManager([]string{"not used"}, "not used")
+	p := newProxyManager([]string{"not used"}, "not used", newBlockedRouting())
 	p.dohLookup = func(q, p string) ([]string, error) { return []string{proxy1.URL, proxy2.URL}, nil }
 
 	// Find a proxy.
 	url, err := p.findProxy()
 	require.NoError(t, err)
 	p.useProxy(url)
-	require.Equal(t, proxy1.URL, GlobalGetRootURL())
+	require.Equal(t, proxy1.URL, p.routing.RootURL())
 
 	// Have to wait so as to not get rejected.
 	time.Sleep(proxyLookupWait)
@@ -253,11 +224,11 @@ func TestProxyManager_UseProxy_FindSecondAlternativeIfFirstFailsAndAPIIsStillBlo
 	url, err = p.findProxy()
 	require.NoError(t, err)
 	p.useProxy(url)
-	require.Equal(t, proxy2.URL, GlobalGetRootURL())
+	require.Equal(t, proxy2.URL, p.routing.RootURL())
 }
 
 func TestProxyManager_DoHLookup_Quad9(t *testing.T) {
-	p := newProxyManager([]string{TestQuad9Provider, TestGoogleProvider}, TestDoHQuery)
+	p := newProxyManager([]string{TestQuad9Provider, TestGoogleProvider}, TestDoHQuery, NewRouting(DefaultRootURL))
 
 	records, err := p.dohLookup(TestDoHQuery, TestQuad9Provider)
 	require.NoError(t, err)
@@ -265,7 +236,7 @@ func TestProxyManager_DoHLookup_Quad9(t *testing.T) {
 }
 
 func TestProxyManager_DoHLookup_Google(t *testing.T) {
-	p := newProxyManager([]string{TestQuad9Provider, TestGoogleProvider}, TestDoHQuery)
+	p := newProxyManager([]string{TestQuad9Provider, TestGoogleProvider}, TestDoHQuery, NewRouting(DefaultRootURL))
 
 	records, err := p.dohLookup(TestDoHQuery, TestGoogleProvider)
 	require.NoError(t, err)
@@ -273,7 +244,7 @@ func TestProxyManager_DoHLookup_Google(t *testing.T) {
 }
 
 func TestProxyManager_DoHLookup_FindProxy(t *testing.T) {
-	p := newProxyManager([]string{TestQuad9Provider, TestGoogleProvider}, TestDoHQuery)
+	p := newProxyManager([]string{TestQuad9Provider, TestGoogleProvider}, TestDoHQuery, NewRouting(DefaultRootURL))
 
 	url, err := p.findProxy()
 	require.NoError(t, err)
@@ -281,24 +252,15 @@ func TestProxyManager_DoHLookup_FindProxy(t *testing.T) {
 }
 
 func TestProxyManager_DoHLookup_FindProxyFirstProviderUnreachable(t *testing.T) {
-	p := newProxyManager([]string{"https://unreachable", TestGoogleProvider}, TestDoHQuery)
+	p := newProxyManager([]string{"https://unreachable", TestGoogleProvider}, TestDoHQuery, NewRouting(DefaultRootURL))
 
 	url, err := p.findProxy()
 	require.NoError(t, err)
 	require.NotEmpty(t, url)
 }
 
-// testAPIURLBackup is used to hold the globalOriginalURL because we clear it for test purposes and need to restore it.
-var testAPIURLBackup = globalOriginalURL
-
-// blockAPI prevents tests from reaching the standard API, forcing them to find a proxy.
-func blockAPI() {
-	globalSetRootURL("")
-	globalOriginalURL = ""
-}
-
-// unblockAPI allow tests to reach the standard API again.
-func unblockAPI() {
-	globalOriginalURL = testAPIURLBackup
-	globalSetRootURL(globalOriginalURL)
+// newBlockedRouting returns routing to the API which cannot be reached,
+// forcing tests to find a proxy.
+func newBlockedRouting() *Routing {
+	return NewRouting("")
 }
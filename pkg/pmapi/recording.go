@@ -0,0 +1,427 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/scrypt"
+)
+
+// redactedValue replaces sanitised values in recorded exchanges.
+const redactedValue = "REDACTED"
+
+// recordedTokenFields are JSON fields with credentials. They are never recorded.
+var recordedTokenFields = map[string]bool{ //nolint[gochecknoglobals]
+	"AccessToken":     true,
+	"RefreshToken":    true,
+	"UID":             true,
+	"ClientProof":     true,
+	"ClientEphemeral": true,
+	"TwoFactorCode":   true,
+}
+
+// recordedAuthFields are JSON fields with SRP parameters and key salts.
+// They are recorded only when the recording is encrypted, because replay
+// needs them to finish the login and to unlock the keys.
+var recordedAuthFields = map[string]bool{ //nolint[gochecknoglobals]
+	"ServerProof":     true,
+	"ServerEphemeral": true,
+	"SRPSession":      true,
+	"Salt":            true,
+	"KeySalt":         true,
+}
+
+// recordedContentFields are JSON fields with contents of messages and keys.
+// They are recorded only when the recording is encrypted.
+var recordedContentFields = map[string]bool{ //nolint[gochecknoglobals]
+	"Body":       true,
+	"PrivateKey": true,
+	"Token":      true,
+	"Signature":  true,
+	"KeyPackets": true,
+	"Packages":   true,
+	"Cards":      true,
+}
+
+// Parameters of scrypt used to derive the key of encrypted recordings.
+const (
+	recordingKDF       = "scrypt"
+	recordingSaltSize  = 16
+	recordingScryptN   = 32768
+	recordingScryptR   = 8
+	recordingScryptP   = 1
+	recordingKeyLength = 32
+)
+
+// recordingHeader is the first line of encrypted recordings.
+type recordingHeader struct {
+	KDF  string
+	Salt []byte
+}
+
+// recordedHeaders are response headers kept in recorded exchanges.
+var recordedHeaders = []string{"Content-Type", "Date", "Retry-After"} //nolint[gochecknoglobals]
+
+// recordedExchange is one line of the recording.
+type recordedExchange struct {
+	Method       string
+	URI          string
+	RequestBody  []byte `json:",omitempty"`
+	StatusCode   int
+	Header       http.Header `json:",omitempty"`
+	ResponseBody []byte      `json:",omitempty"`
+	Encrypted    bool        `json:",omitempty"`
+}
+
+func (e *recordedExchange) key() string {
+	return e.Method + " " + e.URI
+}
+
+// RecordingTransport is a transport for ClientConfig which writes all API
+// exchanges to a recording. Credentials are always redacted. Contents of
+// messages and login parameters are redacted too unless the recording is
+// encrypted.
+type RecordingTransport struct {
+	transport http.RoundTripper
+	aead      cipher.AEAD
+
+	lock    sync.Mutex
+	encoder *json.Encoder
+}
+
+// NewRecordingTransport records exchanges done by transport (http.DefaultTransport
+// if nil) to w. When passphrase is not empty, bodies are encrypted by a key
+// derived from it instead of redacting their contents. The salt of the key
+// derivation is written as the first line of the recording.
+func NewRecordingTransport(transport http.RoundTripper, w io.Writer, passphrase string) (*RecordingTransport, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	t := &RecordingTransport{
+		transport: transport,
+		encoder:   json.NewEncoder(w),
+	}
+
+	if passphrase != "" {
+		header := &recordingHeader{
+			KDF:  recordingKDF,
+			Salt: make([]byte, recordingSaltSize),
+		}
+		if _, err := rand.Read(header.Salt); err != nil {
+			return nil, err
+		}
+
+		var err error
+		if t.aead, err = newRecordingCipher(passphrase, header.Salt); err != nil {
+			return nil, err
+		}
+		if err := t.encoder.Encode(header); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	res, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+
+	if err := t.record(req, reqBody, res, resBody); err != nil {
+		logrus.WithField("pkg", "pmapi/recording").WithError(err).Warn("Cannot record API exchange")
+	}
+
+	return res, nil
+}
+
+func (t *RecordingTransport) record(req *http.Request, reqBody []byte, res *http.Response, resBody []byte) (err error) {
+	exchange := &recordedExchange{
+		Method:     req.Method,
+		URI:        redactRequestURI(req.URL),
+		StatusCode: res.StatusCode,
+		Header:     http.Header{},
+		Encrypted:  t.aead != nil,
+	}
+	for _, name := range recordedHeaders {
+		if value := res.Header.Get(name); value != "" {
+			exchange.Header.Set(name, value)
+		}
+	}
+
+	if exchange.RequestBody, err = t.sanitise(reqBody); err != nil {
+		return
+	}
+	if exchange.ResponseBody, err = t.sanitise(resBody); err != nil {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.encoder.Encode(exchange)
+}
+
+// sanitise redacts credentials from the body and then either encrypts it
+// or redacts the contents.
+func (t *RecordingTransport) sanitise(body []byte) ([]byte, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err == nil {
+		redactFields(data, recordedTokenFields)
+		if t.aead == nil {
+			redactFields(data, recordedAuthFields)
+			redactFields(data, recordedContentFields)
+		}
+		if body, err = json.Marshal(data); err != nil {
+			return nil, err
+		}
+	} else if t.aead == nil {
+		// Attachments and multipart requests contain only contents.
+		return []byte(redactedValue), nil
+	}
+
+	if t.aead != nil {
+		return sealRecordedBody(t.aead, body)
+	}
+	return body, nil
+}
+
+func redactFields(data interface{}, fields map[string]bool) {
+	switch data := data.(type) {
+	case map[string]interface{}:
+		for key, value := range data {
+			if fields[key] && value != nil {
+				data[key] = redactedValue
+				continue
+			}
+			redactFields(value, fields)
+		}
+	case []interface{}:
+		for _, value := range data {
+			redactFields(value, fields)
+		}
+	}
+}
+
+// redactRequestURI returns the path of the request with values of the query
+// redacted, because they can contain addresses or search terms.
+func redactRequestURI(u *url.URL) string {
+	uri := u.EscapedPath()
+	if u.RawQuery == "" {
+		return uri
+	}
+
+	query := u.Query()
+	for _, values := range query {
+		for i := range values {
+			values[i] = redactedValue
+		}
+	}
+	return uri + "?" + query.Encode()
+}
+
+// ReplayTransport is a transport for ClientConfig which responds with
+// exchanges from a recording made by RecordingTransport. Requests are matched
+// by method, path and names of query parameters; responses to the same
+// request are replayed in the recorded order and when all of them were used,
+// the last one is repeated.
+type ReplayTransport struct {
+	lock      sync.Mutex
+	exchanges map[string][]*recordedExchange
+	last      map[string]*recordedExchange
+	unmatched []string
+}
+
+// NewReplayTransport reads the recording from r. The passphrase is needed
+// only for encrypted recordings.
+func NewReplayTransport(r io.Reader, passphrase string) (*ReplayTransport, error) {
+	t := &ReplayTransport{
+		exchanges: map[string][]*recordedExchange{},
+		last:      map[string]*recordedExchange{},
+	}
+
+	var aead cipher.AEAD
+	decoder := json.NewDecoder(r)
+	for first := true; ; first = false {
+		var line json.RawMessage
+		if err := decoder.Decode(&line); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if first {
+			header := &recordingHeader{}
+			if err := json.Unmarshal(line, header); err != nil {
+				return nil, err
+			}
+			if header.KDF != "" {
+				if header.KDF != recordingKDF {
+					return nil, fmt.Errorf("pmapi: unsupported key derivation %q of recording", header.KDF)
+				}
+				if passphrase == "" {
+					return nil, errors.New("pmapi: recording is encrypted but no passphrase was given")
+				}
+				var err error
+				if aead, err = newRecordingCipher(passphrase, header.Salt); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		exchange := &recordedExchange{}
+		if err := json.Unmarshal(line, exchange); err != nil {
+			return nil, err
+		}
+
+		if exchange.Encrypted {
+			if aead == nil {
+				return nil, errors.New("pmapi: recording is encrypted but has no key derivation header")
+			}
+
+			var err error
+			if exchange.ResponseBody, err = openRecordedBody(aead, exchange.ResponseBody); err != nil {
+				return nil, err
+			}
+		}
+
+		t.exchanges[exchange.key()] = append(t.exchanges[exchange.key()], exchange)
+	}
+
+	return t, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Request body has to be consumed, multipart requests are written
+	// by another goroutine.
+	if req.Body != nil {
+		_, _ = io.Copy(ioutil.Discard, req.Body)
+		_ = req.Body.Close()
+	}
+
+	key := req.Method + " " + redactRequestURI(req.URL)
+
+	t.lock.Lock()
+	exchange := t.last[key]
+	if exchanges := t.exchanges[key]; len(exchanges) > 0 {
+		exchange, t.exchanges[key] = exchanges[0], exchanges[1:]
+		t.last[key] = exchange
+	}
+	if exchange == nil {
+		t.unmatched = append(t.unmatched, key)
+	}
+	t.lock.Unlock()
+
+	if exchange == nil {
+		return nil, fmt.Errorf("pmapi: no recorded response for %s", key)
+	}
+
+	header := http.Header{}
+	for name, values := range exchange.Header {
+		header[name] = append([]string{}, values...)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.StatusCode, http.StatusText(exchange.StatusCode)),
+		StatusCode:    exchange.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(exchange.ResponseBody)),
+		ContentLength: int64(len(exchange.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+// Unmatched returns requests for which the recording had no response.
+func (t *ReplayTransport) Unmatched() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return append([]string{}, t.unmatched...)
+}
+
+func newRecordingCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, recordingScryptN, recordingScryptR, recordingScryptP, recordingKeyLength)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealRecordedBody(aead cipher.AEAD, body []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, body, nil), nil
+}
+
+func openRecordedBody(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) == 0 {
+		return nil, nil
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("pmapi: recorded body is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
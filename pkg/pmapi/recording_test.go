@@ -0,0 +1,216 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/srp"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRecordedAccessToken  = "secret-access-token"
+	testRecordedRefreshToken = "secret-refresh-token"
+	testRecordedBody         = "secret-message-body"
+	testRecordedMessageID    = "messageID"
+	testRecordedEmail        = "secret@recipient.com"
+)
+
+func newRecordingTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/auth/refresh":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"Code":1000,"AccessToken":"%s","RefreshToken":"%s","UID":"uid","ExpiresIn":86400}`, testRecordedAccessToken, testRecordedRefreshToken)
+		case "/messages/" + testRecordedMessageID:
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"Code":1000,"Message":{"ID":"%s","Subject":"Subject","Body":"%s"}}`, testRecordedMessageID, testRecordedBody)
+		case "/attachments/" + testAttachment.ID:
+			fmt.Fprint(w, testAttachmentCleartext)
+		case "/keys":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"Code":1000,"RecipientType":%d,"Keys":[]}`, RecipientExternal)
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// recordTestSession does the API calls of the recorded session and checks
+// the results are the same every time, no matter whether they come from
+// the server or the recording.
+func recordTestSession(t *testing.T, transport http.RoundTripper, rootURL string) {
+	cfg := *testClientConfig
+	cfg.Transport = transport
+	cfg.Routing = NewRouting(rootURL)
+	c := NewClient(&cfg, "tester")
+
+	auth, err := c.AuthRefresh("uid:" + testRecordedRefreshToken)
+	require.NoError(t, err)
+	require.Equal(t, "uid", auth.UID())
+
+	message, err := c.GetMessage(testRecordedMessageID)
+	require.NoError(t, err)
+	require.Equal(t, "Subject", message.Subject)
+
+	att, err := c.GetAttachment(testAttachment.ID)
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(att)
+	require.NoError(t, err)
+	require.NoError(t, att.Close())
+
+	_, internal, err := c.GetPublicKeysForEmail(testRecordedEmail)
+	require.NoError(t, err)
+	require.False(t, internal)
+}
+
+func TestRecordingTransport_Redacted(t *testing.T) {
+	s := newRecordingTestServer(t)
+	defer s.Close()
+
+	var recording bytes.Buffer
+	recorder, err := NewRecordingTransport(nil, &recording, "")
+	require.NoError(t, err)
+	recordTestSession(t, recorder, s.URL)
+
+	require.NotContains(t, recording.String(), testRecordedAccessToken)
+	require.NotContains(t, recording.String(), testRecordedRefreshToken)
+	require.NotContains(t, recording.String(), testRecordedBody)
+	require.NotContains(t, recording.String(), testAttachmentCleartext)
+	require.NotContains(t, recording.String(), testRecordedEmail)
+
+	replay, err := NewReplayTransport(&recording, "")
+	require.NoError(t, err)
+
+	cfg := *testClientConfig
+	cfg.Transport = replay
+	cfg.Routing = NewRouting(s.URL)
+	c := NewClient(&cfg, "tester")
+
+	message, err := c.GetMessage(testRecordedMessageID)
+	require.NoError(t, err)
+	require.Equal(t, "Subject", message.Subject)
+	require.Equal(t, redactedValue, message.Body)
+}
+
+func TestRecordingTransport_Encrypted(t *testing.T) {
+	s := newRecordingTestServer(t)
+
+	var recording bytes.Buffer
+	recorder, err := NewRecordingTransport(nil, &recording, "passphrase")
+	require.NoError(t, err)
+	recordTestSession(t, recorder, s.URL)
+	s.Close()
+
+	require.NotContains(t, recording.String(), testRecordedAccessToken)
+	require.NotContains(t, recording.String(), testRecordedBody)
+	require.NotContains(t, recording.String(), testRecordedEmail)
+
+	_, err = NewReplayTransport(bytes.NewReader(recording.Bytes()), "")
+	require.Error(t, err)
+	_, err = NewReplayTransport(bytes.NewReader(recording.Bytes()), "wrong passphrase")
+	require.Error(t, err)
+
+	replay, err := NewReplayTransport(bytes.NewReader(recording.Bytes()), "passphrase")
+	require.NoError(t, err)
+	recordTestSession(t, replay, s.URL)
+
+	cfg := *testClientConfig
+	cfg.Transport = replay
+	cfg.Routing = NewRouting(s.URL)
+	c := NewClient(&cfg, "tester")
+
+	message, err := c.GetMessage(testRecordedMessageID)
+	require.NoError(t, err)
+	require.Equal(t, testRecordedBody, message.Body)
+
+	att, err := c.GetAttachment(testAttachment.ID)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(att)
+	require.NoError(t, err)
+	require.Equal(t, testAttachmentCleartext, string(data))
+	require.Empty(t, replay.Unmatched())
+
+	// Values of the query are redacted, the request is matched by its names.
+	_, _, err = c.GetPublicKeysForEmail("other@recipient.com")
+	require.NoError(t, err)
+	require.Empty(t, replay.Unmatched())
+
+	_, err = c.GetMessage("unknown")
+	require.Error(t, err)
+	require.Equal(t, []string{"GET /messages/unknown"}, replay.Unmatched())
+}
+
+// recordTestLogin logs in and unlocks the keys. The random reader of SRP is
+// reset so the client proofs are the same every time.
+func recordTestLogin(t *testing.T, transport http.RoundTripper, rootURL string) {
+	srp.RandReader = rand.New(rand.NewSource(42))
+
+	cfg := *testClientConfig
+	cfg.Transport = transport
+	cfg.Routing = NewRouting(rootURL)
+	c := NewClient(&cfg, "tester")
+
+	info, err := c.AuthInfo(testUsername)
+	require.NoError(t, err)
+
+	auth, err := c.Auth(testUsername, testAPIPassword, info)
+	require.NoError(t, err)
+	require.Equal(t, "abc", auth.KeySalt)
+
+	_, err = c.Unlock(testMailboxPassword)
+	require.NoError(t, err)
+}
+
+func TestRecordingTransport_EncryptedLogin(t *testing.T) {
+	finish, c := newTestServerCallbacks(t,
+		func(tb testing.TB, w http.ResponseWriter, r *http.Request) string {
+			require.NoError(t, checkMethodAndPath(r, "POST", "/auth/info"))
+			return "/auth/info/post_response.json"
+		},
+		func(tb testing.TB, w http.ResponseWriter, r *http.Request) string {
+			require.NoError(t, checkMethodAndPath(r, "POST", "/auth"))
+			return "/auth/post_response.json"
+		},
+		routeGetUsers,
+		routeGetAddresses,
+		routeGetSalts,
+	)
+	defer finish()
+
+	var recording bytes.Buffer
+	recorder, err := NewRecordingTransport(nil, &recording, "passphrase")
+	require.NoError(t, err)
+	recordTestLogin(t, recorder, c.routing.RootURL())
+
+	require.NotContains(t, recording.String(), testAccessToken)
+	require.NotContains(t, recording.String(), testRefreshToken)
+
+	replay, err := NewReplayTransport(bytes.NewReader(recording.Bytes()), "passphrase")
+	require.NoError(t, err)
+	recordTestLogin(t, replay, c.routing.RootURL())
+	require.Empty(t, replay.Unmatched())
+}
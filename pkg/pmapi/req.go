@@ -19,15 +19,23 @@ package pmapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"mime/multipart"
 	"net/http"
 )
 
-// NewRequest creates a new request.
+// NewRequest creates a new request. The path is relative to the API root URL
+// which is added by the client sending the request, see ClientConfig.Routing.
 func NewRequest(method, path string, body io.Reader) (req *http.Request, err error) {
-	req, err = http.NewRequest(method, GlobalGetRootURL()+path, body)
+	return NewRequestWithContext(context.Background(), method, path, body)
+}
+
+// NewRequestWithContext creates a new request which is canceled together
+// with the context, including waiting for its retries.
+func NewRequestWithContext(ctx context.Context, method, path string, body io.Reader) (req *http.Request, err error) {
+	req, err = http.NewRequestWithContext(ctx, method, path, body)
 	if req != nil {
 		req.Header.Set("User-Agent", CurrentUserAgent)
 	}
@@ -0,0 +1,285 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrorCategory groups failed API requests by the reason of the failure.
+type ErrorCategory string
+
+// Categories of failed requests. ErrorCategoryNone means success.
+const (
+	ErrorCategoryNone         ErrorCategory = ""
+	ErrorCategoryNetwork      ErrorCategory = "network"
+	ErrorCategoryCanceled     ErrorCategory = "canceled"
+	ErrorCategoryUnauthorized ErrorCategory = "unauthorized"
+	ErrorCategoryRateLimited  ErrorCategory = "rate-limited"
+	ErrorCategoryClient       ErrorCategory = "client"
+	ErrorCategoryServer       ErrorCategory = "server"
+)
+
+// getErrorCategory returns the category of the HTTP status code.
+func getErrorCategory(statusCode int) ErrorCategory {
+	switch {
+	case statusCode == http.StatusUnauthorized:
+		return ErrorCategoryUnauthorized
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorCategoryRateLimited
+	case statusCode >= http.StatusInternalServerError:
+		return ErrorCategoryServer
+	case statusCode >= http.StatusBadRequest:
+		return ErrorCategoryClient
+	}
+	return ErrorCategoryNone
+}
+
+// RequestObservation is the result of one HTTP request sent to the API.
+type RequestObservation struct {
+	Method   string
+	Endpoint string // Path with IDs replaced, see EndpointName.
+
+	// StatusCode is zero when no response was received.
+	StatusCode int
+	Category   ErrorCategory
+
+	// Latency is the time from sending the request to getting response
+	// headers. Time spent waiting in the scheduler is not included.
+	Latency time.Duration
+}
+
+// MetricsCollector receives measurements of API requests. It is shared
+// by all clients, so it has to be safe for concurrent use.
+type MetricsCollector interface {
+	// ObserveRequest is called after each HTTP request, retries included.
+	ObserveRequest(RequestObservation)
+
+	// ObserveRetry is called when the request is going to be sent again.
+	ObserveRetry(method, endpoint string, reason ErrorCategory)
+
+	// ObserveAPIError is called when the API responds with an error code.
+	ObserveAPIError(method, endpoint string, code int)
+}
+
+// EndpointName returns the path with IDs replaced by a placeholder,
+// so all requests of the same kind have the same name.
+func EndpointName(path string) string {
+	segments := strings.Split(path, "/")
+	for idx, segment := range segments {
+		if looksLikeID(segment) {
+			segments[idx] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// looksLikeID returns whether the path segment is an ID and not a name
+// of a resource or an action. API IDs are long base64 strings.
+func looksLikeID(segment string) bool {
+	if len(segment) >= 20 {
+		return true
+	}
+	for _, r := range segment {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return true
+		}
+	}
+	return false
+}
+
+// LatencyBuckets are upper bounds of latency histogram buckets of APIMetrics.
+var LatencyBuckets = []time.Duration{ //nolint[gochecknoglobals]
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+}
+
+// EndpointMetrics are metrics of requests to one endpoint.
+type EndpointMetrics struct {
+	Method   string
+	Endpoint string
+
+	Requests  int
+	Retries   map[ErrorCategory]int
+	Errors    map[ErrorCategory]int
+	APIErrors map[int]int // Count by API code.
+
+	TotalLatency time.Duration
+	MaxLatency   time.Duration
+
+	// LatencyHistogram counts requests by LatencyBuckets. The last item
+	// counts requests slower than the last bucket.
+	LatencyHistogram []int
+}
+
+func newEndpointMetrics(method, endpoint string) *EndpointMetrics {
+	return &EndpointMetrics{
+		Method:           method,
+		Endpoint:         endpoint,
+		Retries:          map[ErrorCategory]int{},
+		Errors:           map[ErrorCategory]int{},
+		APIErrors:        map[int]int{},
+		LatencyHistogram: make([]int, len(LatencyBuckets)+1),
+	}
+}
+
+// MeanLatency returns the average latency of the requests.
+func (em *EndpointMetrics) MeanLatency() time.Duration {
+	if em.Requests == 0 {
+		return 0
+	}
+	return em.TotalLatency / time.Duration(em.Requests)
+}
+
+func (em *EndpointMetrics) copy() *EndpointMetrics {
+	c := *em
+	c.Retries = map[ErrorCategory]int{}
+	for k, v := range em.Retries {
+		c.Retries[k] = v
+	}
+	c.Errors = map[ErrorCategory]int{}
+	for k, v := range em.Errors {
+		c.Errors[k] = v
+	}
+	c.APIErrors = map[int]int{}
+	for k, v := range em.APIErrors {
+		c.APIErrors[k] = v
+	}
+	c.LatencyHistogram = append([]int{}, em.LatencyHistogram...)
+	return &c
+}
+
+// APIMetrics is MetricsCollector which keeps counters and latency
+// histograms of requests per endpoint in memory.
+type APIMetrics struct {
+	lock      sync.Mutex
+	endpoints map[string]*EndpointMetrics
+}
+
+// NewAPIMetrics creates empty metrics.
+func NewAPIMetrics() *APIMetrics {
+	return &APIMetrics{endpoints: map[string]*EndpointMetrics{}}
+}
+
+func (m *APIMetrics) getEndpoint(method, endpoint string) *EndpointMetrics {
+	key := method + " " + endpoint
+	em, ok := m.endpoints[key]
+	if !ok {
+		em = newEndpointMetrics(method, endpoint)
+		m.endpoints[key] = em
+	}
+	return em
+}
+
+// ObserveRequest updates counters and the latency histogram of the endpoint.
+func (m *APIMetrics) ObserveRequest(obs RequestObservation) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	em := m.getEndpoint(obs.Method, obs.Endpoint)
+	em.Requests++
+	if obs.Category != ErrorCategoryNone {
+		em.Errors[obs.Category]++
+	}
+
+	em.TotalLatency += obs.Latency
+	if obs.Latency > em.MaxLatency {
+		em.MaxLatency = obs.Latency
+	}
+	bucket := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return obs.Latency <= LatencyBuckets[i]
+	})
+	em.LatencyHistogram[bucket]++
+}
+
+// ObserveRetry counts the retry of the endpoint.
+func (m *APIMetrics) ObserveRetry(method, endpoint string, reason ErrorCategory) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.getEndpoint(method, endpoint).Retries[reason]++
+}
+
+// ObserveAPIError counts the API error code of the endpoint.
+func (m *APIMetrics) ObserveAPIError(method, endpoint string, code int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.getEndpoint(method, endpoint).APIErrors[code]++
+}
+
+// Snapshot returns a copy of metrics of all endpoints. The slowest ones
+// in total are first, because those are the bottlenecks.
+func (m *APIMetrics) Snapshot() []*EndpointMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	snapshot := []*EndpointMetrics{}
+	for _, em := range m.endpoints {
+		snapshot = append(snapshot, em.copy())
+	}
+	sort.Slice(snapshot, func(i, j int) bool {
+		if snapshot[i].TotalLatency != snapshot[j].TotalLatency {
+			return snapshot[i].TotalLatency > snapshot[j].TotalLatency
+		}
+		return snapshot[i].Method+snapshot[i].Endpoint < snapshot[j].Method+snapshot[j].Endpoint
+	})
+	return snapshot
+}
+
+func (c *Client) observeRequest(ri *requestInstrumentation, statusCode int, category ErrorCategory, latency time.Duration) {
+	if statusCode != 0 {
+		ri.span.SetAttribute("http.status_code", statusCode)
+	}
+	if c.config.Metrics == nil {
+		return
+	}
+	c.config.Metrics.ObserveRequest(RequestObservation{
+		Method:     ri.method,
+		Endpoint:   ri.endpoint,
+		StatusCode: statusCode,
+		Category:   category,
+		Latency:    latency,
+	})
+}
+
+func (c *Client) observeRetry(ri *requestInstrumentation, reason ErrorCategory) {
+	ri.retries++
+	ri.span.SetAttribute("pm.retries", ri.retries)
+	if c.config.Metrics != nil {
+		c.config.Metrics.ObserveRetry(ri.method, ri.endpoint, reason)
+	}
+}
+
+func (c *Client) observeAPIError(ri *requestInstrumentation, code int) {
+	ri.span.SetAttribute("pm.code", code)
+	if c.config.Metrics != nil {
+		c.config.Metrics.ObserveAPIError(ri.method, ri.endpoint, code)
+	}
+}
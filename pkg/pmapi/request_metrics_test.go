@@ -0,0 +1,184 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testMetricsMessageID = "ZvAhYGUnS9Dx-Ub5c2NBSe9iWBDrpT4eTMFRa4uy8uyA6bAVWx_gRLuXN2KTvV8Rb4fCdd3CLtIbzzTBFc4Nmw=="
+
+func newTestMetricsClient(s http.Handler) (func(), *Client, *APIMetrics) {
+	server, c := newTestServer(s)
+	metrics := NewAPIMetrics()
+	cfg := *testClientConfig
+	cfg.Metrics = metrics
+	c.config = &cfg
+	return server.Close, c, metrics
+}
+
+func TestEndpointName(t *testing.T) {
+	tests := map[string]string{
+		"/messages":                         "/messages",
+		"/messages/" + testMetricsMessageID: "/messages/{id}",
+		"/messages/read":                    "/messages/read",
+		"/events/latest":                    "/events/latest",
+		"/events/ACXDmTaBub14w==":           "/events/{id}",
+		"/auth/2fa":                         "/auth/2fa",
+		"/labels/" + testMetricsMessageID:   "/labels/{id}",
+	}
+	for path, want := range tests {
+		require.Equal(t, want, EndpointName(path), path)
+	}
+}
+
+func TestClient_Metrics(t *testing.T) {
+	unauthorized := true
+	closeServer, c, metrics := newTestMetricsClient(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && unauthorized:
+			unauthorized = false
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.Method == http.MethodGet:
+			fmt.Fprint(w, `{"Code": 1000}`)
+		default:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprint(w, `{"Code": 2001, "Error": "Invalid value"}`)
+		}
+	}))
+	defer closeServer()
+
+	req, err := NewRequest("GET", "/messages/"+testMetricsMessageID, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.DoJSON(req, &Res{}))
+
+	req, err = NewRequest("PUT", "/labels/"+testMetricsMessageID, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.DoJSON(req, &Res{}))
+
+	snapshot := metrics.Snapshot()
+	require.Len(t, snapshot, 2)
+	byEndpoint := map[string]*EndpointMetrics{}
+	for _, em := range snapshot {
+		byEndpoint[em.Method+" "+em.Endpoint] = em
+	}
+
+	get := byEndpoint["GET /messages/{id}"]
+	require.NotNil(t, get)
+	require.Equal(t, 2, get.Requests)
+	require.Equal(t, map[ErrorCategory]int{ErrorCategoryUnauthorized: 1}, get.Errors)
+	require.Equal(t, map[ErrorCategory]int{ErrorCategoryUnauthorized: 1}, get.Retries)
+	require.Equal(t, map[int]int{}, get.APIErrors)
+
+	put := byEndpoint["PUT /labels/{id}"]
+	require.NotNil(t, put)
+	require.Equal(t, 1, put.Requests)
+	require.Equal(t, map[ErrorCategory]int{ErrorCategoryClient: 1}, put.Errors)
+	require.Equal(t, map[int]int{2001: 1}, put.APIErrors)
+
+	total := 0
+	for _, count := range get.LatencyHistogram {
+		total += count
+	}
+	require.Equal(t, get.Requests, total)
+}
+
+func TestAPIMetrics_LatencyHistogram(t *testing.T) {
+	metrics := NewAPIMetrics()
+	for _, latency := range []time.Duration{10 * time.Millisecond, 50 * time.Millisecond, 3 * time.Second, time.Minute} {
+		metrics.ObserveRequest(RequestObservation{Method: "GET", Endpoint: "/messages", Latency: latency})
+	}
+	metrics.ObserveRequest(RequestObservation{Method: "GET", Endpoint: "/events/{id}", Latency: time.Millisecond})
+
+	snapshot := metrics.Snapshot()
+	require.Len(t, snapshot, 2)
+	require.Equal(t, "/messages", snapshot[0].Endpoint, "the slowest endpoint is first")
+	require.Equal(t, []int{2, 0, 0, 0, 0, 0, 1, 0, 0, 1}, snapshot[0].LatencyHistogram)
+	require.Equal(t, time.Minute, snapshot[0].MaxLatency)
+	require.Equal(t, (10*time.Millisecond+50*time.Millisecond+3*time.Second+time.Minute)/4, snapshot[0].MeanLatency())
+
+	// Snapshot is not changed by following observations.
+	metrics.ObserveRequest(RequestObservation{Method: "GET", Endpoint: "/messages", Latency: time.Millisecond})
+	require.Equal(t, 4, snapshot[0].Requests)
+}
+
+type testSpanKey struct{}
+
+type testSpan struct {
+	name       string
+	parent     *testSpan
+	attributes map[string]interface{}
+	err        error
+	ended      bool
+}
+
+func (s *testSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *testSpan) RecordError(err error)                      { s.err = err }
+func (s *testSpan) End()                                       { s.ended = true }
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+func (t *testTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	parent, _ := ctx.Value(testSpanKey{}).(*testSpan)
+	span := &testSpan{name: spanName, parent: parent, attributes: map[string]interface{}{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, testSpanKey{}, span), span
+}
+
+func TestClient_Tracing(t *testing.T) {
+	s, c := newTestServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"Code": 2001, "Error": "Invalid value"}`)
+	}))
+	defer s.Close()
+
+	tracer := &testTracer{}
+	cfg := *testClientConfig
+	cfg.Tracer = tracer
+	c.config = &cfg
+
+	ctx, parent := StartSpan(context.Background(), tracer, "IMAP FETCH")
+	req, err := NewRequestWithContext(ctx, "GET", "/messages/"+testMetricsMessageID, nil)
+	require.NoError(t, err)
+	require.NoError(t, c.DoJSON(req, &Res{}))
+	EndSpan(parent, nil)
+
+	require.Len(t, tracer.spans, 2)
+	span := tracer.spans[1]
+	require.Equal(t, "API GET /messages/{id}", span.name)
+	require.Equal(t, tracer.spans[0], span.parent)
+	require.Equal(t, http.StatusUnprocessableEntity, span.attributes["http.status_code"])
+	require.Equal(t, 2001, span.attributes["pm.code"])
+	require.True(t, span.ended)
+	require.True(t, tracer.spans[0].ended)
+}
+
+func TestStartSpan_WithoutTracer(t *testing.T) {
+	ctx := context.Background()
+	spanCtx, span := StartSpan(ctx, nil, "name")
+	require.Equal(t, ctx, spanCtx)
+	EndSpan(span, fmt.Errorf("does not panic"))
+}
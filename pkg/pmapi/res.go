@@ -19,7 +19,8 @@ package pmapi
 
 // Common response codes.
 const (
-	CodeOk = 1000
+	CodeOk         = 1000
+	CodeMultipleOk = 1001 // Response of multiple items with their own codes.
 )
 
 // Res is an API response.
@@ -51,6 +52,7 @@ func (res Res) Err() error {
 
 	return &Error{
 		Code:         res.Code,
+		StatusCode:   res.StatusCode,
 		ErrorMessage: res.ResError.Error,
 	}
 }
@@ -63,6 +65,8 @@ type ResError struct {
 type Error struct {
 	// The error code.
 	Code int
+	// The HTTP status code of the response, if known.
+	StatusCode int `json:"-"`
 	// The error message.
 	ErrorMessage string `json:"Error"`
 }
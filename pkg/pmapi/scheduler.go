@@ -0,0 +1,194 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority of the request in the scheduler.
+type Priority int
+
+// Request priorities. Interactive requests are the default.
+const (
+	PriorityInteractive Priority = iota
+	PriorityBackground
+)
+
+// backgroundPollInterval is how often a background request checks whether
+// interactive requests of the same user are done.
+const backgroundPollInterval = 100 * time.Millisecond
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx for requests with the given priority.
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+func getPriority(ctx context.Context) Priority {
+	if priority, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return priority
+	}
+	return PriorityInteractive
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Scheduler is shared by all clients to keep the request rate of every user
+// within limits and to pause requests of the user when the API asks the user
+// to slow down.
+//
+// Every user has a token bucket. Background requests leave a reserve
+// of tokens for interactive ones and wait while interactive requests
+// of the same user are waiting.
+type Scheduler struct {
+	rate    float64 // Tokens added per second, zero means no limit.
+	burst   float64
+	reserve float64
+
+	lock               sync.Mutex
+	buckets            map[string]*tokenBucket
+	waitingInteractive map[string]int
+	throttledUntil     map[string]time.Time
+
+	// ReportThrottled is called when the API asks to slow down with the time
+	// for which all requests are paused.
+	ReportThrottled func(retryAfter time.Duration)
+
+	now func() time.Time
+}
+
+// NewScheduler creates a scheduler allowing `rate` requests per second
+// and bursts of `burst` requests for each user. Zero rate means requests
+// are not limited and they are only paused when the API asks to slow down.
+func NewScheduler(rate float64, burst int) *Scheduler {
+	return &Scheduler{
+		rate:               rate,
+		burst:              float64(burst),
+		reserve:            float64(burst) / 4,
+		buckets:            map[string]*tokenBucket{},
+		waitingInteractive: map[string]int{},
+		throttledUntil:     map[string]time.Time{},
+		now:                time.Now,
+	}
+}
+
+// ThrottledUntil returns the time until which requests of the user are paused.
+func (s *Scheduler) ThrottledUntil(userID string) time.Time {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.throttledUntil[userID]
+}
+
+// wait blocks until the request of the user can be sent or ctx is done.
+func (s *Scheduler) wait(ctx context.Context, userID string) error {
+	priority := getPriority(ctx)
+
+	if priority == PriorityInteractive {
+		s.lock.Lock()
+		s.waitingInteractive[userID]++
+		s.lock.Unlock()
+
+		defer func() {
+			s.lock.Lock()
+			s.waitingInteractive[userID]--
+			if s.waitingInteractive[userID] == 0 {
+				delete(s.waitingInteractive, userID)
+			}
+			s.lock.Unlock()
+		}()
+	}
+
+	for {
+		delay := s.take(userID, priority)
+		if delay == 0 {
+			return nil
+		}
+		if err := sleepWithContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// take takes a token for the request and returns zero, or returns
+// how long to wait before trying again.
+func (s *Scheduler) take(userID string, priority Priority) time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	if until, ok := s.throttledUntil[userID]; ok {
+		if now.Before(until) {
+			return until.Sub(now)
+		}
+		delete(s.throttledUntil, userID)
+	}
+
+	if priority == PriorityBackground && s.waitingInteractive[userID] > 0 {
+		return backgroundPollInterval
+	}
+
+	if s.rate <= 0 {
+		return 0
+	}
+
+	bucket, ok := s.buckets[userID]
+	if !ok {
+		bucket = &tokenBucket{tokens: s.burst, last: now}
+		s.buckets[userID] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.last).Seconds() * s.rate
+	if bucket.tokens > s.burst {
+		bucket.tokens = s.burst
+	}
+	bucket.last = now
+
+	needed := 1.0
+	if priority == PriorityBackground {
+		needed += s.reserve
+	}
+
+	if bucket.tokens >= needed {
+		bucket.tokens--
+		return 0
+	}
+	return time.Duration((needed - bucket.tokens) / s.rate * float64(time.Second))
+}
+
+// throttle pauses requests of the user for the given time.
+func (s *Scheduler) throttle(userID string, retryAfter time.Duration) {
+	s.lock.Lock()
+	until := s.now().Add(retryAfter)
+	extended := until.After(s.throttledUntil[userID])
+	if extended {
+		s.throttledUntil[userID] = until
+	}
+	report := s.ReportThrottled
+	s.lock.Unlock()
+
+	if extended && report != nil {
+		report(retryAfter)
+	}
+}
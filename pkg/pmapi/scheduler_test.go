@@ -0,0 +1,119 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestScheduler(rate float64, burst int) (*Scheduler, *time.Time) {
+	now := time.Now()
+	s := NewScheduler(rate, burst)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestScheduler_TokenBucket(t *testing.T) {
+	s, now := newTestScheduler(2, 4)
+
+	for i := 0; i < 4; i++ {
+		require.Equal(t, time.Duration(0), s.take("user", PriorityInteractive))
+	}
+	require.Equal(t, 500*time.Millisecond, s.take("user", PriorityInteractive))
+
+	// Other users have their own bucket.
+	require.Equal(t, time.Duration(0), s.take("other", PriorityInteractive))
+
+	*now = now.Add(500 * time.Millisecond)
+	require.Equal(t, time.Duration(0), s.take("user", PriorityInteractive))
+	require.Equal(t, 500*time.Millisecond, s.take("user", PriorityInteractive))
+}
+
+func TestScheduler_BackgroundKeepsReserve(t *testing.T) {
+	s, _ := newTestScheduler(1, 4)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, time.Duration(0), s.take("user", PriorityBackground))
+	}
+	// One token is reserved for interactive requests.
+	require.Equal(t, time.Second, s.take("user", PriorityBackground))
+	require.Equal(t, time.Duration(0), s.take("user", PriorityInteractive))
+}
+
+func TestScheduler_BackgroundWaitsForInteractive(t *testing.T) {
+	s, _ := newTestScheduler(1, 4)
+
+	s.waitingInteractive["user"] = 1
+	require.Equal(t, backgroundPollInterval, s.take("user", PriorityBackground))
+	require.Equal(t, time.Duration(0), s.take("other", PriorityBackground))
+}
+
+func TestScheduler_Throttle(t *testing.T) {
+	s, now := newTestScheduler(10, 10)
+
+	var reported []time.Duration
+	s.ReportThrottled = func(retryAfter time.Duration) {
+		reported = append(reported, retryAfter)
+	}
+
+	s.throttle("user", 5*time.Second)
+	s.throttle("user", time.Second) // Shorter throttle does not change anything.
+	require.Equal(t, []time.Duration{5 * time.Second}, reported)
+	require.Equal(t, now.Add(5*time.Second), s.ThrottledUntil("user"))
+
+	require.Equal(t, 5*time.Second, s.take("user", PriorityInteractive))
+	require.Equal(t, 5*time.Second, s.take("user", PriorityBackground))
+
+	// Other users are not paused.
+	require.Equal(t, time.Time{}, s.ThrottledUntil("other"))
+	require.Equal(t, time.Duration(0), s.take("other", PriorityInteractive))
+
+	*now = now.Add(5 * time.Second)
+	require.Equal(t, time.Duration(0), s.take("user", PriorityInteractive))
+}
+
+func TestScheduler_Unlimited(t *testing.T) {
+	s, _ := newTestScheduler(0, 0)
+
+	for i := 0; i < 100; i++ {
+		require.Equal(t, time.Duration(0), s.take("user", PriorityBackground))
+	}
+
+	s.waitingInteractive["user"] = 1
+	require.Equal(t, backgroundPollInterval, s.take("user", PriorityBackground))
+}
+
+func TestScheduler_WaitCanceled(t *testing.T) {
+	s := NewScheduler(1, 1)
+	s.throttle("user", time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	require.Equal(t, context.DeadlineExceeded, s.wait(ctx, "user"))
+	require.Empty(t, s.waitingInteractive)
+}
+
+func TestWithPriority(t *testing.T) {
+	require.Equal(t, PriorityInteractive, getPriority(context.Background()))
+	require.Equal(t, PriorityBackground, getPriority(WithPriority(context.Background(), PriorityBackground)))
+}
@@ -72,9 +72,10 @@ func Equals(tb testing.TB, exp, act interface{}) {
 // newTestServer is old function and should be replaced everywhere by newTestServerCallbacks.
 func newTestServer(h http.Handler) (*httptest.Server, *Client) {
 	s := httptest.NewServer(h)
-	RootURL = s.URL
 
-	return s, newTestClient()
+	c := newTestClient()
+	c.routing = NewRouting(s.URL)
+	return s, c
 }
 
 func newTestServerCallbacks(tb testing.TB, callbacks ...func(testing.TB, http.ResponseWriter, *http.Request) string) (func(), *Client) {
@@ -95,7 +96,6 @@ func newTestServerCallbacks(tb testing.TB, callbacks ...func(testing.TB, http.Re
 			writeJSONResponsefromFile(tb, w, response, reqNum-1)
 		}
 	}))
-	RootURL = server.URL
 	finish := func() {
 		server.CloseClientConnections() // Closing without waiting for finishing requests.
 		if reqNum != len(callbacks) {
@@ -106,7 +106,9 @@ func newTestServerCallbacks(tb testing.TB, callbacks ...func(testing.TB, http.Re
 			tb.Error("server failed")
 		}
 	}
-	return finish, newTestClient()
+	c := newTestClient()
+	c.routing = NewRouting(server.URL)
+	return finish, c
 }
 
 func checkMethodAndPath(r *http.Request, method, path string) error {
@@ -0,0 +1,102 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"context"
+	"net/http"
+)
+
+// Tracer starts spans of traced operations. The interface follows
+// OpenTelemetry, so its tracer can be plugged in with a thin adapter.
+type Tracer interface {
+	// Start starts a span which is a child of the span in ctx, if there
+	// is any. The returned context contains the new span.
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span is one traced operation.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	RecordError(err error)
+	End()
+}
+
+// StartSpan starts a span using the tracer. Without tracer, the context
+// is returned as it is together with a span which does nothing.
+func StartSpan(ctx context.Context, tracer Tracer, spanName string) (context.Context, Span) {
+	if tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return tracer.Start(ctx, spanName)
+}
+
+// EndSpan records the error, if any, and ends the span.
+func EndSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) RecordError(error)                {}
+func (noopSpan) End()                             {}
+
+type requestInstrumentationKey struct{}
+
+// requestInstrumentation is kept in the context of the request so that all
+// attempts of the request are measured under the same endpoint and span.
+type requestInstrumentation struct {
+	method   string
+	endpoint string
+	span     Span
+	retries  int
+}
+
+// instrumentRequest starts the span of the request. The endpoint is taken
+// before the root URL is added to the path.
+func (c *Client) instrumentRequest(req *http.Request) (*http.Request, Span) {
+	endpoint := EndpointName(req.URL.Path)
+
+	ctx, span := StartSpan(req.Context(), c.config.Tracer, "API "+req.Method+" "+endpoint)
+	span.SetAttribute("http.method", req.Method)
+	span.SetAttribute("http.route", endpoint)
+
+	ctx = context.WithValue(ctx, requestInstrumentationKey{}, &requestInstrumentation{
+		method:   req.Method,
+		endpoint: endpoint,
+		span:     span,
+	})
+	return req.WithContext(ctx), span
+}
+
+// getRequestInstrumentation returns the instrumentation of the request.
+// Requests which were not instrumented get one without a span.
+func getRequestInstrumentation(req *http.Request) *requestInstrumentation {
+	if ri, ok := req.Context().Value(requestInstrumentationKey{}).(*requestInstrumentation); ok {
+		return ri
+	}
+	return &requestInstrumentation{
+		method:   req.Method,
+		endpoint: EndpointName(req.URL.Path),
+		span:     noopSpan{},
+	}
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package pmapi
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// Schemes of proxies which can be set by the user.
+const (
+	UserProxySchemeHTTP   = "http"
+	UserProxySchemeSOCKS5 = "socks5"
+)
+
+// ParseUserProxy validates the proxy URL in format scheme://[user:password@]host:port
+// where scheme is http (HTTP CONNECT) or socks5.
+func ParseUserProxy(rawURL string) (*url.URL, error) {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy URL")
+	}
+
+	if proxyURL.Scheme != UserProxySchemeHTTP && proxyURL.Scheme != UserProxySchemeSOCKS5 {
+		return nil, fmt.Errorf("unsupported proxy scheme %q, use %s or %s", proxyURL.Scheme, UserProxySchemeHTTP, UserProxySchemeSOCKS5)
+	}
+	if proxyURL.Hostname() == "" || proxyURL.Port() == "" {
+		return nil, errors.New("proxy URL must contain host and port")
+	}
+	if proxyURL.Path != "" && proxyURL.Path != "/" {
+		return nil, errors.New("proxy URL must not contain path")
+	}
+
+	return proxyURL, nil
+}
+
+// SetUserProxy sets the proxy for all connections to the API. Empty URL
+// disables the proxy. When it is set, alternative routing is not used.
+func (r *Routing) SetUserProxy(rawURL string) error {
+	var proxyURL *url.URL
+	if rawURL != "" {
+		var err error
+		if proxyURL, err = ParseUserProxy(rawURL); err != nil {
+			return err
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	changed := r.userProxy != proxyURL
+	if r.userProxy != nil && proxyURL != nil {
+		changed = r.userProxy.String() != proxyURL.String()
+	}
+	if changed {
+		r.userProxyChanges++
+	}
+	r.userProxy = proxyURL
+
+	// Alternative routing found without the proxy is not needed anymore.
+	if proxyURL != nil {
+		r.rootURL = r.originalURL
+	}
+
+	return nil
+}
+
+// getUserProxy returns the proxy set by the user, nil if not set.
+func (r *Routing) getUserProxy() *url.URL {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.userProxy
+}
+
+// getUserProxyChanges returns how many times the user proxy was changed.
+func (r *Routing) getUserProxyChanges() uint32 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.userProxyChanges
+}
+
+// proxyForRequest is used by the transport with pinning. HTTPS connections
+// through the user proxy are dialled by DialerWithPinning itself to keep
+// the certificate pinning in force.
+func (r *Routing) proxyForRequest(req *http.Request) (*url.URL, error) {
+	proxyURL := r.getUserProxy()
+	if proxyURL == nil {
+		return http.ProxyFromEnvironment(req)
+	}
+	if req.URL.Scheme == "https" {
+		return nil, nil
+	}
+	return proxyURL, nil
+}
+
+// userProxyOrEnvironment is used by requests which are not pinned.
+func (r *Routing) userProxyOrEnvironment(req *http.Request) (*url.URL, error) {
+	if proxyURL := r.getUserProxy(); proxyURL != nil {
+		return proxyURL, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// dialTLSThroughProxy returns TLS connection to the address tunnelled through the proxy.
+func dialTLSThroughProxy(dialer *net.Dialer, proxyURL *url.URL, network, address string, tlsConfig *tls.Config) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := dialThroughProxy(dialer, proxyURL, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{}
+	if tlsConfig != nil {
+		config = tlsConfig.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+
+	tlsConn := tls.Client(conn, config)
+	if dialer.Timeout != 0 {
+		_ = tlsConn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
+
+// dialThroughProxy returns connection to the address tunnelled through the proxy.
+func dialThroughProxy(dialer *net.Dialer, proxyURL *url.URL, network, address string) (net.Conn, error) {
+	switch proxyURL.Scheme {
+	case UserProxySchemeSOCKS5:
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		socksDialer, err := proxy.SOCKS5("tcp", proxyURL.Host, auth, dialer)
+		if err != nil {
+			return nil, err
+		}
+		return socksDialer.Dial(network, address)
+
+	case UserProxySchemeHTTP:
+		return dialHTTPConnect(dialer, proxyURL, address)
+
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+// dialHTTPConnect opens the tunnel using HTTP CONNECT method.
+func dialHTTPConnect(dialer *net.Dialer, proxyURL *url.URL, address string) (net.Conn, error) {
+	conn, err := dialer.Dial("tcp", proxyURL.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: http.Header{},
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+
+	if dialer.Timeout != 0 {
+		_ = conn.SetDeadline(time.Now().Add(dialer.Timeout))
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	// The server does not send anything after the response until
+	// the client starts TLS handshake, so nothing is lost by buffering.
+	res, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	// The body of successful response is the tunnel, it must not be closed.
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		_ = conn.Close()
+		return nil, fmt.Errorf("proxy refused connection: %s", res.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
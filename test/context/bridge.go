@@ -39,6 +39,7 @@ func (ctx *TestContext) withBridgeInstance() {
 	}
 	ctx.bridge = newBridgeInstance(ctx.t, ctx.cfg, ctx.credStore, ctx.listener, pmapiFactory)
 	ctx.addCleanupChecked(ctx.bridge.ClearData, "Cleaning bridge data")
+	ctx.addCleanup(ctx.bridge.Shutdown, "Stopping bridge background jobs")
 }
 
 // RestartBridge closes store for each user and recreates a bridge instance the same way as `withBridgeInstance`.
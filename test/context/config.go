@@ -22,7 +22,9 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/ProtonMail/proton-bridge/pkg/config"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
@@ -56,6 +58,13 @@ func (c *fakeConfig) GetAPIConfig() *pmapi.ClientConfig {
 		TokenManager: c.tm,
 	}
 }
+func (c *fakeConfig) GetSendRecorderConfig() config.SendRecorderConfig {
+	return config.SendRecorderConfig{
+		Expiration:     30 * time.Minute,
+		SendingTimeout: 10 * time.Minute,
+		WaitTimeout:    60 * time.Second,
+	}
+}
 func (c *fakeConfig) GetDBDir() string {
 	return c.dir
 }
@@ -74,6 +83,9 @@ func (c *fakeConfig) GetTLSCertPath() string {
 func (c *fakeConfig) GetTLSKeyPath() string {
 	return filepath.Join(c.dir, "key.pem")
 }
+func (c *fakeConfig) GetOutgoingRulesPath() string {
+	return filepath.Join(c.dir, "outgoing_rules.json")
+}
 func (c *fakeConfig) GetEventsPath() string {
 	return filepath.Join(c.dir, "events.json")
 }
@@ -87,6 +87,11 @@ func New() *TestContext {
 	// Ensure that the config is cleaned up after the test is over.
 	ctx.addCleanupChecked(cfg.ClearData, "Cleaning bridge config data")
 
+	// Fake API server has to be stopped after the test as well.
+	if closer, ok := ctx.pmapiController.(interface{ Close() }); ok {
+		ctx.addCleanup(closer.Close, "Closing fake API server")
+	}
+
 	// Create bridge instance under test.
 	ctx.withBridgeInstance()
 
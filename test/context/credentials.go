@@ -27,7 +27,8 @@ import (
 const bridgePassword = "bridgepassword"
 
 type fakeCredStore struct {
-	credentials map[string]*credentials.Credentials
+	credentials   map[string]*credentials.Credentials
+	proxyPassword string
 }
 
 // newFakeCredStore returns a fake credentials store (optionally configured with the given credentials).
@@ -77,6 +78,10 @@ func (c *fakeCredStore) SwitchAddressMode(userID string) error {
 	return nil
 }
 
+func (c *fakeCredStore) SetAddressGroups(userID string, groups [][]string) error {
+	return nil
+}
+
 func (c *fakeCredStore) UpdateEmails(userID string, emails []string) error {
 	return nil
 }
@@ -100,3 +105,12 @@ func (c *fakeCredStore) Delete(userID string) error {
 	delete(c.credentials, userID)
 	return nil
 }
+
+func (c *fakeCredStore) GetProxyPassword() (string, error) {
+	return c.proxyPassword, nil
+}
+
+func (c *fakeCredStore) SetProxyPassword(password string) error {
+	c.proxyPassword = password
+	return nil
+}
@@ -23,14 +23,23 @@ import (
 )
 
 const (
-	EnvName = "TEST_ENV"
-	EnvFake = "fake"
-	EnvLive = "live"
+	EnvName     = "TEST_ENV"
+	EnvFake     = "fake"
+	EnvFakeHTTP = "fakehttp"
+	EnvLive     = "live"
+
+	// EnvAPIRecord is the file to which the fakehttp environment records
+	// all API traffic, and EnvAPIReplay is the recording which it replays
+	// instead of using the fake API server. Recordings are encrypted by
+	// EnvAPIPassphrase if set, otherwise contents of messages are redacted.
+	EnvAPIRecord     = "TEST_API_RECORD"
+	EnvAPIReplay     = "TEST_API_REPLAY"
+	EnvAPIPassphrase = "TEST_API_PASSPHRASE"
 )
 
 func (ctx *TestContext) EventLoopTimeout() time.Duration {
 	switch os.Getenv(EnvName) {
-	case EnvFake:
+	case EnvFake, EnvFakeHTTP:
 		return 5 * time.Second
 	case EnvLive:
 		return 60 * time.Second
@@ -18,12 +18,15 @@
 package context
 
 import (
+	"fmt"
+	"net/http"
 	"os"
 
 	"github.com/ProtonMail/proton-bridge/internal/bridge"
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 	"github.com/ProtonMail/proton-bridge/test/fakeapi"
 	"github.com/ProtonMail/proton-bridge/test/liveapi"
+	"github.com/sirupsen/logrus"
 )
 
 type PMAPIController interface {
@@ -44,6 +47,8 @@ func newPMAPIController() PMAPIController {
 	switch os.Getenv(EnvName) {
 	case EnvFake:
 		return newFakePMAPIController()
+	case EnvFakeHTTP:
+		return newFakeHTTPPMAPIController()
 	case EnvLive:
 		return newLivePMAPIController()
 	default:
@@ -67,6 +72,80 @@ func (s *fakePMAPIControllerWrap) GetClient(userID string) bridge.PMAPIProvider
 	return s.Controller.GetClient(userID)
 }
 
+// fakeHTTPPMAPIControllerWrap uses the state of the fake controller
+// served over HTTP to the real pmapi client.
+type fakeHTTPPMAPIControllerWrap struct {
+	*fakeapi.Controller
+	server       *fakeapi.Server
+	tokenManager *pmapi.TokenManager
+	routing      *pmapi.Routing
+	transport    http.RoundTripper
+	recording    *os.File
+}
+
+func newFakeHTTPPMAPIController() PMAPIController {
+	controller := fakeapi.NewController()
+	server := fakeapi.NewServer(controller)
+
+	s := &fakeHTTPPMAPIControllerWrap{
+		Controller:   controller,
+		server:       server,
+		tokenManager: pmapi.NewTokenManager(),
+		routing:      pmapi.NewRouting(server.URL()),
+	}
+	if err := s.setupTransport(); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// setupTransport makes clients record API traffic or replay it
+// instead of using the server, see EnvAPIRecord and EnvAPIReplay.
+func (s *fakeHTTPPMAPIControllerWrap) setupTransport() (err error) {
+	passphrase := os.Getenv(EnvAPIPassphrase)
+
+	if path := os.Getenv(EnvAPIReplay); path != "" {
+		var f *os.File
+		if f, err = os.Open(path); err != nil { //nolint[gosec]
+			return err
+		}
+		defer f.Close() //nolint[errcheck]
+
+		s.transport, err = pmapi.NewReplayTransport(f, passphrase)
+		return err
+	}
+
+	if path := os.Getenv(EnvAPIRecord); path != "" {
+		if s.recording, err = os.Create(path); err != nil {
+			return err
+		}
+		s.transport, err = pmapi.NewRecordingTransport(nil, s.recording, passphrase)
+	}
+
+	return err
+}
+
+func (s *fakeHTTPPMAPIControllerWrap) GetClient(userID string) bridge.PMAPIProvider {
+	return pmapi.NewClient(&pmapi.ClientConfig{
+		AppVersion:   fmt.Sprintf("Bridge_%s", os.Getenv("VERSION")),
+		ClientID:     "bridge",
+		TokenManager: s.tokenManager,
+		Transport:    s.transport,
+		Routing:      s.routing,
+	}, userID)
+}
+
+func (s *fakeHTTPPMAPIControllerWrap) Close() {
+	s.server.Close()
+
+	if s.recording != nil {
+		_ = s.recording.Close()
+	}
+	if replay, ok := s.transport.(*pmapi.ReplayTransport); ok && len(replay.Unmatched()) > 0 {
+		logrus.WithField("requests", replay.Unmatched()).Warn("Requests missing in API recording")
+	}
+}
+
 func newLivePMAPIController() PMAPIController {
 	return newLiveAPIControllerWrap(liveapi.NewController())
 }
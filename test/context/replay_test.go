@@ -0,0 +1,104 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package context
+
+import (
+	"net/mail"
+	"os"
+	"testing"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+// testReplayRecording is the API traffic of TestReplaySyncAndFetch recorded
+// against the fake API server. Run the test with TEST_API_RECORD set to this
+// path to record it again.
+const (
+	testReplayRecording  = "testdata/sync_and_fetch.recording"
+	testReplayPassphrase = "replay test passphrase"
+)
+
+// setTestEnv sets the environment variable and returns function restoring
+// its previous value.
+func setTestEnv(t *testing.T, name, value string) func() {
+	old, ok := os.LookupEnv(name)
+	require.NoError(t, os.Setenv(name, value))
+	return func() {
+		if ok {
+			_ = os.Setenv(name, old)
+		} else {
+			_ = os.Unsetenv(name)
+		}
+	}
+}
+
+func TestReplaySyncAndFetch(t *testing.T) {
+	for name, value := range map[string]string{
+		EnvName:          EnvFakeHTTP,
+		EnvAPIPassphrase: testReplayPassphrase,
+		"TEST_ACCOUNTS":  "../accounts/fake.json",
+		"TEST_DATA":      "../testdata",
+		"VERSION":        "1.2.5-integrationtest",
+		"VERBOSITY":      "fatal",
+	} {
+		defer setTestEnv(t, name, value)()
+	}
+	if os.Getenv(EnvAPIRecord) == "" {
+		defer setTestEnv(t, EnvAPIReplay, testReplayRecording)()
+	}
+
+	ctx := New()
+	defer ctx.Cleanup()
+
+	account := ctx.GetTestAccount("user")
+	require.NotNil(t, account)
+	controller := ctx.GetPMAPIController()
+	require.NoError(t, controller.AddUser(account.User(), account.Addresses(), account.Password(), account.IsTwoFAEnabled()))
+
+	labelIDs, err := controller.GetLabelIDs(account.Username(), []string{"INBOX"})
+	require.NoError(t, err)
+	require.NoError(t, controller.AddUserMessage(account.Username(), &pmapi.Message{
+		MIMEType:  "text/plain",
+		LabelIDs:  labelIDs,
+		AddressID: account.AddressID(),
+		Sender:    &mail.Address{Address: "john.doe@mail.com"},
+		ToList:    []*mail.Address{{Address: account.Address()}},
+		Subject:   "Replayed message",
+		Header:    mail.Header{"Subject": {"Replayed message"}},
+		Body:      "Hello from the recording",
+	}))
+
+	require.NoError(t, ctx.LoginUser(account.Username(), account.Password(), account.MailboxPassword()))
+	require.NoError(t, ctx.WaitForSync(account.Username()))
+
+	mailbox, err := ctx.GetStoreMailbox(account.Username(), account.AddressID(), "INBOX")
+	require.NoError(t, err)
+	total, _, err := mailbox.GetCounts()
+	require.NoError(t, err)
+	require.Equal(t, uint(1), total)
+
+	client := ctx.GetIMAPClient("imap")
+	client.Login(account.Address(), account.BridgePassword()).AssertOK()
+	client.Select("INBOX").AssertOK()
+	client.FetchAllBodies().
+		AssertOK().
+		AssertSections(`Subject: Replayed message`, `Hello from the recording`)
+
+	require.NoError(t, ctx.GetTestingError())
+}
@@ -59,7 +59,7 @@ func (ctx *TestContext) withSMTPServer() {
 	port := pref.GetInt(preferences.SMTPPortKey)
 	useSSL := pref.GetBool(preferences.SMTPSSLKey)
 
-	backend := smtp.NewSMTPBackend(ph, ctx.listener, pref, ctx.bridge)
+	backend := smtp.NewSMTPBackend(ph, ctx.listener, pref, ctx.cfg, ctx.bridge)
 	server := smtp.NewSMTPServer(true, port, useSSL, tls, backend, ctx.listener)
 
 	go server.ListenAndServe()
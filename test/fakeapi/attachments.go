@@ -18,6 +18,7 @@
 package fakeapi
 
 import (
+	"context"
 	"encoding/base64"
 	"io"
 	"io/ioutil"
@@ -26,6 +27,13 @@ import (
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
+func (api *FakePMAPI) GetAttachmentContext(ctx context.Context, attachmentID string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return api.GetAttachment(attachmentID)
+}
+
 func (api *FakePMAPI) GetAttachment(attachmentID string) (io.ReadCloser, error) {
 	if err := api.checkAndRecordCall(GET, "/attachments/"+attachmentID, nil); err != nil {
 		return nil, err
@@ -42,6 +42,19 @@ func (api *FakePMAPI) GetContactEmailByEmail(email string, page int, pageSize in
 	return []pmapi.ContactEmail{}, nil
 }
 
+func (api *FakePMAPI) GetContactEmailsByGroup(groupID string, page int, pageSize int) ([]pmapi.ContactEmail, error) {
+	v := url.Values{}
+	v.Set("Page", strconv.Itoa(page))
+	if pageSize > 0 {
+		v.Set("PageSize", strconv.Itoa(pageSize))
+	}
+	v.Set("LabelID", groupID)
+	if err := api.checkAndRecordCall(GET, "/contacts/emails?"+v.Encode(), nil); err != nil {
+		return nil, err
+	}
+	return []pmapi.ContactEmail{}, nil
+}
+
 func (api *FakePMAPI) GetContactByID(contactID string) (pmapi.Contact, error) {
 	if err := api.checkAndRecordCall(GET, "/contacts/"+contactID, nil); err != nil {
 		return pmapi.Contact{}, err
@@ -60,10 +60,20 @@ func (cntrl *Controller) AddUserLabel(username string, label *pmapi.Label) error
 	}
 
 	labelName := getLabelNameWithoutPrefix(label.Name)
-	for _, existingLabel := range cntrl.labelsByUsername[username] {
-		if existingLabel.Name == labelName {
-			return fmt.Errorf("folder or label %s already exists", label.Name)
+	if _, err := cntrl.getLabelID(username, label.Name); err == nil {
+		return fmt.Errorf("folder or label %s already exists", label.Name)
+	}
+
+	// Nested labels are under its parent which has to exist already.
+	label.ParentID = ""
+	if idx := strings.LastIndex(labelName, pmapi.LabelPathDelimiter); idx >= 0 {
+		parentName := label.Name[:len(label.Name)-len(labelName)+idx]
+		parentID, err := cntrl.getLabelID(username, parentName)
+		if err != nil {
+			return err
 		}
+		label.ParentID = parentID
+		labelName = labelName[idx+len(pmapi.LabelPathDelimiter):]
 	}
 
 	label.Exclusive = getLabelExclusive(label.Name)
@@ -95,8 +105,9 @@ func (cntrl *Controller) getLabelID(username, labelName string) (string, error)
 		return labelID, nil
 	}
 	labelName = getLabelNameWithoutPrefix(labelName)
-	for _, label := range cntrl.labelsByUsername[username] {
-		if label.Name == labelName {
+	labels := cntrl.labelsByUsername[username]
+	for _, label := range labels {
+		if pmapi.LabelPath(labels, label) == labelName {
 			return label.ID, nil
 		}
 	}
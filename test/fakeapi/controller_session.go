@@ -22,9 +22,9 @@ import (
 )
 
 type fakeSession struct {
-	username          string
-	uid, refreshToken string
-	hasFullScope      bool
+	username                       string
+	uid, accessToken, refreshToken string
+	hasFullScope                   bool
 }
 
 var errWrongNameOrPassword = errors.New("Incorrect login credentials. Please try again") //nolint[stylecheck]
@@ -49,6 +49,7 @@ func (cntrl *Controller) createSessionIfAuthorized(username, password string) (*
 }
 
 func (cntrl *Controller) refreshTheTokensForSession(session *fakeSession) {
+	session.accessToken = cntrl.tokenGenerator.next("access")
 	session.refreshToken = cntrl.tokenGenerator.next("refresh")
 }
 
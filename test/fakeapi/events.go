@@ -18,9 +18,18 @@
 package fakeapi
 
 import (
+	"context"
+
 	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
 )
 
+func (api *FakePMAPI) GetEventContext(ctx context.Context, eventID string) (*pmapi.Event, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return api.GetEvent(eventID)
+}
+
 func (api *FakePMAPI) GetEvent(eventID string) (*pmapi.Event, error) {
 	if err := api.checkAndRecordCall(GET, "/events/"+eventID, nil); err != nil {
 		return nil, err
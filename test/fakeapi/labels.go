@@ -39,12 +39,19 @@ func (api *FakePMAPI) ListLabels() ([]*pmapi.Label, error) {
 	return api.labels, nil
 }
 
+func (api *FakePMAPI) ListContactGroups() ([]*pmapi.Label, error) {
+	if err := api.checkAndRecordCall(GET, "/labels/2", nil); err != nil {
+		return nil, err
+	}
+	return []*pmapi.Label{}, nil
+}
+
 func (api *FakePMAPI) CreateLabel(label *pmapi.Label) (*pmapi.Label, error) {
 	if err := api.checkAndRecordCall(POST, "/labels", &pmapi.LabelReq{Label: label}); err != nil {
 		return nil, err
 	}
 	for _, existingLabel := range api.labels {
-		if existingLabel.Name == label.Name {
+		if existingLabel.Name == label.Name && existingLabel.ParentID == label.ParentID {
 			return nil, fmt.Errorf("folder or label %s already exists", label.Name)
 		}
 	}
@@ -79,12 +86,28 @@ func (api *FakePMAPI) DeleteLabel(labelID string) error {
 	if err := api.checkAndRecordCall(DELETE, "/labels/"+labelID, nil); err != nil {
 		return err
 	}
+	for _, existingLabel := range api.labels {
+		if existingLabel.ID == labelID {
+			api.deleteLabelWithChildren(labelID)
+			return nil
+		}
+	}
+	return fmt.Errorf("label %s does not exist", labelID)
+}
+
+// deleteLabelWithChildren deletes the label and all nested labels
+// the same way as the API does.
+func (api *FakePMAPI) deleteLabelWithChildren(labelID string) {
+	for _, existingLabel := range api.labels {
+		if existingLabel.ParentID == labelID {
+			api.deleteLabelWithChildren(existingLabel.ID)
+		}
+	}
 	for idx, existingLabel := range api.labels {
 		if existingLabel.ID == labelID {
 			api.labels = append(api.labels[:idx], api.labels[idx+1:]...)
 			api.addEventLabel(pmapi.EventDelete, existingLabel)
-			return nil
+			return
 		}
 	}
-	return fmt.Errorf("label %s does not exist", labelID)
 }
@@ -19,6 +19,7 @@ package fakeapi
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/mail"
 	"time"
@@ -29,6 +30,13 @@ import (
 
 var errWasNotUpdated = errors.New("message was not updated")
 
+func (api *FakePMAPI) GetMessageContext(ctx context.Context, apiID string) (*pmapi.Message, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return api.GetMessage(apiID)
+}
+
 func (api *FakePMAPI) GetMessage(apiID string) (*pmapi.Message, error) {
 	if err := api.checkAndRecordCall(GET, "/messages/"+apiID, nil); err != nil {
 		return nil, err
@@ -41,6 +49,13 @@ func (api *FakePMAPI) GetMessage(apiID string) (*pmapi.Message, error) {
 	return nil, fmt.Errorf("message %s not found", apiID)
 }
 
+func (api *FakePMAPI) ListMessagesContext(ctx context.Context, filter *pmapi.MessagesFilter) ([]*pmapi.Message, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	return api.ListMessages(filter)
+}
+
 // ListMessages does not implement following filters:
 //  * Sort (it sorts by ID only), but Desc works
 //  * Keyword
@@ -0,0 +1,260 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/sirupsen/logrus"
+)
+
+// API codes returned by the server.
+const (
+	codeInvalidValue        = 2001
+	codeNotFound            = 2501
+	codeWrongCredentials    = 8002
+	codeInvalidRefreshToken = 10013
+)
+
+// Server serves the state of the controller over HTTP, so the whole stack
+// including the real pmapi.Client can be tested without the live API.
+// All requests are handled by FakePMAPI instances, one per session, so
+// the calls are recorded by the controller the same way as in-process.
+type Server struct {
+	controller *Controller
+	server     *httptest.Server
+
+	lock        sync.Mutex
+	apisByUID   map[string]*FakePMAPI
+	srpSessions map[string]*srpSession
+	keys        map[string]string // Armored private key by username.
+
+	faultsLock sync.Mutex
+	faults     []*Fault
+
+	log *logrus.Entry
+}
+
+// NewServer starts the server. Use routing to the server URL
+// in pmapi.ClientConfig to make clients use it.
+func NewServer(controller *Controller) *Server {
+	s := &Server{
+		controller:  controller,
+		apisByUID:   map[string]*FakePMAPI{},
+		srpSessions: map[string]*srpSession{},
+		keys:        map[string]string{},
+		log:         logrus.WithField("pkg", "fakeapi-server"),
+	}
+	s.server = httptest.NewServer(s)
+	return s
+}
+
+// URL returns the root URL of the API.
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Close shuts down the server and closes all connections.
+func (s *Server) Close() {
+	s.server.CloseClientConnections()
+	s.server.Close()
+}
+
+// ExpireAccessTokens invalidates access tokens of all sessions. Clients
+// have to refresh them using their refresh tokens.
+func (s *Server) ExpireAccessTokens() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, session := range s.controller.sessionsByUID {
+		session.accessToken = ""
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.log.WithField(r.Method, r.URL.RequestURI()).Trace("REQUEST")
+
+	if s.applyFaults(w, r) {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.controller.noInternetConnection {
+		disconnect(w)
+		return
+	}
+
+	switch r.URL.Path {
+	case "/auth/info":
+		s.handleAuthInfo(w, r)
+		return
+	case "/auth":
+		if r.Method == http.MethodPost {
+			s.handleAuth(w, r)
+			return
+		}
+	case "/auth/refresh":
+		s.handleAuthRefresh(w, r)
+		return
+	}
+
+	api, ok := s.authorizedAPI(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, http.StatusUnauthorized, "Invalid access token")
+		return
+	}
+
+	s.route(api, w, r)
+}
+
+// authorizedAPI returns the API of the session the request belongs to
+// if the access token is valid.
+func (s *Server) authorizedAPI(r *http.Request) (*FakePMAPI, bool) {
+	uid := r.Header.Get("x-pm-uid")
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	api, ok := s.apisByUID[uid]
+	if !ok {
+		return nil, false
+	}
+	session, ok := s.controller.sessionsByUID[uid]
+	if !ok || session.accessToken == "" || session.accessToken != accessToken {
+		return nil, false
+	}
+	return api, true
+}
+
+func (s *Server) route(api *FakePMAPI, w http.ResponseWriter, r *http.Request) { //nolint[gocyclo]
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/auth/2fa":
+		s.handleAuth2FA(api, w, r)
+	case r.Method == http.MethodDelete && r.URL.Path == "/auth":
+		s.handleLogout(api, w)
+
+	case r.Method == http.MethodGet && r.URL.Path == "/users":
+		s.handleGetUser(api, w)
+	case r.Method == http.MethodGet && r.URL.Path == "/addresses":
+		s.handleGetAddresses(api, w)
+	case r.Method == http.MethodGet && r.URL.Path == "/keys/salts":
+		s.handleGetKeySalts(api, w)
+	case r.Method == http.MethodGet && r.URL.Path == "/keys":
+		s.handleGetPublicKeys(api, w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/settings/mail":
+		s.handleGetMailSettings(api, w)
+
+	case r.Method == http.MethodGet && path[0] == "events" && len(path) == 2:
+		s.handleGetEvent(api, w, path[1])
+
+	case r.Method == http.MethodGet && r.URL.Path == "/messages":
+		s.handleListMessages(api, w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/messages/count":
+		s.handleCountMessages(api, w, r)
+	case r.Method == http.MethodGet && path[0] == "messages" && len(path) == 2:
+		s.handleGetMessage(api, w, path[1])
+	case r.Method == http.MethodPost && r.URL.Path == "/messages":
+		s.handleCreateDraft(api, w, r)
+	case r.Method == http.MethodPost && path[0] == "messages" && len(path) == 2:
+		s.handleSendMessage(api, w, r, path[1])
+	case r.Method == http.MethodPut && path[0] == "messages" && len(path) == 2:
+		s.handleMessagesAction(api, w, r, path[1])
+	case r.Method == http.MethodDelete && r.URL.Path == "/messages/empty":
+		s.handleEmptyFolder(api, w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/import":
+		s.handleImport(api, w, r)
+
+	case r.Method == http.MethodGet && r.URL.Path == "/labels":
+		s.handleListLabels(api, w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/labels":
+		s.handleCreateLabel(api, w, r)
+	case r.Method == http.MethodPut && path[0] == "labels" && len(path) == 2:
+		s.handleUpdateLabel(api, w, r, path[1])
+	case r.Method == http.MethodDelete && path[0] == "labels" && len(path) == 2:
+		s.handleDeleteLabel(api, w, path[1])
+
+	case r.Method == http.MethodGet && path[0] == "attachments" && len(path) == 2:
+		s.handleGetAttachment(api, w, path[1])
+	case r.Method == http.MethodPost && r.URL.Path == "/attachments":
+		s.handleCreateAttachment(api, w, r)
+
+	case r.Method == http.MethodGet && r.URL.Path == "/contacts/emails":
+		s.handleGetContactEmails(api, w, r)
+	case r.Method == http.MethodGet && path[0] == "contacts" && len(path) == 2:
+		s.handleGetContact(api, w, path[1])
+
+	default:
+		writeError(w, http.StatusNotFound, codeNotFound, "Route "+r.Method+" "+r.URL.Path+" does not exist")
+	}
+}
+
+// writeResponse writes successful response. Armored keys in the response
+// must not be escaped, pmapi reads them as they are.
+func writeResponse(w http.ResponseWriter, res interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(res)
+}
+
+func writeError(w http.ResponseWriter, status, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(&pmapi.Res{
+		Code:     code,
+		ResError: &pmapi.ResError{Error: message},
+	})
+}
+
+// writeAPIError translates the error of FakePMAPI to the HTTP response
+// the real API would send.
+func writeAPIError(w http.ResponseWriter, err error) {
+	switch err {
+	case pmapi.ErrAPINotReachable:
+		disconnect(w)
+	case pmapi.ErrInvalidToken:
+		writeError(w, http.StatusUnauthorized, http.StatusUnauthorized, "Invalid access token")
+	default:
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidValue, err.Error())
+	}
+}
+
+// disconnect closes the connection without any response.
+func disconnect(w http.ResponseWriter) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		panic("fakeapi: connection cannot be hijacked")
+	}
+	conn, _, err := hijacker.Hijack()
+	if err != nil {
+		panic(err)
+	}
+	_ = conn.Close()
+}
+
+func okRes() pmapi.Res {
+	return pmapi.Res{Code: pmapi.CodeOk}
+}
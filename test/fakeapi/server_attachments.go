@@ -0,0 +1,71 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+func (s *Server) handleGetAttachment(api *FakePMAPI, w http.ResponseWriter, attachmentID string) {
+	data, err := api.GetAttachment(attachmentID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	defer data.Close() //nolint[errcheck]
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.WriteHeader(http.StatusOK)
+	_, _ = io.Copy(w, data)
+}
+
+func (s *Server) handleCreateAttachment(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	dataPacket, err := readFormFile(r, "DataPacket")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+	signature, err := readFormFile(r, "Signature")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	attachment := &pmapi.Attachment{
+		Name:      r.FormValue("Filename"),
+		MessageID: r.FormValue("MessageID"),
+		MIMEType:  r.FormValue("MIMEType"),
+		ContentID: r.FormValue("ContentID"),
+	}
+	created, err := api.CreateAttachment(attachment, bytes.NewReader(dataPacket), bytes.NewReader(signature))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.CreateAttachmentRes{Res: okRes(), Attachment: created})
+}
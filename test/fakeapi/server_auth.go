@@ -0,0 +1,330 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+
+	pmcrypto "github.com/ProtonMail/gopenpgp/crypto"
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+const (
+	accessTokenExpiresIn = 24 * 60 * 60 // In seconds.
+	singlePasswordMode   = 1
+)
+
+// serverKey is the private key as sent by the API.
+type serverKey struct {
+	ID         string
+	Flags      int
+	Primary    int
+	PrivateKey string
+}
+
+// serverUser, serverAddress and serverEvent replace keys which are
+// in different format in pmapi structures.
+type serverUser struct {
+	*pmapi.User
+	Keys []serverKey
+}
+
+type serverAddress struct {
+	*pmapi.Address
+	HasKeys int
+	Keys    []serverKey
+}
+
+type serverEvent struct {
+	*pmapi.Event
+	User serverUser
+}
+
+func (s *Server) handleAuthInfo(w http.ResponseWriter, r *http.Request) {
+	var req pmapi.AuthInfoReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	info, err := New(s.controller).AuthInfo(req.Username)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	// Unknown users get valid parameters as well, the login fails later.
+	password := s.controller.tokenGenerator.next("password")
+	if user, ok := s.controller.usersByUsername[req.Username]; ok {
+		password = user.password
+	}
+
+	session, err := newSRPSession(req.Username, password)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInvalidValue, err.Error())
+		return
+	}
+	srpSessionID := s.controller.tokenGenerator.next("srp")
+	s.srpSessions[srpSessionID] = session
+
+	writeResponse(w, &pmapi.AuthInfoRes{
+		Res:             okRes(),
+		AuthInfo:        *info,
+		Modulus:         srpSignedModulus,
+		ServerEphemeral: session.encodedServerEphemeral,
+		Version:         srpVersion,
+		Salt:            session.salt,
+		SRPSession:      srpSessionID,
+	})
+}
+
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	var req pmapi.AuthReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	session, ok := s.srpSessions[req.SRPSession]
+	delete(s.srpSessions, req.SRPSession)
+	user, userExists := s.controller.usersByUsername[req.Username]
+	if !ok || !userExists || session.username != req.Username {
+		writeError(w, http.StatusUnprocessableEntity, codeWrongCredentials, errWrongNameOrPassword.Error())
+		return
+	}
+
+	serverProof, err := session.verifyProofs(req.ClientEphemeral, req.ClientProof)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, codeWrongCredentials, errWrongNameOrPassword.Error())
+		return
+	}
+
+	api := s.controller.GetClient("")
+	auth, err := api.Auth(req.Username, user.password, nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	s.apisByUID[api.uid] = api
+
+	writeResponse(w, s.newAuthRes(api, auth, base64.StdEncoding.EncodeToString(serverProof)))
+}
+
+func (s *Server) handleAuthRefresh(w http.ResponseWriter, r *http.Request) {
+	var req pmapi.AuthRefreshReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	api, ok := s.apisByUID[req.UID]
+	if !ok {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidRefreshToken, pmapi.ErrInvalidToken.Error())
+		return
+	}
+
+	auth, err := api.AuthRefresh(req.UID + ":" + req.RefreshToken)
+	if err == pmapi.ErrInvalidToken {
+		writeError(w, http.StatusUnprocessableEntity, codeInvalidRefreshToken, err.Error())
+		return
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, s.newAuthRes(api, auth, ""))
+}
+
+func (s *Server) newAuthRes(api *FakePMAPI, auth *pmapi.Auth, serverProof string) *pmapi.AuthRes {
+	session := s.controller.sessionsByUID[api.uid]
+
+	res := &pmapi.AuthRes{
+		Res:         okRes(),
+		Auth:        *auth,
+		AccessToken: session.accessToken,
+		TokenType:   "Bearer",
+		UID:         api.uid,
+		ServerProof: serverProof,
+	}
+	res.ExpiresIn = accessTokenExpiresIn
+	res.PasswordMode = singlePasswordMode
+	res.Scope = "full self"
+	if !session.hasFullScope {
+		res.Scope = "self"
+	}
+	return res
+}
+
+func (s *Server) handleAuth2FA(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	var req pmapi.Auth2FAReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	auth2FA, err := api.Auth2FA(req.TwoFactorCode, nil)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.Auth2FARes{Res: okRes(), Scope: auth2FA.Scope})
+}
+
+func (s *Server) handleLogout(api *FakePMAPI, w http.ResponseWriter) {
+	uid := api.uid
+	if err := api.Logout(); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	delete(s.apisByUID, uid)
+
+	writeResponse(w, okRes())
+}
+
+func (s *Server) handleGetUser(api *FakePMAPI, w http.ResponseWriter) {
+	user, err := api.UpdateUser()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	key, err := s.privateKey(api.username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInvalidValue, err.Error())
+		return
+	}
+
+	writeResponse(w, &struct {
+		pmapi.Res
+		User *serverUser
+	}{
+		Res: okRes(),
+		User: &serverUser{
+			User: user,
+			Keys: []serverKey{newServerKey("user-key", key)},
+		},
+	})
+}
+
+func (s *Server) handleGetAddresses(api *FakePMAPI, w http.ResponseWriter) {
+	if err := api.checkAndRecordCall(GET, "/addresses", nil); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+	key, err := s.privateKey(api.username)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, codeInvalidValue, err.Error())
+		return
+	}
+
+	addresses := []*serverAddress{}
+	for _, address := range api.Addresses() {
+		addresses = append(addresses, &serverAddress{
+			Address: address,
+			HasKeys: pmapi.KeysPresent,
+			Keys:    []serverKey{newServerKey("address-key-"+address.ID, key)},
+		})
+	}
+
+	writeResponse(w, &struct {
+		pmapi.Res
+		Addresses []*serverAddress
+	}{
+		Res:       okRes(),
+		Addresses: addresses,
+	})
+}
+
+func (s *Server) handleGetKeySalts(api *FakePMAPI, w http.ResponseWriter) {
+	if err := api.checkAndRecordCall(GET, "/keys/salts", nil); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	// Without salt the mailbox password is used as is.
+	writeResponse(w, &pmapi.KeySaltRes{Res: okRes(), KeySalts: []pmapi.KeySalt{}})
+}
+
+func (s *Server) handleGetPublicKeys(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	keys, internal, err := api.GetPublicKeysForEmail(r.URL.Query().Get("Email"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	for idx := range keys {
+		if keys[idx].Flags == 0 {
+			keys[idx].Flags = pmapi.UseToVerifyFlag | pmapi.UseToEncryptFlag
+		}
+	}
+	recipientType := pmapi.RecipientExternal
+	if internal {
+		recipientType = pmapi.RecipientInternal
+	}
+
+	writeResponse(w, &pmapi.PublicKeyRes{Res: okRes(), RecipientType: recipientType, Keys: keys})
+}
+
+func (s *Server) handleGetMailSettings(api *FakePMAPI, w http.ResponseWriter) {
+	settings, err := api.GetMailSettings()
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &struct {
+		pmapi.Res
+		MailSettings pmapi.MailSettings
+	}{
+		Res:          okRes(),
+		MailSettings: settings,
+	})
+}
+
+// privateKey returns the key of the user, generated on first use.
+// The key is locked by the user's password and it is used for all
+// addresses as well.
+func (s *Server) privateKey(username string) (string, error) {
+	if key, ok := s.keys[username]; ok {
+		return key, nil
+	}
+
+	user, ok := s.controller.usersByUsername[username]
+	if !ok {
+		return "", errWrongNameOrPassword
+	}
+
+	key, err := pmcrypto.GetGopenPGP().GenerateKey(username, username, user.password, "x25519", 0)
+	if err != nil {
+		return "", err
+	}
+	s.keys[username] = key
+	return key, nil
+}
+
+func newServerKey(id, privateKey string) serverKey {
+	return serverKey{
+		ID:         id,
+		Flags:      pmapi.UseToVerifyFlag | pmapi.UseToEncryptFlag,
+		Primary:    1,
+		PrivateKey: privateKey,
+	}
+}
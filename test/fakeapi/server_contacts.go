@@ -0,0 +1,61 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+func (s *Server) handleGetContactEmails(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("Page"))
+	pageSize, _ := strconv.Atoi(query.Get("PageSize"))
+
+	var emails []pmapi.ContactEmail
+	var err error
+	if groupID := query.Get("LabelID"); groupID != "" {
+		emails, err = api.GetContactEmailsByGroup(groupID, page, pageSize)
+	} else {
+		emails, err = api.GetContactEmailByEmail(query.Get("Email"), page, pageSize)
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.ContactsEmailsRes{Res: okRes(), ContactEmails: emails, Total: len(emails)})
+}
+
+func (s *Server) handleGetContact(api *FakePMAPI, w http.ResponseWriter, contactID string) {
+	contact, err := api.GetContactByID(contactID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &struct {
+		pmapi.Res
+		Contact pmapi.Contact
+	}{
+		Res:     okRes(),
+		Contact: contact,
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fault makes the server misbehave for matching requests.
+type Fault struct {
+	Method string // Empty matches any method.
+	Path   string // Prefix of the path, empty matches any path.
+
+	// Latency delays the response.
+	Latency time.Duration
+	// StatusCode, when set, is returned instead of serving the request.
+	StatusCode int
+	// RetryAfter is sent in Retry-After header (in seconds) with StatusCode.
+	RetryAfter int
+	// Disconnect closes the connection without any response.
+	Disconnect bool
+
+	// Times limits how many requests are affected. Zero means all of them.
+	Times int
+	hits  int
+}
+
+// AddFault adds the fault for all following requests.
+func (s *Server) AddFault(fault *Fault) {
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+
+	s.faults = append(s.faults, fault)
+}
+
+// ClearFaults removes all faults.
+func (s *Server) ClearFaults() {
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+
+	s.faults = nil
+}
+
+// applyFaults applies the first matching fault and returns whether
+// the request was already handled by it.
+func (s *Server) applyFaults(w http.ResponseWriter, r *http.Request) bool {
+	fault := s.matchFault(r)
+	if fault == nil {
+		return false
+	}
+
+	s.log.WithField(r.Method, r.URL.Path).WithField("fault", fault).Warn("Applying fault")
+
+	if fault.Latency > 0 {
+		time.Sleep(fault.Latency)
+	}
+
+	switch {
+	case fault.Disconnect:
+		disconnect(w)
+		return true
+	case fault.StatusCode != 0:
+		if fault.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(fault.RetryAfter))
+		}
+		writeError(w, fault.StatusCode, fault.StatusCode, http.StatusText(fault.StatusCode))
+		return true
+	}
+
+	return false
+}
+
+func (s *Server) matchFault(r *http.Request) *Fault {
+	s.faultsLock.Lock()
+	defer s.faultsLock.Unlock()
+
+	for _, fault := range s.faults {
+		if fault.Method != "" && fault.Method != r.Method {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, fault.Path) {
+			continue
+		}
+		if fault.Times != 0 && fault.hits >= fault.Times {
+			continue
+		}
+		fault.hits++
+		return fault
+	}
+
+	return nil
+}
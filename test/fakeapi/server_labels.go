@@ -0,0 +1,90 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+func (s *Server) handleListLabels(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	// Client sends only the type as the whole query.
+	labelType := r.URL.Query().Get("Type")
+	if labelType == "" {
+		labelType = r.URL.RawQuery
+	}
+
+	var labels []*pmapi.Label
+	var err error
+	if labelType == strconv.Itoa(pmapi.LabelTypeContactGroup) {
+		labels, err = api.ListContactGroups()
+	} else {
+		labels, err = api.ListLabels()
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.LabelListRes{Res: okRes(), Labels: labels})
+}
+
+func (s *Server) handleCreateLabel(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	var req pmapi.LabelReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	label, err := api.CreateLabel(req.Label)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.LabelRes{Res: okRes(), Label: label})
+}
+
+func (s *Server) handleUpdateLabel(api *FakePMAPI, w http.ResponseWriter, r *http.Request, labelID string) {
+	var req pmapi.LabelReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+	req.Label.ID = labelID
+
+	label, err := api.UpdateLabel(req.Label)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.LabelRes{Res: okRes(), Label: label})
+}
+
+func (s *Server) handleDeleteLabel(api *FakePMAPI, w http.ResponseWriter, labelID string) {
+	if err := api.DeleteLabel(labelID); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, okRes())
+}
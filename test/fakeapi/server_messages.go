@@ -0,0 +1,277 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+)
+
+const (
+	// maxMultipartMemory is the size of the multipart body kept in memory.
+	maxMultipartMemory = 32 << 20
+
+	// defaultPageSize is used when the request does not set page size.
+	defaultPageSize = 150
+)
+
+func (s *Server) handleGetEvent(api *FakePMAPI, w http.ResponseWriter, eventID string) {
+	if eventID == "latest" {
+		eventID = ""
+	}
+
+	event, err := api.GetEvent(eventID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &struct {
+		pmapi.Res
+		serverEvent
+	}{
+		Res: okRes(),
+		serverEvent: serverEvent{
+			Event: event,
+			User:  serverUser{User: &event.User, Keys: []serverKey{}},
+		},
+	})
+}
+
+func (s *Server) handleListMessages(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	messages, total, err := api.ListMessages(parseMessagesFilter(r.URL.Query()))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.MessagesListRes{Res: okRes(), Total: total, Messages: messages})
+}
+
+// parseMessagesFilter parses only filters implemented by ListMessages.
+func parseMessagesFilter(values url.Values) *pmapi.MessagesFilter {
+	atoi := func(key string) int {
+		value, _ := strconv.Atoi(values.Get(key))
+		return value
+	}
+	boolean := func(key string) *bool {
+		if values.Get(key) == "" {
+			return nil
+		}
+		value := values.Get(key) == "1"
+		return &value
+	}
+
+	filter := &pmapi.MessagesFilter{
+		Page:           atoi("Page"),
+		PageSize:       atoi("PageSize"),
+		Limit:          atoi("Limit"),
+		LabelID:        values.Get("LabelID"),
+		Desc:           boolean("Desc"),
+		Begin:          int64(atoi("Begin")),
+		End:            int64(atoi("End")),
+		BeginID:        values.Get("BeginID"),
+		EndID:          values.Get("EndID"),
+		From:           values.Get("From"),
+		ConversationID: values.Get("ConversationID"),
+		AddressID:      values.Get("AddressID"),
+		ID:             values["ID[]"],
+		Unread:         boolean("Unread"),
+		ExternalID:     values.Get("ExternalID"),
+	}
+	if filter.PageSize == 0 {
+		filter.PageSize = defaultPageSize
+	}
+	if filter.Desc == nil {
+		desc := false
+		filter.Desc = &desc
+	}
+	return filter
+}
+
+func (s *Server) handleCountMessages(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	counts, err := api.CountMessages(r.URL.Query().Get("AddressID"))
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.MessagesCountsRes{Res: okRes(), Counts: counts})
+}
+
+func (s *Server) handleGetMessage(api *FakePMAPI, w http.ResponseWriter, messageID string) {
+	message, err := api.GetMessage(messageID)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.MessageRes{Res: okRes(), Message: message})
+}
+
+func (s *Server) handleCreateDraft(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	var req pmapi.DraftReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	message, err := api.CreateDraft(req.Message, req.ParentID, req.Action)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.MessageRes{Res: okRes(), Message: message})
+}
+
+func (s *Server) handleSendMessage(api *FakePMAPI, w http.ResponseWriter, r *http.Request, messageID string) {
+	var req pmapi.SendMessageReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	sent, parent, err := api.SendMessage(messageID, &req)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.SendMessageRes{Res: okRes(), Sent: sent, Parent: parent})
+}
+
+func (s *Server) handleMessagesAction(api *FakePMAPI, w http.ResponseWriter, r *http.Request, action string) {
+	var req pmapi.LabelMessagesReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	var err error
+	switch action {
+	case "read":
+		err = api.MarkMessagesRead(req.IDs)
+	case "unread":
+		err = api.MarkMessagesUnread(req.IDs)
+	case "delete":
+		err = api.DeleteMessages(req.IDs)
+	case "label":
+		err = api.LabelMessages(req.IDs, req.LabelID)
+	case "unlabel":
+		err = api.UnlabelMessages(req.IDs, req.LabelID)
+	default:
+		writeError(w, http.StatusNotFound, codeNotFound, "Action "+action+" does not exist")
+		return
+	}
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, &pmapi.MessagesActionRes{Res: okRes()})
+}
+
+func (s *Server) handleEmptyFolder(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if err := api.EmptyFolder(query.Get("LabelID"), query.Get("AddressID")); err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeResponse(w, okRes())
+}
+
+func (s *Server) handleImport(api *FakePMAPI, w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	metadata := map[string]*pmapi.ImportMsgReq{}
+	if err := json.Unmarshal([]byte(r.FormValue("Metadata")), &metadata); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+		return
+	}
+
+	names := []string{}
+	for name := range metadata {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, _ := strconv.Atoi(names[i])
+		b, _ := strconv.Atoi(names[j])
+		return a < b
+	})
+
+	reqs := []*pmapi.ImportMsgReq{}
+	for _, name := range names {
+		body, err := readFormFile(r, name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, codeInvalidValue, err.Error())
+			return
+		}
+		metadata[name].Body = body
+		reqs = append(reqs, metadata[name])
+	}
+
+	results, err := api.Import(reqs)
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	res := &pmapi.ImportRes{Res: okRes()}
+	for idx, result := range results {
+		res.Responses = append(res.Responses, newImportResponse(names[idx], result))
+	}
+	writeResponse(w, res)
+}
+
+func newImportResponse(name string, result *pmapi.ImportMsgRes) (response struct {
+	Name     string
+	Response struct {
+		pmapi.Res
+		MessageID string
+	}
+}) {
+	response.Name = name
+	response.Response.Res = okRes()
+	response.Response.MessageID = result.MessageID
+	if result.Error != nil {
+		response.Response.Code = codeInvalidValue
+		response.Response.ResError = &pmapi.ResError{Error: result.Error.Error()}
+	}
+	return
+}
+
+func readFormFile(r *http.Request, name string) ([]byte, error) {
+	file, _, err := r.FormFile(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint[errcheck]
+
+	return ioutil.ReadAll(file)
+}
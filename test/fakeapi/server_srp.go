@@ -0,0 +1,166 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"math/big"
+
+	"github.com/ProtonMail/proton-bridge/pkg/srp"
+)
+
+const (
+	srpBitLength = 2048
+	srpVersion   = 4
+)
+
+// srpSignedModulus is the modulus used by pkg/srp unit tests. It is signed
+// by the Proton modulus key so the real client accepts it.
+const srpSignedModulus = `-----BEGIN PGP SIGNED MESSAGE-----
+Hash: SHA256
+
+W2z5HBi8RvsfYzZTS7qBaUxxPhsfHJFZpu3Kd6s1JafNrCCH9rfvPLrfuqocxWPgWDH2R8neK7PkNvjxto9TStuY5z7jAzWRvFWN9cQhAKkdWgy0JY6ywVn22+HFpF4cYesHrqFIKUPDMSSIlWjBVmEJZ/MusD44ZT29xcPrOqeZvwtCffKtGAIjLYPZIEbZKnDM1Dm3q2K/xS5h+xdhjnndhsrkwm9U9oyA2wxzSXFL+pdfj2fOdRwuR5nW0J2NFrq3kJjkRmpO/Genq1UW+TEknIWAb6VzJJJA244K/H8cnSx2+nSNZO3bbo6Ys228ruV9A8m6DhxmS+bihN3ttQ==
+-----BEGIN PGP SIGNATURE-----
+Version: ProtonMail
+Comment: https://protonmail.com
+
+wl4EARYIABAFAlwB1j0JEDUFhcTpUY8mAAD8CgEAnsFnF4cF0uSHKkXa1GIa
+GO86yMV4zDZEZcDSJo0fgr8A/AlupGN9EdHlsrZLmTA1vhIx+rOgxdEff28N
+kvNM7qIK
+=q6vu
+-----END PGP SIGNATURE-----`
+
+var errBadClientProof = errors.New("bad client proof")
+
+// srpSession is the server side of one SRP login.
+type srpSession struct {
+	username string
+
+	modulus                []byte
+	verifier               *big.Int
+	serverSecret           *big.Int
+	serverEphemeral        *big.Int
+	salt                   string
+	encodedServerEphemeral string
+}
+
+func srpToInt(arr []byte) *big.Int {
+	reversed := make([]byte, len(arr))
+	for i := 0; i < len(arr); i++ {
+		reversed[len(arr)-i-1] = arr[i]
+	}
+	return big.NewInt(0).SetBytes(reversed)
+}
+
+func srpFromInt(num *big.Int) []byte {
+	arr := num.Bytes()
+	reversed := make([]byte, srpBitLength/8)
+	for i := 0; i < len(arr); i++ {
+		reversed[len(arr)-i-1] = arr[i]
+	}
+	return reversed
+}
+
+// newSRPSession computes the verifier of the password and the server
+// ephemeral sent to the client in auth info.
+func newSRPSession(username, password string) (*srpSession, error) {
+	encodedModulus, err := srp.ReadClearSignedMessage(srpSignedModulus)
+	if err != nil {
+		return nil, err
+	}
+	modulusBytes, err := base64.StdEncoding.DecodeString(encodedModulus)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 10)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := srp.HashPassword(srpVersion, password, username, salt, modulusBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	generator := big.NewInt(2)
+	modulus := srpToInt(modulusBytes)
+	multiplier := srpToInt(srp.ExpandHash(append(srpFromInt(generator), modulusBytes...)))
+	multiplier.Mod(multiplier, modulus)
+
+	verifier := big.NewInt(0).Exp(generator, srpToInt(hashedPassword), modulus)
+
+	modulusMinusOne := big.NewInt(0).Sub(modulus, big.NewInt(1))
+	var serverSecret, serverEphemeral *big.Int
+	for {
+		if serverSecret, err = rand.Int(rand.Reader, modulusMinusOne); err != nil {
+			return nil, err
+		}
+		serverEphemeral = big.NewInt(0).Mul(multiplier, verifier)
+		serverEphemeral.Add(serverEphemeral, big.NewInt(0).Exp(generator, serverSecret, modulus))
+		serverEphemeral.Mod(serverEphemeral, modulus)
+		if serverEphemeral.Cmp(big.NewInt(1)) > 0 && serverEphemeral.Cmp(modulusMinusOne) < 0 {
+			break
+		}
+	}
+
+	return &srpSession{
+		username:               username,
+		modulus:                modulusBytes,
+		verifier:               verifier,
+		serverSecret:           serverSecret,
+		serverEphemeral:        serverEphemeral,
+		salt:                   base64.StdEncoding.EncodeToString(salt),
+		encodedServerEphemeral: base64.StdEncoding.EncodeToString(srpFromInt(serverEphemeral)),
+	}, nil
+}
+
+// verifyProofs checks the client proof and returns the server proof.
+func (s *srpSession) verifyProofs(encodedClientEphemeral, encodedClientProof string) ([]byte, error) {
+	clientEphemeralBytes, err := base64.StdEncoding.DecodeString(encodedClientEphemeral)
+	if err != nil {
+		return nil, err
+	}
+	clientProof, err := base64.StdEncoding.DecodeString(encodedClientProof)
+	if err != nil {
+		return nil, err
+	}
+
+	modulus := srpToInt(s.modulus)
+	clientEphemeral := srpToInt(clientEphemeralBytes)
+	if big.NewInt(0).Mod(clientEphemeral, modulus).Sign() == 0 {
+		return nil, errBadClientProof
+	}
+
+	scramblingParam := srpToInt(srp.ExpandHash(append(srpFromInt(clientEphemeral), srpFromInt(s.serverEphemeral)...)))
+
+	sharedSession := big.NewInt(0).Exp(s.verifier, scramblingParam, modulus)
+	sharedSession.Mul(sharedSession, clientEphemeral)
+	sharedSession.Exp(sharedSession, s.serverSecret, modulus)
+
+	expectedClientProof := srp.ExpandHash(bytes.Join([][]byte{srpFromInt(clientEphemeral), srpFromInt(s.serverEphemeral), srpFromInt(sharedSession)}, []byte{}))
+	if subtle.ConstantTimeCompare(expectedClientProof, clientProof) != 1 {
+		return nil, errBadClientProof
+	}
+
+	return srp.ExpandHash(bytes.Join([][]byte{srpFromInt(clientEphemeral), clientProof, srpFromInt(sharedSession)}, []byte{})), nil
+}
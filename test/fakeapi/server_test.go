@@ -0,0 +1,201 @@
+// Copyright (c) 2020 Proton Technologies AG
+//
+// This file is part of ProtonMail Bridge.
+//
+// ProtonMail Bridge is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// ProtonMail Bridge is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ProtonMail Bridge.  If not, see <https://www.gnu.org/licenses/>.
+
+package fakeapi
+
+import (
+	"context"
+	"net/http"
+	"net/mail"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/proton-bridge/pkg/pmapi"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testUsername = "user"
+	testPassword = "password"
+)
+
+func newTestServer(t *testing.T) (*Controller, *Server, *pmapi.Client) {
+	cntrl := NewController()
+	require.NoError(t, cntrl.AddUser(
+		&pmapi.User{ID: "userID", Name: testUsername},
+		&pmapi.AddressList{{ID: "addressID", Email: "user@pm.me", Type: pmapi.OriginalAddress, Send: 1, Receive: 1, Status: 1}},
+		testPassword,
+		false,
+	))
+	require.NoError(t, cntrl.AddUserMessage(testUsername, &pmapi.Message{
+		AddressID: "addressID",
+		Subject:   "Hello",
+		Sender:    &mail.Address{Address: "sender@pm.me"},
+		LabelIDs:  []string{pmapi.InboxLabel},
+		Body:      "body",
+	}))
+
+	server := NewServer(cntrl)
+
+	client := pmapi.NewClient(&pmapi.ClientConfig{
+		AppVersion:   "Bridge_test",
+		ClientID:     "bridge",
+		TokenManager: pmapi.NewTokenManager(),
+		Routing:      pmapi.NewRouting(server.URL()),
+	}, "userID")
+
+	return cntrl, server, client
+}
+
+func login(t *testing.T, client *pmapi.Client) {
+	_, err := client.Auth(testUsername, testPassword, nil)
+	require.NoError(t, err)
+}
+
+func TestServer_AuthAndUnlock(t *testing.T) {
+	_, server, client := newTestServer(t)
+	defer server.Close()
+
+	auth, err := client.Auth(testUsername, testPassword, nil)
+	require.NoError(t, err)
+	require.NotEmpty(t, auth.UID())
+	require.False(t, auth.HasTwoFactor())
+
+	kr, err := client.Unlock(testPassword)
+	require.NoError(t, err)
+	require.NotNil(t, kr.FirstKey())
+	require.NoError(t, client.UnlockAddresses([]byte(testPassword)))
+	require.NotNil(t, client.KeyRingForAddressID("addressID").FirstKey())
+
+	require.NoError(t, client.Logout())
+	_, err = client.ListLabels()
+	require.Error(t, err)
+}
+
+func TestServer_AuthWrongPassword(t *testing.T) {
+	_, server, client := newTestServer(t)
+	defer server.Close()
+
+	_, err := client.Auth(testUsername, "wrong", nil)
+	require.Error(t, err)
+
+	_, err = client.Auth("unknown", testPassword, nil)
+	require.Error(t, err)
+}
+
+func TestServer_Messages(t *testing.T) {
+	cntrl, server, client := newTestServer(t)
+	defer server.Close()
+	login(t, client)
+
+	messages, total, err := client.ListMessages(&pmapi.MessagesFilter{LabelID: pmapi.InboxLabel})
+	require.NoError(t, err)
+	require.Equal(t, 1, total)
+	require.Equal(t, "Hello", messages[0].Subject)
+	require.Empty(t, messages[0].Body)
+
+	message, err := client.GetMessage(messages[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, "body", message.Body)
+	require.Equal(t, "sender@pm.me", message.Sender.Address)
+
+	event, err := client.GetEvent("")
+	require.NoError(t, err)
+
+	require.NoError(t, client.MarkMessagesUnread([]string{message.ID}))
+	require.True(t, cntrl.WasCalled("PUT", "/messages/unread", []byte(`{"IDs":["`+message.ID+`"]}`)))
+
+	event, err = client.GetEvent(event.EventID)
+	require.NoError(t, err)
+	require.Len(t, event.Messages, 1)
+	require.Equal(t, message.ID, event.Messages[0].ID)
+
+	_, err = client.GetMessage("unknown")
+	require.EqualError(t, err, "message unknown not found")
+}
+
+func TestServer_RefreshExpiredAccessToken(t *testing.T) {
+	cntrl, server, client := newTestServer(t)
+	defer server.Close()
+	login(t, client)
+
+	server.ExpireAccessTokens()
+
+	_, err := client.ListLabels()
+	require.NoError(t, err)
+	require.Len(t, cntrl.GetCalls("POST", "/auth/refresh"), 1)
+}
+
+func TestServer_FaultLatency(t *testing.T) {
+	_, server, client := newTestServer(t)
+	defer server.Close()
+	login(t, client)
+
+	server.AddFault(&Fault{Path: "/labels", Latency: 100 * time.Millisecond})
+
+	start := time.Now()
+	_, err := client.ListLabels()
+	require.NoError(t, err)
+	require.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestServer_FaultStatusCode(t *testing.T) {
+	_, server, client := newTestServer(t)
+	defer server.Close()
+	login(t, client)
+
+	server.AddFault(&Fault{Path: "/labels", StatusCode: http.StatusServiceUnavailable, Times: 1})
+
+	_, err := client.ListLabels()
+	require.Error(t, err)
+
+	_, err = client.ListLabels()
+	require.NoError(t, err)
+}
+
+func TestServer_FaultTooManyRequests(t *testing.T) {
+	_, server, client := newTestServer(t)
+	defer server.Close()
+	login(t, client)
+
+	server.AddFault(&Fault{Path: "/messages", StatusCode: http.StatusTooManyRequests, RetryAfter: 1})
+
+	// The client waits before retrying, the request is canceled meanwhile.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, _, err := client.ListMessagesContext(ctx, &pmapi.MessagesFilter{})
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestServer_FaultDisconnect(t *testing.T) {
+	cntrl, server, client := newTestServer(t)
+	defer server.Close()
+	login(t, client)
+
+	server.AddFault(&Fault{Method: "GET", Path: "/labels", Disconnect: true})
+	_, err := client.ListLabels()
+	require.Equal(t, pmapi.ErrAPINotReachable, err)
+	server.ClearFaults()
+
+	cntrl.TurnInternetConnectionOff()
+	_, err = client.ListLabels()
+	require.Equal(t, pmapi.ErrAPINotReachable, err)
+
+	cntrl.TurnInternetConnectionOn()
+	_, err = client.ListLabels()
+	require.NoError(t, err)
+}
@@ -15,6 +15,20 @@ Feature: IMAP create mailbox
     And "user" does not have mailbox "Folders/mbox"
     And "user" has mailbox "Labels/mbox"
 
+  Scenario: Create nested folder
+    When IMAP client creates mailbox "Folders/parent/mbox"
+    Then IMAP response is "OK"
+    And "user" has mailbox "Folders/parent"
+    And "user" has mailbox "Folders/parent/mbox"
+    And "user" does not have mailbox "Labels/parent/mbox"
+
+  Scenario: Create nested label
+    When IMAP client creates mailbox "Labels/parent/mbox"
+    Then IMAP response is "OK"
+    And "user" has mailbox "Labels/parent"
+    And "user" has mailbox "Labels/parent/mbox"
+    And "user" does not have mailbox "Folders/parent/mbox"
+
   Scenario: Creating system mailbox is not possible
     When IMAP client creates mailbox "INBOX"
     Then IMAP response is "IMAP error: NO mailbox INBOX already exists"
@@ -16,6 +16,15 @@ Feature: IMAP delete mailbox
     Then IMAP response is "OK"
     And "user" does not have mailbox "Labels/mbox"
 
+  Scenario: Delete folder with nested folders
+    Given there is "user" with mailbox "Folders/parent"
+    And there is "user" with mailbox "Folders/parent/mbox"
+    And there is IMAP client logged in as "user"
+    When IMAP client deletes mailbox "Folders/parent"
+    Then IMAP response is "OK"
+    And "user" does not have mailbox "Folders/parent"
+    And "user" does not have mailbox "Folders/parent/mbox"
+
   Scenario: Empty Trash by deleting it
     Given there are 10 messages in mailbox "Trash" for "user"
     And there is IMAP client logged in as "user"
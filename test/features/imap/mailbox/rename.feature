@@ -18,6 +18,31 @@ Feature: IMAP mailbox rename
     And "user" does not have mailbox "Labels/mbox"
     And "user" has mailbox "Labels/mbox2"
 
+  Scenario: Rename folder renames nested folders
+    Given there is "user" with mailbox "Folders/parent"
+    And there is "user" with mailbox "Folders/parent/mbox"
+    And there is IMAP client logged in as "user"
+    When IMAP client renames mailbox "Folders/parent" to "Folders/parent2"
+    Then IMAP response is "OK"
+    And "user" does not have mailbox "Folders/parent/mbox"
+    And "user" has mailbox "Folders/parent2"
+    And "user" has mailbox "Folders/parent2/mbox"
+
+  Scenario: Move folder under another folder
+    Given there is "user" with mailbox "Folders/parent"
+    And there is "user" with mailbox "Folders/mbox"
+    And there is IMAP client logged in as "user"
+    When IMAP client renames mailbox "Folders/mbox" to "Folders/parent/mbox"
+    Then IMAP response is "OK"
+    And "user" does not have mailbox "Folders/mbox"
+    And "user" has mailbox "Folders/parent/mbox"
+
+  Scenario: Moving folder under itself is not possible
+    Given there is "user" with mailbox "Folders/mbox"
+    And there is IMAP client logged in as "user"
+    When IMAP client renames mailbox "Folders/mbox" to "Folders/mbox/mbox2"
+    Then IMAP response is "IMAP error: NO cannot move mailbox under itself"
+
   Scenario: Renaming folder to label is not possible
     Given there is "user" with mailbox "Folders/mbox"
     And there is IMAP client logged in as "user"
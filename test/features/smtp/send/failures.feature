@@ -16,7 +16,7 @@ Feature: SMTP wrong messages
       sdfsdfsd
 
       """
-    Then SMTP response is "SMTP error: 554 Error: transaction failed, blame it on the weather: non-utf8 content without charset specification"
+    Then SMTP response is "SMTP error: 554 5.6.0 Cannot parse message: non-utf8 content without charset specification"
 
   Scenario: Message with attachment and wrong boundaries
     When SMTP client sends message
@@ -53,4 +53,4 @@ Feature: SMTP wrong messages
 
 
       """
-    Then SMTP response is "SMTP error: 554 Error: transaction failed, blame it on the weather: multipart: NextPart: EOF"
\ No newline at end of file
+    Then SMTP response is "SMTP error: 554 5.6.0 Cannot parse message: multipart: NextPart: EOF"
\ No newline at end of file
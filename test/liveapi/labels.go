@@ -41,8 +41,20 @@ func (cntrl *Controller) AddUserLabel(username string, label *pmapi.Label) error
 		return fmt.Errorf("user %s does not exist", username)
 	}
 
+	// Nested labels are under its parent which has to exist already.
+	labelName := getLabelNameWithoutPrefix(label.Name)
+	if idx := strings.LastIndex(labelName, pmapi.LabelPathDelimiter); idx >= 0 {
+		parentName := label.Name[:len(label.Name)-len(labelName)+idx]
+		parentID, err := cntrl.getLabelID(username, parentName)
+		if err != nil {
+			return err
+		}
+		label.ParentID = parentID
+		labelName = labelName[idx+len(pmapi.LabelPathDelimiter):]
+	}
+
 	label.Exclusive = getLabelExclusive(label.Name)
-	label.Name = getLabelNameWithoutPrefix(label.Name)
+	label.Name = labelName
 	label.Color = pmapi.LabelColors[0]
 	if _, err := client.CreateLabel(label); err != nil {
 		return errors.Wrap(err, "failed to create label")
@@ -80,7 +92,7 @@ func (cntrl *Controller) getLabelID(username, labelName string) (string, error)
 	exclusive := getLabelExclusive(labelName)
 	labelName = getLabelNameWithoutPrefix(labelName)
 	for _, label := range labels {
-		if label.Exclusive == exclusive && label.Name == labelName {
+		if label.Exclusive == exclusive && pmapi.LabelPath(labels, label) == labelName {
 			return label.ID, nil
 		}
 	}